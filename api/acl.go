@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/casbin/casbin"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/permissions"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Object level permissions.
+// Policies are given in a domain, * (permissions.DOMAIN_ALL) being the whole archive.
+// Other domains grant access to some objects only:
+//
+// collection:<uid>          the collection, its content units and their files
+// content_type:<type name>  collections and content units of that type, content units in such collections and their files
+//
+// For example, a team editing a single series of programs:
+// p, ru_team, data_private, write, collection:d0Zs6tJr
+
+const (
+	DOMAIN_COLLECTION   = "collection:"
+	DOMAIN_CONTENT_TYPE = "content_type:"
+)
+
+// collectionsOfUnitSQL selects the collections of a content unit. Args: content unit id
+const collectionsOfUnitSQL = `SELECT c.uid, c.type_id FROM collections c
+INNER JOIN collections_content_units ccu ON c.id = ccu.collection_id AND ccu.content_unit_id = $1`
+
+func contentTypeDomain(typeID int64) string {
+	if ct, ok := CONTENT_TYPE_REGISTRY.ByID[typeID]; ok {
+		return DOMAIN_CONTENT_TYPE + ct.Name
+	}
+	return ""
+}
+
+func collectionDomains(c *models.Collection) []string {
+	domains := []string{permissions.DOMAIN_ALL}
+	if c.UID != "" {
+		domains = append(domains, DOMAIN_COLLECTION+c.UID)
+	}
+	if d := contentTypeDomain(c.TypeID); d != "" {
+		domains = append(domains, d)
+	}
+	return domains
+}
+
+func contentUnitDomains(exec boil.Executor, cu *models.ContentUnit) ([]string, error) {
+	domains := []string{permissions.DOMAIN_ALL}
+	if d := contentTypeDomain(cu.TypeID); d != "" {
+		domains = append(domains, d)
+	}
+	if cu.ID == 0 {
+		return domains, nil
+	}
+
+	rows, err := exec.Query(collectionsOfUnitSQL, cu.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load collections of content unit")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uid string
+		var typeID int64
+		if err := rows.Scan(&uid, &typeID); err != nil {
+			return nil, errors.Wrap(err, "Scan collection")
+		}
+		domains = append(domains, DOMAIN_COLLECTION+uid)
+		if d := contentTypeDomain(typeID); d != "" {
+			domains = append(domains, d)
+		}
+	}
+
+	return domains, errors.Wrap(rows.Err(), "Iterate collections")
+}
+
+func canCollection(cp utils.ContextProvider, c *models.Collection, act string) bool {
+	return canIn(cp, collectionDomains(c), secureToPermission(c.Secure), act)
+}
+
+func canContentUnit(cp utils.ContextProvider, exec boil.Executor, cu *models.ContentUnit, act string) bool {
+	return canContentUnitSecure(cp, exec, cu, cu.Secure, act)
+}
+
+// canContentUnitSecure checks the permission on the unit as if it had the given secure level
+func canContentUnitSecure(cp utils.ContextProvider, exec boil.Executor, cu *models.ContentUnit, secure int16, act string) bool {
+	obj := secureToPermission(secure)
+
+	// spare the DB when there's nothing but the whole archive
+	if len(subjectDomains(cp)) == 0 {
+		return can(cp, obj, act)
+	}
+
+	domains, err := contentUnitDomains(exec, cu)
+	if err != nil {
+		log.Errorf("Permission domains of content unit %d: %s", cu.ID, err.Error())
+		return can(cp, obj, act)
+	}
+
+	return canIn(cp, domains, obj, act)
+}
+
+func canFile(cp utils.ContextProvider, exec boil.Executor, f *models.File, act string) bool {
+	if !f.ContentUnitID.Valid || len(subjectDomains(cp)) == 0 {
+		return can(cp, secureToPermission(f.Secure), act)
+	}
+
+	cu := &models.ContentUnit{ID: f.ContentUnitID.Int64}
+	if err := exec.QueryRow("SELECT type_id FROM content_units WHERE id = $1", cu.ID).Scan(&cu.TypeID); err != nil {
+		log.Errorf("Content unit of file %d: %s", f.ID, err.Error())
+		return can(cp, secureToPermission(f.Secure), act)
+	}
+
+	return canContentUnitSecure(cp, exec, cu, f.Secure, act)
+}
+
+// subjectDomains returns the domains, other than the whole archive, the subject has policies in
+func subjectDomains(cp utils.ContextProvider) []string {
+	v, ok := cp.Get("ID_TOKEN_CLAIMS")
+	if !ok {
+		return nil
+	}
+	enforcer := cp.MustGet("PERMISSIONS_ENFORCER").(*casbin.SyncedEnforcer)
+
+	set := make(map[string]bool)
+	for _, role := range v.(permissions.IDTokenClaims).RealmAccess.Roles {
+		for _, p := range enforcer.GetFilteredPolicy(0, role) {
+			if len(p) > 3 && p[3] != permissions.DOMAIN_ALL {
+				set[p[3]] = true
+			}
+		}
+	}
+
+	domains := make([]string, 0, len(set))
+	for d := range set {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	return domains
+}
+
+// domainGrant is a domain in which the subject may access more secure levels than in the whole archive
+type domainGrant struct {
+	domain string
+	secure int16
+}
+
+// domainGrants returns the domains in which the subject may access more than in the whole archive
+func domainGrants(cp utils.ContextProvider, act string) []domainGrant {
+	secure := allowedSecure(cp, act)
+	grants := make([]domainGrant, 0)
+	for _, d := range subjectDomains(cp) {
+		if dSecure := allowedSecureIn(cp, d, act); dSecure > secure {
+			grants = append(grants, domainGrant{domain: d, secure: dSecure})
+		}
+	}
+	return grants
+}
+
+// permissionsMod filters a list by the secure levels the subject may access,
+// in the whole archive or in the domains it has policies in.
+// entityType is one of SEARCH_IN_COLLECTIONS, SEARCH_IN_CONTENT_UNITS or SEARCH_IN_FILES
+func permissionsMod(cp utils.ContextProvider, entityType int, act string) qm.QueryMod {
+	clauses := []string{"secure <= ?"}
+	args := []interface{}{allowedSecure(cp, act)}
+
+	for _, g := range domainGrants(cp, act) {
+		clause, dArgs := domainFilterSQL(g.domain, entityType)
+		if clause == "" {
+			continue
+		}
+		clauses = append(clauses, fmt.Sprintf("(secure <= ? AND %s)", clause))
+		args = append(append(args, g.secure), dArgs...)
+	}
+
+	if len(clauses) == 1 {
+		return qm.Where(clauses[0], args...)
+	}
+	return qm.Where(fmt.Sprintf("(%s)", strings.Join(clauses, " OR ")), args...)
+}
+
+// domainFilterRawSQL is domainFilterSQL for raw queries: a condition matching the given id column
+// to the entities in the domain. Args are bound through arg, which returns their placeholder ($n).
+func domainFilterRawSQL(domain string, entityType int, column string, arg func(interface{}) string) string {
+	clause, args := domainFilterSQL(domain, entityType)
+	if clause == "" {
+		return ""
+	}
+
+	parts := strings.Split(clause, "?")
+	var buf bytes.Buffer
+	for i, part := range parts {
+		buf.WriteString(part)
+		if i < len(args) {
+			buf.WriteString(arg(args[i]))
+		}
+	}
+
+	var table string
+	switch entityType {
+	case SEARCH_IN_COLLECTIONS:
+		table = "collections"
+	case SEARCH_IN_CONTENT_UNITS:
+		table = "content_units"
+	case SEARCH_IN_FILES:
+		table = "files"
+	}
+
+	return fmt.Sprintf("%s IN (SELECT id FROM %s WHERE %s)", column, table, buf.String())
+}
+
+// domainFilterSQL returns an SQL condition matching the entities in the given domain
+func domainFilterSQL(domain string, entityType int) (string, []interface{}) {
+	var collections, units string
+	var collectionsArgs, unitsArgs []interface{}
+
+	switch {
+	case strings.HasPrefix(domain, DOMAIN_COLLECTION):
+		uid := strings.TrimPrefix(domain, DOMAIN_COLLECTION)
+		collections = "uid = ?"
+		collectionsArgs = []interface{}{uid}
+		units = `SELECT ccu.content_unit_id FROM collections_content_units ccu
+INNER JOIN collections c ON ccu.collection_id = c.id WHERE c.uid = ?`
+		unitsArgs = []interface{}{uid}
+	case strings.HasPrefix(domain, DOMAIN_CONTENT_TYPE):
+		ct, ok := CONTENT_TYPE_REGISTRY.ByName[strings.TrimPrefix(domain, DOMAIN_CONTENT_TYPE)]
+		if !ok {
+			log.Warnf("Unknown content type in permissions domain %s", domain)
+			return "", nil
+		}
+		collections = "type_id = ?"
+		collectionsArgs = []interface{}{ct.ID}
+		units = `SELECT id FROM content_units WHERE type_id = ?
+UNION SELECT ccu.content_unit_id FROM collections_content_units ccu
+INNER JOIN collections c ON ccu.collection_id = c.id WHERE c.type_id = ?`
+		unitsArgs = []interface{}{ct.ID, ct.ID}
+	default:
+		log.Warnf("Unknown permissions domain %s", domain)
+		return "", nil
+	}
+
+	switch entityType {
+	case SEARCH_IN_COLLECTIONS:
+		return collections, collectionsArgs
+	case SEARCH_IN_CONTENT_UNITS:
+		return fmt.Sprintf("id IN (%s)", units), unitsArgs
+	case SEARCH_IN_FILES:
+		return fmt.Sprintf("content_unit_id IN (%s)", units), unitsArgs
+	}
+
+	return "", nil
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/permissions"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const (
+	AUDIT_COLLECTION   = "collection"
+	AUDIT_CONTENT_UNIT = "content_unit"
+	AUDIT_FILE         = "file"
+	AUDIT_SOURCE       = "source"
+	AUDIT_TAG          = "tag"
+	AUDIT_PERSON       = "person"
+	AUDIT_PUBLISHER    = "publisher"
+
+	AUDIT_PERMISSION_RULE = "permission_rule"
+
+	PERM_AUDIT_LOG = "audit_log"
+)
+
+// Snapshot of an entity as recorded in the audit log.
+// args:
+// 1 entity id
+var AUDIT_SNAPSHOT_SQL = map[string]string{
+	AUDIT_COLLECTION: `
+SELECT jsonb_build_object(
+  'collection', to_jsonb(c),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM collection_i18n i WHERE i.collection_id = c.id),
+  'content_units', (SELECT jsonb_agg(jsonb_build_object('id', ccu.content_unit_id, 'name', ccu.name, 'position', ccu.position)
+                                     ORDER BY ccu.position, ccu.content_unit_id)
+                    FROM collections_content_units ccu WHERE ccu.collection_id = c.id))
+FROM collections c WHERE c.id = $1`,
+
+	AUDIT_CONTENT_UNIT: `
+SELECT jsonb_build_object(
+  'content_unit', to_jsonb(cu),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM content_unit_i18n i WHERE i.content_unit_id = cu.id),
+  'files', (SELECT jsonb_agg(f.id ORDER BY f.id) FROM files f WHERE f.content_unit_id = cu.id),
+  'sources', (SELECT jsonb_agg(x.source_id ORDER BY x.source_id) FROM content_units_sources x WHERE x.content_unit_id = cu.id),
+  'tags', (SELECT jsonb_agg(x.tag_id ORDER BY x.tag_id) FROM content_units_tags x WHERE x.content_unit_id = cu.id),
+  'persons', (SELECT jsonb_agg(jsonb_build_object('id', x.person_id, 'role_id', x.role_id) ORDER BY x.person_id)
+              FROM content_units_persons x WHERE x.content_unit_id = cu.id),
+  'publishers', (SELECT jsonb_agg(x.publisher_id ORDER BY x.publisher_id) FROM content_units_publishers x WHERE x.content_unit_id = cu.id),
+  'derivatives', (SELECT jsonb_agg(jsonb_build_object('id', x.derived_id, 'name', x.name) ORDER BY x.derived_id)
+                  FROM content_unit_derivations x WHERE x.source_id = cu.id))
+FROM content_units cu WHERE cu.id = $1`,
+
+	AUDIT_FILE: `
+SELECT jsonb_build_object('file', to_jsonb(f) - 'sha1' || jsonb_build_object('sha1', encode(f.sha1, 'hex')))
+FROM files f WHERE f.id = $1`,
+
+	AUDIT_SOURCE: `
+SELECT jsonb_build_object(
+  'source', to_jsonb(s),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM source_i18n i WHERE i.source_id = s.id))
+FROM sources s WHERE s.id = $1`,
+
+	AUDIT_TAG: `
+SELECT jsonb_build_object(
+  'tag', to_jsonb(t),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM tag_i18n i WHERE i.tag_id = t.id))
+FROM tags t WHERE t.id = $1`,
+
+	AUDIT_PERSON: `
+SELECT jsonb_build_object(
+  'person', to_jsonb(p),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM person_i18n i WHERE i.person_id = p.id))
+FROM persons p WHERE p.id = $1`,
+
+	AUDIT_PUBLISHER: `
+SELECT jsonb_build_object(
+  'publisher', to_jsonb(p),
+  'i18n', (SELECT jsonb_agg(to_jsonb(i) ORDER BY i.language) FROM publisher_i18n i WHERE i.publisher_id = p.id))
+FROM publishers p WHERE p.id = $1`,
+
+	AUDIT_PERMISSION_RULE: `
+SELECT jsonb_build_object('permission_rule', to_jsonb(r))
+FROM permission_rules r WHERE r.id = $1`,
+}
+
+// Entity of update and change events, for attaching diffs from audit snapshots.
+// Creation, removal and file insert events carry no diff.
+var AUDIT_EVENT_ENTITY = map[string]string{
+	events.E_COLLECTION_UPDATE:               AUDIT_COLLECTION,
+	events.E_COLLECTION_PUBLISHED_CHANGE:     AUDIT_COLLECTION,
+	events.E_COLLECTION_CONTENT_UNITS_CHANGE: AUDIT_COLLECTION,
+	events.E_CONTENT_UNIT_UPDATE:             AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_PUBLISHED_CHANGE:   AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_DERIVATIVES_CHANGE: AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_SOURCES_CHANGE:     AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_TAGS_CHANGE:        AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_PERSONS_CHANGE:     AUDIT_CONTENT_UNIT,
+	events.E_CONTENT_UNIT_PUBLISHERS_CHANGE:  AUDIT_CONTENT_UNIT,
+	events.E_FILE_UPDATE:                     AUDIT_FILE,
+	events.E_FILE_PUBLISHED:                  AUDIT_FILE,
+	events.E_SOURCE_UPDATE:                   AUDIT_SOURCE,
+	events.E_TAG_UPDATE:                      AUDIT_TAG,
+	events.E_PERSON_UPDATE:                   AUDIT_PERSON,
+	events.E_PUBLISHER_UPDATE:                AUDIT_PUBLISHER,
+}
+
+// audit records who changed which entities through the API.
+// Snapshots of the entities are taken when the audit starts and again when it's concluded,
+// both in the transaction of the change itself.
+type audit struct {
+	cp     utils.ContextProvider
+	entity string
+	ids    []int64
+	before map[int64]null.JSON
+	after  map[int64]null.JSON // set by conclude
+	err    *HttpError
+}
+
+// startAudit takes before snapshots of the given entities.
+// Pass no ids when the entity is about to be created.
+// Errors are reported by conclude.
+func startAudit(cp utils.ContextProvider, exec boil.Executor, entity string, ids ...int64) *audit {
+	a := &audit{
+		cp:     cp,
+		entity: entity,
+		ids:    ids,
+		before: make(map[int64]null.JSON, len(ids)),
+	}
+
+	for _, id := range ids {
+		snapshot, err := auditSnapshot(exec, entity, id)
+		if err != nil {
+			a.err = NewInternalError(err)
+			break
+		}
+		a.before[id] = snapshot
+	}
+
+	return a
+}
+
+// conclude takes after snapshots and writes the audit log.
+// createdIDs are the ids of newly created entities.
+func (a *audit) conclude(exec boil.Executor, createdIDs ...int64) *HttpError {
+	if a.err != nil {
+		return a.err
+	}
+
+	var sub, email, endpoint null.String
+	roles := make([]string, 0)
+	if v, ok := a.cp.Get("ID_TOKEN_CLAIMS"); ok {
+		claims := v.(permissions.IDTokenClaims)
+		sub = null.NewString(claims.Sub, claims.Sub != "")
+		email = null.NewString(claims.Email, claims.Email != "")
+		roles = claims.RealmAccess.Roles
+	}
+	if c, ok := a.cp.(*gin.Context); ok {
+		endpoint = null.StringFrom(fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path))
+	}
+
+	a.after = make(map[int64]null.JSON)
+	for _, id := range append(a.ids, createdIDs...) {
+		after, err := auditSnapshot(exec, a.entity, id)
+		if err != nil {
+			return NewInternalError(err)
+		}
+		a.after[id] = after
+
+		before := a.before[id]
+		if before.Valid == after.Valid && bytes.Equal(before.JSON, after.JSON) {
+			continue // nothing changed
+		}
+
+		_, err = queries.Raw(exec,
+			`INSERT INTO audit_log (user_sub, user_email, user_roles, endpoint, entity, entity_id, before, after)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			sub, email, pq.Array(roles), endpoint, a.entity, id, before, after).Exec()
+		if err != nil {
+			return NewInternalError(errors.Wrap(err, "Insert audit log"))
+		}
+	}
+
+	return nil
+}
+
+// withDiffs attaches the diff between the before and after snapshots
+// to update and change events of the audited entities. Call after conclude.
+func (a *audit) withDiffs(evnts ...events.Event) []events.Event {
+	for i, e := range evnts {
+		if AUDIT_EVENT_ENTITY[e.Type] != a.entity {
+			continue
+		}
+		id, ok := e.Payload["id"].(int64)
+		if !ok {
+			continue
+		}
+		after, ok := a.after[id]
+		if !ok {
+			continue
+		}
+		evnts[i] = e.WithDiff(auditDiffFields(a.entity, a.before[id]), auditDiffFields(a.entity, after))
+	}
+	return evnts
+}
+
+// auditDiffFields flattens a snapshot for diffs.
+// Columns of the entity itself are top level, i18n columns are "i18n.<language>.<column>"
+// and the associations are kept as they are.
+func auditDiffFields(entity string, snapshot null.JSON) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if !snapshot.Valid {
+		return fields
+	}
+
+	var parts map[string]json.RawMessage
+	if err := snapshot.Unmarshal(&parts); err != nil {
+		return fields
+	}
+
+	for k, v := range parts {
+		switch k {
+		case entity:
+			var columns map[string]json.RawMessage
+			if err := json.Unmarshal(v, &columns); err == nil {
+				for col, x := range columns {
+					fields[col] = x
+				}
+			}
+		case "i18n":
+			var rows []map[string]json.RawMessage
+			if err := json.Unmarshal(v, &rows); err != nil {
+				continue
+			}
+			for _, row := range rows {
+				var language string
+				if err := json.Unmarshal(row["language"], &language); err != nil {
+					continue
+				}
+				for col, x := range row {
+					if col == "language" || col == "created_at" || strings.HasSuffix(col, "_id") {
+						continue
+					}
+					fields["i18n."+language+"."+col] = x
+				}
+			}
+		default:
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
+
+// auditSnapshot returns an invalid JSON if the entity doesn't exist
+func auditSnapshot(exec boil.Executor, entity string, id int64) (null.JSON, error) {
+	var snapshot null.JSON
+	err := queries.Raw(exec, AUDIT_SNAPSHOT_SQL[entity], id).QueryRow().Scan(&snapshot)
+	if err != nil && err != sql.ErrNoRows {
+		return snapshot, errors.Wrapf(err, "Snapshot %s %d", entity, id)
+	}
+	return snapshot, nil
+}
+
+func AuditLogHandler(c *gin.Context) {
+	var r AuditLogRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleAuditLog(c, c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func handleAuditLog(cp utils.ContextProvider, exec boil.Executor, r AuditLogRequest) (*AuditLogResponse, *HttpError) {
+	if !can(cp, PERM_AUDIT_LOG, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	mods := []qm.QueryMod{qm.From("audit_log")}
+
+	// filters
+	if r.Entity != "" {
+		if _, ok := AUDIT_SNAPSHOT_SQL[r.Entity]; !ok {
+			return nil, NewBadRequestError(errors.Errorf("Unknown entity %s", r.Entity))
+		}
+		mods = append(mods, qm.Where("entity = ?", r.Entity))
+	}
+	if r.EntityID != 0 {
+		mods = append(mods, qm.Where("entity_id = ?", r.EntityID))
+	}
+	if r.User != "" {
+		mods = append(mods, qm.Where("(user_sub = ? OR user_email = ?)", r.User, r.User))
+	}
+	if err := appendDateRangeFilterMods(&mods, r.DateRangeFilter, "created_at"); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// count query
+	var total int64
+	countMods := append([]qm.QueryMod{qm.Select("count(DISTINCT id)")}, mods...)
+	err := models.NewQuery(exec, countMods...).QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return NewAuditLogResponse(), nil
+	}
+
+	// order, limit, offset
+	if err = appendListMods(&mods, r.ListRequest, AUDIT_LOG_SORT_FIELDS); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// data query
+	mods = append(mods, qm.Select("id", "created_at", "user_sub", "user_email", "user_roles",
+		"endpoint", "entity", "entity_id", "before", "after"))
+	data := make([]*AuditLogEntry, 0)
+	if err := models.NewQuery(exec, mods...).Bind(&data); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &AuditLogResponse{
+		ListResponse: ListResponse{Total: total},
+		AuditLog:     data,
+	}, nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func TestAuditWithDiffs(t *testing.T) {
+	a := &audit{
+		entity: AUDIT_CONTENT_UNIT,
+		ids:    []int64{1},
+		before: map[int64]null.JSON{
+			1: null.JSONFrom([]byte(`{"content_unit": {"id": 1, "secure": 0, "properties": {"film_date": "2018-01-01"}},
+"i18n": [{"content_unit_id": 1, "language": "he", "name": "old"}], "tags": [1]}`)),
+		},
+		after: map[int64]null.JSON{
+			1: null.JSONFrom([]byte(`{"content_unit": {"id": 1, "secure": 0, "properties": {"film_date": "2018-01-02"}},
+"i18n": [{"content_unit_id": 1, "language": "he", "name": "new"}], "tags": [1, 2]}`)),
+		},
+	}
+
+	cu := &models.ContentUnit{ID: 1}
+	evnts := a.withDiffs(
+		events.ContentUnitUpdateEvent(cu),
+		events.ContentUnitCreateEvent(cu),
+		events.FileUpdateEvent(&models.File{ID: 1}))
+
+	diff, ok := evnts[0].Payload["diff"].(map[string]events.Change)
+	if assert.True(t, ok, "update diff") {
+		assert.Len(t, diff, 3)
+		assert.Equal(t, "2018-01-02", diff["properties.film_date"].New)
+		assert.Equal(t, "old", diff["i18n.he.name"].Old)
+		assert.Equal(t, "new", diff["i18n.he.name"].New)
+		assert.Contains(t, diff, "tags")
+	}
+	assert.NotContains(t, evnts[1].Payload, "diff", "create event")
+	assert.NotContains(t, evnts[2].Payload, "diff", "other entity")
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const (
+	BULK_ADD_TAG          = "add_tag"
+	BULK_REMOVE_TAG       = "remove_tag"
+	BULK_ADD_SOURCE       = "add_source"
+	BULK_REMOVE_SOURCE    = "remove_source"
+	BULK_ADD_PERSON       = "add_person"
+	BULK_REMOVE_PERSON    = "remove_person"
+	BULK_ADD_PUBLISHER    = "add_publisher"
+	BULK_REMOVE_PUBLISHER = "remove_publisher"
+	BULK_SET_SECURE       = "set_secure"
+	BULK_PATCH_PROPERTIES = "patch_properties"
+
+	MAX_BULK_UNITS = 1000
+)
+
+// Apply a list of operations to many content units in a single transaction.
+// With dry_run the changes are reported but not saved.
+func ContentUnitsBulkHandler(c *gin.Context) {
+	var r ContentUnitsBulkRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_CONTENT_UNIT, r.IDs...)
+	resp, evnts, err := handleContentUnitsBulk(c, tx, r)
+	if r.DryRun {
+		utils.Must(tx.Rollback())
+		concludeRequest(c, resp, err)
+		return
+	}
+
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+	}
+	mustConcludeTx(tx, err)
+
+	concludeRequest(c, resp, err)
+}
+
+func handleContentUnitsBulk(cp utils.ContextProvider, exec boil.Executor, r ContentUnitsBulkRequest) (*ContentUnitsBulkResponse, []events.Event, *HttpError) {
+	if len(r.IDs) > MAX_BULK_UNITS {
+		return nil, nil, NewBadRequestError(errors.Errorf("Too many content units, max is %d", MAX_BULK_UNITS))
+	}
+
+	// validate operations
+	perms := make(map[string]bool)
+	for i, op := range r.Operations {
+		if err := validateBulkOperation(exec, op); err != nil {
+			return nil, nil, NewBadRequestError(errors.Wrapf(err, "operations[%d]", i))
+		}
+		switch op.Op {
+		case BULK_SET_SECURE, BULK_PATCH_PROPERTIES:
+			perms[PERM_WRITE] = true
+		default:
+			perms[PERM_METADATA_WRITE] = true
+		}
+	}
+
+	units, err := models.ContentUnits(exec,
+		qm.WhereIn("id in ?", utils.ConvertArgsInt64(r.IDs)...),
+		qm.Where("removed_at IS NULL"),
+		qm.OrderBy("id")).
+		All()
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+
+	// all or nothing
+	byID := make(map[int64]*models.ContentUnit, len(units))
+	for _, cu := range units {
+		byID[cu.ID] = cu
+	}
+	for _, id := range r.IDs {
+		if _, ok := byID[id]; !ok {
+			return nil, nil, NewBadRequestError(errors.Errorf("Unknown content unit id %d", id))
+		}
+	}
+
+	// check object level permissions
+	for _, cu := range units {
+		for perm := range perms {
+			if !canContentUnit(cp, exec, cu, perm) {
+				return nil, nil, NewHttpError(http.StatusForbidden,
+					errors.Errorf("No %s permission on content unit %d", perm, cu.ID), gin.ErrorTypePublic)
+			}
+		}
+		// units can't be made more secure than one may write
+		for _, op := range r.Operations {
+			if op.Op == BULK_SET_SECURE && !canContentUnitSecure(cp, exec, cu, op.Secure.Int16, PERM_WRITE) {
+				return nil, nil, NewHttpError(http.StatusForbidden,
+					errors.Errorf("No permission to set secure %d on content unit %d", op.Secure.Int16, cu.ID), gin.ErrorTypePublic)
+			}
+		}
+	}
+
+	resp := &ContentUnitsBulkResponse{
+		DryRun:  r.DryRun,
+		Changes: make([]*ContentUnitBulkChanges, 0),
+	}
+	evnts := make([]events.Event, 0)
+	for _, cu := range units {
+		changes := &ContentUnitBulkChanges{ID: cu.ID, UID: cu.UID, Operations: make([]int, 0)}
+		changed := make(map[string]bool)
+		for i, op := range r.Operations {
+			ok, err := applyBulkOperation(exec, cu, op)
+			if err != nil {
+				return nil, nil, NewInternalError(errors.Wrapf(err, "operations[%d] on content unit %d", i, cu.ID))
+			}
+			if ok {
+				changes.Operations = append(changes.Operations, i)
+				changed[op.Op] = true
+			}
+		}
+
+		if len(changes.Operations) == 0 {
+			continue
+		}
+		resp.Changes = append(resp.Changes, changes)
+
+		if changed[BULK_ADD_TAG] || changed[BULK_REMOVE_TAG] {
+			evnts = append(evnts, events.ContentUnitTagsChangeEvent(cu))
+		}
+		if changed[BULK_ADD_SOURCE] || changed[BULK_REMOVE_SOURCE] {
+			evnts = append(evnts, events.ContentUnitSourcesChangeEvent(cu))
+		}
+		if changed[BULK_ADD_PERSON] || changed[BULK_REMOVE_PERSON] {
+			evnts = append(evnts, events.ContentUnitPersonsChangeEvent(cu))
+		}
+		if changed[BULK_ADD_PUBLISHER] || changed[BULK_REMOVE_PUBLISHER] {
+			evnts = append(evnts, events.ContentUnitPublishersChangeEvent(cu))
+		}
+		if changed[BULK_SET_SECURE] || changed[BULK_PATCH_PROPERTIES] {
+			evnts = append(evnts, events.ContentUnitUpdateEvent(cu))
+		}
+	}
+
+	return resp, evnts, nil
+}
+
+func validateBulkOperation(exec boil.Executor, op *ContentUnitsBulkOperation) error {
+	var exists bool
+	var err error
+
+	switch op.Op {
+	case BULK_ADD_TAG, BULK_REMOVE_TAG:
+		exists, err = models.TagExists(exec, op.ID)
+	case BULK_ADD_SOURCE, BULK_REMOVE_SOURCE:
+		exists, err = models.SourceExists(exec, op.ID)
+	case BULK_ADD_PERSON, BULK_REMOVE_PERSON:
+		exists, err = models.PersonExists(exec, op.ID)
+		if err == nil && exists && op.Op == BULK_ADD_PERSON {
+			exists, err = models.ContentRoleTypeExists(exec, op.RoleID)
+			if err == nil && !exists {
+				return errors.Errorf("Unknown role id %d", op.RoleID)
+			}
+		}
+	case BULK_ADD_PUBLISHER, BULK_REMOVE_PUBLISHER:
+		exists, err = models.PublisherExists(exec, op.ID)
+	case BULK_SET_SECURE:
+		if !op.Secure.Valid {
+			return errors.New("secure is required")
+		}
+		if op.Secure.Int16 != SEC_PUBLIC && op.Secure.Int16 != SEC_SENSITIVE && op.Secure.Int16 != SEC_PRIVATE {
+			return errors.Errorf("Unknown security level: %d", op.Secure.Int16)
+		}
+		return nil
+	case BULK_PATCH_PROPERTIES:
+		if len(op.Properties) == 0 {
+			return errors.New("properties are required")
+		}
+		return nil
+	default:
+		return errors.Errorf("Unknown operation %s", op.Op)
+	}
+
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Errorf("Unknown %s id %d", op.Op, op.ID)
+	}
+
+	return nil
+}
+
+// applyBulkOperation returns true if the unit was actually changed
+func applyBulkOperation(exec boil.Executor, cu *models.ContentUnit, op *ContentUnitsBulkOperation) (bool, error) {
+	var res sql.Result
+	var err error
+
+	switch op.Op {
+	case BULK_ADD_TAG:
+		res, err = queries.Raw(exec,
+			"INSERT INTO content_units_tags (content_unit_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			cu.ID, op.ID).Exec()
+	case BULK_REMOVE_TAG:
+		res, err = queries.Raw(exec,
+			"DELETE FROM content_units_tags WHERE content_unit_id = $1 AND tag_id = $2",
+			cu.ID, op.ID).Exec()
+	case BULK_ADD_SOURCE:
+		res, err = queries.Raw(exec,
+			"INSERT INTO content_units_sources (content_unit_id, source_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			cu.ID, op.ID).Exec()
+	case BULK_REMOVE_SOURCE:
+		res, err = queries.Raw(exec,
+			"DELETE FROM content_units_sources WHERE content_unit_id = $1 AND source_id = $2",
+			cu.ID, op.ID).Exec()
+	case BULK_ADD_PERSON:
+		res, err = queries.Raw(exec,
+			`INSERT INTO content_units_persons (content_unit_id, person_id, role_id) VALUES ($1, $2, $3)
+ON CONFLICT (content_unit_id, person_id) DO UPDATE SET role_id = EXCLUDED.role_id
+WHERE content_units_persons.role_id <> EXCLUDED.role_id`,
+			cu.ID, op.ID, op.RoleID).Exec()
+	case BULK_REMOVE_PERSON:
+		res, err = queries.Raw(exec,
+			"DELETE FROM content_units_persons WHERE content_unit_id = $1 AND person_id = $2",
+			cu.ID, op.ID).Exec()
+	case BULK_ADD_PUBLISHER:
+		res, err = queries.Raw(exec,
+			"INSERT INTO content_units_publishers (content_unit_id, publisher_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			cu.ID, op.ID).Exec()
+	case BULK_REMOVE_PUBLISHER:
+		res, err = queries.Raw(exec,
+			"DELETE FROM content_units_publishers WHERE content_unit_id = $1 AND publisher_id = $2",
+			cu.ID, op.ID).Exec()
+	case BULK_SET_SECURE:
+		if cu.Secure == op.Secure.Int16 {
+			return false, nil
+		}
+		cu.Secure = op.Secure.Int16
+		return true, cu.Update(exec, "secure")
+	case BULK_PATCH_PROPERTIES:
+		return mergeContentUnitProperties(exec, cu, op.Properties)
+	}
+
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+)
+
+// Keyset (cursor) pagination.
+// A cursor is the position of the last row of a page: the value of its order column and its id.
+// The next page seeks past that position instead of skipping rows with OFFSET,
+// so deep pages are as fast as the first and don't shift when rows are inserted mid-scan.
+
+type listCursor struct {
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+// keysetOrder tells if a list order is usable for keyset pagination, i.e. a single plain column.
+func keysetOrder(terms []sortTerm, fields sortFields) (col string, desc bool, ok bool) {
+	if len(terms) != 1 || !fields.isColumn(terms[0].field) {
+		return "", false, false
+	}
+	return terms[0].field, terms[0].desc, true
+}
+
+func appendCursorListMods(mods *[]qm.QueryMod, r ListRequest, terms []sortTerm, fields sortFields) error {
+	if r.PageNumber != 0 || r.StartIndex != 0 {
+		return errors.New("cursor can't be combined with page_no or start_index")
+	}
+
+	col, desc, ok := keysetOrder(terms, fields)
+	if !ok {
+		return errors.Errorf("cursor requires ordering by a single column, got %s", r.OrderBy)
+	}
+
+	c, err := decodeListCursor(r.Cursor)
+	if err != nil {
+		return err
+	}
+
+	cmp, dir := ">", "asc"
+	if desc {
+		cmp, dir = "<", "desc"
+	}
+
+	if col == "id" {
+		*mods = append(*mods,
+			qm.Where(fmt.Sprintf("id %s ?", cmp), c.ID),
+			qm.OrderBy(fmt.Sprintf("id %s", dir)))
+	} else {
+		// nulls sort first in descending order and last in ascending order
+		if c.Value == nil {
+			if desc {
+				*mods = append(*mods, qm.Where(fmt.Sprintf("((%[1]s IS NULL AND id < ?) OR %[1]s IS NOT NULL)", col), c.ID))
+			} else {
+				*mods = append(*mods, qm.Where(fmt.Sprintf("(%s IS NULL AND id > ?)", col), c.ID))
+			}
+		} else {
+			clause := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", col, cmp)
+			if !desc {
+				clause = fmt.Sprintf("(%s OR %s IS NULL)", clause, col)
+			}
+			*mods = append(*mods, qm.Where(clause, c.Value, c.Value, c.ID))
+		}
+		*mods = append(*mods, qm.OrderBy(fmt.Sprintf("%s %s, id %s", col, dir, dir)))
+	}
+
+	limit, _, _ := listLimits(r)
+	*mods = append(*mods, qm.Limit(limit))
+
+	return nil
+}
+
+// nextListCursor returns the cursor of the page following the given rows,
+// or an empty string if this is the last page or the order doesn't support cursors.
+// rows is a slice of pointers to structs with boil tags.
+func nextListCursor(r ListRequest, fields sortFields, rows interface{}) string {
+	terms, err := parseSort(r, fields)
+	if err != nil {
+		return ""
+	}
+	col, _, ok := keysetOrder(terms, fields)
+	if !ok {
+		return ""
+	}
+
+	v := reflect.ValueOf(rows)
+	limit, _, _ := listLimits(r)
+	if v.Len() == 0 || v.Len() < limit {
+		return ""
+	}
+
+	last := v.Index(v.Len() - 1)
+	id, ok := boilFieldValue(last, "id")
+	if !ok {
+		return ""
+	}
+	c := listCursor{ID: id.Int()}
+
+	if col != "id" {
+		x, ok := boilFieldValue(last, col)
+		if !ok {
+			return ""
+		}
+
+		value := x.Interface()
+		if valuer, ok := value.(driver.Valuer); ok {
+			if value, err = valuer.Value(); err != nil {
+				return ""
+			}
+		}
+		if b, ok := value.([]byte); ok {
+			value = `\x` + hex.EncodeToString(b) // bytea hex format
+		}
+		c.Value = value
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	// keep numbers as is, int64 values don't survive a float64
+	var c listCursor
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	return &c, nil
+}
+
+// boilFieldValue finds the field tagged with the given column, in embedded structs as well
+func boilFieldValue(v reflect.Value, column string) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.Split(f.Tag.Get("boil"), ",")[0] == column {
+			return v.Field(i), true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Anonymous {
+			if x, ok := boilFieldValue(v.Field(i), column); ok {
+				return x, true
+			}
+		}
+	}
+
+	return reflect.Value{}, false
+}
@@ -37,7 +37,7 @@ func (suite *DocsSuite) SetupSuite() {
 	suite.Require().Nil(InitTypeRegistries(suite.DB))
 	//suite.Require().Nil(InitTypeRegistries(boil.GetDB()))
 
-	enforcer, err := permissions.NewEnforcer()
+	enforcer, err := permissions.NewEnforcer(permissions.NewBindataPolicyAdapter())
 	utils.Must(err)
 	enforcer.EnableEnforce(false)
 
@@ -37,6 +37,10 @@ func NewForbiddenError() *HttpError {
 	return &HttpError{Code: http.StatusForbidden, Type: gin.ErrorTypePublic}
 }
 
+func NewConflictError(err error) *HttpError {
+	return NewHttpError(http.StatusConflict, err, gin.ErrorTypePublic)
+}
+
 func NewInternalError(err error) *HttpError {
 	return NewHttpError(http.StatusInternalServerError, err, gin.ErrorTypePrivate)
 }
@@ -64,4 +68,12 @@ type CollectionNotFound struct {
 
 func (x CollectionNotFound) Error() string {
 	return fmt.Sprintf("Collection not found, CaptureID = %s", x.CaptureID)
-}
\ No newline at end of file
+}
+
+type IdempotencyKeyConflict struct {
+	Key string
+}
+
+func (x IdempotencyKeyConflict) Error() string {
+	return fmt.Sprintf("Idempotency key reused with a different payload, key = %s", x.Key)
+}
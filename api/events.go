@@ -0,0 +1,247 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-contrib/sse"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/events"
+)
+
+const DEFAULT_EVENTS_LIMIT = 100
+const MAX_EVENTS_LIMIT = 1000
+const EVENTS_POLL_INTERVAL = 500 * time.Millisecond
+
+// Wakes up consumers waiting for events when the relay delivers new ones.
+// Set by the server command. Without it, waiting consumers poll every EVENTS_POLL_INTERVAL.
+var EventsDeliveries *events.DeliveryListener
+
+// Delivered events after a given position, visible to the subject.
+// Secure level of an event is taken from its payload if present,
+// otherwise from the current secure level of the entity it refers to.
+// args:
+// 1 since seq (exclusive)
+// 2 since id (exclusive), used when we don't know the seq
+// 3 types (empty array means all)
+// 4 max secure level in the whole archive
+// 5 limit
+// 6... secure levels and filters of permission domains, in the visibility condition
+const EVENTS_SQL = `
+SELECT o.seq, o.id, o.type, o.payload, coalesce(o.rloc, '')
+FROM events_outbox o
+  LEFT JOIN collections c
+    ON o.type LIKE 'COLLECTION\_%%' AND c.id = (o.payload ->> 'id') :: BIGINT
+  LEFT JOIN content_units cu
+    ON o.type LIKE 'CONTENT\_UNIT\_%%' AND cu.id = (o.payload ->> 'id') :: BIGINT
+  LEFT JOIN files f
+    ON o.type LIKE 'FILE\_%%' AND f.id = coalesce(o.payload ->> 'id', o.payload -> 'new' ->> 'id') :: BIGINT
+WHERE o.delivered_at IS NOT NULL
+      AND o.seq > $1
+      AND o.id > $2
+      AND (cardinality($3 :: VARCHAR[]) = 0 OR o.type = ANY ($3))
+      AND (%s)
+ORDER BY o.seq
+LIMIT $5;
+`
+
+// Secure level of an event in EVENTS_SQL
+// Events of collections, content units and files we can't tell the secure level of are private.
+const EVENT_SECURE_SQL = `CASE WHEN o.type LIKE 'COLLECTION\_%' OR o.type LIKE 'CONTENT\_UNIT\_%' OR o.type LIKE 'FILE\_%'
+  THEN coalesce((o.payload ->> 'secure') :: SMALLINT, (o.payload -> 'new' ->> 'secure') :: SMALLINT,
+                c.secure, cu.secure, f.secure, 2)
+  ELSE 0 END`
+
+// eventsDelivered returns a channel which is closed when there might be new events
+func eventsDelivered() <-chan struct{} {
+	if EventsDeliveries != nil {
+		return EventsDeliveries.Wait()
+	}
+
+	ch := make(chan struct{})
+	time.AfterFunc(EVENTS_POLL_INTERVAL, func() { close(ch) })
+	return ch
+}
+
+// Persisted history of events. Consumers resync by asking for everything since the last event they've seen.
+// With wait > 0 this is a long-poll: respond as soon as there are events or when wait seconds have passed.
+func EventsHandler(c *gin.Context) {
+	var r EventsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	secure, grants := allowedRead(c), domainGrants(c, PERM_READ)
+	if secure < 0 && len(grants) == 0 {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	mdb := c.MustGet("MDB").(*sql.DB)
+	delivered := eventsDelivered()
+	resp, err := handleEvents(mdb, r, secure, grants)
+	if err == nil && len(resp.Data) == 0 && r.Wait > 0 {
+		deadline := time.After(time.Duration(r.Wait) * time.Second)
+		clientGone := c.Writer.CloseNotify()
+	wait:
+		for err == nil && len(resp.Data) == 0 {
+			select {
+			case <-clientGone:
+				return
+			case <-deadline:
+				break wait
+			case <-delivered:
+			}
+			delivered = eventsDelivered()
+			resp, err = handleEvents(mdb, r, secure, grants)
+		}
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+// Server-Sent Events stream of events.
+// Resumes from the Last-Event-ID header if present.
+func EventsStreamHandler(c *gin.Context) {
+	var r EventsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+	if lastID := c.GetHeader("Last-Event-ID"); lastID != "" {
+		r.Since = lastID
+	}
+
+	secure, grants := allowedRead(c), domainGrants(c, PERM_READ)
+	if secure < 0 && len(grants) == 0 {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	mdb := c.MustGet("MDB").(*sql.DB)
+	clientGone := c.Writer.CloseNotify()
+	var failed *HttpError
+	c.Stream(func(w io.Writer) bool {
+		delivered := eventsDelivered()
+		resp, err := handleEvents(mdb, r, secure, grants)
+		if err != nil {
+			failed = err
+			return false
+		}
+
+		for i := range resp.Data {
+			event := resp.Data[i]
+			c.Render(-1, sse.Event{
+				Id:    event.ID,
+				Event: event.Type,
+				Data:  event,
+			})
+			r.Since = event.ID
+		}
+
+		if len(resp.Data) == 0 {
+			select {
+			case <-clientGone:
+				return false
+			case <-delivered:
+			}
+		}
+		return true
+	})
+
+	if failed != nil {
+		log.Errorf("events stream: %+v", failed.Err)
+		c.SSEvent("error", http.StatusText(failed.Code))
+	}
+}
+
+func handleEvents(exec boil.Executor, r EventsRequest, secure int16, grants []domainGrant) (*EventsResponse, *HttpError) {
+	limit := r.Limit
+	if limit == 0 {
+		limit = DEFAULT_EVENTS_LIMIT
+	} else if limit > MAX_EVENTS_LIMIT {
+		limit = MAX_EVENTS_LIMIT
+	}
+
+	types := make([]string, 0)
+	for i := range r.Types {
+		for _, t := range strings.Split(r.Types[i], ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	// Prefer position in outbox over ULID comparison.
+	// ULIDs generated by different servers in the same millisecond are not ordered.
+	var sinceSeq int64
+	sinceID := r.Since
+	if r.Since != "" {
+		err := queries.Raw(exec, "SELECT seq FROM events_outbox WHERE id = $1", r.Since).
+			QueryRow().Scan(&sinceSeq)
+		if err == nil {
+			sinceID = ""
+		} else if err != sql.ErrNoRows {
+			return nil, NewInternalError(errors.Wrap(err, "Lookup since"))
+		}
+	}
+
+	args := []interface{}{sinceSeq, sinceID, pq.Array(types), secure, limit}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// events of entities in permission domains are visible at the secure level of the domain
+	visibility := []string{EVENT_SECURE_SQL + " <= $4"}
+	for _, g := range grants {
+		inDomain := make([]string, 0)
+		for i, column := range []string{"c.id", "cu.id", "f.id"} {
+			entityType := []int{SEARCH_IN_COLLECTIONS, SEARCH_IN_CONTENT_UNITS, SEARCH_IN_FILES}[i]
+			if clause := domainFilterRawSQL(g.domain, entityType, column, arg); clause != "" {
+				inDomain = append(inDomain, clause)
+			}
+		}
+		if len(inDomain) > 0 {
+			visibility = append(visibility, fmt.Sprintf("(%s <= %s AND (%s))",
+				EVENT_SECURE_SQL, arg(g.secure), strings.Join(inDomain, " OR ")))
+		}
+	}
+
+	q := fmt.Sprintf(EVENTS_SQL, strings.Join(visibility, " OR "))
+	rows, err := queries.Raw(exec, q, args...).Query()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	defer rows.Close()
+
+	resp := &EventsResponse{Data: make([]events.Event, 0)}
+	for rows.Next() {
+		var seq int64
+		var event events.Event
+		var payload []byte
+		err = rows.Scan(&seq, &event.ID, &event.Type, &payload, &event.ReplicationLocation)
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+		if err := json.Unmarshal(payload, &event.Payload); err != nil {
+			return nil, NewInternalError(errors.Wrapf(err, "json.Unmarshal payload [%s]", event.ID))
+		}
+		resp.Data = append(resp.Data, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return resp, nil
+}
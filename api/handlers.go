@@ -18,10 +18,31 @@ import (
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/media"
+	"github.com/Bnei-Baruch/mdb/metrics"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
+const PERM_OPERATIONS = "operations"
+
+// OperationsAuthorizationMiddleware lets only authorized clients, i.e. workflow stations, report operations
+func OperationsAuthorizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		act := PERM_WRITE
+		if c.Request.Method == http.MethodGet {
+			act = PERM_READ
+		}
+
+		if !can(c, PERM_OPERATIONS, act) {
+			NewForbiddenError().Abort(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // Start capture of AV file, i.e. morning lesson, tv program, etc...
 func CaptureStartHandler(c *gin.Context) {
 	log.Info(OP_CAPTURE_START)
@@ -64,36 +85,26 @@ func SendHandler(c *gin.Context) {
 	log.Info(OP_SEND)
 	var i SendRequest
 	if c.BindJSON(&i) == nil {
-		// we skip using the generic handleOperation to return some data to caller
-
-		mdb := c.MustGet("MDB").(*sql.DB)
-		tx, err := mdb.Begin()
-		utils.Must(err)
-
-		_, evnts, err := handleSend(tx, i)
-		if err != nil {
-			utils.Must(tx.Rollback())
-			err = errors.Wrapf(err, "Handle operation")
-			NewInternalError(err).Abort(c)
-			return
-		}
+		// we respond with the newly created content unit instead of the generic operation result
+		doOperation(c, i, handleSend, sendResponse)
+	}
+}
 
-		utils.Must(tx.Commit())
+// Respond to send operation with the newly created content unit
+func sendResponse(exec boil.Executor, input interface{}, op *models.Operation) (interface{}, error) {
+	r := input.(SendRequest)
 
-		// fetch newly created content unit
-		original, _, _ := FindFileBySHA1(mdb, i.Original.Sha1)
-		cu, err := models.FindContentUnit(mdb, original.ContentUnitID.Int64)
-		if err != nil {
-			err = errors.Wrapf(err, "Lookup content unit")
-		}
+	original, _, err := FindFileBySHA1(exec, r.Original.Sha1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Lookup original file")
+	}
 
-		if err == nil {
-			emitEvents(c, evnts...)
-			c.JSON(http.StatusOK, cu)
-		} else {
-			NewInternalError(err).Abort(c)
-		}
+	cu, err := models.FindContentUnit(exec, original.ContentUnitID.Int64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Lookup content unit")
 	}
+
+	return cu, nil
 }
 
 // Files converted to low resolution web formats, language splitting, etc...
@@ -185,7 +196,7 @@ func DescendantUnitsHandler(c *gin.Context) {
 ) SELECT array_agg(DISTINCT rf.content_unit_id)
   FILTER (WHERE rf.content_unit_id IS NOT NULL)
   FROM rf 
-	INNER JOIN content_units cu ON rf.content_unit_id = cu.id AND NOT (cu.type_id = ANY($2))`
+	INNER JOIN content_units cu ON rf.content_unit_id = cu.id AND NOT (cu.type_id = ANY($2)) AND cu.removed_at IS NULL`
 	err = queries.Raw(mdb, q, f.ID, pq.Array([]int64{
 		//CONTENT_TYPE_REGISTRY.ByName[CT_KITEI_MAKOR].ID,  // created in workflow
 		//CONTENT_TYPE_REGISTRY.ByName[CT_LELO_MIKUD].ID,   // created in workflow
@@ -327,6 +338,9 @@ func handleDemux(exec boil.Executor, input interface{}) (*models.Operation, []ev
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := saveMediaInfo(exec, original, r.Original); err != nil {
+		return nil, nil, err
+	}
 
 	log.Info("Creating proxy")
 	props = map[string]interface{}{
@@ -336,6 +350,9 @@ func handleDemux(exec boil.Executor, input interface{}) (*models.Operation, []ev
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := saveMediaInfo(exec, proxy, r.Proxy); err != nil {
+		return nil, nil, err
+	}
 
 	log.Info("Associating files to operation")
 	return operation, nil, operation.AddFiles(exec, false, parent, original, proxy)
@@ -376,6 +393,9 @@ func handleTrim(exec boil.Executor, input interface{}) (*models.Operation, []eve
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := saveMediaInfo(exec, originalTrim, r.Original); err != nil {
+		return nil, nil, err
+	}
 
 	log.Info("Creating trimmed proxy")
 	props = map[string]interface{}{
@@ -385,6 +405,9 @@ func handleTrim(exec boil.Executor, input interface{}) (*models.Operation, []eve
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := saveMediaInfo(exec, proxyTrim, r.Proxy); err != nil {
+		return nil, nil, err
+	}
 
 	log.Info("Associating files to operation")
 	return operation, nil, operation.AddFiles(exec, false, original, originalTrim, proxy, proxyTrim)
@@ -510,6 +533,7 @@ func handleConvert(exec boil.Executor, input interface{}) (*models.Operation, []
 		f, _, err := FindFileBySHA1(exec, x.Sha1)
 		if err == nil {
 			log.Infof("File already exists, updating: %s", x.Sha1)
+			before := *f
 			err = UpdateFile(exec, f, in, x.File, props)
 			if err != nil {
 				return nil, nil, errors.Wrap(err, "Update file")
@@ -525,7 +549,7 @@ func handleConvert(exec boil.Executor, input interface{}) (*models.Operation, []
 				}
 			}
 
-			evnts = append(evnts, events.FileUpdateEvent(f))
+			evnts = append(evnts, events.FileUpdateEvent(f).WithDiff(&before, f))
 		} else {
 			if _, ok := err.(FileNotFound); ok {
 				// new file
@@ -538,14 +562,34 @@ func handleConvert(exec boil.Executor, input interface{}) (*models.Operation, []
 			}
 		}
 
+		if err := saveMediaInfo(exec, f, x); err != nil {
+			return nil, nil, err
+		}
+
 		i++
 		files[i] = f
 	}
 
+	log.Info("Updating convert job")
+	err = linkJobOperation(exec, JOB_CONVERT, in.ID, operation, "")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Update convert job")
+	}
+
 	log.Info("Associating files to operation")
 	return operation, evnts, operation.AddFiles(exec, false, files...)
 }
 
+// saveMediaInfo keeps the technical metadata of an AV file, if given
+func saveMediaInfo(exec boil.Executor, file *models.File, x AVFile) error {
+	if x.FFprobe == nil {
+		return nil
+	}
+
+	log.Infof("Saving media info of file %d", file.ID)
+	return errors.Wrapf(media.SaveFileInfo(exec, file.ID, media.NewInfo(x.FFprobe)), "Save media info of file %d", file.ID)
+}
+
 func handleUpload(exec boil.Executor, input interface{}) (*models.Operation, []events.Event, error) {
 	r := input.(UploadRequest)
 
@@ -580,6 +624,9 @@ func handleUpload(exec boil.Executor, input interface{}) (*models.Operation, []e
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := saveMediaInfo(exec, file, r.AVFile); err != nil {
+		return nil, nil, err
+	}
 
 	impact, err := PublishFile(exec, file)
 	if err != nil {
@@ -680,7 +727,7 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 
 	log.Infof("Lookup content unit by uid %s", r.ContentUnitUID)
 	cu, err := models.ContentUnits(exec,
-		qm.Where("uid = ?", r.ContentUnitUID),
+		qm.Where("uid = ? AND removed_at IS NULL", r.ContentUnitUID),
 		qm.Load("SourceContentUnitDerivations", "SourceContentUnitDerivations.Derived"),
 	).One()
 	if err != nil {
@@ -736,6 +783,7 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 	}
 
 	// create new file based on mode
+	var before models.File
 	if r.Mode == "new" || r.Mode == "update" {
 		log.Info("Creating new file")
 		file, err = CreateFile(exec, parent, r.File, props)
@@ -752,6 +800,7 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 		}
 
 		// set new attributes
+		before = *file
 		file.Name = mf.Name
 		file.Type = mf.Type
 		file.SubType = mf.SubType
@@ -767,6 +816,10 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 		}
 	}
 
+	if err := saveMediaInfo(exec, file, r.AVFile); err != nil {
+		return nil, nil, err
+	}
+
 	opFiles = append(opFiles, file)
 
 	// special types logic
@@ -868,7 +921,7 @@ FROM content_units cu
 	if r.Mode == "new" {
 		evnts = append(evnts, events.FileInsertEvent(file, r.InsertType))
 	} else if r.Mode == "rename" {
-		evnts = append(evnts, events.FileUpdateEvent(file))
+		evnts = append(evnts, events.FileUpdateEvent(file).WithDiff(&before, file))
 	} else if r.Mode == "update" {
 		evnts = append(evnts, events.FileReplaceEvent(oldFile, file, r.InsertType))
 
@@ -905,10 +958,9 @@ func handleTranscode(exec boil.Executor, input interface{}) (*models.Operation,
 			return nil, nil, errors.Wrapf(err, "Lookup original file %s", r.OriginalSha1)
 		}
 
-		log.Info("Updating queue table")
-		_, err = queries.Raw(exec, "update batch_convert set operation_id=$1 where file_id=$2", operation.ID, original.ID).Exec()
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "Update queue table")
+		log.Info("Updating transcode job")
+		if err := linkJobOperation(exec, JOB_TRANSCODE, original.ID, operation, r.Message); err != nil {
+			return nil, nil, errors.Wrap(err, "Update transcode job")
 		}
 
 		return operation, nil, operation.AddFiles(exec, false, original)
@@ -962,10 +1014,10 @@ func handleTranscode(exec boil.Executor, input interface{}) (*models.Operation,
 		return nil, nil, errors.Wrapf(err, "Update secure published [%d]", file.ID)
 	}
 
-	log.Info("Updating queue table")
-	_, err = queries.Raw(exec, "update batch_convert set operation_id=$1 where file_id=$2", operation.ID, original.ID).Exec()
+	log.Info("Updating transcode job")
+	err = linkJobOperation(exec, JOB_TRANSCODE, original.ID, operation, "")
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "Update queue table")
+		return nil, nil, errors.Wrap(err, "Update transcode job")
 	}
 
 	opFiles := []*models.File{original, file}
@@ -1000,11 +1052,45 @@ func handleTranscode(exec boil.Executor, input interface{}) (*models.Operation,
 
 type OperationHandler func(boil.Executor, interface{}) (*models.Operation, []events.Event, error)
 
+// Compute the response of an operation.
+// Called within the operation's transaction, after the operation logic handler.
+type OperationResponder func(boil.Executor, interface{}, *models.Operation) (interface{}, error)
+
+func operationResponse(exec boil.Executor, input interface{}, op *models.Operation) (interface{}, error) {
+	return NewOperationResult(exec, op)
+}
+
 // Generic operation handler.
 // 	* Manage DB transactions
 // 	* Call operation logic handler
+// 	* Mark replays of recorded requests
 // 	* Render JSON response
 func handleOperation(c *gin.Context, input interface{}, opHandler OperationHandler) {
+	doOperation(c, input, opHandler, operationResponse)
+}
+
+// Generic operation handler with a custom response.
+// 	* Replay recorded response for a known idempotency key
+// 	* Manage DB transactions
+// 	* Call operation logic handler
+// 	* Record response for idempotency key
+// 	* Render JSON response
+func doOperation(c *gin.Context, input interface{}, opHandler OperationHandler, responder OperationResponder) {
+	endpoint := c.Request.URL.Path
+	key, err := idempotencyKey(c, input)
+	if err != nil {
+		NewBadRequestError(err).Abort(c)
+		return
+	}
+	var reqHash string
+	if key != "" {
+		reqHash, err = hashRequest(input)
+		if err != nil {
+			NewInternalError(errors.Wrapf(err, "Hash request")).Abort(c)
+			return
+		}
+	}
+
 	mdb := c.MustGet("MDB").(*sql.DB)
 	tx, err := mdb.Begin()
 	//tx, err := boil.Begin()
@@ -1018,17 +1104,52 @@ func handleOperation(c *gin.Context, input interface{}, opHandler OperationHandl
 		}
 	}()
 
-	_, evnts, err := opHandler(tx, input)
+	if key != "" {
+		recorded, herr := recordedResponse(tx, endpoint, key, reqHash)
+		if herr != nil {
+			utils.Must(tx.Rollback())
+			herr.Abort(c)
+			return
+		}
+		if recorded.Valid {
+			utils.Must(tx.Rollback())
+			log.Infof("Replay %s for idempotency key %s", endpoint, key)
+			c.Header(IDEMPOTENT_REPLAYED_HEADER, "true")
+			c.Data(http.StatusOK, "application/json; charset=utf-8", recorded.JSON)
+			return
+		}
+	}
+
+	var resp interface{}
+	op, evnts, err := opHandler(tx, input)
+	if err == nil && op != nil {
+		if id := replayOf(c); id != 0 {
+			err = markReplay(tx, op.ID, id)
+		}
+	}
+	if err == nil {
+		resp, err = responder(tx, input, op)
+	}
+	if err == nil && key != "" {
+		err = saveIdempotencyRecord(tx, endpoint, key, reqHash, op, resp)
+	}
+	if err == nil {
+		if e := emitEvents(c, tx, evnts...); e != nil {
+			err = e
+		}
+	}
 	if err == nil {
 		utils.Must(tx.Commit())
+		if op != nil {
+			metrics.Operations.WithLabelValues(OPERATION_TYPE_REGISTRY.ByID[op.TypeID].Name).Inc()
+		}
 	} else {
 		utils.Must(tx.Rollback())
 		err = errors.Wrapf(err, "Handle operation")
 	}
 
 	if err == nil {
-		emitEvents(c, evnts...)
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		c.JSON(http.StatusOK, resp)
 	} else {
 		switch err.(type) {
 		case FileNotFound:
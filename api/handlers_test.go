@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"math"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -1471,3 +1473,113 @@ func (suite *HandlersSuite) TestHandleTranscodeError() {
 	originalParent := op.R.Files[0]
 	suite.Equal(original.ID, originalParent.ID, "original <-> operation")
 }
+
+func (suite *HandlersSuite) TestRecordAndMarkReplay() {
+	req, err := http.NewRequest(http.MethodPost, "/operations/insert", nil)
+	suite.Require().Nil(err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	body := `{"sha1": "012356789abcdef012356789abcdef9876543210"}`
+	err = recordRequest(suite.tx, req, []byte(body), http.StatusInternalServerError, `{"error": "boom"}`, time.Second)
+	suite.Require().Nil(err)
+
+	var recordID int64
+	var operation, headers, recorded string
+	var status, duration int
+	err = suite.tx.QueryRow(`SELECT id, operation, headers, body, status, duration FROM recorded_requests
+ORDER BY id DESC LIMIT 1`).Scan(&recordID, &operation, &headers, &recorded, &status, &duration)
+	suite.Require().Nil(err)
+	suite.Equal(OP_INSERT, operation, "operation")
+	suite.Equal(body, recorded, "body")
+	suite.Equal(http.StatusInternalServerError, status, "status")
+	suite.Equal(1000, duration, "duration")
+	suite.NotContains(headers, "secret", "redacted headers")
+
+	// the replay creates an operation marked with the recorded request
+	op, err := CreateOperation(suite.tx, OP_INSERT, Operation{Station: "station", User: "operator@dev.com"},
+		map[string]interface{}{"mode": "new"})
+	suite.Require().Nil(err)
+	suite.Require().Nil(markReplay(suite.tx, op.ID, recordID))
+
+	suite.Require().Nil(op.Reload(suite.tx))
+	var props map[string]interface{}
+	suite.Require().Nil(json.Unmarshal(op.Properties.JSON, &props))
+	suite.EqualValues(recordID, props["replay_of"], "replay_of")
+	suite.Equal("new", props["mode"], "existing properties")
+
+	// replays of unknown requests are recorded, and marked, as plain requests
+	req.Header.Set(REPLAY_OF_HEADER, strconv.FormatInt(recordID+100, 10))
+	err = recordRequest(suite.tx, req, []byte(body), http.StatusOK, `{}`, time.Second)
+	suite.Require().Nil(err, "bogus replay of")
+	var replayOf null.Int64
+	err = suite.tx.QueryRow(`SELECT replay_of FROM recorded_requests ORDER BY id DESC LIMIT 1`).Scan(&replayOf)
+	suite.Require().Nil(err)
+	suite.False(replayOf.Valid, "bogus replay_of")
+
+	op, err = CreateOperation(suite.tx, OP_INSERT, Operation{Station: "station", User: "operator@dev.com"}, nil)
+	suite.Require().Nil(err)
+	suite.Require().Nil(markReplay(suite.tx, op.ID, recordID+100))
+	suite.Require().Nil(op.Reload(suite.tx))
+	suite.NotContains(string(op.Properties.JSON), "replay_of", "bogus mark")
+}
+
+func (suite *HandlersSuite) TestOperationIdempotency() {
+	input := CaptureStartRequest{
+		Operation: Operation{
+			Station:    "Capture station",
+			User:       "operator@dev.com",
+			WorkflowID: "c12356789",
+		},
+		FileName:      "heb_o_rav_rb-1990-02-kishalon_2016-09-14_lesson.mp4",
+		CaptureSource: "mltcap",
+		CollectionUID: "abcdefgh",
+	}
+	op, _, err := handleCaptureStart(suite.tx, input)
+	suite.Require().Nil(err)
+
+	result, err := NewOperationResult(suite.tx, op)
+	suite.Require().Nil(err)
+	suite.Equal("ok", result.Status, "result.Status")
+	suite.Equal(op.UID, result.OperationUID, "result.OperationUID")
+	suite.Require().Len(result.FileIDs, 1, "result.FileIDs")
+	suite.Empty(result.ContentUnitIDs, "result.ContentUnitIDs")
+
+	endpoint := "/operations/capture_start"
+	key := input.IdempotencyKey()
+	suite.Equal(input.Operation.Station+":"+input.Operation.WorkflowID, key, "IdempotencyKey")
+	reqHash, err := hashRequest(input)
+	suite.Require().Nil(err)
+
+	record, err := findIdempotencyRecord(suite.tx, endpoint, key)
+	suite.Require().Nil(err)
+	suite.Nil(record, "record before save")
+
+	suite.Require().Nil(saveIdempotencyRecord(suite.tx, endpoint, key, reqHash, op, result))
+
+	record, err = findIdempotencyRecord(suite.tx, endpoint, key)
+	suite.Require().Nil(err)
+	suite.Require().NotNil(record, "record after save")
+	suite.Equal(reqHash, record.RequestHash, "record.RequestHash")
+	var replay OperationResult
+	suite.Require().Nil(json.Unmarshal(record.Response.JSON, &replay))
+	suite.Equal(*result, replay, "record.Response")
+
+	recorded, herr := recordedResponse(suite.tx, endpoint, key, reqHash)
+	suite.Require().Nil(herr)
+	suite.JSONEq(string(record.Response.JSON), string(recorded.JSON), "recorded response")
+
+	// different payload, same key is a conflict
+	input.CaptureSource = "other"
+	suite.Equal(key, input.IdempotencyKey(), "IdempotencyKey of different payload")
+	otherHash, err := hashRequest(input)
+	suite.Require().Nil(err)
+	suite.NotEqual(reqHash, otherHash, "hash of different payload")
+	_, herr = recordedResponse(suite.tx, endpoint, key, otherHash)
+	suite.Require().NotNil(herr, "conflict")
+	suite.Equal(http.StatusConflict, herr.Code, "conflict status")
+
+	// other endpoints are not affected
+	record, err = findIdempotencyRecord(suite.tx, "/operations/demux", key)
+	suite.Require().Nil(err)
+	suite.Nil(record, "record on other endpoint")
+}
@@ -7,10 +7,45 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/migrations"
+)
+
+// Deep health checks, reporting the status of each component.
+// /health/live fails when the process itself is broken and should be restarted.
+// /health/ready fails when the instance can't do its job, e.g. publish events,
+// and should be taken out of the load balancer.
+
+// HealthCheck checks a single component.
+// Details, if any, are reported with the component's status.
+type HealthCheck func(ctx context.Context) (interface{}, error)
+
+var (
+	// Readiness checks of components set up by the server, by component name
+	READINESS_CHECKS = make(map[string]HealthCheck)
+
+	// An instance with more undelivered events than this isn't ready
+	OutboxBacklogThreshold int64 = 1000
+
+	HealthCheckTimeout = 3 * time.Second
 )
 
+type ComponentStatus struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Latency float64     `json:"latency_ms"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type HealthResponse struct {
+	Status     string                      `json:"status"`
+	Components map[string]*ComponentStatus `json:"components"`
+}
+
 func HealthCheckHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
 	defer cancel()
@@ -49,3 +84,153 @@ func Ping(db *sql.DB, ctx context.Context) error {
 	defer rows.Close()
 	return nil
 }
+
+func HealthLiveHandler(c *gin.Context) {
+	respondHealth(c, map[string]HealthCheck{
+		"registries": checkRegistries,
+	})
+}
+
+func HealthReadyHandler(c *gin.Context) {
+	mdb := c.MustGet("MDB").(*sql.DB)
+
+	checks := map[string]HealthCheck{
+		"registries": checkRegistries,
+		"mdb": func(ctx context.Context) (interface{}, error) {
+			return nil, Ping(mdb, ctx)
+		},
+		"schema": func(ctx context.Context) (interface{}, error) {
+			return checkSchema(mdb)
+		},
+		"events_outbox": func(ctx context.Context) (interface{}, error) {
+			return checkOutbox(mdb)
+		},
+	}
+	for k, v := range READINESS_CHECKS {
+		checks[k] = v
+	}
+
+	respondHealth(c, checks)
+}
+
+func respondHealth(c *gin.Context, checks map[string]HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.TODO(), HealthCheckTimeout)
+	defer cancel()
+
+	resp := runHealthChecks(ctx, checks)
+	if resp.Status == "ok" {
+		c.JSON(http.StatusOK, resp)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, resp)
+	}
+}
+
+// runHealthChecks runs all checks concurrently.
+// Checks still running when the context is done are reported as timed out.
+func runHealthChecks(ctx context.Context, checks map[string]HealthCheck) *HealthResponse {
+	type result struct {
+		name   string
+		status *ComponentStatus
+	}
+
+	ch := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check HealthCheck) {
+			start := time.Now()
+			details, err := check(ctx)
+			status := &ComponentStatus{
+				Status:  "ok",
+				Latency: float64(time.Since(start)) / float64(time.Millisecond),
+				Details: details,
+			}
+			if err != nil {
+				status.Status = "error"
+				status.Error = err.Error()
+			}
+			ch <- result{name: name, status: status}
+		}(name, check)
+	}
+
+	resp := &HealthResponse{
+		Status:     "ok",
+		Components: make(map[string]*ComponentStatus, len(checks)),
+	}
+	for name := range checks {
+		resp.Components[name] = &ComponentStatus{Status: "error", Error: "timeout"}
+	}
+
+collect:
+	for range checks {
+		select {
+		case r := <-ch:
+			resp.Components[r.name] = r.status
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	for _, status := range resp.Components {
+		if status.Status != "ok" {
+			resp.Status = "error"
+		}
+	}
+
+	return resp
+}
+
+func checkRegistries(ctx context.Context) (interface{}, error) {
+	sizes := map[string]int{
+		"content_types":      len(CONTENT_TYPE_REGISTRY.ByName),
+		"operation_types":    len(OPERATION_TYPE_REGISTRY.ByName),
+		"content_role_types": len(CONTENT_ROLE_TYPE_REGISTRY.ByName),
+		"persons":            len(PERSON_REGISTRY.ByPattern),
+		"authors":            len(AUTHOR_REGISTRY.ByCode),
+		"source_types":       len(SOURCE_TYPE_REGISTRY.ByName),
+		"media_types":        len(MEDIA_TYPE_REGISTRY.ByExtension),
+	}
+
+	if CONTENT_TYPE_REGISTRY.ByName == nil ||
+		OPERATION_TYPE_REGISTRY.ByName == nil ||
+		CONTENT_ROLE_TYPE_REGISTRY.ByName == nil ||
+		PERSON_REGISTRY.ByPattern == nil ||
+		AUTHOR_REGISTRY.ByCode == nil ||
+		SOURCE_TYPE_REGISTRY.ByName == nil ||
+		MEDIA_TYPE_REGISTRY.ByExtension == nil {
+		return sizes, errors.New("Type registries are not initialized")
+	}
+
+	return sizes, nil
+}
+
+func checkSchema(db *sql.DB) (interface{}, error) {
+	applied, err := migrations.AppliedVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// a newer schema is fine, migrations are applied before the binaries are rolled out
+	details := gin.H{"expected": migrations.SCHEMA_VERSION, "applied": applied}
+	if applied < migrations.SCHEMA_VERSION {
+		return details, errors.Errorf("Pending migrations")
+	}
+
+	return details, nil
+}
+
+func checkOutbox(db *sql.DB) (interface{}, error) {
+	pending, oldest, err := events.OutboxBacklog(db)
+	if err != nil {
+		return nil, err
+	}
+
+	details := gin.H{
+		"pending":        pending,
+		"oldest_seconds": oldest.Seconds(),
+		"threshold":      OutboxBacklogThreshold,
+	}
+	if pending > OutboxBacklogThreshold {
+		return details, errors.Errorf("%d events waiting for delivery", pending)
+	}
+
+	return details, nil
+}
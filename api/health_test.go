@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	ok := func(ctx context.Context) (interface{}, error) {
+		return "details", nil
+	}
+	failing := func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("down")
+	}
+	slow := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}
+
+	resp := runHealthChecks(context.TODO(), map[string]HealthCheck{"a": ok, "b": ok})
+	assert.Equal(t, "ok", resp.Status)
+	assert.Len(t, resp.Components, 2)
+	assert.Equal(t, "ok", resp.Components["a"].Status)
+	assert.Equal(t, "details", resp.Components["a"].Details)
+
+	resp = runHealthChecks(context.TODO(), map[string]HealthCheck{"a": ok, "b": failing})
+	assert.Equal(t, "error", resp.Status)
+	assert.Equal(t, "ok", resp.Components["a"].Status)
+	assert.Equal(t, "error", resp.Components["b"].Status)
+	assert.Equal(t, "down", resp.Components["b"].Error)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	resp = runHealthChecks(ctx, map[string]HealthCheck{"a": ok, "b": slow})
+	assert.Equal(t, "error", resp.Status)
+	assert.Equal(t, "ok", resp.Components["a"].Status)
+	assert.Equal(t, "timeout", resp.Components["b"].Error)
+}
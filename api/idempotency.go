@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// Operations endpoints are idempotent.
+// A request is identified by the Idempotency-Key header or, if missing, by its operation station and workflow_id.
+// Stations working on the same workflow (main and backup capture) share a workflow_id, so the station is part of the key.
+// We record the key, a hash of the payload and the response in the same transaction as the operation.
+// A retry with the same key and payload gets the recorded response without running the operation again.
+// Reusing a key with a different payload is a conflict.
+// Recorded responses are sent with the Idempotent-Replayed header.
+
+const (
+	IDEMPOTENCY_KEY_HEADER     = "Idempotency-Key"
+	IDEMPOTENT_REPLAYED_HEADER = "Idempotent-Replayed"
+	IDEMPOTENCY_KEY_MAX_LENGTH = 255 // operations_idempotency.key
+)
+
+// How long are idempotency keys remembered.
+// Overridden by the server command from configuration.
+var IdempotencyKeyTTL = 24 * time.Hour
+
+// Response of the operations endpoints.
+type OperationResult struct {
+	Status         string  `json:"status"`
+	OperationUID   string  `json:"operation_uid,omitempty"`
+	FileIDs        []int64 `json:"file_ids"`
+	ContentUnitIDs []int64 `json:"content_unit_ids"`
+}
+
+// Compute the response of an operation from the files it affected.
+func NewOperationResult(exec boil.Executor, op *models.Operation) (*OperationResult, error) {
+	r := &OperationResult{
+		Status:         "ok",
+		FileIDs:        make([]int64, 0),
+		ContentUnitIDs: make([]int64, 0),
+	}
+	if op == nil {
+		return r, nil
+	}
+	r.OperationUID = op.UID
+
+	rows, err := queries.Raw(exec,
+		`SELECT f.id, f.content_unit_id
+FROM files f INNER JOIN files_operations fo ON f.id = fo.file_id AND fo.operation_id = $1
+ORDER BY f.id`,
+		op.ID).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load operation files")
+	}
+	defer rows.Close()
+
+	cuIDs := make(map[int64]bool)
+	for rows.Next() {
+		var fID int64
+		var cuID null.Int64
+		if err := rows.Scan(&fID, &cuID); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		r.FileIDs = append(r.FileIDs, fID)
+		if cuID.Valid && !cuIDs[cuID.Int64] {
+			cuIDs[cuID.Int64] = true
+			r.ContentUnitIDs = append(r.ContentUnitIDs, cuID.Int64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err()")
+	}
+
+	return r, nil
+}
+
+// Operation requests carrying a workflow_id are idempotent by it, per station.
+func (o Operation) IdempotencyKey() string {
+	if strings.TrimSpace(o.WorkflowID) == "" {
+		return ""
+	}
+	return o.Station + ":" + o.WorkflowID
+}
+
+type idempotentRequest interface {
+	IdempotencyKey() string
+}
+
+type idempotencyRecord struct {
+	RequestHash string    `boil:"request_hash"`
+	Response    null.JSON `boil:"response"`
+}
+
+// idempotencyKey returns the key of a request, if any
+func idempotencyKey(c *gin.Context, input interface{}) (string, error) {
+	key := strings.TrimSpace(c.GetHeader(IDEMPOTENCY_KEY_HEADER))
+	if key == "" {
+		if r, ok := input.(idempotentRequest); ok {
+			key = strings.TrimSpace(r.IdempotencyKey())
+		}
+	}
+	if len(key) > IDEMPOTENCY_KEY_MAX_LENGTH {
+		return "", errors.Errorf("Idempotency key is longer than %d", IDEMPOTENCY_KEY_MAX_LENGTH)
+	}
+	return key, nil
+}
+
+func hashRequest(input interface{}) (string, error) {
+	b, err := json.Marshal(input)
+	if err != nil {
+		return "", errors.Wrap(err, "json.Marshal")
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Lookup the recorded response of a request, if any.
+// A key reused with a different payload is a conflict.
+func recordedResponse(exec boil.Executor, endpoint, key, reqHash string) (null.JSON, *HttpError) {
+	record, err := findIdempotencyRecord(exec, endpoint, key)
+	if err != nil {
+		return null.JSON{}, NewInternalError(err)
+	}
+	if record == nil {
+		return null.JSON{}, nil
+	}
+	if record.RequestHash != reqHash {
+		return null.JSON{}, NewConflictError(IdempotencyKeyConflict{Key: key})
+	}
+	return record.Response, nil
+}
+
+// Lookup a live record for the given key.
+// Concurrent requests with the same key wait for each other until the end of the transaction.
+func findIdempotencyRecord(exec boil.Executor, endpoint, key string) (*idempotencyRecord, error) {
+	_, err := queries.Raw(exec, "SELECT pg_advisory_xact_lock(hashtext($1))", endpoint+":"+key).Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "Lock idempotency key")
+	}
+
+	var r idempotencyRecord
+	err = queries.Raw(exec,
+		`SELECT request_hash, response FROM operations_idempotency
+WHERE endpoint = $1 AND key = $2 AND expires_at > now_utc()`,
+		endpoint, key).Bind(&r)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Lookup idempotency key")
+	}
+
+	return &r, nil
+}
+
+func saveIdempotencyRecord(exec boil.Executor, endpoint, key, reqHash string,
+	op *models.Operation, response interface{}) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	var opID null.Int64
+	if op != nil {
+		opID = null.Int64From(op.ID)
+	}
+
+	_, err = queries.Raw(exec, "DELETE FROM operations_idempotency WHERE expires_at <= now_utc()").Exec()
+	if err != nil {
+		return errors.Wrap(err, "Delete expired idempotency keys")
+	}
+
+	_, err = queries.Raw(exec,
+		`INSERT INTO operations_idempotency (endpoint, key, request_hash, operation_id, response, expires_at)
+VALUES ($1, $2, $3, $4, $5, now_utc() + $6::BIGINT * INTERVAL '1 second')`,
+		endpoint, key, reqHash, opID, b, int64(IdempotencyKeyTTL.Seconds())).Exec()
+	if err != nil {
+		return errors.Wrap(err, "Save idempotency key")
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	main := CaptureStartRequest{
+		Operation:     Operation{Station: "main", User: "operator@dev.com", WorkflowID: "c12356789"},
+		CaptureSource: "mltcap",
+	}
+	backup := main
+	backup.Operation.Station = "backup"
+	backup.CaptureSource = "mltbackup"
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodPost, "/operations/capture_start", nil)
+
+	mainKey, err := idempotencyKey(c, main)
+	assert.Nil(t, err)
+	assert.Equal(t, "main:c12356789", mainKey, "workflow_id")
+
+	backupKey, err := idempotencyKey(c, backup)
+	assert.Nil(t, err)
+	assert.NotEqual(t, mainKey, backupKey, "backup station")
+
+	// same station and workflow_id with a different payload keeps the key, its hash tells the conflict
+	other := main
+	other.CaptureSource = "other"
+	otherKey, err := idempotencyKey(c, other)
+	assert.Nil(t, err)
+	assert.Equal(t, mainKey, otherKey, "different payload")
+
+	main.Operation.WorkflowID = " "
+	key, err := idempotencyKey(c, main)
+	assert.Nil(t, err)
+	assert.Empty(t, key, "no workflow_id")
+
+	c.Request.Header.Set(IDEMPOTENCY_KEY_HEADER, "key")
+	key, err = idempotencyKey(c, backup)
+	assert.Nil(t, err)
+	assert.Equal(t, "key", key, "header")
+
+	c.Request.Header.Set(IDEMPOTENCY_KEY_HEADER, strings.Repeat("k", IDEMPOTENCY_KEY_MAX_LENGTH+1))
+	_, err = idempotencyKey(c, backup)
+	assert.NotNil(t, err, "key too long")
+}
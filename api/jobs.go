@@ -0,0 +1,539 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Jobs are units of background work on files, such as transcoding, done by external workers.
+//
+// Workers claim the next queued job, holding a lease on it which they extend with heartbeats.
+// Jobs are concluded by the worker, or by the operation reporting their result (see handleTranscode).
+// Failed attempts are retried with a backoff until max_attempts, as are jobs whose lease has expired.
+
+const (
+	PERM_JOBS = "jobs"
+
+	JOB_TRANSCODE = "transcode"
+	JOB_CONVERT   = "convert"
+
+	JOB_QUEUED  = "queued"
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_FAILED  = "failed"
+
+	// predefined selections of files to enqueue jobs for
+	JOB_SELECTION_LEGACY_VIDEO = "legacy_video"
+
+	JOB_DEFAULT_MAX_ATTEMPTS = 3
+)
+
+var JOB_TYPES = map[string]bool{
+	JOB_TRANSCODE: true,
+	JOB_CONVERT:   true,
+}
+
+var (
+	JobLeaseDuration = 10 * time.Minute
+	JobRetryBackoff  = 5 * time.Minute
+)
+
+var JOB_COLUMNS = []string{"id", "type", "file_id",
+	"(SELECT uid FROM files WHERE id = jobs.file_id) AS file_uid",
+	"(SELECT name FROM files WHERE id = jobs.file_id) AS file_name",
+	"params", "state", "priority", "attempts", "max_attempts", "run_at", "worker", "lease_expires_at",
+	"error", "result", "operation_id", "created_at", "updated_at", "started_at", "finished_at"}
+
+func JobsHandler(c *gin.Context) {
+	var err *HttpError
+	var resp interface{}
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		var r JobsRequest
+		if c.Bind(&r) != nil {
+			return
+		}
+
+		resp, err = handleJobsList(c, c.MustGet("MDB").(*sql.DB), r)
+	case http.MethodPost:
+		var r EnqueueJobsRequest
+		if c.BindJSON(&r) != nil {
+			return
+		}
+
+		tx := mustBeginTx(c)
+		resp, err = handleEnqueueJobs(c, tx, r)
+		mustConcludeTx(tx, err)
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func JobHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleGetJob(c, c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, resp, err)
+}
+
+func ClaimJobHandler(c *gin.Context) {
+	var r ClaimJobRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleClaimJob(c, tx, r)
+	mustConcludeTx(tx, err)
+
+	if err == nil && resp == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	concludeRequest(c, resp, err)
+}
+
+func JobHeartbeatHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var r JobHeartbeatRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleJobHeartbeat(c, tx, id, r)
+	mustConcludeTx(tx, err)
+	concludeRequest(c, resp, err)
+}
+
+func CompleteJobHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var r CompleteJobRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleCompleteJob(c, tx, id, r)
+	mustConcludeTx(tx, err)
+	concludeRequest(c, resp, err)
+}
+
+func handleJobsList(cp utils.ContextProvider, exec boil.Executor, r JobsRequest) (*JobsResponse, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	mods := []qm.QueryMod{qm.From("jobs")}
+
+	// filters
+	if len(r.States) > 0 {
+		mods = append(mods, qm.Where("state = ANY(?)", pq.Array(r.States)))
+	}
+	if len(r.Types) > 0 {
+		mods = append(mods, qm.Where("type = ANY(?)", pq.Array(r.Types)))
+	}
+	if r.FileID != 0 {
+		mods = append(mods, qm.Where("file_id = ?", r.FileID))
+	}
+
+	// count query
+	var total int64
+	countMods := append([]qm.QueryMod{qm.Select("count(DISTINCT id)")}, mods...)
+	err := models.NewQuery(exec, countMods...).QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return NewJobsResponse(), nil
+	}
+
+	// order, limit, offset
+	if err = appendListMods(&mods, r.ListRequest, JOB_SORT_FIELDS); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// data query
+	mods = append(mods, qm.Select(JOB_COLUMNS...))
+	data := make([]*Job, 0)
+	if err := models.NewQuery(exec, mods...).Bind(&data); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &JobsResponse{
+		ListResponse: ListResponse{Total: total},
+		Jobs:         data,
+	}, nil
+}
+
+func handleGetJob(cp utils.ContextProvider, exec boil.Executor, id int64) (*Job, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	job, err := loadJob(exec, id, false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		}
+		return nil, NewInternalError(err)
+	}
+
+	return job, nil
+}
+
+func handleEnqueueJobs(cp utils.ContextProvider, exec boil.Executor, r EnqueueJobsRequest) (*EnqueueJobsResponse, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	if !JOB_TYPES[r.Type] {
+		return nil, NewBadRequestError(errors.Errorf("Unknown job type %s", r.Type))
+	}
+	if (len(r.FileIDs) == 0) == (r.Selection == "") {
+		return nil, NewBadRequestError(errors.New("Expecting either file_ids or selection"))
+	}
+
+	var candidates string
+	var args []interface{}
+	switch r.Selection {
+	case "":
+		candidates = `SELECT DISTINCT id FROM files WHERE id = ANY($1) AND removed_at IS NULL`
+		args = []interface{}{pq.Array(r.FileIDs)}
+	case JOB_SELECTION_LEGACY_VIDEO:
+		candidates = LEGACY_VIDEO_FILES_SQL
+		for _, ext := range []string{"mp4", "wmv", "flv"} {
+			mt, ok := MEDIA_TYPE_REGISTRY.ByExtension[ext]
+			if !ok {
+				return nil, NewInternalError(errors.Errorf("Unknown media type %s", ext))
+			}
+			args = append(args, mt.MimeType)
+		}
+	default:
+		return nil, NewBadRequestError(errors.Errorf("Unknown selection %s", r.Selection))
+	}
+
+	params := r.Params
+	if !params.Valid && r.Type == JOB_TRANSCODE {
+		params = null.JSONFrom([]byte(`{"format":"mp4"}`))
+	}
+	maxAttempts := r.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = JOB_DEFAULT_MAX_ATTEMPTS
+	}
+
+	// job fields follow the arguments of the candidates query
+	n := len(args)
+	args = append(args, r.Type, params, r.Priority, maxAttempts)
+	q := fmt.Sprintf(`WITH candidates AS (%s),
+inserted AS (
+  INSERT INTO jobs (type, file_id, params, priority, max_attempts)
+  SELECT $%d::text, id, $%d::jsonb, $%d::int, $%d::int
+  FROM candidates
+  ON CONFLICT DO NOTHING
+  RETURNING id)
+SELECT (SELECT count(*) FROM candidates), (SELECT count(*) FROM inserted)`, candidates, n+1, n+2, n+3, n+4)
+
+	var total int64
+	resp := new(EnqueueJobsResponse)
+	if err := exec.QueryRow(q, args...).Scan(&total, &resp.Queued); err != nil {
+		return nil, NewInternalError(errors.Wrap(err, "Insert jobs"))
+	}
+	if r.Selection == "" && total != int64(len(uniqueInt64(r.FileIDs))) {
+		return nil, NewBadRequestError(errors.New("Unknown or removed files in file_ids"))
+	}
+	resp.Skipped = total - resp.Queued
+
+	log.Infof("Queued %d %s jobs, skipped %d", resp.Queued, r.Type, resp.Skipped)
+
+	return resp, nil
+}
+
+// Legacy video files are wmv and flv files with no mp4 (or for wmv, flv) of the same name
+// in their content unit, and which were not converted already (have no video children).
+// args:
+// 1 mp4 mime type
+// 2 wmv mime type
+// 3 flv mime type
+const LEGACY_VIDEO_FILES_SQL = `
+SELECT f.id FROM files f
+WHERE f.type = 'video' AND f.mime_type IN ($2, $3) AND f.sha1 IS NOT NULL
+  AND f.content_unit_id IS NOT NULL AND f.removed_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM files c
+                  WHERE c.parent_id = f.id AND c.type = 'video' AND c.mime_type IN ($1, $2, $3))
+  AND NOT EXISTS (SELECT 1 FROM files s
+                  WHERE s.content_unit_id = f.content_unit_id AND s.id <> f.id AND s.sha1 IS NOT NULL
+                    AND regexp_replace(s.name, '\.[^.]*$', '') = regexp_replace(f.name, '\.[^.]*$', '')
+                    AND (s.mime_type = $1 OR (f.mime_type = $2 AND s.mime_type = $3)))`
+
+func handleClaimJob(cp utils.ContextProvider, exec boil.Executor, r ClaimJobRequest) (*Job, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	if err := reapExpiredJobs(exec); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	lease := JobLeaseDuration
+	if r.Lease > 0 {
+		lease = time.Duration(r.Lease) * time.Second
+	}
+
+	// omitted types are sent as NULL, not as an empty array
+	q := `UPDATE jobs SET state = $1, worker = $2, attempts = attempts + 1,
+  lease_expires_at = now_utc() + $3::int * interval '1 second', started_at = now_utc(), updated_at = now_utc()
+WHERE id = (SELECT id FROM jobs
+            WHERE state = $4 AND run_at <= now_utc() AND (coalesce(cardinality($5::text[]), 0) = 0 OR type = ANY($5))
+            ORDER BY priority DESC, run_at, id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED)
+RETURNING id`
+	var id int64
+	err := exec.QueryRow(q, JOB_RUNNING, r.Worker, int64(lease.Seconds()), JOB_QUEUED, pq.Array(r.Types)).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, NewInternalError(errors.Wrap(err, "Claim job"))
+	}
+
+	log.Infof("Job %d claimed by %s", id, r.Worker)
+
+	job, err := loadJob(exec, id, false)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return job, nil
+}
+
+func handleJobHeartbeat(cp utils.ContextProvider, exec boil.Executor, id int64, r JobHeartbeatRequest) (*Job, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	job, hErr := loadWorkerJob(exec, id, r.Worker)
+	if hErr != nil {
+		return nil, hErr
+	}
+	if job.State != JOB_RUNNING {
+		return nil, NewConflictError(errors.Errorf("Job is %s", job.State))
+	}
+
+	lease := JobLeaseDuration
+	if r.Lease > 0 {
+		lease = time.Duration(r.Lease) * time.Second
+	}
+
+	_, err := exec.Exec(`UPDATE jobs SET lease_expires_at = now_utc() + $1::int * interval '1 second', updated_at = now_utc()
+WHERE id = $2`, int64(lease.Seconds()), id)
+	if err != nil {
+		return nil, NewInternalError(errors.Wrap(err, "Extend lease"))
+	}
+
+	job, err = loadJob(exec, id, false)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return job, nil
+}
+
+func handleCompleteJob(cp utils.ContextProvider, exec boil.Executor, id int64, r CompleteJobRequest) (*Job, *HttpError) {
+	if !can(cp, PERM_JOBS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	job, hErr := loadWorkerJob(exec, id, r.Worker)
+	if hErr != nil {
+		return nil, hErr
+	}
+
+	switch job.State {
+	case JOB_RUNNING:
+	case JOB_DONE, JOB_FAILED:
+		// already concluded by the operation reporting its result
+		return job, nil
+	default:
+		return nil, NewConflictError(errors.Errorf("Job is %s", job.State))
+	}
+
+	if r.OperationUID != "" {
+		operation, err := models.Operations(exec, qm.Where("uid = ?", r.OperationUID)).One()
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, NewBadRequestError(errors.Errorf("Unknown operation %s", r.OperationUID))
+			}
+			return nil, NewInternalError(err)
+		}
+		job.OperationID = null.Int64From(operation.ID)
+	}
+
+	if !r.Success && r.Error == "" {
+		r.Error = "unknown error"
+	}
+	if err := concludeJob(exec, job, r.Error, r.Result); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	job, err := loadJob(exec, id, false)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return job, nil
+}
+
+// loadJob loads a job, optionally locking it for update
+func loadJob(exec boil.Executor, id int64, lock bool) (*Job, error) {
+	mods := []qm.QueryMod{qm.Select(JOB_COLUMNS...), qm.From("jobs"), qm.Where("id = ?", id)}
+	if lock {
+		mods = append(mods, qm.For("UPDATE"))
+	}
+
+	job := new(Job)
+	if err := models.NewQuery(exec, mods...).Bind(job); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "Load job %d", id)
+	}
+
+	return job, nil
+}
+
+// loadWorkerJob loads a job for update by the worker holding it
+func loadWorkerJob(exec boil.Executor, id int64, worker string) (*Job, *HttpError) {
+	job, err := loadJob(exec, id, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		}
+		return nil, NewInternalError(err)
+	}
+
+	if job.Worker.String != worker {
+		return nil, NewConflictError(errors.Errorf("Job is held by %s", job.Worker.String))
+	}
+
+	return job, nil
+}
+
+// concludeJob ends the current attempt of a running job, a failure if errMsg is not empty.
+// Failed jobs are queued again after a backoff until they run out of attempts.
+func concludeJob(exec boil.Executor, job *Job, errMsg string, result null.JSON) error {
+	state := JOB_DONE
+	runAt := job.RunAt
+	if errMsg != "" {
+		if job.Attempts < job.MaxAttempts {
+			state = JOB_QUEUED
+			runAt = time.Now().UTC().Add(time.Duration(job.Attempts*job.Attempts) * JobRetryBackoff)
+		} else {
+			state = JOB_FAILED
+		}
+	}
+
+	var finishedAt null.Time
+	if state != JOB_QUEUED {
+		finishedAt = null.TimeFrom(time.Now().UTC())
+	}
+
+	_, err := exec.Exec(`UPDATE jobs SET state = $1, run_at = $2, error = $3, result = $4, operation_id = $5,
+  worker = CASE WHEN $1 = 'queued' THEN NULL ELSE worker END, lease_expires_at = NULL,
+  finished_at = $6, updated_at = now_utc()
+WHERE id = $7`,
+		state, runAt, null.NewString(errMsg, errMsg != ""), result, job.OperationID, finishedAt, job.ID)
+	if err != nil {
+		return errors.Wrapf(err, "Conclude job %d", job.ID)
+	}
+
+	log.Infof("Job %d attempt %d/%d: %s", job.ID, job.Attempts, job.MaxAttempts, state)
+
+	return nil
+}
+
+// reapExpiredJobs fails the current attempt of running jobs whose lease has expired
+func reapExpiredJobs(exec boil.Executor) error {
+	res, err := exec.Exec(`UPDATE jobs SET
+  state = CASE WHEN attempts < max_attempts THEN 'queued' ELSE 'failed' END,
+  finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE now_utc() END,
+  error = 'lease expired', worker = NULL, lease_expires_at = NULL, updated_at = now_utc()
+WHERE state = 'running' AND lease_expires_at < now_utc()`)
+	if err != nil {
+		return errors.Wrap(err, "Reap expired jobs")
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Infof("Reaped %d jobs with expired leases", n)
+	}
+
+	return nil
+}
+
+// linkJobOperation concludes the running job on a file with the operation carrying it out,
+// a failure if errMsg is not empty. Operations not run by a job worker are left alone.
+func linkJobOperation(exec boil.Executor, jobType string, fileID int64, operation *models.Operation, errMsg string) error {
+	var id int64
+	err := exec.QueryRow(`SELECT id FROM jobs WHERE type = $1 AND file_id = $2 AND state = $3`,
+		jobType, fileID, JOB_RUNNING).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return errors.Wrap(err, "Lookup job")
+	}
+
+	job, err := loadJob(exec, id, true)
+	if err != nil {
+		return err
+	}
+	if job.State != JOB_RUNNING {
+		return nil // concluded in the meantime
+	}
+
+	log.Infof("Linking operation %d to job %d", operation.ID, job.ID)
+	job.OperationID = null.Int64From(operation.ID)
+	return concludeJob(exec, job, errMsg, job.Result)
+}
+
+func uniqueInt64(x []int64) []int64 {
+	seen := make(map[int64]bool, len(x))
+	res := make([]int64, 0, len(x))
+	for _, v := range x {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
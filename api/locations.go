@@ -0,0 +1,239 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/storage"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Locations of a file are its copies in storages, and the URL it was published at, if any.
+// URLs of storage copies come from per storage templates, keyed by (lower case) storage name.
+// The "*" template applies to storages with no template of their own.
+// Templates may reference {id}, {uid}, {sha1}, {name}, {storage}, {country} and {location}.
+//
+// URLs of files which are not public are signed with an expiry, for the file servers to verify:
+// expires=<unix time>&signature=<hex of HMAC-SHA256(DownloadLinkSecret, path + "\n" + expires)>.
+// Without a secret we can't sign, so such files have no URLs. Neither do callers who may read them
+// only through a domain, the signed links are valid for anyone holding them.
+//
+// Copies in the caller's country are ranked first. The country is taken from CountryHeader, set by the proxy
+// in front of us, falling back to the country query parameter. Either way it's a hint for ranking only,
+// it has no bearing on which locations and URLs are returned.
+
+const ACCESS_PUBLIC = "public"
+
+var (
+	StorageURLTemplates = make(map[string]string)
+	DownloadLinkSecret  []byte
+	DownloadLinkTTL     = time.Hour
+	CountryHeader       string // e.g. CF-IPCountry, empty if the proxy doesn't tell
+)
+
+func FileLocationsHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var r FileLocationsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+	if CountryHeader != "" {
+		if x := c.GetHeader(CountryHeader); len(x) == 2 {
+			r.Country = x
+		}
+	}
+
+	resp, err := handleFileLocations(c, c.MustGet("MDB").(*sql.DB), id, r)
+	concludeRequest(c, resp, err)
+}
+
+func handleFileLocations(cp utils.ContextProvider, exec boil.Executor, id int64, r FileLocationsRequest) ([]*FileLocation, *HttpError) {
+	file, err := models.FindFile(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	if file.RemovedAt.Valid {
+		return nil, NewNotFoundError()
+	}
+
+	// check object level permissions
+	if !canFile(cp, exec, file, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	storages, err := models.Storages(exec,
+		qm.InnerJoin("files_storages fs on fs.storage_id=id and fs.file_id = ?", id)).
+		All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	// readers through a domain only don't get signed links
+	sign := allowedRead(cp) >= file.Secure
+	now := time.Now().UTC()
+	locations := make([]*FileLocation, 0, len(storages)+1)
+
+	// published copy, see handleUpload
+	if file.Properties.Valid {
+		var props map[string]interface{}
+		if err := file.Properties.Unmarshal(&props); err != nil {
+			return nil, NewInternalError(errors.Wrap(err, "json.Unmarshal properties"))
+		}
+		if u, ok := props["url"].(string); ok && u != "" {
+			l := &FileLocation{
+				Status: storage.STATUS_ONLINE,
+				Access: ACCESS_PUBLIC,
+			}
+			if err := setLocationURL(l, file, u, sign, now); err != nil {
+				return nil, NewInternalError(err)
+			}
+			locations = append(locations, l)
+		}
+	}
+
+	for i := range storages {
+		s := storages[i]
+		l := &FileLocation{
+			Storage: s,
+			Status:  s.Status,
+			Access:  s.Access,
+			Country: s.Country,
+		}
+		if u := storageURL(s, file); u != "" {
+			if err := setLocationURL(l, file, u, sign, now); err != nil {
+				return nil, NewInternalError(err)
+			}
+		}
+		locations = append(locations, l)
+	}
+
+	sortLocations(locations, strings.ToUpper(r.Country))
+
+	return locations, nil
+}
+
+func setLocationURL(l *FileLocation, file *models.File, u string, sign bool, now time.Time) error {
+	if file.Secure == SEC_PUBLIC {
+		l.URL = u
+		return nil
+	}
+
+	if !sign || len(DownloadLinkSecret) == 0 {
+		return nil
+	}
+
+	expiresAt := now.Add(DownloadLinkTTL)
+	signed, err := signURL(u, expiresAt)
+	if err != nil {
+		return errors.Wrapf(err, "Sign %s", u)
+	}
+	l.URL = signed
+	l.ExpiresAt = &expiresAt
+
+	return nil
+}
+
+func storageURL(s *models.Storage, file *models.File) string {
+	tmpl, ok := StorageURLTemplates[strings.ToLower(s.Name)]
+	if !ok {
+		tmpl, ok = StorageURLTemplates["*"]
+	}
+	if !ok || tmpl == "" {
+		return ""
+	}
+
+	return strings.NewReplacer(
+		"{id}", strconv.FormatInt(file.ID, 10),
+		"{uid}", file.UID,
+		"{sha1}", hex.EncodeToString(file.Sha1.Bytes),
+		"{name}", url.PathEscape(file.Name),
+		"{storage}", url.PathEscape(s.Name),
+		"{country}", strings.ToLower(s.Country),
+		"{location}", url.PathEscape(s.Location),
+	).Replace(tmpl)
+}
+
+func signURL(u string, expiresAt time.Time) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	q := parsed.Query()
+	q.Set("expires", expires)
+	q.Set("signature", urlSignature(parsed.EscapedPath(), expires))
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String(), nil
+}
+
+func urlSignature(path, expires string) string {
+	mac := hmac.New(sha256.New, DownloadLinkSecret)
+	fmt.Fprintf(mac, "%s\n%s", path, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sortLocations ranks locations by status, access and then those in the caller's country.
+// Locations with URLs come before those without.
+func sortLocations(locations []*FileLocation, country string) {
+	rank := func(l *FileLocation) []int {
+		var status int
+		switch l.Status {
+		case storage.STATUS_ONLINE:
+			status = 0
+		case storage.STATUS_NEARLINE:
+			status = 1
+		case storage.STATUS_OFFLINE:
+			status = 2
+		default:
+			status = 3
+		}
+
+		x := []int{status, 1, 1, 1}
+		if l.Access == ACCESS_PUBLIC {
+			x[1] = 0
+		}
+		if country != "" && strings.ToUpper(l.Country) == country {
+			x[2] = 0
+		}
+		if l.URL != "" {
+			x[3] = 0
+		}
+		return x
+	}
+
+	sort.SliceStable(locations, func(i, j int) bool {
+		ri, rj := rank(locations[i]), rank(locations[j])
+		for k := range ri {
+			if ri[k] != rj[k] {
+				return ri[k] < rj[k]
+			}
+		}
+		return false
+	})
+}
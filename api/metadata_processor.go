@@ -39,6 +39,23 @@ func ProcessCITMetadata(exec boil.Executor, metadata CITMetadata, original, prox
 // 	11. Associate unit and derived units
 // 	12. Set default permissions ?!
 func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models.File, cu *models.ContentUnit) ([]events.Event, error) {
+	originalBefore, proxyBefore := *original, *proxy
+
+	evnts, err := processMetadata(exec, metadata, original, proxy, cu)
+	if err != nil {
+		return nil, err
+	}
+
+	// update events of original and proxy are made once all their changes are in
+	evnts[0] = events.FileUpdateEvent(original).WithDiff(&originalBefore, original)
+	evnts[1] = events.FileUpdateEvent(proxy).WithDiff(&proxyBefore, proxy)
+
+	return evnts, nil
+}
+
+// processMetadata does the work of doProcess.
+// The first two events are placeholders for those of original and proxy.
+func processMetadata(exec boil.Executor, metadata CITMetadata, original, proxy *models.File, cu *models.ContentUnit) ([]events.Event, error) {
 	isUpdate := cu != nil
 	log.Infof("Processing CITMetadata, isUpdate: %t", isUpdate)
 
@@ -67,8 +84,6 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 	}
 
 	evnts := make([]events.Event, 2)
-	evnts[0] = events.FileUpdateEvent(original)
-	evnts[1] = events.FileUpdateEvent(proxy)
 
 	// Update language of original.
 	// TODO: What about proxy !?
@@ -177,6 +192,10 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 			ancestors = append(ancestors, proxy.R.Parent)
 		}
 
+		befores := make([]models.File, len(ancestors))
+		for i := range ancestors {
+			befores[i] = *ancestors[i]
+		}
 		err = cu.AddFiles(exec, false, ancestors...)
 		if err != nil {
 			return nil, errors.Wrap(err, "Add ancestors to unit")
@@ -184,7 +203,7 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 		log.Infof("Added %d ancestors", len(ancestors))
 		for i := range ancestors {
 			x := ancestors[i]
-			evnts = append(evnts, events.FileUpdateEvent(x))
+			evnts = append(evnts, events.FileUpdateEvent(x).WithDiff(&befores[i], x))
 			log.Infof("%s [%d]", x.Name, x.ID)
 		}
 	}
@@ -288,7 +307,7 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 		log.Infof("Specific collection %s", metadata.CollectionUID.String)
 
 		// find collection
-		c, err := models.Collections(exec, qm.Where("uid = ?", metadata.CollectionUID.String)).One()
+		c, err := models.Collections(exec, qm.Where("uid = ? AND removed_at IS NULL", metadata.CollectionUID.String)).One()
 		if err != nil {
 			if err == sql.ErrNoRows {
 				log.Warnf("No such collection %s", metadata.CollectionUID.String)
@@ -368,6 +387,7 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 				} else if ct == CT_FULL_LESSON {
 					// Update collection properties to those of full lesson
 					log.Info("Full lesson, overriding collection properties")
+					before := *c
 					if c.TypeID != CONTENT_TYPE_REGISTRY.ByName[cct].ID {
 						log.Infof("Full lesson, content_type changed to %s", cct)
 						c.TypeID = CONTENT_TYPE_REGISTRY.ByName[cct].ID
@@ -381,7 +401,7 @@ func doProcess(exec boil.Executor, metadata CITMetadata, original, proxy *models
 					if err != nil {
 						return nil, err
 					}
-					evnts = append(evnts, events.CollectionUpdateEvent(c))
+					evnts = append(evnts, events.CollectionUpdateEvent(c).WithDiff(&before, c))
 				}
 
 				// Associate unit to collection
@@ -644,7 +664,7 @@ We should:
 
 */
 func ProcessCITMetadataUpdate(exec boil.Executor, metadata CITMetadata, original, proxy *models.File) ([]events.Event, error) {
-	unit, err := models.ContentUnits(exec, qm.Where("uid = ?", metadata.UnitToFixUID.String)).One()
+	unit, err := models.ContentUnits(exec, qm.Where("uid = ? AND removed_at IS NULL", metadata.UnitToFixUID.String)).One()
 	if err != nil {
 		return nil, errors.Wrapf(err, "lookup unit UID %s", metadata.UnitToFixUID.String)
 	}
@@ -10,7 +10,10 @@ import (
 	"github.com/volatiletech/sqlboiler/types"
 	"gopkg.in/volatiletech/null.v6"
 
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/media"
 	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/permissions"
 )
 
 type (
@@ -47,8 +50,9 @@ type (
 
 	AVFile struct {
 		File
-		Duration  float64 `json:"duration"`
-		VideoSize string  `json:"video_size"`
+		Duration  float64                `json:"duration"`
+		VideoSize string                 `json:"video_size"`
+		FFprobe   *media.FFprobeMetadata `json:"ffprobe,omitempty"` // ffprobe -show_format -show_streams output
 	}
 
 	CITMetadataMajor struct {
@@ -172,11 +176,14 @@ type (
 		PageSize   int    `json:"page_size" form:"page_size" binding:"omitempty,min=1"`
 		StartIndex int    `json:"start_index" form:"start_index" binding:"omitempty,min=1"`
 		StopIndex  int    `json:"stop_index" form:"stop_index" binding:"omitempty,min=1"`
-		OrderBy    string `json:"order_by" form:"order_by" binding:"omitempty"`
+		OrderBy    string `json:"order_by" form:"order_by" binding:"omitempty"`       // e.g. -film_date,name
+		Language   string `json:"language" form:"language" binding:"omitempty,len=2"` // of i18n sort fields
+		Cursor     string `json:"cursor" form:"cursor" binding:"omitempty"`           // next_cursor of the previous page
 	}
 
 	ListResponse struct {
-		Total int64 `json:"total"`
+		Total      int64  `json:"total"`
+		NextCursor string `json:"next_cursor,omitempty"`
 	}
 
 	IDsFilter struct {
@@ -212,6 +219,10 @@ type (
 		Tags []int64 `json:"tags" form:"tag" binding:"omitempty"`
 	}
 
+	CollectionFilter struct {
+		Collection int64 `json:"collection" form:"collection" binding:"omitempty,min=1"`
+	}
+
 	SearchTermFilter struct {
 		Query string `json:"query" form:"query" binding:"omitempty"`
 	}
@@ -229,6 +240,18 @@ type (
 		Published string `json:"published" form:"published" binding:"omitempty"`
 	}
 
+	// Technical metadata of media files, any of their streams matches
+	MediaFilter struct {
+		Codecs         []string `json:"codecs" form:"codec" binding:"omitempty"`
+		MinHeight      int      `json:"min_height" form:"min_height" binding:"omitempty,min=1"`
+		MaxHeight      int      `json:"max_height" form:"max_height" binding:"omitempty,min=1"`
+		AudioLanguages []string `json:"audio_languages" form:"audio_language" binding:"omitempty"`
+	}
+
+	RemovedFilter struct {
+		Removed string `json:"removed" form:"removed" binding:"omitempty"`
+	}
+
 	CollectionsRequest struct {
 		ListRequest
 		IDsFilter
@@ -237,6 +260,7 @@ type (
 		DateRangeFilter
 		SecureFilter
 		PublishedFilter
+		RemovedFilter
 		SearchTermFilter
 	}
 
@@ -253,8 +277,10 @@ type (
 		DateRangeFilter
 		SecureFilter
 		PublishedFilter
+		RemovedFilter
 		SourcesFilter
 		TagsFilter
+		CollectionFilter
 		SearchTermFilter
 	}
 
@@ -272,6 +298,7 @@ type (
 		SecureFilter
 		PublishedFilter
 		SearchTermFilter
+		MediaFilter
 	}
 
 	FilesResponse struct {
@@ -279,6 +306,12 @@ type (
 		Files []*MFile `json:"data"`
 	}
 
+	// Ancestors and descendants of a file with their operations by ID
+	FileTreeResponse struct {
+		Files      []*MFile                    `json:"files"`
+		Operations map[int64]*models.Operation `json:"operations"`
+	}
+
 	OperationsRequest struct {
 		ListRequest
 		DateRangeFilter
@@ -323,6 +356,7 @@ type (
 		IDsFilter
 		UIDsFilter
 		PatternsFilter
+		RemovedFilter
 	}
 
 	PersonsResponse struct {
@@ -351,6 +385,186 @@ type (
 		Publishers []*Publisher `json:"data"`
 	}
 
+	EventsRequest struct {
+		Since string   `json:"since" form:"since" binding:"omitempty,len=26"`
+		Types []string `json:"types" form:"types" binding:"omitempty"`
+		Limit int      `json:"limit" form:"limit" binding:"omitempty,min=1"`
+		Wait  int      `json:"wait" form:"wait" binding:"omitempty,min=0,max=60"`
+	}
+
+	EventsResponse struct {
+		Data []events.Event `json:"data"`
+	}
+
+	ContentUnitSplitRequest struct {
+		Units []*ContentUnitSplit `json:"units" binding:"required,min=1,dive"`
+	}
+
+	// A new unit to split from an existing one.
+	// Files, derivations and collection memberships are moved from the existing unit.
+	ContentUnitSplit struct {
+		Files       []int64 `json:"files" binding:"required,min=1"`
+		Derivatives []int64 `json:"derivatives"` // IDs of derived units
+		Origins     []int64 `json:"origins"`     // IDs of source units
+		Collections []int64 `json:"collections"` // IDs of collections
+	}
+
+	ContentUnitsBulkRequest struct {
+		IDs        []int64                      `json:"ids" binding:"required,min=1"`
+		Operations []*ContentUnitsBulkOperation `json:"operations" binding:"required,min=1,dive"`
+		DryRun     bool                         `json:"dry_run"`
+	}
+
+	// A single operation applied to every unit in a bulk request.
+	// ID is the tag, source, person or publisher to add or remove.
+	ContentUnitsBulkOperation struct {
+		Op         string                 `json:"op" binding:"required"`
+		ID         int64                  `json:"id"`
+		RoleID     int64                  `json:"role_id"`
+		Secure     null.Int16             `json:"secure"`
+		Properties map[string]interface{} `json:"properties"` // null values remove the key
+	}
+
+	ContentUnitsBulkResponse struct {
+		DryRun  bool                      `json:"dry_run"`
+		Changes []*ContentUnitBulkChanges `json:"data"`
+	}
+
+	// Indexes of the operations that actually changed the unit
+	ContentUnitBulkChanges struct {
+		ID         int64  `json:"id"`
+		UID        string `json:"uid"`
+		Operations []int  `json:"operations"`
+	}
+
+	SearchRequest struct {
+		ListRequest
+		Query    string   `json:"query" form:"query" binding:"required"`
+		Types    []string `json:"types" form:"types" binding:"omitempty"`
+		Language string   `json:"language" form:"language" binding:"omitempty,len=2"`
+	}
+
+	SearchResponse struct {
+		ListResponse
+		Hits []*SearchHit `json:"data"`
+	}
+
+	// Name and description are highlighted with <em> tags
+	SearchHit struct {
+		Type        string      `boil:"type" json:"type"`
+		ID          int64       `boil:"id" json:"id"`
+		UID         string      `boil:"uid" json:"uid"`
+		Language    string      `boil:"language" json:"language"`
+		Rank        float64     `boil:"rank" json:"rank"`
+		Name        null.String `boil:"name" json:"name"`
+		Description null.String `boil:"description" json:"description,omitempty"`
+	}
+
+	AuditLogRequest struct {
+		ListRequest
+		DateRangeFilter
+		Entity   string `json:"entity" form:"entity" binding:"omitempty"`
+		EntityID int64  `json:"id" form:"id" binding:"omitempty,min=1"`
+		User     string `json:"user" form:"user" binding:"omitempty"`
+	}
+
+	AuditLogResponse struct {
+		ListResponse
+		AuditLog []*AuditLogEntry `json:"data"`
+	}
+
+	JobsRequest struct {
+		ListRequest
+		States []string `json:"states" form:"state" binding:"omitempty"`
+		Types  []string `json:"types" form:"type" binding:"omitempty"`
+		FileID int64    `json:"file_id" form:"file_id" binding:"omitempty,min=1"`
+	}
+
+	JobsResponse struct {
+		ListResponse
+		Jobs []*Job `json:"data"`
+	}
+
+	Job struct {
+		ID             int64       `boil:"id" json:"id"`
+		Type           string      `boil:"type" json:"type"`
+		FileID         int64       `boil:"file_id" json:"file_id"`
+		FileUID        string      `boil:"file_uid" json:"file_uid"`
+		FileName       string      `boil:"file_name" json:"file_name"`
+		Params         null.JSON   `boil:"params" json:"params"`
+		State          string      `boil:"state" json:"state"`
+		Priority       int         `boil:"priority" json:"priority"`
+		Attempts       int         `boil:"attempts" json:"attempts"`
+		MaxAttempts    int         `boil:"max_attempts" json:"max_attempts"`
+		RunAt          time.Time   `boil:"run_at" json:"run_at"`
+		Worker         null.String `boil:"worker" json:"worker"`
+		LeaseExpiresAt null.Time   `boil:"lease_expires_at" json:"lease_expires_at"`
+		Error          null.String `boil:"error" json:"error"`
+		Result         null.JSON   `boil:"result" json:"result"`
+		OperationID    null.Int64  `boil:"operation_id" json:"operation_id"`
+		CreatedAt      time.Time   `boil:"created_at" json:"created_at"`
+		UpdatedAt      time.Time   `boil:"updated_at" json:"updated_at"`
+		StartedAt      null.Time   `boil:"started_at" json:"started_at"`
+		FinishedAt     null.Time   `boil:"finished_at" json:"finished_at"`
+	}
+
+	// Files to queue jobs for, by ID or a predefined selection
+	EnqueueJobsRequest struct {
+		Type        string    `json:"type" binding:"required"`
+		FileIDs     []int64   `json:"file_ids"`
+		Selection   string    `json:"selection"`
+		Params      null.JSON `json:"params"`
+		Priority    int       `json:"priority"`
+		MaxAttempts int       `json:"max_attempts" binding:"omitempty,min=1"`
+	}
+
+	EnqueueJobsResponse struct {
+		Queued  int64 `json:"queued"`
+		Skipped int64 `json:"skipped"` // files with an active job already
+	}
+
+	ClaimJobRequest struct {
+		Worker string   `json:"worker" binding:"required"`
+		Types  []string `json:"types" binding:"omitempty"`
+		Lease  int      `json:"lease" binding:"omitempty,min=1"` // seconds
+	}
+
+	JobHeartbeatRequest struct {
+		Worker string `json:"worker" binding:"required"`
+		Lease  int    `json:"lease" binding:"omitempty,min=1"` // seconds
+	}
+
+	CompleteJobRequest struct {
+		Worker       string    `json:"worker" binding:"required"`
+		Success      bool      `json:"success"`
+		Error        string    `json:"error"`
+		Result       null.JSON `json:"result"`
+		OperationUID string    `json:"operation_uid" binding:"omitempty,len=8"`
+	}
+
+	PermissionRulesRequest struct {
+		PType string `json:"ptype" form:"ptype" binding:"omitempty"`
+		Value string `json:"value" form:"value" binding:"omitempty"` // role, object, action etc.
+	}
+
+	PermissionRulesResponse struct {
+		ListResponse
+		Rules []permissions.PolicyRule `json:"data"`
+	}
+
+	AuditLogEntry struct {
+		ID        int64             `boil:"id" json:"id"`
+		CreatedAt time.Time         `boil:"created_at" json:"created_at"`
+		UserSub   null.String       `boil:"user_sub" json:"user_sub"`
+		UserEmail null.String       `boil:"user_email" json:"user_email"`
+		UserRoles types.StringArray `boil:"user_roles" json:"user_roles"`
+		Endpoint  null.String       `boil:"endpoint" json:"endpoint"`
+		Entity    string            `boil:"entity" json:"entity"`
+		EntityID  int64             `boil:"entity_id" json:"entity_id"`
+		Before    null.JSON         `boil:"before" json:"before"`
+		After     null.JSON         `boil:"after" json:"after"`
+	}
+
 	HierarchyRequest struct {
 		Language string `json:"language" form:"language" binding:"omitempty,len=2"`
 		RootUID  string `json:"root" form:"root" binding:"omitempty,len=8"`
@@ -443,6 +657,21 @@ type (
 		models.Storage
 	}
 
+	FileLocationsRequest struct {
+		Country string `json:"country" form:"country" binding:"omitempty,len=2"` // ranking hint, see CountryHeader
+	}
+
+	// FileLocation is a copy of a file and where to fetch it from.
+	// URL is empty when we don't know how to fetch from that storage.
+	FileLocation struct {
+		Storage   *models.Storage `json:"storage,omitempty"` // nil for the published copy
+		Status    string          `json:"status"`
+		Access    string          `json:"access"`
+		Country   string          `json:"country,omitempty"`
+		URL       string          `json:"url,omitempty"`
+		ExpiresAt *time.Time      `json:"expires_at,omitempty"` // of signed URLs
+	}
+
 	Publisher struct {
 		models.Publisher
 		I18n map[string]*models.PublisherI18n `json:"i18n"`
@@ -521,6 +750,18 @@ func NewPublishersResponse() *PublishersResponse {
 	return &PublishersResponse{Publishers: make([]*Publisher, 0)}
 }
 
+func NewJobsResponse() *JobsResponse {
+	return &JobsResponse{Jobs: make([]*Job, 0)}
+}
+
+func NewAuditLogResponse() *AuditLogResponse {
+	return &AuditLogResponse{AuditLog: make([]*AuditLogEntry, 0)}
+}
+
+func NewSearchResponse() *SearchResponse {
+	return &SearchResponse{Hits: make([]*SearchHit, 0)}
+}
+
 func (mf MaybeFile) AsFile() File {
 	return File{
 		FileName:  mf.FileName,
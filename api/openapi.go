@@ -0,0 +1,599 @@
+package api
+
+import (
+	"encoding/json"
+	"go/ast"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/bindata"
+	"github.com/Bnei-Baruch/mdb/version"
+)
+
+// OpenAPI 3 specification of the API.
+// It's generated from the spec of each route in API_SPECS: JSON schemas are
+// taken from the request and response types, constraints from their binding tags.
+// Every route registered in SetupRoutes must have a spec, see TestOpenAPISpecs.
+
+// RouteSpec describes a single route, keyed by "METHOD /path" in API_SPECS
+type RouteSpec struct {
+	Summary     string
+	Tag         string      // defaults to the resource in the path
+	Query       interface{} // bound from the query string with form tags
+	Body        interface{} // bound from a JSON body
+	Response    interface{} // JSON response, nil if there's none
+	ContentType string      // of a non JSON response
+	Public      bool        // requires no authentication
+}
+
+// oneOf documents a response of either of the given types
+type oneOf []interface{}
+
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Security   []map[string][]string                   `json:"security"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *OpenAPI
+)
+
+func OpenAPIHandler(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = BuildOpenAPI(API_SPECS)
+	})
+	c.JSON(http.StatusOK, openAPIDoc)
+}
+
+// OpenAPIViewerHandler serves a page browsing /openapi.json
+func OpenAPIViewerHandler(c *gin.Context) {
+	b, err := bindata.Asset("data/openapi.html")
+	if err != nil {
+		NewInternalError(errors.Wrap(err, "Load openapi viewer")).Abort(c)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", b)
+}
+
+func BuildOpenAPI(specs map[string]RouteSpec) *OpenAPI {
+	g := &schemaGenerator{schemas: make(map[string]*OpenAPISchema)}
+	g.schemas["Error"] = &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"status": {Type: "string", Enum: []string{"error"}},
+			"error":  {Type: "string"},
+			"errors": {
+				Type:                 "object",
+				Description:          "Validation errors by field",
+				AdditionalProperties: &OpenAPISchema{Type: "string"},
+			},
+		},
+	}
+
+	doc := &OpenAPI{
+		OpenAPI: "3.0.0",
+		Info: OpenAPIInfo{
+			Title:       "MDB",
+			Description: "Metadata DB of the Bnei Baruch archive",
+			Version:     version.Version,
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}},
+		Paths:    make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]*OpenAPISecurityScheme{
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "OIDC ID token or service account API key",
+				},
+			},
+		},
+	}
+
+	for key, spec := range specs {
+		s := strings.SplitN(key, " ", 2)
+		method, route := s[0], s[1]
+
+		p := openAPIPath(route)
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[p][strings.ToLower(method)] = g.operation(method, route, spec)
+	}
+
+	return doc
+}
+
+// openAPIPath converts gin route params, /rest/collections/:id/ to /rest/collections/{id}/
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPIOperationID derives an operation ID from the route, i.e.
+// GET /rest/collections/:id/content_units/ gives getCollectionsByIdContentUnits
+func openAPIOperationID(method, route string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.Split(route, "/") {
+		if s == "" || s == "rest" {
+			continue
+		}
+		if strings.HasPrefix(s, ":") {
+			id += "By" + camelCase(s[1:])
+		} else {
+			id += camelCase(s)
+		}
+	}
+	return id
+}
+
+func camelCase(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '.' })
+	for i := range parts {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func openAPITag(route string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	if segments[0] == "rest" && len(segments) > 1 {
+		return segments[1]
+	}
+	return segments[0]
+}
+
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema // named schemas, by name
+}
+
+func (g *schemaGenerator) operation(method, route string, spec RouteSpec) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		OperationID: openAPIOperationID(method, route),
+		Summary:     spec.Summary,
+		Tags:        []string{spec.Tag},
+		Responses: map[string]*OpenAPIResponse{
+			"default": {
+				Description: "Error",
+				Content: map[string]*OpenAPIMediaType{
+					"application/json": {Schema: &OpenAPISchema{Ref: "#/components/schemas/Error"}},
+				},
+			},
+		},
+	}
+	if spec.Tag == "" {
+		op.Tags = []string{openAPITag(route)}
+	}
+	if spec.Public {
+		op.Security = []map[string][]string{{}}
+	}
+
+	// path params are IDs, except for sha1s
+	for _, s := range strings.Split(route, "/") {
+		if !strings.HasPrefix(s, ":") {
+			continue
+		}
+		schema := &OpenAPISchema{Type: "integer", Format: "int64"}
+		if s == ":sha1" {
+			schema = &OpenAPISchema{Type: "string", Pattern: "^[0-9a-fA-F]{40}$"}
+		}
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{Name: s[1:], In: "path", Required: true, Schema: schema})
+	}
+
+	if spec.Query != nil {
+		for _, f := range formFields(reflect.TypeOf(spec.Query)) {
+			schema := g.schemaOf(f.typ)
+			required := applyBinding(schema, f.tag.Get("binding"))
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{Name: f.name, In: "query", Required: required, Schema: schema})
+		}
+	}
+
+	if spec.Body != nil {
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]*OpenAPIMediaType{
+				"application/json": {Schema: g.schemaOf(reflect.TypeOf(spec.Body))},
+			},
+		}
+	}
+
+	ok := &OpenAPIResponse{Description: "OK"}
+	switch {
+	case spec.ContentType != "":
+		schema := &OpenAPISchema{Type: "string"}
+		if spec.Response != nil {
+			schema = g.schemaOf(reflect.TypeOf(spec.Response))
+		}
+		ok.Content = map[string]*OpenAPIMediaType{spec.ContentType: {Schema: schema}}
+	case spec.Response != nil:
+		ok.Content = map[string]*OpenAPIMediaType{"application/json": {Schema: g.responseSchema(spec.Response)}}
+	}
+	op.Responses["200"] = ok
+
+	return op
+}
+
+func (g *schemaGenerator) responseSchema(resp interface{}) *OpenAPISchema {
+	if alternatives, ok := resp.(oneOf); ok {
+		schema := new(OpenAPISchema)
+		for _, x := range alternatives {
+			schema.OneOf = append(schema.OneOf, g.schemaOf(reflect.TypeOf(x)))
+		}
+		return schema
+	}
+	return g.schemaOf(reflect.TypeOf(resp))
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+	nullPkgPath       = reflect.TypeOf(null.String{}).PkgPath()
+	apiPkgPath        = reflect.TypeOf(RouteSpec{}).PkgPath()
+)
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(Timestamp{}):
+		return &OpenAPISchema{Type: "integer", Format: "int64", Description: "Unix timestamp"}
+	case reflect.TypeOf(Date{}):
+		return &OpenAPISchema{Type: "string", Format: "date"}
+	}
+
+	if t.PkgPath() == nullPkgPath {
+		var schema *OpenAPISchema
+		switch t.Name() {
+		case "JSON":
+			schema = new(OpenAPISchema)
+		case "Bytes":
+			schema = &OpenAPISchema{Type: "string", Format: "byte"}
+		default:
+			schema = g.schemaOf(t.Field(0).Type)
+		}
+		schema.Nullable = true
+		return schema
+	}
+
+	// marshalled in a way of their own
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return new(OpenAPISchema)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		// anonymous and ad hoc types are inlined
+		if t.Name() == "" || !ast.IsExported(t.Name()) {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// register first, types may refer to themselves
+			schema := new(OpenAPISchema)
+			g.schemas[name] = schema
+			*schema = *g.structSchema(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	}
+
+	return new(OpenAPISchema)
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	for _, f := range jsonFields(t) {
+		fSchema := g.schemaOf(f.typ)
+		if applyBinding(fSchema, f.tag.Get("binding")) {
+			schema.Required = append(schema.Required, f.name)
+		}
+		schema.Properties[f.name] = fSchema
+	}
+	return schema
+}
+
+// schemaName qualifies names of types from other packages, e.g. models.Collection vs Collection
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == apiPkgPath {
+		return t.Name()
+	}
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// applyBinding sets the constraints of validator tags on the schema.
+// Returns true if the value is required.
+func applyBinding(schema *OpenAPISchema, binding string) bool {
+	if binding == "" {
+		return false
+	}
+
+	required := false
+	tags := strings.Split(binding, ",")
+	for i, tag := range tags {
+		// the rest applies to each item
+		if tag == "dive" {
+			if schema.Items != nil {
+				applyBinding(schema.Items, strings.Join(tags[i+1:], ","))
+			}
+			break
+		}
+
+		if tag == "required" {
+			required = true
+			continue
+		}
+
+		// can't add constraints to a reference
+		if schema.Ref != "" {
+			continue
+		}
+
+		if strings.Contains(tag, "|") {
+			for _, alt := range strings.Split(tag, "|") {
+				if strings.HasPrefix(alt, "eq=") {
+					schema.Enum = append(schema.Enum, strings.TrimPrefix(alt, "eq="))
+				}
+			}
+			continue
+		}
+
+		kv := strings.SplitN(tag, "=", 2)
+		switch kv[0] {
+		case "email":
+			schema.Format = "email"
+		case "hexadecimal":
+			schema.Pattern = "^[0-9a-fA-F]*$"
+		case "len", "min", "max", "gte", "lte":
+			if len(kv) == 2 {
+				applyLimit(schema, kv[0], kv[1])
+			}
+		}
+	}
+
+	return required
+}
+
+func applyLimit(schema *OpenAPISchema, limit, value string) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	i := int(n)
+
+	lower := limit == "len" || limit == "min" || limit == "gte"
+	upper := limit == "len" || limit == "max" || limit == "lte"
+
+	switch schema.Type {
+	case "string":
+		if lower {
+			schema.MinLength = &i
+		}
+		if upper {
+			schema.MaxLength = &i
+		}
+	case "array":
+		if lower {
+			schema.MinItems = &i
+		}
+		if upper {
+			schema.MaxItems = &i
+		}
+	case "integer", "number":
+		if limit == "len" {
+			return
+		}
+		if lower {
+			schema.Minimum = &n
+		}
+		if upper {
+			schema.Maximum = &n
+		}
+	}
+}
+
+type structField struct {
+	name   string
+	typ    reflect.Type
+	tag    reflect.StructTag
+	depth  int
+	tagged bool
+}
+
+// jsonFields returns the fields of a struct as encoding/json sees them:
+// embedded structs are flattened and shallower fields hide deeper ones of the same name.
+func jsonFields(t reflect.Type) []structField {
+	return dominantFields(walkFields(t, "json", 0, true))
+}
+
+// formFields returns the fields bound from a query string, i.e. those with a form tag
+func formFields(t reflect.Type) []structField {
+	return dominantFields(walkFields(t, "form", 0, false))
+}
+
+func walkFields(t reflect.Type, key string, depth int, untagged bool) []structField {
+	fields := make([]structField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(key)
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, walkFields(ft, key, depth+1, untagged)...)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			if !untagged {
+				continue
+			}
+			name = sf.Name
+		}
+
+		fields = append(fields, structField{name: name, typ: sf.Type, tag: sf.Tag, depth: depth, tagged: tag != ""})
+	}
+	return fields
+}
+
+func dominantFields(fields []structField) []structField {
+	byName := make(map[string][]structField)
+	names := make([]string, 0)
+	for _, f := range fields {
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	dominant := make([]structField, 0, len(names))
+	for _, name := range names {
+		candidates := byName[name]
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].depth < candidates[j].depth
+		})
+
+		top := candidates[:1]
+		for _, f := range candidates[1:] {
+			if f.depth == top[0].depth {
+				top = append(top, f)
+			}
+		}
+		if len(top) > 1 {
+			tagged := make([]structField, 0)
+			for _, f := range top {
+				if f.tagged {
+					tagged = append(tagged, f)
+				}
+			}
+			if len(tagged) != 1 {
+				continue // ambiguous, encoding/json drops these
+			}
+			top = tagged
+		}
+		dominant = append(dominant, top[0])
+	}
+
+	return dominant
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/media"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/permissions"
+)
+
+// Spec of every route in SetupRoutes, see RouteSpec.
+// Keep in sync when adding or changing routes, TestOpenAPISpecs fails otherwise.
+
+// Ad hoc bodies and responses
+type (
+	statusResponse struct {
+		Status string `json:"status"`
+	}
+
+	sourceIDBody struct {
+		SourceID int64 `json:"sourceID" binding:"required"`
+	}
+
+	tagIDBody struct {
+		TagID int64 `json:"tagID" binding:"required"`
+	}
+
+	publisherIDBody struct {
+		PublisherID int64 `json:"publisherID" binding:"required"`
+	}
+)
+
+var API_SPECS = map[string]RouteSpec{
+	// system
+	"GET /health_check":  {Summary: "Check the DB connection", Tag: "health", Response: statusResponse{}, Public: true},
+	"GET /health/live":   {Summary: "Liveness of this instance", Tag: "health", Response: HealthResponse{}, Public: true},
+	"GET /health/ready":  {Summary: "Readiness of this instance and its dependencies", Tag: "health", Response: HealthResponse{}, Public: true},
+	"GET /metrics":       {Summary: "Prometheus metrics", Tag: "health", ContentType: "text/plain", Public: true},
+	"GET /openapi.json":  {Summary: "This specification", Tag: "docs", ContentType: "application/json", Public: true},
+	"GET /openapi":       {Summary: "Browse this specification", Tag: "docs", ContentType: "text/html", Public: true},
+	"GET /events":        {Summary: "Events since a given event", Query: EventsRequest{}, Response: EventsResponse{}},
+	"GET /events/stream": {Summary: "Server-Sent Events stream of events", Query: EventsRequest{}, Response: events.Event{}, ContentType: "text/event-stream"},
+	"GET /hierarchy/sources/": {Summary: "Sources tree, under their authors if no root is given", Query: SourcesHierarchyRequest{},
+		Response: oneOf{[]*AuthorH{}, []*SourceH{}}},
+	"GET /hierarchy/tags/": {Summary: "Tags tree", Query: TagsHierarchyRequest{}, Response: []*TagH{}},
+
+	// operations
+	"POST /operations/capture_start":         {Summary: "Capture of an AV file started", Body: CaptureStartRequest{}, Response: OperationResult{}},
+	"POST /operations/capture_stop":          {Summary: "Capture of an AV file stopped", Body: CaptureStopRequest{}, Response: OperationResult{}},
+	"POST /operations/demux":                 {Summary: "Captured file demuxed to original and proxy", Body: DemuxRequest{}, Response: OperationResult{}},
+	"POST /operations/trim":                  {Summary: "Original and proxy trimmed", Body: TrimRequest{}, Response: OperationResult{}},
+	"POST /operations/send":                  {Summary: "Trimmed files sent to the archive with their metadata", Body: SendRequest{}, Response: OperationResult{}},
+	"POST /operations/convert":               {Summary: "File converted to other formats", Body: ConvertRequest{}, Response: OperationResult{}},
+	"POST /operations/upload":                {Summary: "File uploaded to a public URL", Body: UploadRequest{}, Response: OperationResult{}},
+	"POST /operations/sirtutim":              {Summary: "Sirtutim archive file generated", Body: SirtutimRequest{}, Response: OperationResult{}},
+	"POST /operations/insert":                {Summary: "File inserted to an existing content unit", Body: InsertRequest{}, Response: OperationResult{}},
+	"POST /operations/transcode":             {Summary: "File transcoded, or failed to", Body: TranscodeRequest{}, Response: OperationResult{}},
+	"GET /operations/descendant_units/:sha1": {Summary: "Content units of the descendants of a file", Response: ContentUnitsResponse{}},
+
+	// collections
+	"GET /rest/collections/":                           {Summary: "List collections", Query: CollectionsRequest{}, Response: CollectionsResponse{}},
+	"POST /rest/collections/":                          {Summary: "Create a collection", Body: Collection{}, Response: Collection{}},
+	"GET /rest/collections/:id/":                       {Summary: "Get a collection", Response: Collection{}},
+	"PUT /rest/collections/:id/":                       {Summary: "Update a collection", Body: PartialCollection{}, Response: Collection{}},
+	"DELETE /rest/collections/:id/":                    {Summary: "Remove a collection, it can be restored"},
+	"PUT /rest/collections/:id/i18n/":                  {Summary: "Update translations of a collection", Body: []*models.CollectionI18n{}, Response: Collection{}},
+	"GET /rest/collections/:id/content_units/":         {Summary: "Content units of a collection", Response: []*CollectionContentUnit{}},
+	"POST /rest/collections/:id/content_units/":        {Summary: "Add content units to a collection", Body: []*models.CollectionsContentUnit{}},
+	"PUT /rest/collections/:id/content_units/:cuID":    {Summary: "Update name or position of a content unit in a collection", Body: models.CollectionsContentUnit{}},
+	"DELETE /rest/collections/:id/content_units/:cuID": {Summary: "Remove a content unit from a collection"},
+	"POST /rest/collections/:id/activate":              {Summary: "Toggle the active flag of a collection", Response: Collection{}},
+	"POST /rest/collections/:id/restore":               {Summary: "Restore a removed collection", Response: Collection{}},
+
+	// content units
+	"GET /rest/content_units/":                               {Summary: "List content units", Query: ContentUnitsRequest{}, Response: ContentUnitsResponse{}},
+	"POST /rest/content_units/":                              {Summary: "Create a content unit", Body: ContentUnit{}, Response: ContentUnit{}},
+	"GET /rest/content_units/:id/":                           {Summary: "Get a content unit", Response: ContentUnit{}},
+	"PUT /rest/content_units/:id/":                           {Summary: "Update a content unit", Body: PartialContentUnit{}, Response: ContentUnit{}},
+	"PUT /rest/content_units/:id/i18n/":                      {Summary: "Update translations of a content unit", Body: []*models.ContentUnitI18n{}, Response: ContentUnit{}},
+	"GET /rest/content_units/:id/files/":                     {Summary: "Files of a content unit", Response: []*MFile{}},
+	"POST /rest/content_units/:id/files/":                    {Summary: "Add files, by ID, to a content unit", Body: []int64{}, Response: ContentUnit{}},
+	"GET /rest/content_units/:id/collections/":               {Summary: "Collections of a content unit", Response: []*CollectionContentUnit{}},
+	"GET /rest/content_units/:id/derivatives/":               {Summary: "Content units derived from a content unit", Response: []*ContentUnitDerivation{}},
+	"POST /rest/content_units/:id/derivatives/":              {Summary: "Add a derived content unit", Body: models.ContentUnitDerivation{}, Response: models.ContentUnit{}},
+	"PUT /rest/content_units/:id/derivatives/:duID":          {Summary: "Update the name of a derivation", Body: models.ContentUnitDerivation{}, Response: models.ContentUnit{}},
+	"DELETE /rest/content_units/:id/derivatives/:duID":       {Summary: "Remove a derived content unit", Response: models.ContentUnit{}},
+	"GET /rest/content_units/:id/origins/":                   {Summary: "Content units a content unit is derived from", Response: []*ContentUnitDerivation{}},
+	"GET /rest/content_units/:id/sources/":                   {Summary: "Sources of a content unit", Response: []*Source{}},
+	"POST /rest/content_units/:id/sources/":                  {Summary: "Add a source to a content unit", Body: sourceIDBody{}, Response: models.ContentUnit{}},
+	"DELETE /rest/content_units/:id/sources/:sourceID":       {Summary: "Remove a source from a content unit", Response: models.ContentUnit{}},
+	"GET /rest/content_units/:id/tags/":                      {Summary: "Tags of a content unit", Response: []*Tag{}},
+	"POST /rest/content_units/:id/tags/":                     {Summary: "Add a tag to a content unit", Body: tagIDBody{}, Response: models.ContentUnit{}},
+	"DELETE /rest/content_units/:id/tags/:tagID":             {Summary: "Remove a tag from a content unit", Response: models.ContentUnit{}},
+	"GET /rest/content_units/:id/persons/":                   {Summary: "Persons of a content unit", Response: []*ContentUnitPerson{}},
+	"POST /rest/content_units/:id/persons/":                  {Summary: "Add a person, in a role, to a content unit", Body: models.ContentUnitsPerson{}, Response: models.ContentUnit{}},
+	"DELETE /rest/content_units/:id/persons/:personID":       {Summary: "Remove a person from a content unit", Response: models.ContentUnit{}},
+	"GET /rest/content_units/:id/publishers/":                {Summary: "Publishers of a content unit", Response: []*Publisher{}},
+	"POST /rest/content_units/:id/publishers/":               {Summary: "Add a publisher to a content unit", Body: publisherIDBody{}, Response: models.ContentUnit{}},
+	"DELETE /rest/content_units/:id/publishers/:publisherID": {Summary: "Remove a publisher from a content unit", Response: models.ContentUnit{}},
+	"POST /rest/content_units/:id/merge":                     {Summary: "Merge content units, by ID, into a content unit", Body: []int64{}, Response: ContentUnit{}},
+	"POST /rest/content_units/:id/split":                     {Summary: "Split files of a content unit into new content units", Body: ContentUnitSplitRequest{}, Response: []*ContentUnit{}},
+	"POST /rest/content_units/:id/restore":                   {Summary: "Restore a removed content unit", Response: ContentUnit{}},
+
+	// files
+	"GET /rest/files/":               {Summary: "List files", Query: FilesRequest{}, Response: FilesResponse{}},
+	"GET /rest/files/:id/":           {Summary: "Get a file", Response: MFile{}},
+	"PUT /rest/files/:id/":           {Summary: "Update a file", Body: PartialFile{}, Response: MFile{}},
+	"DELETE /rest/files/:id/":        {Summary: "Remove a file"},
+	"POST /rest/files/:id/publish":   {Summary: "Publish a file, and its content unit and collections if needed", Response: MFile{}},
+	"POST /rest/files/:id/unpublish": {Summary: "Unpublish a file, and its content unit and collections if no other file is published", Response: MFile{}},
+	"GET /rest/files/:id/storages/":  {Summary: "Storages holding a file", Response: []*Storage{}},
+	"GET /rest/files/:id/locations/": {Summary: "Copies of a file with URLs to fetch them, best first", Query: FileLocationsRequest{}, Response: []*FileLocation{}},
+	"GET /rest/files/:id/media/":     {Summary: "Technical metadata of a media file", Response: media.Info{}},
+	"GET /rest/files/:id/tree/":      {Summary: "Ancestors and descendants of a file with their operations", Response: FileTreeResponse{}},
+
+	// operations
+	"GET /rest/operations/":           {Summary: "List operations", Query: OperationsRequest{}, Response: OperationsResponse{}},
+	"GET /rest/operations/:id/":       {Summary: "Get an operation", Response: models.Operation{}},
+	"GET /rest/operations/:id/files/": {Summary: "Files of an operation", Response: []*MFile{}},
+
+	// sources, tags, authors
+	"GET /rest/authors/":          {Summary: "List authors with their sources", Response: AuthorsResponse{}},
+	"GET /rest/sources/":          {Summary: "List sources", Query: SourcesRequest{}, Response: SourcesResponse{}},
+	"POST /rest/sources/":         {Summary: "Create a source", Body: CreateSourceRequest{}, Response: Source{}},
+	"GET /rest/sources/:id/":      {Summary: "Get a source", Response: Source{}},
+	"PUT /rest/sources/:id/":      {Summary: "Update a source", Body: Source{}, Response: Source{}},
+	"PUT /rest/sources/:id/i18n/": {Summary: "Update translations of a source", Body: []*models.SourceI18n{}, Response: Source{}},
+	"GET /rest/tags/":             {Summary: "List tags", Query: TagsRequest{}, Response: TagsResponse{}},
+	"POST /rest/tags/":            {Summary: "Create a tag", Body: Tag{}, Response: Tag{}},
+	"GET /rest/tags/:id/":         {Summary: "Get a tag", Response: Tag{}},
+	"PUT /rest/tags/:id/":         {Summary: "Update a tag", Body: Tag{}, Response: Tag{}},
+	"PUT /rest/tags/:id/i18n/":    {Summary: "Update translations of a tag", Body: []*models.TagI18n{}, Response: Tag{}},
+
+	// persons
+	"GET /rest/persons/":             {Summary: "List persons", Query: PersonsRequest{}, Response: PersonsResponse{}},
+	"POST /rest/persons/":            {Summary: "Create a person", Body: Person{}, Response: Person{}},
+	"GET /rest/persons/:id/":         {Summary: "Get a person", Response: Person{}},
+	"PUT /rest/persons/:id/":         {Summary: "Update a person", Body: Person{}, Response: Person{}},
+	"DELETE /rest/persons/:id/":      {Summary: "Remove a person, it can be restored"},
+	"PUT /rest/persons/:id/i18n/":    {Summary: "Update translations of a person", Body: []*models.PersonI18n{}, Response: Person{}},
+	"POST /rest/persons/:id/restore": {Summary: "Restore a removed person", Response: Person{}},
+
+	// storages and publishers
+	"GET /rest/storages/":            {Summary: "List storages", Query: StoragesRequest{}, Response: StoragesResponse{}},
+	"GET /rest/publishers/":          {Summary: "List publishers", Query: PublishersRequest{}, Response: PublishersResponse{}},
+	"POST /rest/publishers/":         {Summary: "Create a publisher", Body: Publisher{}, Response: Publisher{}},
+	"GET /rest/publishers/:id/":      {Summary: "Get a publisher", Response: Publisher{}},
+	"PUT /rest/publishers/:id/":      {Summary: "Update a publisher", Body: Publisher{}, Response: Publisher{}},
+	"PUT /rest/publishers/:id/i18n/": {Summary: "Update translations of a publisher", Body: []*models.PublisherI18n{}, Response: Publisher{}},
+
+	// search, audit, permissions
+	"GET /rest/search/":                   {Summary: "Full text search", Query: SearchRequest{}, Response: SearchResponse{}},
+	"GET /rest/audit/":                    {Summary: "Audit log of changes", Query: AuditLogRequest{}, Response: AuditLogResponse{}},
+	"GET /rest/permissions/rules/":        {Summary: "List rules of the permissions policy", Query: PermissionRulesRequest{}, Response: PermissionRulesResponse{}},
+	"POST /rest/permissions/rules/":       {Summary: "Add a rule to the permissions policy", Body: permissions.PolicyRule{}, Response: permissions.PolicyRule{}},
+	"GET /rest/permissions/rules/:id/":    {Summary: "Get a rule of the permissions policy", Response: permissions.PolicyRule{}},
+	"DELETE /rest/permissions/rules/:id/": {Summary: "Remove a rule from the permissions policy", Response: permissions.PolicyRule{}},
+
+	// jobs
+	"GET /rest/jobs/":                {Summary: "List background jobs", Query: JobsRequest{}, Response: JobsResponse{}},
+	"POST /rest/jobs/":               {Summary: "Queue jobs for files, by ID or a predefined selection", Body: EnqueueJobsRequest{}, Response: EnqueueJobsResponse{}},
+	"GET /rest/jobs/:id/":            {Summary: "Get a job", Response: Job{}},
+	"POST /rest/jobs/:id/heartbeat/": {Summary: "Extend the lease of a worker on a running job", Body: JobHeartbeatRequest{}, Response: Job{}},
+	"POST /rest/jobs/:id/complete/":  {Summary: "Report the result of a running job", Body: CompleteJobRequest{}, Response: Job{}},
+	"POST /rest/job-claims/":         {Summary: "Claim the next queued job, no content if there is none", Body: ClaimJobRequest{}, Response: Job{}},
+
+	// bulk
+	"POST /rest/bulk/content_units/": {Summary: "Bulk edit content units, not under /rest/content_units/ as it would conflict with :id", Body: ContentUnitsBulkRequest{}, Response: ContentUnitsBulkResponse{}},
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+func TestOpenAPISpecs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router)
+
+	routes := make(map[string]bool)
+	for _, r := range router.Routes() {
+		key := r.Method + " " + r.Path
+		routes[key] = true
+		_, ok := API_SPECS[key]
+		assert.True(t, ok, "No spec for route %s, add one to API_SPECS", key)
+	}
+	for key := range API_SPECS {
+		assert.True(t, routes[key], "Spec of unknown route %s", key)
+	}
+
+	doc := BuildOpenAPI(API_SPECS)
+
+	ids := make(map[string]bool)
+	for p, ops := range doc.Paths {
+		for m, op := range ops {
+			assert.False(t, ids[op.OperationID], "Duplicate operation ID %s of %s %s", op.OperationID, m, p)
+			ids[op.OperationID] = true
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	assert.Nil(t, err)
+	for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(b), -1) {
+		_, ok := doc.Components.Schemas[m[1]]
+		assert.True(t, ok, "Unknown schema %s", m[1])
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	g := &schemaGenerator{schemas: make(map[string]*OpenAPISchema)}
+
+	// binding tags
+	assert.Equal(t, "#/components/schemas/File", g.schemaOf(reflect.TypeOf(File{})).Ref)
+	file := g.schemas["File"]
+	assert.Equal(t, []string{"file_name", "sha1", "size", "created_at"}, file.Required)
+	assert.Equal(t, 255, *file.Properties["file_name"].MaxLength)
+	assert.Equal(t, 40, *file.Properties["sha1"].MinLength)
+	assert.Equal(t, 40, *file.Properties["sha1"].MaxLength)
+	assert.NotEmpty(t, file.Properties["sha1"].Pattern)
+	assert.Equal(t, "integer", file.Properties["created_at"].Type)
+	assert.Equal(t, 2, *file.Properties["language"].MinLength)
+
+	// embedded structs are flattened, shallower fields win
+	g.schemaOf(reflect.TypeOf(MFile{}))
+	mfile := g.schemas["MFile"]
+	assert.Equal(t, "string", mfile.Properties["sha1"].Type)
+	assert.Empty(t, mfile.Properties["sha1"].Format)
+	assert.Equal(t, "array", mfile.Properties["operations"].Type)
+	assert.Contains(t, mfile.Properties, "content_unit_id")
+	assert.True(t, mfile.Properties["content_unit_id"].Nullable)
+	assert.NotContains(t, mfile.Properties, "R")
+
+	// dive
+	g.schemaOf(reflect.TypeOf(CITMetadata{}))
+	sources := g.schemas["CITMetadata"].Properties["sources"]
+	assert.Equal(t, 8, *sources.Items.MaxLength)
+
+	// enums
+	g.schemaOf(reflect.TypeOf(CITMetadataMajor{}))
+	assert.Equal(t, []string{"source", "tag"}, g.schemas["CITMetadataMajor"].Properties["type"].Enum)
+
+	// recursive types
+	g.schemaOf(reflect.TypeOf(TagH{}))
+	assert.Equal(t, "#/components/schemas/TagH", g.schemas["TagH"].Properties["children"].Items.Ref)
+
+	// query parameters
+	op := g.operation("GET", "/rest/collections/", API_SPECS["GET /rest/collections/"])
+	params := make(map[string]*OpenAPIParameter)
+	for _, p := range op.Parameters {
+		params[p.Name] = p
+	}
+	assert.Equal(t, "query", params["page_no"].In)
+	assert.Equal(t, float64(1), *params["page_no"].Schema.Minimum)
+	assert.Equal(t, "array", params["id"].Schema.Type)
+	assert.Equal(t, "array", params["content_type"].Schema.Type)
+	assert.NotContains(t, params, "ids")
+
+	// path parameters
+	op = g.operation("GET", "/rest/collections/:id/", API_SPECS["GET /rest/collections/:id/"])
+	assert.Equal(t, "path", op.Parameters[0].In)
+	assert.Equal(t, "id", op.Parameters[0].Name)
+	assert.Equal(t, "getCollectionsById", op.OperationID)
+	assert.Equal(t, "/rest/collections/{id}/", openAPIPath("/rest/collections/:id/"))
+}
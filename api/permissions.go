@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/casbin/casbin"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/permissions"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Runtime editing of the permissions policy.
+// Changes are broadcast to all instances which reload their policy, see permissions.PolicyListener.
+
+const PERM_PERMISSIONS = "permissions"
+
+func PermissionRulesHandler(c *gin.Context) {
+	var err *HttpError
+	var resp interface{}
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		var r PermissionRulesRequest
+		if c.Bind(&r) != nil {
+			return
+		}
+
+		resp, err = handlePermissionRulesList(c, c.MustGet("MDB").(*sql.DB), r)
+	case http.MethodPost:
+		var rule permissions.PolicyRule
+		if c.BindJSON(&rule) != nil {
+			return
+		}
+
+		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_PERMISSION_RULE)
+		resp, err = handleCreatePermissionRule(c, tx, &rule)
+		if err == nil {
+			err = a.conclude(tx, rule.ID)
+		}
+		mustConcludeTx(tx, err)
+		if err == nil {
+			reloadPolicy(c)
+		}
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func PermissionRuleHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var err *HttpError
+	var resp interface{}
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		resp, err = handleGetPermissionRule(c, c.MustGet("MDB").(*sql.DB), id)
+	case http.MethodDelete:
+		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_PERMISSION_RULE, id)
+		resp, err = handleDeletePermissionRule(c, tx, id)
+		if err == nil {
+			err = a.conclude(tx)
+		}
+		mustConcludeTx(tx, err)
+		if err == nil {
+			reloadPolicy(c)
+		}
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func handlePermissionRulesList(cp utils.ContextProvider, exec boil.Executor, r PermissionRulesRequest) (*PermissionRulesResponse, *HttpError) {
+	if !can(cp, PERM_PERMISSIONS, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	rules, err := permissions.LoadPolicyRules(exec)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	data := make([]permissions.PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		if r.PType != "" && rule.PType != r.PType {
+			continue
+		}
+		if r.Value != "" && !ruleHasValue(rule, r.Value) {
+			continue
+		}
+		data = append(data, rule)
+	}
+
+	return &PermissionRulesResponse{
+		ListResponse: ListResponse{Total: int64(len(data))},
+		Rules:        data,
+	}, nil
+}
+
+func handleGetPermissionRule(cp utils.ContextProvider, exec boil.Executor, id int64) (*permissions.PolicyRule, *HttpError) {
+	if !can(cp, PERM_PERMISSIONS, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	rules, err := permissions.LoadPolicyRules(exec)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	for i := range rules {
+		if rules[i].ID == id {
+			return &rules[i], nil
+		}
+	}
+
+	return nil, NewNotFoundError()
+}
+
+func handleCreatePermissionRule(cp utils.ContextProvider, exec boil.Executor, rule *permissions.PolicyRule) (*permissions.PolicyRule, *HttpError) {
+	if !can(cp, PERM_PERMISSIONS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	if err := rule.Validate(); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	created, err := permissions.InsertPolicyRule(exec, rule)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if !created {
+		return nil, NewBadRequestError(errors.Errorf("Rule already exists: %s", rule.String()))
+	}
+
+	if err := permissions.NotifyPolicyChanged(exec); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return rule, nil
+}
+
+func handleDeletePermissionRule(cp utils.ContextProvider, exec boil.Executor, id int64) (*permissions.PolicyRule, *HttpError) {
+	if !can(cp, PERM_PERMISSIONS, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	rule, hErr := handleGetPermissionRule(cp, exec, id)
+	if hErr != nil {
+		return nil, hErr
+	}
+
+	if _, err := permissions.DeletePolicyRule(exec, rule); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	if err := permissions.NotifyPolicyChanged(exec); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return rule, nil
+}
+
+func ruleHasValue(rule permissions.PolicyRule, value string) bool {
+	for _, v := range rule.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadPolicy applies a committed policy change on this instance right away.
+// Other instances reload when notified.
+func reloadPolicy(cp utils.ContextProvider) {
+	if err := cp.MustGet("PERMISSIONS_ENFORCER").(*casbin.SyncedEnforcer).LoadPolicy(); err != nil {
+		log.Errorf("Reload permissions policy: %+v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Operation requests and their responses may be recorded in the recorded_requests table.
+// When a deploy bug fails operations, they are replayed by the replay command once fixed.
+//
+// Replays carry the ID of the recorded request in the X-MDB-Replay-Of header.
+// The operation they create is marked with it in its properties, as replay_of,
+// if the caller may replay recorded requests.
+
+const (
+	REPLAY_OF_HEADER = "X-MDB-Replay-Of"
+
+	PERM_RECORDED_REQUESTS = "recorded_requests"
+)
+
+// Whether operation requests are recorded.
+// Overridden by the server command from configuration.
+var RecordOperationRequests = false
+
+// Headers never recorded as is
+var REDACTED_HEADERS = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// RequestRecorderMiddleware records requests to the operations endpoints with their responses
+func RequestRecorderMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			NewBadRequestError(errors.Wrap(err, "Read request body")).Abort(c)
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		w := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		// panics are answered further up the chain, we record them as they pass
+		defer func() {
+			status, response := w.Status(), w.body.String()
+			p := recover()
+			if p != nil {
+				status, response = http.StatusInternalServerError, fmt.Sprintf("panic: %v", p)
+			}
+
+			err := recordRequest(c.MustGet("MDB").(*sql.DB), c.Request, body, status, response, time.Since(start))
+			if err != nil {
+				log.Errorf("Record request: %s", err.Error())
+			}
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func recordRequest(exec boil.Executor, r *http.Request, body []byte, status int, response string, duration time.Duration) error {
+	headers, err := json.Marshal(redactHeaders(r.Header))
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal headers")
+	}
+
+	var replayOf null.Int64
+	if x := r.Header.Get(REPLAY_OF_HEADER); x != "" {
+		if id, err := strconv.ParseInt(x, 10, 64); err == nil {
+			replayOf = null.Int64From(id)
+		}
+	}
+
+	path := r.URL.Path
+	operation := strings.Trim(strings.TrimPrefix(path, "/operations/"), "/")
+
+	// a replay of an unknown request is recorded as a plain request
+	_, err = exec.Exec(`INSERT INTO recorded_requests
+(method, path, operation, headers, body, status, response, duration, replay_of)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, (SELECT id FROM recorded_requests WHERE id = $9))`,
+		r.Method, path, operation, headers, string(body), status, response,
+		int64(duration/time.Millisecond), replayOf)
+	return errors.Wrap(err, "Insert recorded request")
+}
+
+func redactHeaders(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		redacted[k] = v
+	}
+	for _, k := range REDACTED_HEADERS {
+		if _, ok := redacted[http.CanonicalHeaderKey(k)]; ok {
+			redacted[http.CanonicalHeaderKey(k)] = []string{"REDACTED"}
+		}
+	}
+	return redacted
+}
+
+// replayOf returns the ID of the recorded request replayed by this request, if any.
+// The header is ignored unless the caller may replay recorded requests.
+func replayOf(c *gin.Context) int64 {
+	id, _ := strconv.ParseInt(c.GetHeader(REPLAY_OF_HEADER), 10, 64)
+	if id == 0 || !can(c, PERM_RECORDED_REQUESTS, PERM_WRITE) {
+		return 0
+	}
+	return id
+}
+
+// markReplay records in the properties of an operation that it replays a recorded request.
+// Unknown recorded requests are ignored.
+func markReplay(exec boil.Executor, opID int64, recordID int64) error {
+	_, err := exec.Exec(`UPDATE operations
+SET properties = coalesce(properties, '{}' :: JSONB) || jsonb_build_object('replay_of', $1 :: BIGINT)
+WHERE id = $2 AND EXISTS(SELECT 1 FROM recorded_requests WHERE id = $1)`, recordID, opID)
+	return errors.Wrapf(err, "Mark operation %d as replay of %d", opID, recordID)
+}
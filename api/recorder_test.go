@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Content-Type", "application/json")
+	h.Set(IDEMPOTENCY_KEY_HEADER, "key")
+
+	redacted := redactHeaders(h)
+	assert.Equal(t, "REDACTED", redacted.Get("Authorization"))
+	assert.Equal(t, "application/json", redacted.Get("Content-Type"))
+	assert.Equal(t, "key", redacted.Get(IDEMPOTENCY_KEY_HEADER))
+	assert.Equal(t, "Bearer secret", h.Get("Authorization"), "original untouched")
+	assert.Empty(t, redacted.Get("Cookie"), "missing stay missing")
+}
@@ -191,6 +191,7 @@ func (r *ContentTypeRegistry) Init(exec boil.Executor) error {
 
 type OperationTypeRegistry struct {
 	ByName map[string]*models.OperationType
+	ByID   map[int64]*models.OperationType
 }
 
 func (r *OperationTypeRegistry) Init(exec boil.Executor) error {
@@ -200,8 +201,10 @@ func (r *OperationTypeRegistry) Init(exec boil.Executor) error {
 	}
 
 	r.ByName = make(map[string]*models.OperationType)
+	r.ByID = make(map[int64]*models.OperationType)
 	for _, t := range types {
 		r.ByName[t.Name] = t
+		r.ByID[t.ID] = t
 	}
 
 	return nil
@@ -230,7 +233,7 @@ type PersonRegistry struct {
 }
 
 func (r *PersonRegistry) Init(exec boil.Executor) error {
-	types, err := models.Persons(exec, qm.Where("pattern is not null")).All()
+	types, err := models.Persons(exec, qm.Where("pattern is not null and removed_at is null")).All()
 	if err != nil {
 		return errors.Wrap(err, "Load persons from DB")
 	}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
@@ -289,8 +290,41 @@ func CreateContentUnit(exec boil.Executor, contentType string, properties map[st
 	return unit, err
 }
 
-func DeleteContentUnit(exec boil.Executor, unit *models.ContentUnit) error {
+// findCollection is models.FindCollection for collections which were not removed
+func findCollection(exec boil.Executor, id int64) (*models.Collection, error) {
+	return models.Collections(exec, qm.Where("id = ? AND removed_at IS NULL", id)).One()
+}
+
+// findContentUnit is models.FindContentUnit for content units which were not removed
+func findContentUnit(exec boil.Executor, id int64) (*models.ContentUnit, error) {
+	return models.ContentUnits(exec, qm.Where("id = ? AND removed_at IS NULL", id)).One()
+}
+
+// findPerson is models.FindPerson for persons who were not removed
+func findPerson(exec boil.Executor, id int64) (*models.Person, error) {
+	return models.Persons(exec, qm.Where("id = ? AND removed_at IS NULL", id)).One()
+}
+
+func RemoveContentUnit(exec boil.Executor, unit *models.ContentUnit) error {
 	log.Infof("Removing content_unit %d", unit.ID)
+	unit.RemovedAt = null.TimeFrom(time.Now().UTC())
+	return errors.Wrap(unit.Update(exec, "removed_at"), "Save content_unit to DB")
+}
+
+// PurgeContentUnit deletes a content unit with all its relations.
+// Files of the unit are left without a unit.
+func PurgeContentUnit(exec boil.Executor, unit *models.ContentUnit) error {
+	log.Infof("Purging content_unit %d", unit.ID)
+
+	_, err := queries.Raw(exec, "UPDATE files SET content_unit_id = NULL WHERE content_unit_id = $1", unit.ID).Exec()
+	if err != nil {
+		return errors.Wrap(err, "Detach files")
+	}
+
+	_, err = queries.Raw(exec, "DELETE FROM content_unit_derivations WHERE source_id = $1 OR derived_id = $1", unit.ID).Exec()
+	if err != nil {
+		return errors.Wrap(err, "Delete content_unit_derivations")
+	}
 
 	tables := [...]string{
 		"collections_content_units",
@@ -311,6 +345,40 @@ func DeleteContentUnit(exec boil.Executor, unit *models.ContentUnit) error {
 	return unit.Delete(exec)
 }
 
+// PurgeCollection deletes a collection with all its relations.
+func PurgeCollection(exec boil.Executor, collection *models.Collection) error {
+	log.Infof("Purging collection %d", collection.ID)
+
+	err := models.CollectionsContentUnits(exec, qm.Where("collection_id = ?", collection.ID)).DeleteAll()
+	if err != nil {
+		return errors.Wrap(err, "Delete collections_content_units")
+	}
+
+	err = models.CollectionI18ns(exec, qm.Where("collection_id = ?", collection.ID)).DeleteAll()
+	if err != nil {
+		return errors.Wrap(err, "Delete collection_i18n")
+	}
+
+	return collection.Delete(exec)
+}
+
+// PurgePerson deletes a person with all its relations.
+func PurgePerson(exec boil.Executor, person *models.Person) error {
+	log.Infof("Purging person %d", person.ID)
+
+	err := models.ContentUnitsPersons(exec, qm.Where("person_id = ?", person.ID)).DeleteAll()
+	if err != nil {
+		return errors.Wrap(err, "Delete content_units_persons")
+	}
+
+	err = models.PersonI18ns(exec, qm.Where("person_id = ?", person.ID)).DeleteAll()
+	if err != nil {
+		return errors.Wrap(err, "Delete person_i18n")
+	}
+
+	return person.Delete(exec)
+}
+
 func GetNextPositionInCollection(exec boil.Executor, id int64) (position int, err error) {
 	err = queries.Raw(exec,
 		"SELECT COALESCE(MAX(position), -1) + 1 FROM collections_content_units WHERE collection_id = $1", id).
@@ -318,36 +386,57 @@ func GetNextPositionInCollection(exec boil.Executor, id int64) (position int, er
 	return
 }
 
+// UpdateContentUnitProperties merges the given properties into the unit's properties.
+// A nil value removes the key.
 func UpdateContentUnitProperties(exec boil.Executor, unit *models.ContentUnit, props map[string]interface{}) error {
+	_, err := mergeContentUnitProperties(exec, unit, props)
+	return err
+}
+
+// mergeContentUnitProperties is UpdateContentUnitProperties, returning true if the properties actually changed.
+// Unchanged properties are not saved.
+func mergeContentUnitProperties(exec boil.Executor, unit *models.ContentUnit, props map[string]interface{}) (bool, error) {
 	if len(props) == 0 {
-		return nil
+		return false, nil
 	}
 
-	var p map[string]interface{}
+	p := make(map[string]interface{})
 	if unit.Properties.Valid {
 		err := unit.Properties.Unmarshal(&p)
 		if err != nil {
-			return errors.Wrap(err, "json.Unmarshal")
+			return false, errors.Wrap(err, "json.Unmarshal")
 		}
-		for k, v := range props {
+	}
+
+	// compare normalized json
+	old, err := json.Marshal(p)
+	if err != nil {
+		return false, errors.Wrap(err, "json Marshal")
+	}
+
+	for k, v := range props {
+		if v == nil {
+			delete(p, k)
+		} else {
 			p[k] = v
 		}
-	} else {
-		p = props
 	}
 
 	fpa, err := json.Marshal(p)
 	if err != nil {
-		return errors.Wrap(err, "json Marshal")
+		return false, errors.Wrap(err, "json Marshal")
+	}
+	if bytes.Equal(old, fpa) {
+		return false, nil
 	}
 
 	unit.Properties = null.JSONFrom(fpa)
 	err = unit.Update(exec, "properties")
 	if err != nil {
-		return errors.Wrap(err, "Save properties to DB")
+		return false, errors.Wrap(err, "Save properties to DB")
 	}
 
-	return nil
+	return true, nil
 }
 
 func CreateFile(exec boil.Executor, parent *models.File, f File, properties map[string]interface{}) (*models.File, error) {
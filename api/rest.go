@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/casbin/casbin"
@@ -20,6 +22,8 @@ import (
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/media"
+	"github.com/Bnei-Baruch/mdb/metrics"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/permissions"
 	"github.com/Bnei-Baruch/mdb/utils"
@@ -67,12 +71,15 @@ func CollectionsListHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_COLLECTION)
 		resp, err = handleCreateCollection(c, tx, collection)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.CollectionCreateEvent(&resp.(*Collection).Collection))
+			err = a.conclude(tx, resp.(*Collection).ID)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, events.CollectionCreateEvent(&resp.(*Collection).Collection))
+		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -98,22 +105,29 @@ func CollectionHandler(c *gin.Context) {
 		}
 
 		cl.ID = id
+		var evnts []events.Event
 		tx := mustBeginTx(c)
-		resp, err = handleUpdateCollection(c, tx, &cl)
-		mustConcludeTx(tx, err)
-
+		a := startAudit(c, tx, AUDIT_COLLECTION, id)
+		resp, evnts, err = handleUpdateCollection(c, tx, &cl)
 		if err == nil {
-			emitEvents(c, events.CollectionUpdateEvent(&resp.(*Collection).Collection))
+			err = a.conclude(tx)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		tx := mustBeginTx(c)
 		var cl *models.Collection
+		a := startAudit(c, tx, AUDIT_COLLECTION, id)
 		cl, err = handleDeleteCollection(c, tx, id)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.CollectionDeleteEvent(cl))
+			err = a.conclude(tx)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, events.CollectionDeleteEvent(cl))
+		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -138,12 +152,15 @@ func CollectionI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_COLLECTION, id)
 	resp, err := handleUpdateCollectionI18n(c, tx, id, i18ns)
-	mustConcludeTx(tx, err)
-
 	if err == nil {
-		emitEvents(c, events.CollectionUpdateEvent(&resp.Collection))
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.CollectionUpdateEvent(&resp.Collection))...)
 	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -169,12 +186,15 @@ func CollectionContentUnitsHandler(c *gin.Context) {
 
 		var evnts []events.Event
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_COLLECTION, id)
 		evnts, err = handleCollectionAddCCU(c, tx, id, ccus)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, evnts...)
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(evnts...)...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodPut:
 		var ccu models.CollectionsContentUnit
 		if c.BindJSON(&ccu) != nil {
@@ -190,12 +210,15 @@ func CollectionContentUnitsHandler(c *gin.Context) {
 
 		var event *events.Event
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_COLLECTION, id)
 		event, err = handleCollectionUpdateCCU(c, tx, id, ccu)
-		mustConcludeTx(tx, err)
-
+		if err == nil {
+			err = a.conclude(tx)
+		}
 		if err == nil && event != nil {
-			emitEvents(c, *event)
+			err = emitEvents(c, tx, a.withDiffs(*event)...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		cuID, e := strconv.ParseInt(c.Param("cuID"), 10, 0)
 		if e != nil {
@@ -205,12 +228,15 @@ func CollectionContentUnitsHandler(c *gin.Context) {
 
 		var evnts []events.Event
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_COLLECTION, id)
 		evnts, err = handleCollectionRemoveCCU(c, tx, id, cuID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, evnts...)
+			err = a.conclude(tx)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -224,7 +250,37 @@ func CollectionActivateHandler(c *gin.Context) {
 		return
 	}
 
-	resp, err := handleCollectionActivate(c, c.MustGet("MDB").(*sql.DB), id)
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_COLLECTION, id)
+	resp, err := handleCollectionActivate(c, tx, id)
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	mustConcludeTx(tx, err)
+
+	concludeRequest(c, resp, err)
+}
+
+// Reinstate a removed collection with its relations.
+// Consumers get a create event as the collection reappears.
+func CollectionRestoreHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_COLLECTION, id)
+	resp, err := handleRestoreCollection(c, tx, id)
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, events.CollectionCreateEvent(&resp.Collection))
+	}
+	mustConcludeTx(tx, err)
+
 	concludeRequest(c, resp, err)
 }
 
@@ -261,12 +317,15 @@ func ContentUnitsListHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT)
 		resp, err = handleCreateContentUnit(c, tx, unit)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitCreateEvent(&resp.(*ContentUnit).ContentUnit))
+			err = a.conclude(tx, resp.(*ContentUnit).ID)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, events.ContentUnitCreateEvent(&resp.(*ContentUnit).ContentUnit))
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -292,13 +351,17 @@ func ContentUnitHandler(c *gin.Context) {
 			}
 
 			cu.ID = id
+			var evnts []events.Event
 			tx := mustBeginTx(c)
-			resp, err = handleUpdateContentUnit(c, tx, &cu)
-			mustConcludeTx(tx, err)
-
+			a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
+			resp, evnts, err = handleUpdateContentUnit(c, tx, &cu)
 			if err == nil {
-				emitEvents(c, events.ContentUnitUpdateEvent(&resp.(*ContentUnit).ContentUnit))
+				err = a.conclude(tx)
 			}
+			if err == nil {
+				err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -324,12 +387,15 @@ func ContentUnitI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 	resp, err := handleUpdateContentUnitI18n(c, tx, id, i18ns)
-	mustConcludeTx(tx, err)
-
 	if err == nil {
-		emitEvents(c, events.ContentUnitUpdateEvent(&resp.ContentUnit))
+		err = a.conclude(tx)
 	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.ContentUnitUpdateEvent(&resp.ContentUnit))...)
+	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -355,12 +421,15 @@ func ContentUnitFilesHandler(c *gin.Context) {
 
 			var evnts []events.Event
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 			resp, evnts, err = handleContentUnitAddFiles(c, tx, id, fids)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, evnts...)
+				err = a.conclude(tx)
 			}
+			if err == nil {
+				err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -398,12 +467,15 @@ func ContentUnitDerivativesHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitAddCUD(c, tx, id, cud)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodPut:
 		var cud models.ContentUnitDerivation
 		if c.BindJSON(&cud) != nil {
@@ -418,12 +490,15 @@ func ContentUnitDerivativesHandler(c *gin.Context) {
 		cud.DerivedID = duID
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitUpdateCUD(c, tx, id, cud)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		duID, e := strconv.ParseInt(c.Param("duID"), 10, 0)
 		if e != nil {
@@ -432,12 +507,15 @@ func ContentUnitDerivativesHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitRemoveCUD(c, tx, id, duID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitDerivativesChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -480,12 +558,15 @@ func ContentUnitSourcesHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitAddSource(c, tx, id, sourceID)
-		mustConcludeTx(tx, err)
-
+		if err == nil {
+			err = a.conclude(tx)
+		}
 		if err == nil && resp != nil {
-			emitEvents(c, events.ContentUnitSourcesChangeEvent(resp.(*models.ContentUnit)))
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitSourcesChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		sourceID, e := strconv.ParseInt(c.Param("sourceID"), 10, 0)
 		if e != nil {
@@ -494,12 +575,15 @@ func ContentUnitSourcesHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitRemoveSource(c, tx, id, sourceID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitSourcesChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitSourcesChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -531,12 +615,15 @@ func ContentUnitTagsHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitAddTag(c, tx, id, tagID)
-		mustConcludeTx(tx, err)
-
+		if err == nil {
+			err = a.conclude(tx)
+		}
 		if err == nil && resp != nil {
-			emitEvents(c, events.ContentUnitTagsChangeEvent(resp.(*models.ContentUnit)))
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitTagsChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		tagID, e := strconv.ParseInt(c.Param("tagID"), 10, 0)
 		if e != nil {
@@ -545,12 +632,15 @@ func ContentUnitTagsHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitRemoveTag(c, tx, id, tagID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitTagsChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitTagsChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -576,12 +666,15 @@ func ContentUnitPersonsHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitAddPerson(c, tx, id, cup)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitPersonsChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitPersonsChangeEvent(resp.(*models.ContentUnit)))...)
+		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		personID, e := strconv.ParseInt(c.Param("personID"), 10, 0)
 		if e != nil {
@@ -590,12 +683,15 @@ func ContentUnitPersonsHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitRemovePerson(c, tx, id, personID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitPersonsChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitPersonsChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -627,12 +723,15 @@ func ContentUnitPublishersHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitAddPublisher(c, tx, id, publisherID)
-		mustConcludeTx(tx, err)
-
+		if err == nil {
+			err = a.conclude(tx)
+		}
 		if err == nil && resp != nil {
-			emitEvents(c, events.ContentUnitPublishersChangeEvent(resp.(*models.ContentUnit)))
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitPublishersChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		publisherID, e := strconv.ParseInt(c.Param("publisherID"), 10, 0)
 		if e != nil {
@@ -641,12 +740,15 @@ func ContentUnitPublishersHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
 		resp, err = handleContentUnitRemovePublisher(c, tx, id, publisherID)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.ContentUnitPublishersChangeEvent(resp.(*models.ContentUnit)))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.ContentUnitPublishersChangeEvent(resp.(*models.ContentUnit)))...)
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -673,12 +775,70 @@ func ContentUnitMergeHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_CONTENT_UNIT, append([]int64{id}, b...)...)
 	resp, evnts, err := handleContentUnitMerge(c, tx, id, b)
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+	}
 	mustConcludeTx(tx, err)
 
+	concludeRequest(c, resp, err)
+}
+
+// Split files, and optionally derivations and collection memberships, of a unit into new units.
+// The original unit is removed if left without files.
+func ContentUnitSplitHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var r ContentUnitSplitRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
+	resp, evnts, err := handleContentUnitSplit(c, tx, id, r)
+	if err == nil {
+		ids := make([]int64, len(resp))
+		for i := range resp {
+			ids[i] = resp[i].ID
+		}
+		err = a.conclude(tx, ids...)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+	}
+	mustConcludeTx(tx, err)
+
+	concludeRequest(c, resp, err)
+}
+
+// Reinstate a removed content unit with its relations.
+// Consumers get a create event as the content unit reappears.
+func ContentUnitRestoreHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_CONTENT_UNIT, id)
+	resp, err := handleRestoreContentUnit(c, tx, id)
+	if err == nil {
+		err = a.conclude(tx)
+	}
 	if err == nil {
-		emitEvents(c, evnts...)
+		err = emitEvents(c, tx, events.ContentUnitCreateEvent(&resp.ContentUnit))
 	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -703,30 +863,73 @@ func FileHandler(c *gin.Context) {
 	var err *HttpError
 	var resp interface{}
 
-	if c.Request.Method == http.MethodGet || c.Request.Method == "" {
+	switch c.Request.Method {
+	case http.MethodGet, "":
 		resp, err = handleGetFile(c, c.MustGet("MDB").(*sql.DB), id)
-	} else {
-		if c.Request.Method == http.MethodPut {
-			var f PartialFile
-			if c.Bind(&f) != nil {
-				return
-			}
-
-			f.ID = id
-			var evnts []events.Event
-			tx := mustBeginTx(c)
-			resp, evnts, err = handleUpdateFile(c, tx, &f)
-			mustConcludeTx(tx, err)
+	case http.MethodPut:
+		var f PartialFile
+		if c.Bind(&f) != nil {
+			return
+		}
 
-			if err == nil {
-				emitEvents(c, evnts...)
-			}
+		f.ID = id
+		var evnts []events.Event
+		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_FILE, id)
+		resp, evnts, err = handleUpdateFile(c, tx, &f)
+		if err == nil {
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+		}
+		mustConcludeTx(tx, err)
+	case http.MethodDelete:
+		var evnts []events.Event
+		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_FILE, id)
+		evnts, err = handleDeleteFile(c, tx, id)
+		if err == nil {
+			err = a.conclude(tx)
 		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
 }
 
+func FilePublishHandler(c *gin.Context) {
+	fileSetPublished(c, true)
+}
+
+func FileUnpublishHandler(c *gin.Context) {
+	fileSetPublished(c, false)
+}
+
+func fileSetPublished(c *gin.Context, published bool) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_FILE, id)
+	resp, evnts, err := handleFileSetPublished(c, tx, id, published)
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(evnts...)...)
+	}
+	mustConcludeTx(tx, err)
+
+	concludeRequest(c, resp, err)
+}
+
 func FileStoragesHandler(c *gin.Context) {
 	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
 	if e != nil {
@@ -738,6 +941,17 @@ func FileStoragesHandler(c *gin.Context) {
 	concludeRequest(c, resp, err)
 }
 
+func FileMediaHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleFileMedia(c, c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, resp, err)
+}
+
 func FilesWithOperationsTreeHandler(c *gin.Context) {
 	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
 	if e != nil {
@@ -780,12 +994,9 @@ func FilesWithOperationsTreeHandler(c *gin.Context) {
 		opsMap[op.ID] = op
 	}
 
-	resp := &struct {
-		Files      []*MFile                    `json:"files"`
-		Operations map[int64]*models.Operation `json:"operations"`
-	}{
-		files,
-		opsMap,
+	resp := &FileTreeResponse{
+		Files:      files,
+		Operations: opsMap,
 	}
 
 	concludeRequest(c, resp, nil)
@@ -922,12 +1133,15 @@ func SourcesHandler(c *gin.Context) {
 			}
 
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_SOURCE)
 			resp, err = handleCreateSource(tx, r)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, events.SourceCreateEvent(&resp.(*Source).Source))
+				err = a.conclude(tx, resp.(*Source).ID)
+			}
+			if err == nil {
+				err = emitEvents(c, tx, events.SourceCreateEvent(&resp.(*Source).Source))
 			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -965,12 +1179,15 @@ func SourceHandler(c *gin.Context) {
 
 			s.ID = id
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_SOURCE, id)
 			resp, err = handleUpdateSource(tx, &s)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, events.SourceUpdateEvent(&resp.(*Source).Source))
+				err = a.conclude(tx)
+			}
+			if err == nil {
+				err = emitEvents(c, tx, a.withDiffs(events.SourceUpdateEvent(&resp.(*Source).Source))...)
 			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -1001,12 +1218,15 @@ func SourceI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_SOURCE, id)
 	resp, err := handleUpdateSourceI18n(tx, id, i18ns)
-	mustConcludeTx(tx, err)
-
 	if err == nil {
-		emitEvents(c, events.SourceUpdateEvent(&resp.Source))
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.SourceUpdateEvent(&resp.Source))...)
 	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -1046,12 +1266,15 @@ func TagsHandler(c *gin.Context) {
 			}
 
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_TAG)
 			resp, err = handleCreateTag(tx, &t)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, events.TagCreateEvent(&resp.(*Tag).Tag))
+				err = a.conclude(tx, resp.(*Tag).ID)
 			}
+			if err == nil {
+				err = emitEvents(c, tx, events.TagCreateEvent(&resp.(*Tag).Tag))
+			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -1089,12 +1312,15 @@ func TagHandler(c *gin.Context) {
 
 			t.ID = id
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_TAG, id)
 			resp, err = handleUpdateTag(tx, &t)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, events.TagUpdateEvent(&resp.(*Tag).Tag))
+				err = a.conclude(tx)
+			}
+			if err == nil {
+				err = emitEvents(c, tx, a.withDiffs(events.TagUpdateEvent(&resp.(*Tag).Tag))...)
 			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -1125,12 +1351,15 @@ func TagI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_TAG, id)
 	resp, err := handleUpdateTagI18n(tx, id, i18ns)
-	mustConcludeTx(tx, err)
-
 	if err == nil {
-		emitEvents(c, events.TagUpdateEvent(&resp.Tag))
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.TagUpdateEvent(&resp.Tag))...)
 	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -1172,12 +1401,15 @@ func PersonsListHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
-		resp, err = handleCreatePerson(tx, &person)
-		mustConcludeTx(tx, err)
-
+		a := startAudit(c, tx, AUDIT_PERSON)
+		resp, err = handleCreatePerson(tx, &person)
+		if err == nil {
+			err = a.conclude(tx, resp.(*Person).ID)
+		}
 		if err == nil {
-			emitEvents(c, events.PersonCreateEvent(&resp.(*Person).Person))
+			err = emitEvents(c, tx, events.PersonCreateEvent(&resp.(*Person).Person))
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -1214,12 +1446,15 @@ func PersonHandler(c *gin.Context) {
 
 		p.ID = id
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_PERSON, id)
 		resp, err = handleUpdatePerson(tx, &p)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.PersonUpdateEvent(&resp.(*Person).Person))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, a.withDiffs(events.PersonUpdateEvent(&resp.(*Person).Person))...)
 		}
+		mustConcludeTx(tx, err)
 	case http.MethodDelete:
 		if !isAdmin(c) {
 			NewForbiddenError().Abort(c)
@@ -1227,12 +1462,15 @@ func PersonHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_PERSON, id)
 		pr, err := handleDeletePerson(tx, id)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.PersonDeleteEvent(pr))
+			err = a.conclude(tx)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, events.PersonDeleteEvent(pr))
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -1262,12 +1500,43 @@ func PersonI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_PERSON, id)
 	resp, err := handleUpdatePersonI18n(tx, id, i18ns)
+	if err == nil {
+		err = a.conclude(tx)
+	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.PersonUpdateEvent(&resp.Person))...)
+	}
 	mustConcludeTx(tx, err)
 
+	concludeRequest(c, resp, err)
+}
+
+// Reinstate a removed person with its relations.
+// Consumers get a create event as the person reappears.
+func PersonRestoreHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_PERSON, id)
+	resp, err := handleRestorePerson(tx, id)
+	if err == nil {
+		err = a.conclude(tx)
+	}
 	if err == nil {
-		emitEvents(c, events.PersonUpdateEvent(&resp.Person))
+		err = emitEvents(c, tx, events.PersonCreateEvent(&resp.Person))
 	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -1309,12 +1578,15 @@ func PublishersHandler(c *gin.Context) {
 		}
 
 		tx := mustBeginTx(c)
+		a := startAudit(c, tx, AUDIT_PUBLISHER)
 		resp, err = handleCreatePublisher(tx, &publisher)
-		mustConcludeTx(tx, err)
-
 		if err == nil {
-			emitEvents(c, events.PublisherCreateEvent(&resp.(*Publisher).Publisher))
+			err = a.conclude(tx, resp.(*Publisher).ID)
+		}
+		if err == nil {
+			err = emitEvents(c, tx, events.PublisherCreateEvent(&resp.(*Publisher).Publisher))
 		}
+		mustConcludeTx(tx, err)
 	}
 
 	concludeRequest(c, resp, err)
@@ -1351,12 +1623,15 @@ func PublisherHandler(c *gin.Context) {
 
 			p.ID = id
 			tx := mustBeginTx(c)
+			a := startAudit(c, tx, AUDIT_PUBLISHER, id)
 			resp, err = handleUpdatePublisher(tx, &p)
-			mustConcludeTx(tx, err)
-
 			if err == nil {
-				emitEvents(c, events.PublisherUpdateEvent(&resp.(*Publisher).Publisher))
+				err = a.conclude(tx)
+			}
+			if err == nil {
+				err = emitEvents(c, tx, a.withDiffs(events.PublisherUpdateEvent(&resp.(*Publisher).Publisher))...)
 			}
+			mustConcludeTx(tx, err)
 		}
 	}
 
@@ -1387,12 +1662,15 @@ func PublisherI18nHandler(c *gin.Context) {
 	}
 
 	tx := mustBeginTx(c)
+	a := startAudit(c, tx, AUDIT_PUBLISHER, id)
 	resp, err := handleUpdatePublisherI18n(tx, id, i18ns)
-	mustConcludeTx(tx, err)
-
 	if err == nil {
-		emitEvents(c, events.PublisherUpdateEvent(&resp.Publisher))
+		err = a.conclude(tx)
 	}
+	if err == nil {
+		err = emitEvents(c, tx, a.withDiffs(events.PublisherUpdateEvent(&resp.Publisher))...)
+	}
+	mustConcludeTx(tx, err)
 
 	concludeRequest(c, resp, err)
 }
@@ -1416,7 +1694,7 @@ func StoragesHandler(c *gin.Context) {
 
 func handleCollectionsList(cp utils.ContextProvider, exec boil.Executor, r CollectionsRequest) (*CollectionsResponse, *HttpError) {
 	mods := make([]qm.QueryMod, 0)
-	appendPermissionsMods(cp, &mods)
+	appendPermissionsMods(cp, &mods, SEARCH_IN_COLLECTIONS)
 
 	// filters
 	if err := appendIDsFilterMods(&mods, r.IDsFilter); err != nil {
@@ -1435,11 +1713,12 @@ func handleCollectionsList(cp utils.ContextProvider, exec boil.Executor, r Colle
 	if err := appendSecureFilterMods(&mods, r.SecureFilter); err != nil {
 		return nil, NewBadRequestError(err)
 	}
-	if err := appendSearchTermFilterMods(exec, &mods, r.SearchTermFilter, SEARCH_IN_COLLECTIONS); err != nil {
+	if err := appendSearchTermFilterMods(&mods, r.SearchTermFilter, SEARCH_IN_COLLECTIONS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
 	appendPublishedFilterMods(&mods, r.PublishedFilter)
+	appendRemovedFilterMods(&mods, r.RemovedFilter)
 
 	// count query
 	var total int64
@@ -1453,7 +1732,12 @@ func handleCollectionsList(cp utils.ContextProvider, exec boil.Executor, r Colle
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	// ranked results have no next_cursor
+	ranked := r.OrderBy == "" && r.Cursor == "" && r.Query != ""
+	if ranked {
+		appendSearchRankMods(&mods, r.SearchTermFilter, SEARCH_IN_COLLECTIONS)
+	}
+	if err = appendListMods(&mods, r.ListRequest, COLLECTION_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -1477,15 +1761,20 @@ func handleCollectionsList(cp utils.ContextProvider, exec boil.Executor, r Colle
 		}
 	}
 
-	return &CollectionsResponse{
+	resp := &CollectionsResponse{
 		ListResponse: ListResponse{Total: total},
 		Collections:  data,
-	}, nil
+	}
+	if !ranked {
+		resp.NextCursor = nextListCursor(r.ListRequest, COLLECTION_SORT_FIELDS, data)
+	}
+
+	return resp, nil
 }
 
 func handleCreateCollection(cp utils.ContextProvider, exec boil.Executor, c Collection) (*Collection, *HttpError) {
 	// check object level permissions
-	if !can(cp, secureToPermission(c.Secure), PERM_WRITE) {
+	if !canCollection(cp, &c.Collection, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1518,7 +1807,7 @@ func handleCreateCollection(cp utils.ContextProvider, exec boil.Executor, c Coll
 
 func handleGetCollection(cp utils.ContextProvider, exec boil.Executor, id int64) (*Collection, *HttpError) {
 	collection, err := models.Collections(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("CollectionI18ns")).
 		One()
 	if err != nil {
@@ -1530,7 +1819,7 @@ func handleGetCollection(cp utils.ContextProvider, exec boil.Executor, id int64)
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_READ) {
+	if !canCollection(cp, collection, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1544,19 +1833,19 @@ func handleGetCollection(cp utils.ContextProvider, exec boil.Executor, id int64)
 	return x, nil
 }
 
-func handleUpdateCollection(cp utils.ContextProvider, exec boil.Executor, c *PartialCollection) (*Collection, *HttpError) {
-	collection, err := models.FindCollection(exec, c.ID)
+func handleUpdateCollection(cp utils.ContextProvider, exec boil.Executor, c *PartialCollection) (*Collection, []events.Event, *HttpError) {
+	collection, err := findCollection(exec, c.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, NewNotFoundError()
+			return nil, nil, NewNotFoundError()
 		} else {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_WRITE) {
-		return nil, NewForbiddenError()
+	if !canCollection(cp, collection, PERM_WRITE) {
+		return nil, nil, NewForbiddenError()
 	}
 
 	// update entity attributes
@@ -1564,7 +1853,7 @@ func handleUpdateCollection(cp utils.ContextProvider, exec boil.Executor, c *Par
 		collection.Secure = c.Secure.Int16
 		err = collection.Update(exec, "secure")
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
@@ -1573,16 +1862,25 @@ func handleUpdateCollection(cp utils.ContextProvider, exec boil.Executor, c *Par
 		var props map[string]interface{}
 		err = c.Properties.Unmarshal(&props)
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 
 		err = UpdateCollectionProperties(exec, collection, props)
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
-	return handleGetCollection(cp, exec, c.ID)
+	resp, herr := handleGetCollection(cp, exec, c.ID)
+	if herr != nil {
+		return nil, nil, herr
+	}
+
+	evnts := []events.Event{
+		events.CollectionUpdateEvent(&resp.Collection),
+	}
+
+	return resp, evnts, nil
 }
 
 func handleDeleteCollection(cp utils.ContextProvider, exec boil.Executor, id int64) (*models.Collection, *HttpError) {
@@ -1595,27 +1893,51 @@ func handleDeleteCollection(cp utils.ContextProvider, exec boil.Executor, id int
 		}
 	}
 
+	if collection.RemovedAt.Valid {
+		return nil, NewNotFoundError()
+	}
+
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_WRITE) {
+	if !canCollection(cp, collection, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
-	err = models.CollectionsContentUnits(exec, qm.Where("collection_id = ?", id)).DeleteAll()
+	// relations are kept so that a restore would bring them back
+	collection.RemovedAt = null.TimeFrom(time.Now().UTC())
+	err = collection.Update(exec, "removed_at")
 	if err != nil {
 		return nil, NewInternalError(err)
 	}
 
-	err = models.CollectionI18ns(exec, qm.Where("collection_id = ?", id)).DeleteAll()
+	return collection, nil
+}
+
+func handleRestoreCollection(cp utils.ContextProvider, exec boil.Executor, id int64) (*Collection, *HttpError) {
+	collection, err := models.FindCollection(exec, id)
 	if err != nil {
-		return nil, NewInternalError(err)
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !canCollection(cp, collection, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	if !collection.RemovedAt.Valid {
+		return nil, NewBadRequestError(errors.Errorf("Collection %d is not removed", id))
 	}
 
-	err = collection.Delete(exec)
+	collection.RemovedAt = null.NewTime(time.Unix(0, 0), false)
+	err = collection.Update(exec, "removed_at")
 	if err != nil {
 		return nil, NewInternalError(err)
 	}
 
-	return collection, nil
+	return handleGetCollection(cp, exec, id)
 }
 
 func handleUpdateCollectionI18n(cp utils.ContextProvider, exec boil.Executor, id int64, i18ns []*models.CollectionI18n) (*Collection, *HttpError) {
@@ -1625,7 +1947,7 @@ func handleUpdateCollectionI18n(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_I18N_WRITE) {
+	if !canCollection(cp, &collection.Collection, PERM_I18N_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1656,7 +1978,7 @@ func handleUpdateCollectionI18n(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleCollectionActivate(cp utils.ContextProvider, exec boil.Executor, id int64) (*Collection, *HttpError) {
-	collection, err := models.FindCollection(exec, id)
+	collection, err := findCollection(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -1666,7 +1988,7 @@ func handleCollectionActivate(cp utils.ContextProvider, exec boil.Executor, id i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_WRITE) {
+	if !canCollection(cp, collection, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1696,7 +2018,7 @@ func handleCollectionActivate(cp utils.ContextProvider, exec boil.Executor, id i
 }
 
 func handleCollectionCCU(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*CollectionContentUnit, *HttpError) {
-	collection, err := models.FindCollection(exec, id)
+	collection, err := findCollection(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -1706,7 +2028,7 @@ func handleCollectionCCU(cp utils.ContextProvider, exec boil.Executor, id int64)
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(collection.Secure), PERM_READ) {
+	if !canCollection(cp, collection, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1725,7 +2047,8 @@ func handleCollectionCCU(cp utils.ContextProvider, exec boil.Executor, id int64)
 		ids[i] = ccu.ContentUnitID
 	}
 	cus, err := models.ContentUnits(exec,
-		qm.Where("secure <= ?", allowedRead(cp)),
+		permissionsMod(cp, SEARCH_IN_CONTENT_UNITS, PERM_READ),
+		qm.Where("removed_at IS NULL"),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
 		qm.Load("ContentUnitI18ns")).
 		All()
@@ -1756,7 +2079,7 @@ func handleCollectionCCU(cp utils.ContextProvider, exec boil.Executor, id int64)
 }
 
 func handleCollectionAddCCU(cp utils.ContextProvider, exec boil.Executor, id int64, ccus []*models.CollectionsContentUnit) ([]events.Event, *HttpError) {
-	c, err := models.FindCollection(exec, id)
+	c, err := findCollection(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -1766,7 +2089,7 @@ func handleCollectionAddCCU(cp utils.ContextProvider, exec boil.Executor, id int
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(c.Secure), PERM_WRITE) {
+	if !canCollection(cp, c, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1774,7 +2097,7 @@ func handleCollectionAddCCU(cp utils.ContextProvider, exec boil.Executor, id int
 	evnts[0] = events.CollectionContentUnitsChangeEvent(c)
 
 	for _, ccu := range ccus {
-		cu, err := models.FindContentUnit(exec, ccu.ContentUnitID)
+		cu, err := findContentUnit(exec, ccu.ContentUnitID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return nil, NewBadRequestError(errors.Errorf("Unknown content unit id %d", ccu.ContentUnitID))
@@ -1782,6 +2105,9 @@ func handleCollectionAddCCU(cp utils.ContextProvider, exec boil.Executor, id int
 				return nil, NewInternalError(err)
 			}
 		}
+		if !canContentUnit(cp, exec, cu, PERM_WRITE) {
+			return nil, NewForbiddenError()
+		}
 
 		exists, err := models.CollectionsContentUnits(exec,
 			qm.Where("collection_id = ? AND content_unit_id = ?", id, ccu.ContentUnitID)).
@@ -1811,7 +2137,7 @@ func handleCollectionAddCCU(cp utils.ContextProvider, exec boil.Executor, id int
 }
 
 func handleCollectionUpdateCCU(cp utils.ContextProvider, exec boil.Executor, id int64, ccu models.CollectionsContentUnit) (*events.Event, *HttpError) {
-	c, err := models.FindCollection(exec, id)
+	c, err := findCollection(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -1821,7 +2147,7 @@ func handleCollectionUpdateCCU(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(c.Secure), PERM_WRITE) {
+	if !canCollection(cp, c, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1834,6 +2160,10 @@ func handleCollectionUpdateCCU(cp utils.ContextProvider, exec boil.Executor, id
 		}
 	}
 
+	if httpErr := checkCCUContentUnit(cp, exec, ccu.ContentUnitID); httpErr != nil {
+		return nil, httpErr
+	}
+
 	mCCU.Name = ccu.Name
 	mCCU.Position = ccu.Position
 	err = mCCU.Update(exec, "name", "position")
@@ -1847,7 +2177,7 @@ func handleCollectionUpdateCCU(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleCollectionRemoveCCU(cp utils.ContextProvider, exec boil.Executor, id int64, cuID int64) ([]events.Event, *HttpError) {
-	c, err := models.FindCollection(exec, id)
+	c, err := findCollection(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -1857,7 +2187,7 @@ func handleCollectionRemoveCCU(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(c.Secure), PERM_WRITE) {
+	if !canCollection(cp, c, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -1870,6 +2200,10 @@ func handleCollectionRemoveCCU(cp utils.ContextProvider, exec boil.Executor, id
 		}
 	}
 
+	if httpErr := checkCCUContentUnit(cp, exec, cuID); httpErr != nil {
+		return nil, httpErr
+	}
+
 	err = ccu.Delete(exec)
 	if err != nil {
 		return nil, NewInternalError(err)
@@ -1899,9 +2233,21 @@ func handleCollectionRemoveCCU(cp utils.ContextProvider, exec boil.Executor, id
 	return evnts, nil
 }
 
+// checkCCUContentUnit checks the content unit of an association may be written too
+func checkCCUContentUnit(cp utils.ContextProvider, exec boil.Executor, cuID int64) *HttpError {
+	cu, err := models.FindContentUnit(exec, cuID)
+	if err != nil {
+		return NewInternalError(err)
+	}
+	if !canContentUnit(cp, exec, cu, PERM_WRITE) {
+		return NewForbiddenError()
+	}
+	return nil
+}
+
 func handleContentUnitsList(cp utils.ContextProvider, exec boil.Executor, r ContentUnitsRequest) (*ContentUnitsResponse, *HttpError) {
 	mods := make([]qm.QueryMod, 0)
-	appendPermissionsMods(cp, &mods)
+	appendPermissionsMods(cp, &mods, SEARCH_IN_CONTENT_UNITS)
 
 	// filters
 	if err := appendIDsFilterMods(&mods, r.IDsFilter); err != nil {
@@ -1927,13 +2273,15 @@ func handleContentUnitsList(cp utils.ContextProvider, exec boil.Executor, r Cont
 	if err := appendTagsFilterMods(exec, &mods, r.TagsFilter); err != nil {
 		return nil, NewInternalError(err)
 	}
-	if err := appendSearchTermFilterMods(exec, &mods, r.SearchTermFilter, SEARCH_IN_CONTENT_UNITS); err != nil {
+	appendCollectionFilterMods(&mods, r.CollectionFilter)
+	if err := appendSearchTermFilterMods(&mods, r.SearchTermFilter, SEARCH_IN_CONTENT_UNITS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 	if err := appendSecureFilterMods(&mods, r.SecureFilter); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 	appendPublishedFilterMods(&mods, r.PublishedFilter)
+	appendRemovedFilterMods(&mods, r.RemovedFilter)
 
 	// count query
 	var total int64
@@ -1947,7 +2295,12 @@ func handleContentUnitsList(cp utils.ContextProvider, exec boil.Executor, r Cont
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	// ranked results have no next_cursor
+	ranked := r.OrderBy == "" && r.Cursor == "" && r.Query != ""
+	if ranked {
+		appendSearchRankMods(&mods, r.SearchTermFilter, SEARCH_IN_CONTENT_UNITS)
+	}
+	if err = appendListMods(&mods, r.ListRequest, contentUnitSortFields(r.Collection)); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -1971,15 +2324,20 @@ func handleContentUnitsList(cp utils.ContextProvider, exec boil.Executor, r Cont
 		}
 	}
 
-	return &ContentUnitsResponse{
+	resp := &ContentUnitsResponse{
 		ListResponse: ListResponse{Total: total},
 		ContentUnits: data,
-	}, nil
+	}
+	if !ranked {
+		resp.NextCursor = nextListCursor(r.ListRequest, contentUnitSortFields(r.Collection), data)
+	}
+
+	return resp, nil
 }
 
 func handleGetContentUnit(cp utils.ContextProvider, exec boil.Executor, id int64) (*ContentUnit, *HttpError) {
 	unit, err := models.ContentUnits(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("ContentUnitI18ns")).
 		One()
 	if err != nil {
@@ -1991,7 +2349,7 @@ func handleGetContentUnit(cp utils.ContextProvider, exec boil.Executor, id int64
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2007,7 +2365,7 @@ func handleGetContentUnit(cp utils.ContextProvider, exec boil.Executor, id int64
 
 func handleCreateContentUnit(cp utils.ContextProvider, exec boil.Executor, cu ContentUnit) (*ContentUnit, *HttpError) {
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, &cu.ContentUnit, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2038,26 +2396,26 @@ func handleCreateContentUnit(cp utils.ContextProvider, exec boil.Executor, cu Co
 	return handleGetContentUnit(cp, exec, unit.ID)
 }
 
-func handleUpdateContentUnit(cp utils.ContextProvider, exec boil.Executor, cu *PartialContentUnit) (*ContentUnit, *HttpError) {
-	unit, err := models.FindContentUnit(exec, cu.ID)
+func handleUpdateContentUnit(cp utils.ContextProvider, exec boil.Executor, cu *PartialContentUnit) (*ContentUnit, []events.Event, *HttpError) {
+	unit, err := findContentUnit(exec, cu.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, NewNotFoundError()
+			return nil, nil, NewNotFoundError()
 		} else {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_WRITE) {
-		return nil, NewForbiddenError()
+	if !canContentUnit(cp, exec, unit, PERM_WRITE) {
+		return nil, nil, NewForbiddenError()
 	}
 
 	if cu.Secure.Valid {
 		unit.Secure = cu.Secure.Int16
 		err = unit.Update(exec, "secure")
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
@@ -2066,16 +2424,25 @@ func handleUpdateContentUnit(cp utils.ContextProvider, exec boil.Executor, cu *P
 		var props map[string]interface{}
 		err = cu.Properties.Unmarshal(&props)
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 
 		err = UpdateContentUnitProperties(exec, unit, props)
 		if err != nil {
-			return nil, NewInternalError(err)
+			return nil, nil, NewInternalError(err)
 		}
 	}
 
-	return handleGetContentUnit(cp, exec, cu.ID)
+	resp, herr := handleGetContentUnit(cp, exec, cu.ID)
+	if herr != nil {
+		return nil, nil, herr
+	}
+
+	evnts := []events.Event{
+		events.ContentUnitUpdateEvent(&resp.ContentUnit),
+	}
+
+	return resp, evnts, nil
 }
 
 func handleUpdateContentUnitI18n(cp utils.ContextProvider, exec boil.Executor, id int64, i18ns []*models.ContentUnitI18n) (*ContentUnit, *HttpError) {
@@ -2085,7 +2452,7 @@ func handleUpdateContentUnitI18n(cp utils.ContextProvider, exec boil.Executor, i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_I18N_WRITE) {
+	if !canContentUnit(cp, exec, &unit.ContentUnit, PERM_I18N_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2116,7 +2483,7 @@ func handleUpdateContentUnitI18n(cp utils.ContextProvider, exec boil.Executor, i
 }
 
 func handleContentUnitFiles(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*MFile, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2126,12 +2493,12 @@ func handleContentUnitFiles(cp utils.ContextProvider, exec boil.Executor, id int
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
 	files, err := models.Files(exec,
-		qm.Where("secure <= ?", allowedRead(cp)),
+		permissionsMod(cp, SEARCH_IN_FILES, PERM_READ),
 		qm.Where("content_unit_id = ?", id)).
 		All()
 	if err != nil {
@@ -2147,7 +2514,7 @@ func handleContentUnitFiles(cp utils.ContextProvider, exec boil.Executor, id int
 }
 
 func handleContentUnitAddFiles(cp utils.ContextProvider, exec boil.Executor, id int64, fileIDs []int64) (*ContentUnit, []events.Event, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil, NewNotFoundError()
@@ -2157,14 +2524,14 @@ func handleContentUnitAddFiles(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, unit, PERM_WRITE) {
 		return nil, nil, NewForbiddenError()
 	}
 
 	// fetch files
 	// With respect to write permissions (as we're about to modify them)
 	files, err := models.Files(exec,
-		qm.Where("secure <= ?", allowedWrite(cp)),
+		permissionsMod(cp, SEARCH_IN_FILES, PERM_WRITE),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(fileIDs)...)).
 		All()
 	if err != nil {
@@ -2183,6 +2550,7 @@ func handleContentUnitAddFiles(cp utils.ContextProvider, exec boil.Executor, id
 	possiblyEffectedCUs := make(map[int64]bool)
 	for i := range files {
 		f := files[i]
+		before := *f
 		fCUID := f.ContentUnitID.Int64
 		if fCUID == id {
 			continue
@@ -2194,7 +2562,7 @@ func handleContentUnitAddFiles(cp utils.ContextProvider, exec boil.Executor, id
 		}
 
 		changedIDs = append(changedIDs, f.ID)
-		evnts = append(evnts, events.FileUpdateEvent(f))
+		evnts = append(evnts, events.FileUpdateEvent(f).WithDiff(&before, f))
 
 		if f.Published {
 			somePublished = true
@@ -2231,7 +2599,7 @@ func handleContentUnitAddFiles(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleContentUnitCCU(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*CollectionContentUnit, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2241,7 +2609,7 @@ func handleContentUnitCCU(cp utils.ContextProvider, exec boil.Executor, id int64
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2259,7 +2627,8 @@ func handleContentUnitCCU(cp utils.ContextProvider, exec boil.Executor, id int64
 		ids[i] = ccu.CollectionID
 	}
 	cs, err := models.Collections(exec,
-		qm.Where("secure <= ?", allowedRead(cp)),
+		permissionsMod(cp, SEARCH_IN_COLLECTIONS, PERM_READ),
+		qm.Where("removed_at IS NULL"),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
 		qm.Load("CollectionI18ns")).
 		All()
@@ -2290,7 +2659,7 @@ func handleContentUnitCCU(cp utils.ContextProvider, exec boil.Executor, id int64
 }
 
 func handleContentUnitCUD(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*ContentUnitDerivation, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2300,7 +2669,7 @@ func handleContentUnitCUD(cp utils.ContextProvider, exec boil.Executor, id int64
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2318,7 +2687,8 @@ func handleContentUnitCUD(cp utils.ContextProvider, exec boil.Executor, id int64
 		ids[i] = cuds[i].DerivedID
 	}
 	cus, err := models.ContentUnits(exec,
-		qm.Where("secure <= ?", allowedRead(cp)),
+		permissionsMod(cp, SEARCH_IN_CONTENT_UNITS, PERM_READ),
+		qm.Where("removed_at IS NULL"),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
 		qm.Load("ContentUnitI18ns")).
 		All()
@@ -2348,7 +2718,7 @@ func handleContentUnitCUD(cp utils.ContextProvider, exec boil.Executor, id int64
 }
 
 func handleContentUnitAddCUD(cp utils.ContextProvider, exec boil.Executor, id int64, cud models.ContentUnitDerivation) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2358,7 +2728,7 @@ func handleContentUnitAddCUD(cp utils.ContextProvider, exec boil.Executor, id in
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2391,7 +2761,7 @@ func handleContentUnitAddCUD(cp utils.ContextProvider, exec boil.Executor, id in
 }
 
 func handleContentUnitUpdateCUD(cp utils.ContextProvider, exec boil.Executor, id int64, cud models.ContentUnitDerivation) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2401,7 +2771,7 @@ func handleContentUnitUpdateCUD(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2424,7 +2794,7 @@ func handleContentUnitUpdateCUD(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleContentUnitRemoveCUD(cp utils.ContextProvider, exec boil.Executor, id int64, duID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2434,7 +2804,7 @@ func handleContentUnitRemoveCUD(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2456,7 +2826,7 @@ func handleContentUnitRemoveCUD(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleContentUnitOrigins(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*ContentUnitDerivation, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2466,7 +2836,7 @@ func handleContentUnitOrigins(cp utils.ContextProvider, exec boil.Executor, id i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2484,7 +2854,8 @@ func handleContentUnitOrigins(cp utils.ContextProvider, exec boil.Executor, id i
 		ids[i] = cuds[i].SourceID
 	}
 	cus, err := models.ContentUnits(exec,
-		qm.Where("secure <= ?", allowedRead(cp)),
+		permissionsMod(cp, SEARCH_IN_CONTENT_UNITS, PERM_READ),
+		qm.Where("removed_at IS NULL"),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
 		qm.Load("ContentUnitI18ns")).
 		All()
@@ -2515,7 +2886,7 @@ func handleContentUnitOrigins(cp utils.ContextProvider, exec boil.Executor, id i
 
 func handleGetContentUnitSources(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*Source, *HttpError) {
 	unit, err := models.ContentUnits(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("Sources", "Sources.SourceI18ns")).
 		One()
 
@@ -2528,7 +2899,7 @@ func handleGetContentUnitSources(cp utils.ContextProvider, exec boil.Executor, i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2546,7 +2917,7 @@ func handleGetContentUnitSources(cp utils.ContextProvider, exec boil.Executor, i
 }
 
 func handleContentUnitAddSource(cp utils.ContextProvider, exec boil.Executor, id int64, sourceID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2556,7 +2927,7 @@ func handleContentUnitAddSource(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2591,7 +2962,7 @@ func handleContentUnitAddSource(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleContentUnitRemoveSource(cp utils.ContextProvider, exec boil.Executor, id int64, sourceID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2601,7 +2972,7 @@ func handleContentUnitRemoveSource(cp utils.ContextProvider, exec boil.Executor,
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2624,7 +2995,7 @@ func handleContentUnitRemoveSource(cp utils.ContextProvider, exec boil.Executor,
 
 func handleGetContentUnitTags(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*Tag, *HttpError) {
 	unit, err := models.ContentUnits(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("Tags", "Tags.TagI18ns")).
 		One()
 
@@ -2637,7 +3008,7 @@ func handleGetContentUnitTags(cp utils.ContextProvider, exec boil.Executor, id i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2655,7 +3026,7 @@ func handleGetContentUnitTags(cp utils.ContextProvider, exec boil.Executor, id i
 }
 
 func handleContentUnitAddTag(cp utils.ContextProvider, exec boil.Executor, id int64, tagID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2665,7 +3036,7 @@ func handleContentUnitAddTag(cp utils.ContextProvider, exec boil.Executor, id in
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2700,7 +3071,7 @@ func handleContentUnitAddTag(cp utils.ContextProvider, exec boil.Executor, id in
 }
 
 func handleContentUnitRemoveTag(cp utils.ContextProvider, exec boil.Executor, id int64, tagID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2710,7 +3081,7 @@ func handleContentUnitRemoveTag(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2733,7 +3104,7 @@ func handleContentUnitRemoveTag(cp utils.ContextProvider, exec boil.Executor, id
 
 func handleGetContentUnitPersons(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*ContentUnitPerson, *HttpError) {
 	unit, err := models.ContentUnits(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("ContentUnitsPersons",
 			"ContentUnitsPersons.Person",
 			"ContentUnitsPersons.Person.PersonI18ns")).
@@ -2748,25 +3119,28 @@ func handleGetContentUnitPersons(cp utils.ContextProvider, exec boil.Executor, i
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
-	data := make([]*ContentUnitPerson, len(unit.R.ContentUnitsPersons))
-	for i, cup := range unit.R.ContentUnitsPersons {
+	data := make([]*ContentUnitPerson, 0, len(unit.R.ContentUnitsPersons))
+	for _, cup := range unit.R.ContentUnitsPersons {
+		if cup.R.Person.RemovedAt.Valid {
+			continue
+		}
 		p := &Person{Person: *cup.R.Person}
 		p.I18n = make(map[string]*models.PersonI18n, len(cup.R.Person.R.PersonI18ns))
 		for _, i18n := range cup.R.Person.R.PersonI18ns {
 			p.I18n[i18n.Language] = i18n
 		}
-		data[i] = &ContentUnitPerson{Person: p, RoleID: cup.RoleID}
+		data = append(data, &ContentUnitPerson{Person: p, RoleID: cup.RoleID})
 	}
 
 	return data, nil
 }
 
 func handleContentUnitAddPerson(cp utils.ContextProvider, exec boil.Executor, id int64, cup models.ContentUnitsPerson) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2776,7 +3150,7 @@ func handleContentUnitAddPerson(cp utils.ContextProvider, exec boil.Executor, id
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2822,7 +3196,7 @@ func handleContentUnitAddPerson(cp utils.ContextProvider, exec boil.Executor, id
 }
 
 func handleContentUnitRemovePerson(cp utils.ContextProvider, exec boil.Executor, id int64, personID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2832,7 +3206,7 @@ func handleContentUnitRemovePerson(cp utils.ContextProvider, exec boil.Executor,
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2855,7 +3229,7 @@ func handleContentUnitRemovePerson(cp utils.ContextProvider, exec boil.Executor,
 
 func handleGetContentUnitPublishers(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*Publisher, *HttpError) {
 	unit, err := models.ContentUnits(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("Publishers", "Publishers.PublisherI18ns")).
 		One()
 
@@ -2868,7 +3242,7 @@ func handleGetContentUnitPublishers(cp utils.ContextProvider, exec boil.Executor
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_READ) {
+	if !canContentUnit(cp, exec, unit, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2886,7 +3260,7 @@ func handleGetContentUnitPublishers(cp utils.ContextProvider, exec boil.Executor
 }
 
 func handleContentUnitAddPublisher(cp utils.ContextProvider, exec boil.Executor, id int64, publisherID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2896,7 +3270,7 @@ func handleContentUnitAddPublisher(cp utils.ContextProvider, exec boil.Executor,
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2931,7 +3305,7 @@ func handleContentUnitAddPublisher(cp utils.ContextProvider, exec boil.Executor,
 }
 
 func handleContentUnitRemovePublisher(cp utils.ContextProvider, exec boil.Executor, id int64, publisherID int64) (*models.ContentUnit, *HttpError) {
-	cu, err := models.FindContentUnit(exec, id)
+	cu, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -2941,7 +3315,7 @@ func handleContentUnitRemovePublisher(cp utils.ContextProvider, exec boil.Execut
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(cu.Secure), PERM_METADATA_WRITE) {
+	if !canContentUnit(cp, exec, cu, PERM_METADATA_WRITE) {
 		return nil, NewForbiddenError()
 	}
 
@@ -2963,7 +3337,7 @@ func handleContentUnitRemovePublisher(cp utils.ContextProvider, exec boil.Execut
 }
 
 func handleContentUnitMerge(cp utils.ContextProvider, exec boil.Executor, id int64, cuIDs []int64) (*ContentUnit, []events.Event, *HttpError) {
-	unit, err := models.FindContentUnit(exec, id)
+	unit, err := findContentUnit(exec, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil, NewNotFoundError()
@@ -2973,15 +3347,16 @@ func handleContentUnitMerge(cp utils.ContextProvider, exec boil.Executor, id int
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(unit.Secure), PERM_WRITE) {
+	if !canContentUnit(cp, exec, unit, PERM_WRITE) {
 		return nil, nil, NewForbiddenError()
 	}
 
 	// fetch units to be merged
 	// With respect to write permissions (as we're about to modify them)
 	units, err := models.ContentUnits(exec,
-		qm.Where("secure <= ?", allowedWrite(cp)),
+		permissionsMod(cp, SEARCH_IN_CONTENT_UNITS, PERM_WRITE),
 		qm.WhereIn("id in ?", utils.ConvertArgsInt64(cuIDs)...),
+		qm.Where("removed_at IS NULL"),
 		qm.Load("Files")).
 		All()
 	if err != nil {
@@ -3013,7 +3388,10 @@ func handleContentUnitMerge(cp utils.ContextProvider, exec boil.Executor, id int
 			return nil, nil, NewInternalError(err)
 		}
 		for i := range cu.R.Files {
-			evnts = append(evnts, events.FileUpdateEvent(cu.R.Files[i]))
+			f := cu.R.Files[i]
+			before := *f
+			f.ContentUnitID = null.Int64From(unit.ID)
+			evnts = append(evnts, events.FileUpdateEvent(f).WithDiff(&before, f))
 		}
 
 		// move derivations
@@ -3021,46 +3399,341 @@ func handleContentUnitMerge(cp utils.ContextProvider, exec boil.Executor, id int
 		if err != nil {
 			return nil, nil, NewInternalError(err)
 		}
-		for i := range cu.R.DerivedContentUnitDerivations {
-			evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(
-				cu.R.DerivedContentUnitDerivations[i].R.Source))
+		for i := range cu.R.DerivedContentUnitDerivations {
+			evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(
+				cu.R.DerivedContentUnitDerivations[i].R.Source))
+		}
+
+		err = cu.R.SourceContentUnitDerivations.UpdateAll(exec, models.M{"source_id": unit.ID})
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		if len(cu.R.SourceContentUnitDerivations) > 0 {
+			cuDerivativesChange = true
+		}
+
+		// remove unit, nothing is left in it to restore
+		err = PurgeContentUnit(exec, cu)
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		evnts = append(evnts, events.ContentUnitDeleteEvent(cu))
+	}
+
+	if cuDerivativesChange {
+		evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(unit))
+	}
+
+	// published status may change for host unit and it's related collections
+	impact, err := FileAddedUnitImpact(exec, somePublished, unit.ID)
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+	evnts = append(evnts, impact.Events()...)
+
+	resp, herr := handleGetContentUnit(cp, exec, id)
+
+	return resp, evnts, herr
+}
+
+func handleContentUnitSplit(cp utils.ContextProvider, exec boil.Executor, id int64, r ContentUnitSplitRequest) ([]*ContentUnit, []events.Event, *HttpError) {
+	unit, err := models.ContentUnits(exec,
+		qm.Where("id = ? AND removed_at IS NULL", id),
+		qm.Load("Files", "CollectionsContentUnits", "SourceContentUnitDerivations",
+			"DerivedContentUnitDerivations")).
+		One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, NewNotFoundError()
+		} else {
+			return nil, nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !canContentUnit(cp, exec, unit, PERM_WRITE) {
+		return nil, nil, NewForbiddenError()
+	}
+
+	// validate everything we're asked to move belongs to the unit, and only once
+	filesByID := make(map[int64]*models.File, len(unit.R.Files))
+	for _, f := range unit.R.Files {
+		filesByID[f.ID] = f
+	}
+	derivatives := make(map[int64]bool, len(unit.R.SourceContentUnitDerivations))
+	for _, cud := range unit.R.SourceContentUnitDerivations {
+		derivatives[cud.DerivedID] = true
+	}
+	origins := make(map[int64]bool, len(unit.R.DerivedContentUnitDerivations))
+	for _, cud := range unit.R.DerivedContentUnitDerivations {
+		origins[cud.SourceID] = true
+	}
+	collections := make(map[int64]bool, len(unit.R.CollectionsContentUnits))
+	for _, ccu := range unit.R.CollectionsContentUnits {
+		collections[ccu.CollectionID] = true
+	}
+
+	seen := make(map[string]bool)
+	checkAndMark := func(kind string, belongs map[int64]bool, ids []int64) *HttpError {
+		for _, x := range ids {
+			if !belongs[x] {
+				return NewBadRequestError(errors.Errorf("%s %d does not belong to content unit %d", kind, x, id))
+			}
+			k := fmt.Sprintf("%s_%d", kind, x)
+			if seen[k] {
+				return NewBadRequestError(errors.Errorf("%s %d appears more than once", kind, x))
+			}
+			seen[k] = true
+		}
+		return nil
+	}
+	fileIDs := make(map[int64]bool, len(filesByID))
+	for k := range filesByID {
+		fileIDs[k] = true
+	}
+	for _, x := range r.Units {
+		if err := checkAndMark("file", fileIDs, x.Files); err != nil {
+			return nil, nil, err
+		}
+		if err := checkAndMark("derivative", derivatives, x.Derivatives); err != nil {
+			return nil, nil, err
+		}
+		if err := checkAndMark("origin", origins, x.Origins); err != nil {
+			return nil, nil, err
+		}
+		if err := checkAndMark("collection", collections, x.Collections); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ct := CONTENT_TYPE_REGISTRY.ByID[unit.TypeID].Name
+	var props map[string]interface{}
+	if unit.Properties.Valid {
+		if err := unit.Properties.Unmarshal(&props); err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "json.Unmarshal properties"))
+		}
+	}
+
+	evnts := make([]events.Event, 0)
+	newUnits := make([]*models.ContentUnit, len(r.Units))
+	someLeftPublished := false
+	cuDerivativesChange := false
+	changedCollections := make([]int64, 0)
+	changedOrigins := make([]int64, 0)
+	for i, x := range r.Units {
+		cu, err := CreateContentUnit(exec, ct, props)
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		if cu.Secure != unit.Secure {
+			cu.Secure = unit.Secure
+			if err := cu.Update(exec, "secure"); err != nil {
+				return nil, nil, NewInternalError(err)
+			}
+		}
+		newUnits[i] = cu
+		log.Infof("Splitting CU %d into CU %d", unit.ID, cu.ID)
+
+		// inherit associations
+		for _, q := range []string{
+			"INSERT INTO content_units_sources (content_unit_id, source_id) SELECT $1, source_id FROM content_units_sources WHERE content_unit_id = $2",
+			"INSERT INTO content_units_tags (content_unit_id, tag_id) SELECT $1, tag_id FROM content_units_tags WHERE content_unit_id = $2",
+			"INSERT INTO content_units_persons (content_unit_id, person_id, role_id) SELECT $1, person_id, role_id FROM content_units_persons WHERE content_unit_id = $2",
+		} {
+			if _, err := queries.Raw(exec, q, cu.ID, unit.ID).Exec(); err != nil {
+				return nil, nil, NewInternalError(errors.Wrap(err, "Copy associations"))
+			}
+		}
+
+		// move files
+		somePublished := false
+		for _, fID := range x.Files {
+			f := filesByID[fID]
+			if f.Published && !f.RemovedAt.Valid {
+				somePublished = true
+			}
+			before := *f
+			f.ContentUnitID = null.Int64From(cu.ID)
+			if err := f.Update(exec, "content_unit_id"); err != nil {
+				return nil, nil, NewInternalError(err)
+			}
+			evnts = append(evnts, events.FileUpdateEvent(f).WithDiff(&before, f))
+		}
+		someLeftPublished = someLeftPublished || somePublished
+
+		// move derivations
+		if len(x.Derivatives) > 0 {
+			_, err := queries.Raw(exec,
+				"UPDATE content_unit_derivations SET source_id = $1 WHERE source_id = $2 AND derived_id = ANY($3)",
+				cu.ID, unit.ID, pq.Array(x.Derivatives)).Exec()
+			if err != nil {
+				return nil, nil, NewInternalError(errors.Wrap(err, "Move derivatives"))
+			}
+			cuDerivativesChange = true
+		}
+		if len(x.Origins) > 0 {
+			_, err := queries.Raw(exec,
+				"UPDATE content_unit_derivations SET derived_id = $1 WHERE derived_id = $2 AND source_id = ANY($3)",
+				cu.ID, unit.ID, pq.Array(x.Origins)).Exec()
+			if err != nil {
+				return nil, nil, NewInternalError(errors.Wrap(err, "Move origins"))
+			}
+			changedOrigins = append(changedOrigins, x.Origins...)
+		}
+
+		// move collection memberships
+		if len(x.Collections) > 0 {
+			_, err := queries.Raw(exec,
+				"UPDATE collections_content_units SET content_unit_id = $1 WHERE content_unit_id = $2 AND collection_id = ANY($3)",
+				cu.ID, unit.ID, pq.Array(x.Collections)).Exec()
+			if err != nil {
+				return nil, nil, NewInternalError(errors.Wrap(err, "Move collection memberships"))
+			}
+			changedCollections = append(changedCollections, x.Collections...)
+		}
+
+		log.Infof("Describing content unit [%d]", cu.ID)
+		metadata, err := splitUnitMetadata(exec, cu, filesByID[x.Files[0]])
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		if err := DescribeContentUnit(exec, cu, metadata); err != nil {
+			log.Errorf("Error describing content unit: %s", err.Error())
+		}
+
+		evnts = append(evnts, events.ContentUnitCreateEvent(cu))
+		if len(x.Derivatives) > 0 {
+			evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(cu))
+		}
+
+		// published status may change for new unit and it's collections
+		impact, err := FileAddedUnitImpact(exec, somePublished, cu.ID)
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		evnts = append(evnts, impact.Events()...)
+	}
+
+	if cuDerivativesChange {
+		evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(unit))
+	}
+	for _, sID := range changedOrigins {
+		source, err := models.FindContentUnit(exec, sID)
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(source))
+	}
+	for _, cID := range changedCollections {
+		c, err := models.FindCollection(exec, cID)
+		if err != nil {
+			return nil, nil, NewInternalError(err)
 		}
+		evnts = append(evnts, events.CollectionContentUnitsChangeEvent(c))
+	}
 
-		err = cu.R.SourceContentUnitDerivations.UpdateAll(exec, models.M{"source_id": unit.ID})
+	// original unit is removed if nothing is left in it,
+	// otherwise it's published status may change
+	left, err := models.Files(exec, qm.Where("content_unit_id = ? AND removed_at IS NULL", unit.ID)).Count()
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+	if left == 0 {
+		if err := RemoveContentUnit(exec, unit); err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		evnts = append(evnts, events.ContentUnitDeleteEvent(unit))
+	} else {
+		impact, err := FileLeftUnitImpact(exec, someLeftPublished, unit.ID)
 		if err != nil {
 			return nil, nil, NewInternalError(err)
 		}
-		if len(cu.R.SourceContentUnitDerivations) > 0 {
-			cuDerivativesChange = true
+		evnts = append(evnts, impact.Events()...)
+		evnts = append(evnts, events.ContentUnitUpdateEvent(unit))
+	}
+
+	resp := make([]*ContentUnit, len(newUnits))
+	for i := range newUnits {
+		cu, herr := handleGetContentUnit(cp, exec, newUnits[i].ID)
+		if herr != nil {
+			return nil, nil, herr
 		}
+		resp[i] = cu
+	}
 
-		// remove unit
-		err = DeleteContentUnit(exec, cu)
-		if err != nil {
-			return nil, nil, NewInternalError(err)
+	return resp, evnts, nil
+}
+
+// splitUnitMetadata gives what we know about a new split unit, for auto naming.
+// Similar to what CIT sends us for a new unit.
+func splitUnitMetadata(exec boil.Executor, cu *models.ContentUnit, file *models.File) (CITMetadata, error) {
+	metadata := CITMetadata{
+		ContentType: CONTENT_TYPE_REGISTRY.ByID[cu.TypeID].Name,
+		FinalName:   strings.TrimSuffix(file.Name, filepath.Ext(file.Name)),
+	}
+
+	var props map[string]interface{}
+	if cu.Properties.Valid {
+		if err := cu.Properties.Unmarshal(&props); err != nil {
+			return metadata, errors.Wrap(err, "json.Unmarshal properties")
 		}
-		evnts = append(evnts, events.ContentUnitDeleteEvent(cu))
+	}
+	if number, ok := props["number"].(float64); ok {
+		metadata.Number = null.IntFrom(int(number))
+	}
+	if part, ok := props["part"].(float64); ok {
+		metadata.Part = null.IntFrom(int(part))
 	}
 
-	if cuDerivativesChange {
-		evnts = append(evnts, events.ContentUnitDerivativesChangeEvent(unit))
+	ccus, err := models.CollectionsContentUnits(exec,
+		qm.Where("content_unit_id = ?", cu.ID),
+		qm.Load("Collection")).
+		All()
+	if err != nil {
+		return metadata, errors.Wrap(err, "Load collections")
+	}
+	for _, ccu := range ccus {
+		c := ccu.R.Collection
+		switch CONTENT_TYPE_REGISTRY.ByID[c.TypeID].Name {
+		case CT_CONGRESS, CT_HOLIDAY, CT_UNITY_DAY, CT_PICNIC:
+			metadata.CollectionUID = null.StringFrom(c.UID)
+		}
 	}
 
-	// published status may change for host unit and it's related collections
-	impact, err := FileAddedUnitImpact(exec, somePublished, unit.ID)
+	return metadata, nil
+}
+
+func handleRestoreContentUnit(cp utils.ContextProvider, exec boil.Executor, id int64) (*ContentUnit, *HttpError) {
+	unit, err := models.FindContentUnit(exec, id)
 	if err != nil {
-		return nil, nil, NewInternalError(err)
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
 	}
-	evnts = append(evnts, impact.Events()...)
 
-	resp, herr := handleGetContentUnit(cp, exec, id)
+	// check object level permissions
+	if !canContentUnit(cp, exec, unit, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
 
-	return resp, evnts, herr
+	if !unit.RemovedAt.Valid {
+		return nil, NewBadRequestError(errors.Errorf("Content unit %d is not removed", id))
+	}
+
+	unit.RemovedAt = null.NewTime(time.Unix(0, 0), false)
+	err = unit.Update(exec, "removed_at")
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return handleGetContentUnit(cp, exec, id)
 }
 
 func handleFilesList(cp utils.ContextProvider, exec boil.Executor, r FilesRequest) (*FilesResponse, *HttpError) {
 	mods := make([]qm.QueryMod, 0)
-	appendPermissionsMods(cp, &mods)
+	appendPermissionsMods(cp, &mods, SEARCH_IN_FILES)
 
 	// filters
 	if err := appendIDsFilterMods(&mods, r.IDsFilter); err != nil {
@@ -3079,9 +3752,10 @@ func handleFilesList(cp utils.ContextProvider, exec boil.Executor, r FilesReques
 		return nil, NewBadRequestError(err)
 	}
 	appendPublishedFilterMods(&mods, r.PublishedFilter)
-	if err := appendSearchTermFilterMods(exec, &mods, r.SearchTermFilter, SEARCH_IN_FILES); err != nil {
+	if err := appendSearchTermFilterMods(&mods, r.SearchTermFilter, SEARCH_IN_FILES); err != nil {
 		return nil, NewBadRequestError(err)
 	}
+	appendMediaFilterMods(&mods, r.MediaFilter)
 	/*if r.Query != "" {
 		mods = append(mods, qm.Where("name ~ ?", r.Query),
 			qm.Or("uid ~ ?", r.Query),
@@ -3100,7 +3774,7 @@ func handleFilesList(cp utils.ContextProvider, exec boil.Executor, r FilesReques
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, FILE_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3116,7 +3790,7 @@ func handleFilesList(cp utils.ContextProvider, exec boil.Executor, r FilesReques
 	}
 
 	return &FilesResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, FILE_SORT_FIELDS, data)},
 		Files:        data,
 	}, nil
 }
@@ -3132,7 +3806,7 @@ func handleGetFile(cp utils.ContextProvider, exec boil.Executor, id int64) (*MFi
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(file.Secure), PERM_READ) {
+	if !canFile(cp, exec, file, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -3150,11 +3824,12 @@ func handleUpdateFile(cp utils.ContextProvider, exec boil.Executor, f *PartialFi
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(file.Secure), PERM_WRITE) {
+	if !canFile(cp, exec, file, PERM_WRITE) {
 		return nil, nil, NewForbiddenError()
 	}
 
 	evnts := make([]events.Event, 0)
+	before := *file
 
 	if f.Type.Valid {
 		file.Type = f.Type.String
@@ -3174,7 +3849,6 @@ func handleUpdateFile(cp utils.ContextProvider, exec boil.Executor, f *PartialFi
 	if f.Secure.Valid {
 		file.Secure = f.Secure.Int16
 	}
-
 	prevCUID := file.ContentUnitID.Int64
 	if f.ContentUnitID.Valid {
 		file.ContentUnitID = f.ContentUnitID
@@ -3192,7 +3866,7 @@ func handleUpdateFile(cp utils.ContextProvider, exec boil.Executor, f *PartialFi
 
 	// The unit we're joining
 	if f.ContentUnitID.Valid {
-		impact, err := FileAddedUnitImpact(exec, file.Published, f.ContentUnitID.Int64)
+		impact, err := FileAddedUnitImpact(exec, file.Published, file.ContentUnitID.Int64)
 		if err != nil {
 			return nil, nil, NewInternalError(err)
 		}
@@ -3201,7 +3875,7 @@ func handleUpdateFile(cp utils.ContextProvider, exec boil.Executor, f *PartialFi
 
 	// The unit we're leaving
 	if prevCUID != 0 {
-		impact, err := FileLeftUnitImpact(exec, file.Published, prevCUID)
+		impact, err := FileLeftUnitImpact(exec, before.Published, prevCUID)
 		if err != nil {
 			return nil, nil, NewInternalError(err)
 		}
@@ -3212,6 +3886,85 @@ func handleUpdateFile(cp utils.ContextProvider, exec boil.Executor, f *PartialFi
 	return resp, evnts, herr
 }
 
+// Publishing a file publishes its content unit and collections if needed.
+// Unpublishing the last published file of a unit unpublishes them.
+func handleFileSetPublished(cp utils.ContextProvider, exec boil.Executor, id int64, published bool) (*MFile, []events.Event, *HttpError) {
+	file, err := models.FindFile(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, NewNotFoundError()
+		} else {
+			return nil, nil, NewInternalError(err)
+		}
+	}
+
+	if file.RemovedAt.Valid {
+		return nil, nil, NewNotFoundError()
+	}
+
+	// check object level permissions
+	if !canFile(cp, exec, file, PERM_WRITE) {
+		return nil, nil, NewForbiddenError()
+	}
+
+	if file.Published == published {
+		return NewMFile(file), nil, nil
+	}
+
+	file.Published = published
+	if err := file.Update(exec, "published"); err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+
+	evnts := []events.Event{events.FileUpdateEvent(file)}
+	if published {
+		evnts = append(evnts, events.FilePublishedEvent(file))
+	}
+
+	if file.ContentUnitID.Valid {
+		var impact *PublishedChangeImpact
+		if published {
+			impact, err = FileAddedUnitImpact(exec, true, file.ContentUnitID.Int64)
+		} else {
+			impact, err = FileLeftUnitImpact(exec, true, file.ContentUnitID.Int64)
+		}
+		if err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		evnts = append(evnts, impact.Events()...)
+	}
+
+	return NewMFile(file), evnts, nil
+}
+
+// Files are removed, not deleted, as their physical copies may still exist
+func handleDeleteFile(cp utils.ContextProvider, exec boil.Executor, id int64) ([]events.Event, *HttpError) {
+	file, err := models.FindFile(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	if file.RemovedAt.Valid {
+		return nil, NewNotFoundError()
+	}
+
+	// check object level permissions
+	if !canFile(cp, exec, file, PERM_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	impact, err := RemoveFile(exec, file)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return append([]events.Event{events.FileRemoveEvent(file)}, impact.Events()...), nil
+}
+
 func handleFileStorages(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*Storage, *HttpError) {
 	file, err := models.FindFile(exec, id)
 	if err != nil {
@@ -3223,7 +3976,7 @@ func handleFileStorages(cp utils.ContextProvider, exec boil.Executor, id int64)
 	}
 
 	// check object level permissions
-	if !can(cp, secureToPermission(file.Secure), PERM_READ) {
+	if !canFile(cp, exec, file, PERM_READ) {
 		return nil, NewForbiddenError()
 	}
 
@@ -3242,6 +3995,32 @@ func handleFileStorages(cp utils.ContextProvider, exec boil.Executor, id int64)
 	return data, nil
 }
 
+func handleFileMedia(cp utils.ContextProvider, exec boil.Executor, id int64) (*media.Info, *HttpError) {
+	file, err := models.FindFile(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !canFile(cp, exec, file, PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	info, err := media.LoadFileInfo(exec, id)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if info == nil {
+		return nil, NewNotFoundError()
+	}
+
+	return info, nil
+}
+
 func handleOperationsList(exec boil.Executor, r OperationsRequest) (*OperationsResponse, *HttpError) {
 	mods := make([]qm.QueryMod, 0)
 
@@ -3265,7 +4044,7 @@ func handleOperationsList(exec boil.Executor, r OperationsRequest) (*OperationsR
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, OPERATION_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3276,7 +4055,7 @@ func handleOperationsList(exec boil.Executor, r OperationsRequest) (*OperationsR
 	}
 
 	return &OperationsResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, OPERATION_SORT_FIELDS, data)},
 		Operations:   data,
 	}, nil
 }
@@ -3304,8 +4083,8 @@ func handleOperationFiles(cp utils.ContextProvider, exec boil.Executor, id int64
 	}
 
 	files, err := models.Files(exec,
-		qm.InnerJoin("files_operations fo on fo.file_id=id and fo.operation_id = ? and secure <= ?",
-			id, allowedRead(cp))).
+		qm.InnerJoin("files_operations fo on fo.file_id=id and fo.operation_id = ?", id),
+		permissionsMod(cp, SEARCH_IN_FILES, PERM_READ)).
 		All()
 	if err != nil {
 		return nil, NewInternalError(err)
@@ -3334,7 +4113,7 @@ func handleGetSources(exec boil.Executor, r SourcesRequest) (*SourcesResponse, *
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, SOURCE_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3359,7 +4138,7 @@ func handleGetSources(exec boil.Executor, r SourcesRequest) (*SourcesResponse, *
 	}
 
 	return &SourcesResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, SOURCE_SORT_FIELDS, data)},
 		Sources:      data,
 	}, nil
 }
@@ -3527,7 +4306,7 @@ func handleGetTags(exec boil.Executor, r TagsRequest) (*TagsResponse, *HttpError
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, TAG_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3552,7 +4331,7 @@ func handleGetTags(exec boil.Executor, r TagsRequest) (*TagsResponse, *HttpError
 	}
 
 	return &TagsResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, TAG_SORT_FIELDS, data)},
 		Tags:         data,
 	}, nil
 }
@@ -3678,6 +4457,7 @@ func handlePersonsList(exec boil.Executor, r PersonsRequest) (*PersonsResponse,
 	if err := appendPatternsFilterMods(&mods, r.PatternsFilter); err != nil {
 		return nil, NewBadRequestError(err)
 	}
+	appendRemovedFilterMods(&mods, r.RemovedFilter)
 
 	// count query
 	var total int64
@@ -3691,7 +4471,7 @@ func handlePersonsList(exec boil.Executor, r PersonsRequest) (*PersonsResponse,
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, PERSON_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3716,7 +4496,7 @@ func handlePersonsList(exec boil.Executor, r PersonsRequest) (*PersonsResponse,
 	}
 
 	return &PersonsResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, PERSON_SORT_FIELDS, data)},
 		Persons:      data,
 	}, nil
 }
@@ -3747,7 +4527,7 @@ func handleCreatePerson(exec boil.Executor, p *Person) (*Person, *HttpError) {
 }
 
 func handleUpdatePerson(exec boil.Executor, p *Person) (*Person, *HttpError) {
-	person, err := models.FindPerson(exec, p.ID)
+	person, err := findPerson(exec, p.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, NewNotFoundError()
@@ -3767,7 +4547,7 @@ func handleUpdatePerson(exec boil.Executor, p *Person) (*Person, *HttpError) {
 
 func handleGetPerson(exec boil.Executor, id int64) (*Person, *HttpError) {
 	person, err := models.Persons(exec,
-		qm.Where("id = ?", id),
+		qm.Where("id = ? AND removed_at IS NULL", id),
 		qm.Load("PersonI18ns")).
 		One()
 	if err != nil {
@@ -3830,22 +4610,54 @@ func handleDeletePerson(exec boil.Executor, id int64) (*models.Person, *HttpErro
 		}
 	}
 
-	err = models.ContentUnitsPersons(exec, qm.Where("person_id = ?", id)).DeleteAll()
+	if person.RemovedAt.Valid {
+		return nil, NewNotFoundError()
+	}
+
+	// relations are kept so that a restore would bring them back
+	person.RemovedAt = null.TimeFrom(time.Now().UTC())
+	err = person.Update(exec, "removed_at")
 	if err != nil {
 		return nil, NewInternalError(err)
 	}
 
-	err = models.PersonI18ns(exec, qm.Where("person_id = ?", id)).DeleteAll()
+	return person, nil
+}
+
+func handleRestorePerson(exec boil.Executor, id int64) (*Person, *HttpError) {
+	person, err := models.FindPerson(exec, id)
 	if err != nil {
-		return nil, NewInternalError(err)
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	if !person.RemovedAt.Valid {
+		return nil, NewBadRequestError(errors.Errorf("Person %d is not removed", id))
 	}
 
-	err = person.Delete(exec)
+	// another person may have taken the pattern in the meantime
+	if person.Pattern.Valid {
+		taken, err := models.Persons(exec,
+			qm.Where("pattern = ? AND removed_at IS NULL", person.Pattern.String)).
+			Exists()
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+		if taken {
+			return nil, NewBadRequestError(errors.Errorf("Pattern %s is used by another person", person.Pattern.String))
+		}
+	}
+
+	person.RemovedAt = null.NewTime(time.Unix(0, 0), false)
+	err = person.Update(exec, "removed_at")
 	if err != nil {
 		return nil, NewInternalError(err)
 	}
 
-	return person, nil
+	return handleGetPerson(exec, id)
 }
 
 func handleStoragesList(exec boil.Executor, r StoragesRequest) (*StoragesResponse, *HttpError) {
@@ -3863,7 +4675,7 @@ func handleStoragesList(exec boil.Executor, r StoragesRequest) (*StoragesRespons
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, STORAGE_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3874,7 +4686,7 @@ func handleStoragesList(exec boil.Executor, r StoragesRequest) (*StoragesRespons
 	}
 
 	return &StoragesResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, STORAGE_SORT_FIELDS, data)},
 		Storages:     data,
 	}, nil
 }
@@ -3905,7 +4717,7 @@ func handlePublishersList(exec boil.Executor, r PublishersRequest) (*PublishersR
 	}
 
 	// order, limit, offset
-	if err = appendListMods(&mods, r.ListRequest); err != nil {
+	if err = appendListMods(&mods, r.ListRequest, PUBLISHER_SORT_FIELDS); err != nil {
 		return nil, NewBadRequestError(err)
 	}
 
@@ -3930,7 +4742,7 @@ func handlePublishersList(exec boil.Executor, r PublishersRequest) (*PublishersR
 	}
 
 	return &PublishersResponse{
-		ListResponse: ListResponse{Total: total},
+		ListResponse: ListResponse{Total: total, NextCursor: nextListCursor(r.ListRequest, PUBLISHER_SORT_FIELDS, data)},
 		Publishers:   data,
 	}, nil
 }
@@ -4036,19 +4848,36 @@ func handleUpdatePublisherI18n(exec boil.Executor, id int64, i18ns []*models.Pub
 
 // Query Helpers
 
-func appendListMods(mods *[]qm.QueryMod, r ListRequest) error {
+func appendListMods(mods *[]qm.QueryMod, r ListRequest, fields sortFields) error {
 
 	// group by id to remove duplicates
 	*mods = append(*mods, qm.GroupBy("id"))
 
-	if r.OrderBy == "" {
-		*mods = append(*mods, qm.OrderBy("id desc"))
-	} else {
-		*mods = append(*mods, qm.OrderBy(r.OrderBy))
+	terms, err := parseSort(r, fields)
+	if err != nil {
+		return err
+	}
+
+	if r.Cursor != "" {
+		return appendCursorListMods(mods, r, terms, fields)
 	}
 
-	var limit, offset int
+	*mods = append(*mods, qm.OrderBy(orderByClause(terms)))
 
+	limit, offset, err := listLimits(r)
+	if err != nil {
+		return err
+	}
+
+	*mods = append(*mods, qm.Limit(limit))
+	if offset != 0 {
+		*mods = append(*mods, qm.Offset(offset))
+	}
+
+	return nil
+}
+
+func listLimits(r ListRequest) (limit, offset int, err error) {
 	if r.StartIndex == 0 {
 		// pagination style
 		if r.PageSize == 0 {
@@ -4065,102 +4894,74 @@ func appendListMods(mods *[]qm.QueryMod, r ListRequest) error {
 		if r.StopIndex == 0 {
 			limit = MAX_PAGE_SIZE
 		} else if r.StopIndex < r.StartIndex {
-			return errors.Errorf("Invalid range [%d-%d]", r.StartIndex, r.StopIndex)
+			err = errors.Errorf("Invalid range [%d-%d]", r.StartIndex, r.StopIndex)
 		} else {
 			limit = r.StopIndex - r.StartIndex + 1
 		}
 	}
 
-	*mods = append(*mods, qm.Limit(limit))
-	if offset != 0 {
-		*mods = append(*mods, qm.Offset(offset))
-	}
-
-	return nil
+	return
 }
 
-func appendPermissionsMods(cp utils.ContextProvider, mods *[]qm.QueryMod) {
-	*mods = append(*mods, qm.Where("secure <= ?", allowedRead(cp)))
+func appendPermissionsMods(cp utils.ContextProvider, mods *[]qm.QueryMod, entityType int) {
+	*mods = append(*mods, permissionsMod(cp, entityType, PERM_READ))
 }
 
-func appendSearchTermFilterMods(exec boil.Executor, mods *[]qm.QueryMod, f SearchTermFilter, entityType int) error {
+func appendSearchTermFilterMods(mods *[]qm.QueryMod, f SearchTermFilter, entityType int) error {
 	if f.Query == "" {
 		return nil
 	}
 
-	whereParts := []string{}
-
-	fMods := make([]qm.QueryMod, 0)
+	whereParts := make([]string, 0)
+	args := make([]interface{}, 0)
 
 	// id field - must be unsigned int
 	if id, err := strconv.ParseUint(f.Query, 10, 64); err == nil {
-		whereParts = append(whereParts, fmt.Sprintf("id = %d", id))
+		whereParts = append(whereParts, "id = ?")
+		args = append(args, id)
 	}
 
 	// uid field
 	if len(f.Query) == 8 {
-		whereParts = append(whereParts, fmt.Sprintf("uid = '%s'", f.Query))
+		whereParts = append(whereParts, "uid = ?")
+		args = append(args, f.Query)
 	}
 
 	switch entityType {
 	case SEARCH_IN_FILES:
 		// file name field
-		whereParts = append(whereParts, fmt.Sprintf("name ~~ '%%%s%%'", f.Query))
+		whereParts = append(whereParts, "name ILIKE ?")
+		args = append(args, "%"+likeEscaper.Replace(f.Query)+"%")
 
 		// file sha1
 		if len(f.Query) == 40 {
 			s, err := hex.DecodeString(f.Query)
 			if err == nil {
-				whereParts = append(whereParts, fmt.Sprintf("sha1 = '%s'", string(s)))
+				whereParts = append(whereParts, "sha1 = ?")
+				args = append(args, s)
 			}
 		}
-	case SEARCH_IN_CONTENT_UNITS:
-
-		// get CU IDs from search in i18ns
-		var ids pq.Int64Array
-		q := `select array_agg(cui.content_unit_id)
-			  from content_units cu 
-			  left join content_unit_i18n cui on cu.id = cui.content_unit_id
-			  where cui.name ~ $1 or cui .description ~ $1 limit $2`
-		err := queries.Raw(exec, q, f.Query, MAX_PAGE_SIZE).QueryRow().Scan(&ids)
-		if err != nil {
-			return err
-		}
-
-		if ids != nil && len(ids) != 0 {
-			intListStr := strings.Trim(strings.Replace(fmt.Sprint(ids), " ", ",", -1), "[]")
-			whereParts = append(whereParts, fmt.Sprintf("id in (%s)", intListStr))
-		}
-
-	case SEARCH_IN_COLLECTIONS:
+	case SEARCH_IN_CONTENT_UNITS, SEARCH_IN_COLLECTIONS:
+		// full text search in i18ns
+		scope, _ := searchScopeOf(entityType)
+		whereParts = append(whereParts, fmt.Sprintf("id IN (%s)", scope.matchSQL()))
+		args = append(args, f.Query)
+	}
 
-		// get Collection IDs from search in i18ns
-		var ids pq.Int64Array
-		q := `select array_agg(c.id)
-				from collections c 
-				left join collection_i18n ci on c.id = ci.collection_id
-				where ci.name ~ $1 or ci.description ~ $1 limit $2`
-		err := queries.Raw(exec, q, f.Query, MAX_PAGE_SIZE).QueryRow().Scan(&ids)
-		if err != nil {
-			return err
-		}
+	*mods = append(*mods, qm.Where(fmt.Sprintf("(%s)", strings.Join(whereParts, " OR ")), args...))
 
-		if ids != nil && len(ids) != 0 {
-			intListStr := strings.Trim(strings.Replace(fmt.Sprint(ids), " ", ",", -1), "[]")
-			whereParts = append(whereParts, fmt.Sprintf("id in (%s)", intListStr))
-		}
-	}
+	return nil
+}
 
-	whereQuery := fmt.Sprintf("(%s)", strings.Join(whereParts, " or "))
-	fMods = append(fMods, qm.And(whereQuery))
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 
-	if len(fMods) > 0 {
-		*mods = append(*mods, fMods...)
-	} else {
-		*mods = append(*mods, qm.Where("id < 0")) // so we get back empty results
+func appendCollectionFilterMods(mods *[]qm.QueryMod, f CollectionFilter) {
+	if f.Collection == 0 {
+		return
 	}
 
-	return nil
+	*mods = append(*mods, qm.Where(
+		"id IN (SELECT content_unit_id FROM collections_content_units WHERE collection_id = ?)", f.Collection))
 }
 
 func appendIDsFilterMods(mods *[]qm.QueryMod, f IDsFilter) error {
@@ -4283,6 +5084,43 @@ func appendPublishedFilterMods(mods *[]qm.QueryMod, f PublishedFilter) {
 	}
 }
 
+func appendMediaFilterMods(mods *[]qm.QueryMod, f MediaFilter) {
+	if len(f.Codecs) > 0 || f.MinHeight > 0 || f.MaxHeight > 0 {
+		where := []string{"s.file_id = files.id"}
+		args := make([]interface{}, 0)
+		if len(f.Codecs) > 0 {
+			where = append(where, "s.codec = ANY(?)")
+			args = append(args, pq.Array(f.Codecs))
+		}
+		if f.MinHeight > 0 {
+			where = append(where, "s.height >= ?")
+			args = append(args, f.MinHeight)
+		}
+		if f.MaxHeight > 0 {
+			where = append(where, "s.height <= ?")
+			args = append(args, f.MaxHeight)
+		}
+		*mods = append(*mods, qm.Where(fmt.Sprintf("EXISTS(SELECT 1 FROM files_media_streams s WHERE %s)",
+			strings.Join(where, " AND ")), args...))
+	}
+
+	if len(f.AudioLanguages) > 0 {
+		*mods = append(*mods, qm.Where(`EXISTS(SELECT 1 FROM files_media_streams s
+WHERE s.file_id = files.id AND s.type = 'audio' AND s.language = ANY(?))`, pq.Array(f.AudioLanguages)))
+	}
+}
+
+// Removed entities are hidden unless explicitly asked for
+func appendRemovedFilterMods(mods *[]qm.QueryMod, f RemovedFilter) {
+	var val null.Bool
+	val.UnmarshalText([]byte(f.Removed))
+	if val.Valid && val.Bool {
+		*mods = append(*mods, qm.Where("removed_at IS NOT NULL"))
+	} else {
+		*mods = append(*mods, qm.Where("removed_at IS NULL"))
+	}
+}
+
 func appendOperationTypesFilterMods(mods *[]qm.QueryMod, f OperationTypesFilter) error {
 	if utils.IsEmpty(f.OperationTypes) {
 		return nil
@@ -4403,17 +5241,6 @@ func mustConcludeTx(tx *sql.Tx, err *HttpError) {
 	}
 }
 
-func mdbReplicationLocation(c utils.ContextProvider) (string, error) {
-	var loc string
-	err := c.MustGet("MDB").(*sql.DB).
-		QueryRow("SELECT pg_current_xlog_insert_location();").
-		Scan(&loc)
-	if err != nil {
-		return "", errors.Wrap(err, "Fetch Replication Position")
-	}
-	return loc, nil
-}
-
 // concludeRequest responds with JSON of given response or aborts the request with the given error.
 func concludeRequest(c *gin.Context, resp interface{}, err *HttpError) {
 	if err == nil {
@@ -4423,54 +5250,60 @@ func concludeRequest(c *gin.Context, resp interface{}, err *HttpError) {
 	}
 }
 
-func emitEvents(cp utils.ContextProvider, evnts ...events.Event) {
+// emitEvents hands the given events to the events emitter within the given transaction.
+// Events are delivered to events handlers only if the transaction commits.
+func emitEvents(cp utils.ContextProvider, exec boil.Executor, evnts ...events.Event) *HttpError {
 	if len(evnts) == 0 {
-		return
+		return nil
 	}
 
-	// We attach postgresql replication log location
-	// so that clients could verify that their stand-bys are synced
-	// see:
-	// https://blog.2ndquadrant.com/postgresql-10-transaction-traceability/
-	// https://www.postgresql.org/docs/9.6/static/functions-admin.html
-	// https://www.postgresql.org/docs/9.6/static/datatype-pg-lsn.html
-	if rLoc, err := mdbReplicationLocation(cp); err != nil {
-		log.Errorf("emitEvents: rLoc: %+v", err)
-	} else {
-		for i := range evnts {
-			evnts[i].ReplicationLocation = rLoc
-		}
+	if err := cp.MustGet("EVENTS_EMITTER").(events.EventEmitter).Emit(exec, evnts...); err != nil {
+		return NewInternalError(errors.Wrap(err, "Emit events"))
 	}
 
-	cp.MustGet("EVENTS_EMITTER").(events.EventEmitter).Emit(evnts...)
+	return nil
 }
 
 func can(cp utils.ContextProvider, obj string, act string) bool {
+	return canIn(cp, []string{permissions.DOMAIN_ALL}, obj, act)
+}
+
+// canIn checks the permission in any of the given domains, see acl.go
+func canIn(cp utils.ContextProvider, domains []string, obj string, act string) bool {
+	allowed := enforceIn(cp, domains, obj, act)
+
+	result := "deny"
+	if allowed {
+		result = "allow"
+	}
+	metrics.PermissionChecks.WithLabelValues(obj, act, result).Inc()
+
+	return allowed
+}
+
+// enforceIn is canIn for probing, it isn't counted as a permission check
+func enforceIn(cp utils.ContextProvider, domains []string, obj string, act string) bool {
 	sub := []string{""}
 	if v, ok := cp.Get("ID_TOKEN_CLAIMS"); ok {
 		claims := v.(permissions.IDTokenClaims)
 		sub = claims.RealmAccess.Roles
 		log.Infof("Subject is %s %s with roles %v", claims.Sub, claims.Name, sub)
 	} else {
-		// bypass hack for workflow insert station
-		if act == PERM_READ && cp.(*gin.Context).ClientIP() == "146.185.60.45" {
-			log.Info("Workflow Insert station read")
-			return true
-		}
-
 		log.Infof("No subject.")
 	}
 
-	enforcer := cp.MustGet("PERMISSIONS_ENFORCER").(*casbin.Enforcer)
+	enforcer := cp.MustGet("PERMISSIONS_ENFORCER").(*casbin.SyncedEnforcer)
 
 	for i := range sub {
-		if enforcer.Enforce(sub[i], obj, act) {
-			log.Infof("ALLOW %s, %s, %s", sub[i], obj, act)
-			return true
+		for j := range domains {
+			if enforcer.Enforce(sub[i], obj, act, domains[j]) {
+				log.Infof("ALLOW %s, %s, %s, %s", sub[i], obj, act, domains[j])
+				return true
+			}
 		}
 	}
 
-	log.Warnf("DENY %v, %s, %s", sub, obj, act)
+	log.Warnf("DENY %v, %s, %s, %v", sub, obj, act, domains)
 	return false
 }
 
@@ -4506,29 +5339,18 @@ func allowedWrite(cp utils.ContextProvider) int16 {
 }
 
 func allowedSecure(cp utils.ContextProvider, act string) int16 {
-	if can(cp, secureToPermission(SEC_PRIVATE), act) {
+	return allowedSecureIn(cp, permissions.DOMAIN_ALL, act)
+}
+
+func allowedSecureIn(cp utils.ContextProvider, domain string, act string) int16 {
+	domains := []string{domain}
+	if enforceIn(cp, domains, secureToPermission(SEC_PRIVATE), act) {
 		return SEC_PRIVATE
-	} else if can(cp, secureToPermission(SEC_SENSITIVE), act) {
+	} else if enforceIn(cp, domains, secureToPermission(SEC_SENSITIVE), act) {
 		return SEC_SENSITIVE
-	} else if can(cp, secureToPermission(SEC_PUBLIC), act) {
+	} else if enforceIn(cp, domains, secureToPermission(SEC_PUBLIC), act) {
 		return SEC_PUBLIC
 	}
 
-	if ginCtx, ok := cp.(*gin.Context); ok {
-		clientIP := ginCtx.ClientIP()
-
-		// workflow insert station
-		if clientIP == "146.185.60.45" {
-			log.Info("Workflow Insert station secure level")
-			return SEC_PRIVATE
-		}
-
-		// internal network (hopefully MDB-CIT [aka rename])
-		if strings.HasPrefix(clientIP, "10.") {
-			log.Infof("Internal network secure level: %s", clientIP)
-			return SEC_PRIVATE
-		}
-	}
-
 	return -1
 }
@@ -6,13 +6,17 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 	"github.com/volatiletech/sqlboiler/boil"
 	"gopkg.in/gin-gonic/gin.v1"
 	"gopkg.in/volatiletech/null.v6"
 
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/media"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/permissions"
 	"github.com/Bnei-Baruch/mdb/utils"
@@ -300,6 +304,159 @@ func (suite *RestSuite) TestFileItem() {
 	}
 }
 
+func (suite *RestSuite) TestFilePublishAndRemove() {
+	cp := new(DummyAuthProvider)
+	unit := createDummyContentUnits(suite.tx, 1)[0]
+	files := createDummyFiles(suite.tx, 2)
+	for _, f := range files {
+		f.ContentUnitID = null.Int64From(unit.ID)
+		suite.Require().Nil(f.Update(suite.tx, "content_unit_id"))
+	}
+
+	// publish
+	f, evnts, err := handleFileSetPublished(cp, suite.tx, files[0].ID, true)
+	suite.Require().Nil(err)
+	suite.True(f.Published, "file published")
+	suite.Len(evnts, 3, "update, published and unit published events")
+	suite.Require().Nil(unit.Reload(suite.tx))
+	suite.True(unit.Published, "unit published")
+
+	// publish again is a no-op
+	_, evnts, err = handleFileSetPublished(cp, suite.tx, files[0].ID, true)
+	suite.Require().Nil(err)
+	suite.Empty(evnts, "no events when already published")
+
+	// updates don't touch published
+	_, _, err = handleUpdateFile(cp, suite.tx, &PartialFile{
+		File:   models.File{ID: files[0].ID},
+		Secure: null.Int16From(0),
+	})
+	suite.Require().Nil(err)
+	suite.Require().Nil(files[0].Reload(suite.tx))
+	suite.True(files[0].Published, "still published after update")
+
+	// unpublish
+	_, evnts, err = handleFileSetPublished(cp, suite.tx, files[0].ID, false)
+	suite.Require().Nil(err)
+	suite.Len(evnts, 2, "update and unit published events")
+	suite.Require().Nil(unit.Reload(suite.tx))
+	suite.False(unit.Published, "unit unpublished")
+
+	// remove
+	_, _, err = handleFileSetPublished(cp, suite.tx, files[1].ID, true)
+	suite.Require().Nil(err)
+	evnts, err = handleDeleteFile(cp, suite.tx, files[1].ID)
+	suite.Require().Nil(err)
+	suite.Len(evnts, 2, "remove and unit published events")
+	suite.Require().Nil(files[1].Reload(suite.tx))
+	suite.True(files[1].RemovedAt.Valid, "removed_at")
+	suite.Require().Nil(unit.Reload(suite.tx))
+	suite.False(unit.Published, "unit unpublished")
+
+	_, err = handleDeleteFile(cp, suite.tx, files[1].ID)
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusNotFound, err.Code, "remove twice")
+
+	_, _, err = handleFileSetPublished(cp, suite.tx, files[1].ID, true)
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusNotFound, err.Code, "publish removed")
+}
+
+func (suite *RestSuite) TestFilesListMediaFilter() {
+	cp := new(DummyAuthProvider)
+	files := createDummyFiles(suite.tx, 3)
+
+	infos := []*media.Info{
+		{Streams: []*media.Stream{{Index: 0, Type: "video", Codec: "h264", Height: 720},
+			{Index: 1, Type: "audio", Codec: "aac", Language: "heb"}}},
+		{Streams: []*media.Stream{{Index: 0, Type: "video", Codec: "wmv3", Height: 480},
+			{Index: 1, Type: "audio", Codec: "wmav2", Language: "rus"}}},
+	}
+	for i, info := range infos {
+		suite.Require().Nil(media.SaveFileInfo(suite.tx, files[i].ID, info))
+	}
+
+	filter := func(f MediaFilter) []int64 {
+		resp, err := handleFilesList(cp, suite.tx, FilesRequest{MediaFilter: f})
+		suite.Require().Nil(err)
+		ids := make([]int64, len(resp.Files))
+		for i, f := range resp.Files {
+			ids[i] = f.ID
+		}
+		return ids
+	}
+
+	suite.Equal([]int64{files[0].ID}, filter(MediaFilter{Codecs: []string{"h264"}}), "codec")
+	suite.Equal([]int64{files[0].ID}, filter(MediaFilter{MinHeight: 720}), "min height")
+	suite.Equal([]int64{files[1].ID}, filter(MediaFilter{MaxHeight: 576}), "max height")
+	suite.Equal([]int64{files[1].ID}, filter(MediaFilter{AudioLanguages: []string{"rus"}}), "audio language")
+	suite.Empty(filter(MediaFilter{Codecs: []string{"h264"}, MaxHeight: 576}), "same stream")
+	suite.Len(filter(MediaFilter{}), 3, "no filter")
+
+	info, err := handleFileMedia(cp, suite.tx, files[0].ID)
+	suite.Require().Nil(err)
+	suite.Equal(infos[0].Streams[0].Codec, info.Streams[0].Codec, "file media")
+	_, err = handleFileMedia(cp, suite.tx, files[2].ID)
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusNotFound, err.Code, "no media info")
+}
+
+func (suite *RestSuite) TestFileLocations() {
+	cp := new(DummyAuthProvider)
+	file := createDummyFiles(suite.tx, 1)[0]
+
+	StorageURLTemplates = map[string]string{"*": "https://{country}.example.com/{sha1}"}
+	DownloadLinkSecret = []byte("secret")
+	defer func() {
+		StorageURLTemplates = make(map[string]string)
+		DownloadLinkSecret = nil
+	}()
+
+	storages := []*models.Storage{
+		{Name: "tape", Country: "il", Location: "pt", Status: "offline", Access: "private"},
+		{Name: "nas-il", Country: "il", Location: "pt", Status: "online", Access: "public"},
+		{Name: "nas-de", Country: "de", Location: "mu", Status: "online", Access: "public"},
+	}
+	for _, s := range storages {
+		suite.Require().Nil(s.Insert(suite.tx))
+		_, err := suite.tx.Exec("INSERT INTO files_storages (file_id, storage_id) VALUES ($1, $2)", file.ID, s.ID)
+		suite.Require().Nil(err)
+	}
+
+	locations, err := handleFileLocations(cp, suite.tx, file.ID, FileLocationsRequest{Country: "DE"})
+	suite.Require().Nil(err)
+	suite.Require().Len(locations, 3, "locations")
+	suite.Equal("nas-de", locations[0].Storage.Name, "caller's country first")
+	suite.Equal("nas-il", locations[1].Storage.Name, "online before offline")
+	suite.Equal("tape", locations[2].Storage.Name, "offline last")
+	suite.Equal(fmt.Sprintf("https://de.example.com/%s", hex.EncodeToString(file.Sha1.Bytes)), locations[0].URL, "url")
+	suite.Nil(locations[0].ExpiresAt, "public files are not signed")
+
+	// published copy of a private file
+	file.Secure = SEC_PRIVATE
+	file.Properties = null.JSONFrom([]byte(`{"url": "https://cdn.example.com/file.mp4"}`))
+	suite.Require().Nil(file.Update(suite.tx, "secure", "properties"))
+
+	locations, err = handleFileLocations(cp, suite.tx, file.ID, FileLocationsRequest{})
+	suite.Require().Nil(err)
+	suite.Require().Len(locations, 4, "locations with published")
+	suite.Nil(locations[0].Storage, "published copy first")
+	suite.Require().NotNil(locations[0].ExpiresAt, "private files are signed")
+	u, e := url.Parse(locations[0].URL)
+	suite.Require().Nil(e)
+	suite.Equal(urlSignature("/file.mp4", u.Query().Get("expires")), u.Query().Get("signature"), "signature")
+
+	_, err = handleFileLocations(cp, suite.tx, 0, FileLocationsRequest{})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusNotFound, err.Code, "not found")
+
+	file.RemovedAt = null.TimeFrom(time.Now())
+	suite.Require().Nil(file.Update(suite.tx, "removed_at"))
+	_, err = handleFileLocations(cp, suite.tx, file.ID, FileLocationsRequest{})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusNotFound, err.Code, "removed")
+}
+
 func (suite *RestSuite) TestOperationsList() {
 	req := OperationsRequest{
 		ListRequest: ListRequest{StartIndex: 1, StopIndex: 5},
@@ -346,6 +503,567 @@ func (suite *RestSuite) TestOperationItem() {
 
 // custom assertions
 
+func (suite *RestSuite) TestEvents() {
+	units := createDummyContentUnits(suite.tx, 3)
+	units[2].Secure = SEC_PRIVATE
+	suite.Require().Nil(units[2].Update(suite.tx, "secure"))
+
+	evnts := []events.Event{
+		events.ContentUnitCreateEvent(units[0]),
+		events.ContentUnitUpdateEvent(units[1]),
+		events.ContentUnitCreateEvent(units[2]),
+		events.SourceCreateEvent(&models.Source{ID: 1, UID: "abcdefgh"}),
+	}
+	suite.Require().Nil(events.NewOutboxEmitter().Emit(suite.tx, evnts...))
+	// a unit we can't tell the secure level of
+	_, err := suite.tx.Exec(`INSERT INTO events_outbox (id, type, payload)
+VALUES ('ZZZZZZZZZZZZZZZZZZZZZZZZZZ', 'CONTENT_UNIT_UPDATE', '{"id": -1}')`)
+	suite.Require().Nil(err)
+	_, err = suite.tx.Exec("UPDATE events_outbox SET delivered_at = now_utc(), rloc = '0/0'")
+	suite.Require().Nil(err)
+
+	resp, hErr := handleEvents(suite.tx, EventsRequest{}, SEC_PUBLIC, nil)
+	suite.Require().Nil(hErr)
+	suite.Require().Len(resp.Data, 3, "public events")
+	suite.Equal(evnts[0].ID, resp.Data[0].ID, "first event")
+	suite.Equal(evnts[3].ID, resp.Data[2].ID, "last event")
+	suite.Equal("0/0", resp.Data[0].ReplicationLocation, "rloc")
+
+	resp, hErr = handleEvents(suite.tx, EventsRequest{}, SEC_PRIVATE, nil)
+	suite.Require().Nil(hErr)
+	suite.Len(resp.Data, 5, "private events")
+
+	resp, hErr = handleEvents(suite.tx, EventsRequest{Since: evnts[0].ID}, SEC_PRIVATE, nil)
+	suite.Require().Nil(hErr)
+	suite.Require().Len(resp.Data, 4, "since")
+	suite.Equal(evnts[1].ID, resp.Data[0].ID, "since first event")
+
+	resp, hErr = handleEvents(suite.tx, EventsRequest{
+		Types: []string{events.E_CONTENT_UNIT_UPDATE + "," + events.E_SOURCE_CREATE},
+	}, SEC_PRIVATE, nil)
+	suite.Require().Nil(hErr)
+	suite.Require().Len(resp.Data, 3, "types")
+	suite.Equal(events.E_CONTENT_UNIT_UPDATE, resp.Data[0].Type, "types first event")
+
+	resp, hErr = handleEvents(suite.tx, EventsRequest{Limit: 1}, SEC_PRIVATE, nil)
+	suite.Require().Nil(hErr)
+	suite.Len(resp.Data, 1, "limit")
+}
+
+func (suite *RestSuite) TestRemoveRestoreCollection() {
+	cp := new(DummyAuthProvider)
+	collections := createDummyCollections(suite.tx, 2)
+	units := createDummyContentUnits(suite.tx, 1)
+	_, hErr := handleCollectionAddCCU(cp, suite.tx, collections[0].ID,
+		[]*models.CollectionsContentUnit{{ContentUnitID: units[0].ID, Name: "1"}})
+	suite.Require().Nil(hErr)
+
+	removed, hErr := handleDeleteCollection(cp, suite.tx, collections[0].ID)
+	suite.Require().Nil(hErr)
+	suite.True(removed.RemovedAt.Valid, "removed_at")
+
+	_, hErr = handleDeleteCollection(cp, suite.tx, collections[0].ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusNotFound, hErr.Code, "delete removed")
+
+	_, hErr = handleGetCollection(cp, suite.tx, collections[0].ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusNotFound, hErr.Code, "get removed")
+
+	_, hErr = handleCollectionCCU(cp, suite.tx, collections[0].ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusNotFound, hErr.Code, "ccus of removed")
+
+	resp, hErr := handleCollectionsList(cp, suite.tx, CollectionsRequest{})
+	suite.Require().Nil(hErr)
+	suite.Require().EqualValues(1, resp.Total, "default list total")
+	suite.Equal(collections[1].ID, resp.Collections[0].ID, "default list")
+
+	resp, hErr = handleCollectionsList(cp, suite.tx, CollectionsRequest{RemovedFilter: RemovedFilter{Removed: "true"}})
+	suite.Require().Nil(hErr)
+	suite.Require().EqualValues(1, resp.Total, "removed list total")
+	suite.Equal(collections[0].ID, resp.Collections[0].ID, "removed list")
+
+	ccus, hErr := handleContentUnitCCU(cp, suite.tx, units[0].ID)
+	suite.Require().Nil(hErr)
+	suite.Require().Len(ccus, 1, "unit ccus")
+	suite.Nil(ccus[0].Collection, "removed collection hidden")
+
+	restored, hErr := handleRestoreCollection(cp, suite.tx, collections[0].ID)
+	suite.Require().Nil(hErr)
+	suite.False(restored.RemovedAt.Valid, "restored removed_at")
+	suite.Len(restored.I18n, 3, "restored i18n")
+
+	ccus, hErr = handleCollectionCCU(cp, suite.tx, collections[0].ID)
+	suite.Require().Nil(hErr)
+	suite.Require().Len(ccus, 1, "restored ccus")
+	suite.Equal(units[0].ID, ccus[0].ContentUnit.ID, "restored ccu unit")
+
+	_, hErr = handleRestoreCollection(cp, suite.tx, collections[0].ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusBadRequest, hErr.Code, "restore not removed")
+}
+
+func (suite *RestSuite) TestRemoveRestorePerson() {
+	person := &models.Person{UID: utils.GenerateUID(8), Pattern: null.StringFrom("test-pattern")}
+	suite.Require().Nil(person.Insert(suite.tx))
+
+	_, hErr := handleDeletePerson(suite.tx, person.ID)
+	suite.Require().Nil(hErr)
+
+	_, hErr = handleGetPerson(suite.tx, person.ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusNotFound, hErr.Code, "get removed")
+
+	// pattern of a removed person is free
+	other := &models.Person{UID: utils.GenerateUID(8), Pattern: null.StringFrom("test-pattern")}
+	suite.Require().Nil(other.Insert(suite.tx))
+
+	_, hErr = handleRestorePerson(suite.tx, person.ID)
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusBadRequest, hErr.Code, "restore taken pattern")
+}
+
+func (suite *RestSuite) TestContentUnitSplit() {
+	cp := new(DummyAuthProvider)
+	units := createDummyContentUnits(suite.tx, 2)
+	collections := createDummyCollections(suite.tx, 1)
+	files := createDummyFiles(suite.tx, 3)
+	unit := units[0]
+	for _, f := range files {
+		f.ContentUnitID = null.Int64From(unit.ID)
+		f.Published = true
+		suite.Require().Nil(f.Update(suite.tx, "content_unit_id", "published"))
+	}
+	_, err := handleCollectionAddCCU(cp, suite.tx, collections[0].ID,
+		[]*models.CollectionsContentUnit{{ContentUnitID: unit.ID, Name: "1"}})
+	suite.Require().Nil(err)
+	_, err = handleContentUnitAddCUD(cp, suite.tx, unit.ID, models.ContentUnitDerivation{DerivedID: units[1].ID})
+	suite.Require().Nil(err)
+
+	// validation
+	_, _, err = handleContentUnitSplit(cp, suite.tx, unit.ID, ContentUnitSplitRequest{
+		Units: []*ContentUnitSplit{{Files: []int64{files[0].ID}}, {Files: []int64{files[0].ID}}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "file twice")
+
+	_, _, err = handleContentUnitSplit(cp, suite.tx, unit.ID, ContentUnitSplitRequest{
+		Units: []*ContentUnitSplit{{Files: []int64{files[0].ID}, Collections: []int64{collections[0].ID + 1}}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown collection")
+
+	// split
+	resp, evnts, err := handleContentUnitSplit(cp, suite.tx, unit.ID, ContentUnitSplitRequest{
+		Units: []*ContentUnitSplit{
+			{Files: []int64{files[0].ID}, Collections: []int64{collections[0].ID}},
+			{Files: []int64{files[1].ID}, Derivatives: []int64{units[1].ID}},
+		},
+	})
+	suite.Require().Nil(err)
+	suite.Require().Len(resp, 2, "new units")
+	suite.NotEmpty(evnts, "events")
+	for i, cu := range resp {
+		suite.Equal(unit.TypeID, cu.TypeID, "new unit type [%d]", i)
+		suite.True(cu.Published, "new unit published [%d]", i)
+	}
+
+	cuFiles, err := handleContentUnitFiles(cp, suite.tx, resp[0].ID)
+	suite.Require().Nil(err)
+	suite.Require().Len(cuFiles, 1, "new unit files")
+	suite.Equal(files[0].ID, cuFiles[0].ID, "new unit file")
+
+	ccus, err := handleContentUnitCCU(cp, suite.tx, resp[0].ID)
+	suite.Require().Nil(err)
+	suite.Len(ccus, 1, "new unit ccus")
+
+	cuds, err := handleContentUnitCUD(cp, suite.tx, resp[1].ID)
+	suite.Require().Nil(err)
+	suite.Len(cuds, 1, "new unit derivatives")
+
+	original, err := handleGetContentUnit(cp, suite.tx, unit.ID)
+	suite.Require().Nil(err)
+	suite.False(original.RemovedAt.Valid, "original kept")
+
+	// moving the last file removes the original
+	_, evnts, err = handleContentUnitSplit(cp, suite.tx, unit.ID, ContentUnitSplitRequest{
+		Units: []*ContentUnitSplit{{Files: []int64{files[2].ID}}},
+	})
+	suite.Require().Nil(err)
+	suite.Equal(events.E_CONTENT_UNIT_DELETE, evnts[len(evnts)-1].Type, "original delete event")
+	original, err = handleGetContentUnit(cp, suite.tx, unit.ID)
+	suite.Require().Nil(err)
+	suite.True(original.RemovedAt.Valid, "original removed")
+}
+
+func (suite *RestSuite) TestContentUnitsBulk() {
+	cp := new(DummyAuthProvider)
+	units := createDummyContentUnits(suite.tx, 3)
+	ids := []int64{units[0].ID, units[1].ID, units[2].ID}
+
+	tag := models.Tag{UID: utils.GenerateUID(8)}
+	suite.Require().Nil(tag.Insert(suite.tx))
+	suite.Require().Nil(units[0].AddTags(suite.tx, false, &tag))
+
+	// validation
+	_, _, err := handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs:        ids,
+		Operations: []*ContentUnitsBulkOperation{{Op: BULK_ADD_TAG, ID: tag.ID + 1}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown tag")
+
+	_, _, err = handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs:        append(ids, units[2].ID+1),
+		Operations: []*ContentUnitsBulkOperation{{Op: BULK_ADD_TAG, ID: tag.ID}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown content unit")
+
+	removed := createDummyContentUnits(suite.tx, 1)[0]
+	removed.RemovedAt = null.TimeFrom(time.Now())
+	suite.Require().Nil(removed.Update(suite.tx, "removed_at"))
+	_, _, err = handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs:        append(ids, removed.ID),
+		Operations: []*ContentUnitsBulkOperation{{Op: BULK_ADD_TAG, ID: tag.ID}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "removed content unit")
+
+	_, _, err = handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs:        ids,
+		Operations: []*ContentUnitsBulkOperation{{Op: "unknown"}},
+	})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown op")
+
+	// apply
+	resp, evnts, err := handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs: ids,
+		Operations: []*ContentUnitsBulkOperation{
+			{Op: BULK_ADD_TAG, ID: tag.ID},
+			{Op: BULK_SET_SECURE, Secure: null.Int16From(SEC_SENSITIVE)},
+			{Op: BULK_PATCH_PROPERTIES, Properties: map[string]interface{}{"film_date": "2018-02-01"}},
+		},
+	})
+	suite.Require().Nil(err)
+	suite.Require().Len(resp.Changes, 3, "changed units")
+	suite.Equal([]int{1, 2}, resp.Changes[0].Operations, "unit with tag")
+	suite.Equal([]int{0, 1, 2}, resp.Changes[1].Operations, "unit without tag")
+	suite.Len(evnts, 5, "events")
+
+	for i, id := range ids {
+		cu, err := models.FindContentUnit(suite.tx, id)
+		suite.Require().Nil(err)
+		suite.Equal(SEC_SENSITIVE, cu.Secure, "secure [%d]", i)
+		var props map[string]interface{}
+		suite.Require().Nil(cu.Properties.Unmarshal(&props))
+		suite.Equal("2018-02-01", props["film_date"], "properties [%d]", i)
+		tags, err := cu.Tags(suite.tx).All()
+		suite.Require().Nil(err)
+		suite.Len(tags, 1, "tags [%d]", i)
+	}
+
+	// nothing left to change
+	resp, evnts, err = handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs: ids,
+		Operations: []*ContentUnitsBulkOperation{
+			{Op: BULK_ADD_TAG, ID: tag.ID},
+			{Op: BULK_PATCH_PROPERTIES, Properties: map[string]interface{}{"film_date": "2018-02-01"}},
+		},
+	})
+	suite.Require().Nil(err)
+	suite.Empty(resp.Changes, "no changes")
+	suite.Empty(evnts, "no events")
+
+	// remove
+	resp, _, err = handleContentUnitsBulk(cp, suite.tx, ContentUnitsBulkRequest{
+		IDs: ids[:2],
+		Operations: []*ContentUnitsBulkOperation{
+			{Op: BULK_REMOVE_TAG, ID: tag.ID},
+			{Op: BULK_PATCH_PROPERTIES, Properties: map[string]interface{}{"film_date": nil}},
+		},
+	})
+	suite.Require().Nil(err)
+	suite.Len(resp.Changes, 2, "removed")
+	count, cErr := units[2].Tags(suite.tx).Count()
+	suite.Require().Nil(cErr)
+	suite.EqualValues(1, count, "untouched unit tags")
+}
+
+func (suite *RestSuite) TestSearch() {
+	cp := new(DummyAuthProvider)
+	units := createDummyContentUnits(suite.tx, 3)
+	collections := createDummyCollections(suite.tx, 1)
+
+	i18ns := []*models.ContentUnitI18n{
+		{ContentUnitID: units[0].ID, Language: LANG_ENGLISH, Name: null.StringFrom("Running in the morning")},
+		{ContentUnitID: units[1].ID, Language: LANG_HEBREW, Name: null.StringFrom("שִׁיעוּר בוקר")},
+		{ContentUnitID: units[2].ID, Language: LANG_RUSSIAN, Name: null.StringFrom("Утренний урок, ёлка")},
+	}
+	for _, i18n := range i18ns {
+		suite.Require().Nil(i18n.Upsert(suite.tx, true,
+			[]string{"content_unit_id", "language"}, []string{"name"}))
+	}
+	ci18n := &models.CollectionI18n{CollectionID: collections[0].ID, Language: LANG_ENGLISH,
+		Name: null.StringFrom("Morning lessons")}
+	suite.Require().Nil(ci18n.Upsert(suite.tx, true, []string{"collection_id", "language"}, []string{"name"}))
+
+	// stemming
+	resp, err := handleSearch(cp, suite.tx, SearchRequest{Query: "runs"})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "stemmed total")
+	suite.Equal(SEARCH_TYPE_CONTENT_UNIT, resp.Hits[0].Type, "stemmed type")
+	suite.Equal(units[0].ID, resp.Hits[0].ID, "stemmed id")
+	suite.Contains(resp.Hits[0].Name.String, "<em>Running</em>", "highlight")
+
+	// hebrew without niqqud, russian ё
+	resp, err = handleSearch(cp, suite.tx, SearchRequest{Query: "שיעור"})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "hebrew total")
+	suite.Equal(units[1].ID, resp.Hits[0].ID, "hebrew id")
+
+	resp, err = handleSearch(cp, suite.tx, SearchRequest{Query: "елка"})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "russian total")
+	suite.Equal(units[2].ID, resp.Hits[0].ID, "russian id")
+
+	// across types
+	resp, err = handleSearch(cp, suite.tx, SearchRequest{Query: "morning"})
+	suite.Require().Nil(err)
+	suite.EqualValues(2, resp.Total, "types total")
+
+	resp, err = handleSearch(cp, suite.tx, SearchRequest{Query: "morning", Types: []string{SEARCH_TYPE_COLLECTION}})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "collections total")
+	suite.Equal(collections[0].ID, resp.Hits[0].ID, "collection id")
+
+	resp, err = handleSearch(cp, suite.tx, SearchRequest{Query: "morning", Language: LANG_HEBREW})
+	suite.Require().Nil(err)
+	suite.EqualValues(0, resp.Total, "language total")
+
+	_, err = handleSearch(cp, suite.tx, SearchRequest{Query: "morning", Types: []string{"unknown"}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown type")
+
+	// query filter in lists
+	cuResp, err := handleContentUnitsList(cp, suite.tx, ContentUnitsRequest{
+		SearchTermFilter: SearchTermFilter{Query: "Morning's"},
+	})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, cuResp.Total, "list total")
+	suite.Equal(units[0].ID, cuResp.ContentUnits[0].ID, "list id")
+
+	cResp, err := handleCollectionsList(cp, suite.tx, CollectionsRequest{
+		SearchTermFilter: SearchTermFilter{Query: "morning"},
+	})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, cResp.Total, "collections list total")
+	suite.Equal(collections[0].ID, cResp.Collections[0].ID, "collections list id")
+}
+
+func (suite *RestSuite) TestListCursor() {
+	cp := new(DummyAuthProvider)
+	files := createDummyFiles(suite.tx, 25)
+
+	for _, orderBy := range []string{"", "id", "-name", "file_created_at"} {
+		seen := make(map[int64]bool)
+		r := FilesRequest{ListRequest: ListRequest{PageSize: 10, OrderBy: orderBy}}
+		pages := 0
+		for {
+			resp, err := handleFilesList(cp, suite.tx, r)
+			suite.Require().Nil(err)
+			suite.EqualValues(len(files), resp.Total, "total %s", orderBy)
+			for _, f := range resp.Files {
+				suite.False(seen[f.ID], "file seen twice %d %s", f.ID, orderBy)
+				seen[f.ID] = true
+			}
+			pages++
+			if resp.NextCursor == "" {
+				break
+			}
+			r.Cursor = resp.NextCursor
+		}
+		suite.Len(seen, len(files), "all files %s", orderBy)
+		suite.Equal(3, pages, "pages %s", orderBy)
+	}
+
+	// cursor first page is the same as the offset one
+	resp, err := handleFilesList(cp, suite.tx, FilesRequest{ListRequest: ListRequest{PageSize: 10}})
+	suite.Require().Nil(err)
+	suite.Equal(files[0].ID, resp.Files[0].ID, "first")
+
+	_, err = handleFilesList(cp, suite.tx, FilesRequest{ListRequest: ListRequest{Cursor: resp.NextCursor, PageNumber: 2}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "cursor and page_no")
+
+	_, err = handleFilesList(cp, suite.tx, FilesRequest{ListRequest: ListRequest{Cursor: "garbage!"}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "invalid cursor")
+
+	_, err = handleFilesList(cp, suite.tx, FilesRequest{ListRequest: ListRequest{
+		Cursor: resp.NextCursor, OrderBy: "-size,name"}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unsupported order")
+
+	// lists of other entities
+	for i := 0; i < 15; i++ {
+		person := &models.Person{UID: utils.GenerateUID(8)}
+		suite.Require().Nil(person.Insert(suite.tx))
+	}
+	seen := make(map[int64]bool)
+	pr := PersonsRequest{ListRequest: ListRequest{PageSize: 10, OrderBy: "id"}}
+	for {
+		resp, err := handlePersonsList(suite.tx, pr)
+		suite.Require().Nil(err)
+		for _, p := range resp.Persons {
+			suite.False(seen[p.ID], "person seen twice %d", p.ID)
+			seen[p.ID] = true
+		}
+		if resp.NextCursor == "" {
+			suite.EqualValues(resp.Total, len(seen), "all persons")
+			break
+		}
+		pr.Cursor = resp.NextCursor
+	}
+}
+
+func (suite *RestSuite) TestListSort() {
+	cp := new(DummyAuthProvider)
+	units := createDummyContentUnits(suite.tx, 3)
+	collections := createDummyCollections(suite.tx, 1)
+
+	// film dates 1, 1, 2
+	for i, cu := range units {
+		cu.Properties = null.JSONFrom([]byte(fmt.Sprintf(`{"film_date": "2018-01-0%d"}`, i/2+1)))
+		suite.Require().Nil(cu.Update(suite.tx, "properties"))
+	}
+	names := []string{"b", "a", "c"}
+	for i, cu := range units {
+		i18n := &models.ContentUnitI18n{ContentUnitID: cu.ID, Language: LANG_ENGLISH, Name: null.StringFrom(names[i])}
+		suite.Require().Nil(i18n.Upsert(suite.tx, true, []string{"content_unit_id", "language"}, []string{"name"}))
+	}
+
+	resp, err := handleContentUnitsList(cp, suite.tx, ContentUnitsRequest{
+		ListRequest: ListRequest{OrderBy: "-film_date,name", Language: LANG_ENGLISH},
+	})
+	suite.Require().Nil(err)
+	suite.Require().Len(resp.ContentUnits, 3, "len")
+	suite.Equal(units[2].ID, resp.ContentUnits[0].ID, "-film_date")
+	suite.Equal(units[1].ID, resp.ContentUnits[1].ID, "name a")
+	suite.Equal(units[0].ID, resp.ContentUnits[2].ID, "name b")
+
+	// position in collection
+	_, err = handleCollectionAddCCU(cp, suite.tx, collections[0].ID, []*models.CollectionsContentUnit{
+		{ContentUnitID: units[0].ID, Name: "1", Position: 2},
+		{ContentUnitID: units[1].ID, Name: "2", Position: 1},
+	})
+	suite.Require().Nil(err)
+	resp, err = handleContentUnitsList(cp, suite.tx, ContentUnitsRequest{
+		ListRequest:      ListRequest{OrderBy: "position"},
+		CollectionFilter: CollectionFilter{Collection: collections[0].ID},
+	})
+	suite.Require().Nil(err)
+	suite.Require().Len(resp.ContentUnits, 2, "collection len")
+	suite.Equal(units[1].ID, resp.ContentUnits[0].ID, "position 1")
+	suite.Equal(units[0].ID, resp.ContentUnits[1].ID, "position 2")
+
+	// unknown fields
+	for _, orderBy := range []string{"position", "-film_date,name;drop table files", "id desc", "name,name"} {
+		_, err = handleContentUnitsList(cp, suite.tx, ContentUnitsRequest{ListRequest: ListRequest{OrderBy: orderBy}})
+		suite.Require().NotNil(err, orderBy)
+		suite.Equal(http.StatusBadRequest, err.Code, orderBy)
+	}
+
+	createDummyFiles(suite.tx, 1)
+	_, err = handleFilesList(cp, suite.tx, FilesRequest{ListRequest: ListRequest{OrderBy: "film_date"}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "files film_date")
+}
+
+func (suite *RestSuite) TestAuditLog() {
+	cp := new(DummyAuthProvider)
+	units := createDummyContentUnits(suite.tx, 2)
+
+	a := startAudit(cp, suite.tx, AUDIT_CONTENT_UNIT, units[0].ID, units[1].ID)
+	units[0].Secure = SEC_PRIVATE
+	suite.Require().Nil(units[0].Update(suite.tx, "secure"))
+	suite.Require().Nil(a.conclude(suite.tx))
+
+	resp, err := handleAuditLog(cp, suite.tx, AuditLogRequest{})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "total")
+	entry := resp.AuditLog[0]
+	suite.Equal(AUDIT_CONTENT_UNIT, entry.Entity, "entity")
+	suite.Equal(units[0].ID, entry.EntityID, "entity_id")
+	suite.Equal("test-user", entry.UserSub.String, "user_sub")
+	suite.EqualValues([]string{"test_user"}, entry.UserRoles, "user_roles")
+	suite.True(entry.Before.Valid, "before")
+	suite.True(entry.After.Valid, "after")
+
+	var after map[string]map[string]interface{}
+	suite.Require().Nil(entry.After.Unmarshal(&after))
+	suite.EqualValues(SEC_PRIVATE, after["content_unit"]["secure"], "after secure")
+
+	// created entity has no before
+	a = startAudit(cp, suite.tx, AUDIT_CONTENT_UNIT)
+	created := createDummyContentUnits(suite.tx, 1)[0]
+	suite.Require().Nil(a.conclude(suite.tx, created.ID))
+
+	resp, err = handleAuditLog(cp, suite.tx, AuditLogRequest{EntityID: created.ID})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "created total")
+	suite.False(resp.AuditLog[0].Before.Valid, "created before")
+
+	resp, err = handleAuditLog(cp, suite.tx, AuditLogRequest{Entity: AUDIT_CONTENT_UNIT, User: "test-user"})
+	suite.Require().Nil(err)
+	suite.EqualValues(2, resp.Total, "user total")
+
+	resp, err = handleAuditLog(cp, suite.tx, AuditLogRequest{User: "someone@else.com"})
+	suite.Require().Nil(err)
+	suite.EqualValues(0, resp.Total, "other user total")
+
+	_, err = handleAuditLog(cp, suite.tx, AuditLogRequest{Entity: "unknown"})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown entity")
+}
+
+func (suite *RestSuite) TestPermissionRules() {
+	cp := new(DummyAuthProvider)
+
+	// seeded by migration
+	resp, err := handlePermissionRulesList(cp, suite.tx, PermissionRulesRequest{})
+	suite.Require().Nil(err)
+	suite.True(resp.Total > 0, "seeded total")
+
+	rule := &permissions.PolicyRule{PType: "p", Values: []string{"test_role", "data_private", "read", permissions.DOMAIN_ALL}}
+	created, err := handleCreatePermissionRule(cp, suite.tx, rule)
+	suite.Require().Nil(err)
+	suite.NotZero(created.ID, "created id")
+
+	_, err = handleCreatePermissionRule(cp, suite.tx, &permissions.PolicyRule{PType: "p", Values: []string{"test_role", "data_private", "read", permissions.DOMAIN_ALL}})
+	suite.Require().NotNil(err, "duplicate")
+	suite.Equal(http.StatusBadRequest, err.Code, "duplicate code")
+
+	_, err = handleCreatePermissionRule(cp, suite.tx, &permissions.PolicyRule{PType: "g", Values: []string{"test_role"}})
+	suite.Require().NotNil(err, "invalid")
+	suite.Equal(http.StatusBadRequest, err.Code, "invalid code")
+
+	resp, err = handlePermissionRulesList(cp, suite.tx, PermissionRulesRequest{Value: "test_role"})
+	suite.Require().Nil(err)
+	suite.Require().EqualValues(1, resp.Total, "filtered total")
+	suite.Equal(*rule, resp.Rules[0], "filtered rule")
+
+	deleted, err := handleDeletePermissionRule(cp, suite.tx, rule.ID)
+	suite.Require().Nil(err)
+	suite.Equal(rule.Values, deleted.Values, "deleted values")
+
+	_, err = handleGetPermissionRule(cp, suite.tx, rule.ID)
+	suite.Require().NotNil(err, "get deleted")
+	suite.Equal(http.StatusNotFound, err.Code, "get deleted code")
+}
+
 func (suite *RestSuite) assertEqualDummyCollection(c *models.Collection, x *Collection, idx int) {
 	suite.Equal(c.ID, x.ID, "collection.ID [%d]", idx)
 	suite.Equal(c.UID, x.UID, "collection.UID [%d]", idx)
@@ -391,6 +1109,176 @@ func (suite *RestSuite) assertEqualDummyOperation(o *models.Operation, x *models
 
 // Helpers
 
+func (suite *RestSuite) TestPermissionDomains() {
+	collections := createDummyCollections(suite.tx, 2)
+	units := createDummyContentUnits(suite.tx, 2)
+	for _, c := range collections {
+		c.Secure = SEC_PRIVATE
+		suite.Require().Nil(c.Update(suite.tx, "secure"))
+	}
+	for _, cu := range units {
+		cu.Secure = SEC_PRIVATE
+		suite.Require().Nil(cu.Update(suite.tx, "secure"))
+	}
+	suite.Require().Nil(collections[0].AddCollectionsContentUnits(suite.tx, true,
+		&models.CollectionsContentUnit{ContentUnitID: units[0].ID, Name: "1"}))
+
+	enforcer, err := permissions.NewEnforcer(permissions.NewBindataPolicyAdapter())
+	suite.Require().Nil(err)
+	domain := DOMAIN_COLLECTION + collections[0].UID
+	enforcer.AddPolicy("test_team", "data_private", PERM_READ, domain)
+	enforcer.AddPolicy("test_team", "data_private", PERM_WRITE, domain)
+	cp := &RolesAuthProvider{Roles: []string{"test_team"}, Enforcer: enforcer}
+
+	suite.True(canCollection(cp, collections[0], PERM_WRITE), "collection in domain")
+	suite.False(canCollection(cp, collections[1], PERM_WRITE), "collection out of domain")
+	suite.True(canContentUnit(cp, suite.tx, units[0], PERM_WRITE), "unit in domain")
+	suite.False(canContentUnit(cp, suite.tx, units[1], PERM_WRITE), "unit out of domain")
+	suite.False(can(cp, secureToPermission(SEC_PUBLIC), PERM_READ), "whole archive")
+
+	cResp, hErr := handleCollectionsList(cp, suite.tx, CollectionsRequest{})
+	suite.Require().Nil(hErr)
+	suite.Require().EqualValues(1, cResp.Total, "collections total")
+	suite.Equal(collections[0].ID, cResp.Collections[0].ID, "collections in domain")
+
+	cuResp, hErr := handleContentUnitsList(cp, suite.tx, ContentUnitsRequest{})
+	suite.Require().Nil(hErr)
+	suite.Require().EqualValues(1, cuResp.Total, "units total")
+	suite.Equal(units[0].ID, cuResp.ContentUnits[0].ID, "units in domain")
+
+	// associations require write on the unit too
+	_, hErr = handleCollectionAddCCU(cp, suite.tx, collections[0].ID,
+		[]*models.CollectionsContentUnit{{ContentUnitID: units[1].ID, Name: "2"}})
+	suite.Require().NotNil(hErr)
+	suite.Equal(http.StatusForbidden, hErr.Code, "add unit out of domain")
+
+	// search and events follow domains
+	secure, grants := allowedRead(cp), domainGrants(cp, PERM_READ)
+	suite.Require().Len(grants, 1, "domain grants")
+	evResp, hErr := handleEvents(suite.tx, EventsRequest{}, secure, grants)
+	suite.Require().Nil(hErr)
+	suite.Empty(evResp.Data, "no delivered events")
+
+	sResp, hErr := handleSearch(cp, suite.tx, SearchRequest{Query: "nothing matches this"})
+	suite.Require().Nil(hErr)
+	suite.EqualValues(0, sResp.Total, "search")
+}
+
+func (suite *RestSuite) TestJobs() {
+	cp := new(DummyAuthProvider)
+	files := createDummyFiles(suite.tx, 2)
+
+	resp, err := handleEnqueueJobs(cp, suite.tx, EnqueueJobsRequest{
+		Type:    JOB_TRANSCODE,
+		FileIDs: []int64{files[0].ID, files[1].ID},
+	})
+	suite.Require().Nil(err)
+	suite.EqualValues(2, resp.Queued, "queued")
+	suite.EqualValues(0, resp.Skipped, "skipped")
+
+	resp, err = handleEnqueueJobs(cp, suite.tx, EnqueueJobsRequest{
+		Type:     JOB_TRANSCODE,
+		FileIDs:  []int64{files[1].ID},
+		Priority: 1,
+	})
+	suite.Require().Nil(err)
+	suite.EqualValues(0, resp.Queued, "already active")
+	suite.EqualValues(1, resp.Skipped, "already active skipped")
+
+	_, err = handleEnqueueJobs(cp, suite.tx, EnqueueJobsRequest{Type: "unknown", FileIDs: []int64{files[0].ID}})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusBadRequest, err.Code, "unknown type")
+
+	// claim, heartbeat, fail and retry
+	job, err := handleClaimJob(cp, suite.tx, ClaimJobRequest{Worker: "w1"})
+	suite.Require().Nil(err)
+	suite.Require().NotNil(job, "claimed")
+	suite.Equal(JOB_RUNNING, job.State, "claimed state")
+	suite.Equal(1, job.Attempts, "claimed attempts")
+	suite.JSONEq(`{"format":"mp4"}`, string(job.Params.JSON), "default params")
+	suite.True(job.LeaseExpiresAt.Valid, "lease")
+
+	_, err = handleJobHeartbeat(cp, suite.tx, job.ID, JobHeartbeatRequest{Worker: "w2"})
+	suite.Require().NotNil(err)
+	suite.Equal(http.StatusConflict, err.Code, "heartbeat by another worker")
+
+	job, err = handleJobHeartbeat(cp, suite.tx, job.ID, JobHeartbeatRequest{Worker: "w1", Lease: 3600})
+	suite.Require().Nil(err)
+	suite.Equal(JOB_RUNNING, job.State, "heartbeat state")
+
+	job, err = handleCompleteJob(cp, suite.tx, job.ID, CompleteJobRequest{Worker: "w1", Error: "boom"})
+	suite.Require().Nil(err)
+	suite.Equal(JOB_QUEUED, job.State, "retry state")
+	suite.Equal("boom", job.Error.String, "retry error")
+	suite.False(job.Worker.Valid, "retry worker")
+	suite.True(job.RunAt.After(time.Now()), "retry backoff")
+
+	// the other file's job is next, the retry waits for its backoff
+	next, err := handleClaimJob(cp, suite.tx, ClaimJobRequest{Worker: "w1", Types: []string{JOB_TRANSCODE}})
+	suite.Require().Nil(err)
+	suite.Require().NotNil(next, "claimed next")
+	suite.NotEqual(job.ID, next.ID, "claimed next id")
+
+	none, err := handleClaimJob(cp, suite.tx, ClaimJobRequest{Worker: "w1"})
+	suite.Require().Nil(err)
+	suite.Nil(none, "nothing to claim")
+
+	// concluded by its operation
+	operation := createDummyOperations(suite.tx, 1)[0]
+	suite.Require().Nil(linkJobOperation(suite.tx, JOB_TRANSCODE, next.FileID, operation, ""))
+	next, err = handleGetJob(cp, suite.tx, next.ID)
+	suite.Require().Nil(err)
+	suite.Equal(JOB_DONE, next.State, "done by operation")
+	suite.Equal(operation.ID, next.OperationID.Int64, "linked operation")
+
+	// a later operation on the file doesn't touch the done job
+	later := createDummyOperations(suite.tx, 1)[0]
+	suite.Require().Nil(linkJobOperation(suite.tx, JOB_TRANSCODE, next.FileID, later, "boom"))
+	next, err = handleGetJob(cp, suite.tx, next.ID)
+	suite.Require().Nil(err)
+	suite.Equal(JOB_DONE, next.State, "done job state")
+	suite.Equal(operation.ID, next.OperationID.Int64, "done job operation")
+
+	next, err = handleCompleteJob(cp, suite.tx, next.ID, CompleteJobRequest{Worker: "w1", Success: true})
+	suite.Require().Nil(err)
+	suite.Equal(JOB_DONE, next.State, "complete after operation")
+
+	listResp, err := handleJobsList(cp, suite.tx, JobsRequest{States: []string{JOB_QUEUED}})
+	suite.Require().Nil(err)
+	suite.EqualValues(1, listResp.Total, "queued total")
+	suite.Equal(job.ID, listResp.Jobs[0].ID, "queued job")
+	for _, f := range files {
+		if f.ID == job.FileID {
+			suite.Equal(f.UID, listResp.Jobs[0].FileUID, "file uid")
+		}
+	}
+}
+
+func (suite *RestSuite) TestClaimJobAnyType() {
+	cp := new(DummyAuthProvider)
+	files := createDummyFiles(suite.tx, 2)
+
+	for i, typ := range []string{JOB_TRANSCODE, JOB_CONVERT} {
+		_, err := handleEnqueueJobs(cp, suite.tx, EnqueueJobsRequest{Type: typ, FileIDs: []int64{files[i].ID}})
+		suite.Require().Nil(err)
+	}
+
+	// a worker taking any type, omitting types
+	claimed := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		job, err := handleClaimJob(cp, suite.tx, ClaimJobRequest{Worker: "w1"})
+		suite.Require().Nil(err)
+		suite.Require().NotNil(job, "claimed %d", i)
+		claimed[job.Type] = true
+	}
+	suite.True(claimed[JOB_TRANSCODE], "claimed transcode")
+	suite.True(claimed[JOB_CONVERT], "claimed convert")
+
+	none, err := handleClaimJob(cp, suite.tx, ClaimJobRequest{Worker: "w1", Types: []string{}})
+	suite.Require().Nil(err)
+	suite.Nil(none, "nothing to claim")
+}
+
 func createDummyCollections(exec boil.Executor, n int) []*models.Collection {
 	collections := make([]*models.Collection, n)
 	for i := range collections {
@@ -470,6 +1358,30 @@ func createDummyOperations(exec boil.Executor, n int) []*models.Operation {
 	return operations
 }
 
+// RolesAuthProvider authenticates with the given roles, enforcing the given policy
+type RolesAuthProvider struct {
+	Roles    []string
+	Enforcer *casbin.SyncedEnforcer
+}
+
+func (p *RolesAuthProvider) Get(key string) (interface{}, bool) {
+	switch key {
+	case "ID_TOKEN_CLAIMS":
+		return permissions.IDTokenClaims{Sub: "test-roles", RealmAccess: permissions.Roles{Roles: p.Roles}}, true
+	default:
+		return nil, false
+	}
+}
+
+func (p *RolesAuthProvider) MustGet(key string) interface{} {
+	switch key {
+	case "PERMISSIONS_ENFORCER":
+		return p.Enforcer
+	default:
+		return nil
+	}
+}
+
 type DummyAuthProvider struct {
 }
 
@@ -492,7 +1404,7 @@ func (p *DummyAuthProvider) Get(key string) (interface{}, bool) {
 func (p *DummyAuthProvider) MustGet(key string) interface{} {
 	switch key {
 	case "PERMISSIONS_ENFORCER":
-		enforcer := casbin.NewEnforcer()
+		enforcer := casbin.NewSyncedEnforcer()
 		enforcer.EnableEnforce(false)
 		return enforcer
 	default:
@@ -2,12 +2,23 @@ package api
 
 import (
 	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/metrics"
 )
 
 func SetupRoutes(router *gin.Engine) {
 	router.GET("/health_check", HealthCheckHandler)
+	router.GET("/health/live", HealthLiveHandler)
+	router.GET("/health/ready", HealthReadyHandler)
+	router.GET("/metrics", metrics.Handler())
+	router.GET("/openapi.json", OpenAPIHandler)
+	router.GET("/openapi", OpenAPIViewerHandler)
 
-	operations := router.Group("operations")
+	operationsMiddleware := []gin.HandlerFunc{OperationsAuthorizationMiddleware()}
+	if RecordOperationRequests {
+		operationsMiddleware = append([]gin.HandlerFunc{RequestRecorderMiddleware()}, operationsMiddleware...)
+	}
+	operations := router.Group("operations", operationsMiddleware...)
 	operations.POST("/capture_start", CaptureStartHandler)
 	operations.POST("/capture_stop", CaptureStopHandler)
 	operations.POST("/demux", DemuxHandler)
@@ -32,6 +43,7 @@ func SetupRoutes(router *gin.Engine) {
 	rest.PUT("/collections/:id/content_units/:cuID", CollectionContentUnitsHandler)
 	rest.DELETE("/collections/:id/content_units/:cuID", CollectionContentUnitsHandler)
 	rest.POST("/collections/:id/activate", CollectionActivateHandler)
+	rest.POST("/collections/:id/restore", CollectionRestoreHandler)
 	rest.GET("/content_units/", ContentUnitsListHandler)
 	rest.POST("/content_units/", ContentUnitsListHandler)
 	rest.GET("/content_units/:id/", ContentUnitHandler)
@@ -58,10 +70,17 @@ func SetupRoutes(router *gin.Engine) {
 	rest.POST("/content_units/:id/publishers/", ContentUnitPublishersHandler)
 	rest.DELETE("/content_units/:id/publishers/:publisherID", ContentUnitPublishersHandler)
 	rest.POST("/content_units/:id/merge", ContentUnitMergeHandler)
+	rest.POST("/content_units/:id/split", ContentUnitSplitHandler)
+	rest.POST("/content_units/:id/restore", ContentUnitRestoreHandler)
 	rest.GET("/files/", FilesListHandler)
 	rest.GET("/files/:id/", FileHandler)
 	rest.PUT("/files/:id/", FileHandler)
+	rest.DELETE("/files/:id/", FileHandler)
+	rest.POST("/files/:id/publish", FilePublishHandler)
+	rest.POST("/files/:id/unpublish", FileUnpublishHandler)
 	rest.GET("/files/:id/storages/", FileStoragesHandler)
+	rest.GET("/files/:id/locations/", FileLocationsHandler)
+	rest.GET("/files/:id/media/", FileMediaHandler)
 	rest.GET("/files/:id/tree/", FilesWithOperationsTreeHandler)
 	rest.GET("/operations/", OperationsListHandler)
 	rest.GET("/operations/:id/", OperationItemHandler)
@@ -83,12 +102,32 @@ func SetupRoutes(router *gin.Engine) {
 	rest.PUT("/persons/:id/", PersonHandler)
 	rest.DELETE("/persons/:id/", PersonHandler)
 	rest.PUT("/persons/:id/i18n/", PersonI18nHandler)
+	rest.POST("/persons/:id/restore", PersonRestoreHandler)
 	rest.GET("/storages/", StoragesHandler)
 	rest.GET("/publishers/", PublishersHandler)
 	rest.POST("/publishers/", PublishersHandler)
 	rest.GET("/publishers/:id/", PublisherHandler)
 	rest.PUT("/publishers/:id/", PublisherHandler)
 	rest.PUT("/publishers/:id/i18n/", PublisherI18nHandler)
+	rest.GET("/search/", SearchHandler)
+	rest.GET("/audit/", AuditLogHandler)
+	rest.GET("/permissions/rules/", PermissionRulesHandler)
+	rest.POST("/permissions/rules/", PermissionRulesHandler)
+	rest.GET("/permissions/rules/:id/", PermissionRuleHandler)
+	rest.DELETE("/permissions/rules/:id/", PermissionRuleHandler)
+	rest.GET("/jobs/", JobsHandler)
+	rest.POST("/jobs/", JobsHandler)
+	rest.GET("/jobs/:id/", JobHandler)
+	rest.POST("/jobs/:id/heartbeat/", JobHeartbeatHandler)
+	rest.POST("/jobs/:id/complete/", CompleteJobHandler)
+	rest.POST("/job-claims/", ClaimJobHandler)
+
+	// not /rest/content_units/bulk, a static segment can't share its position with the :id wildcard in gin
+	bulk := rest.Group("bulk")
+	bulk.POST("/content_units/", ContentUnitsBulkHandler)
+
+	router.GET("/events", EventsHandler)
+	router.GET("/events/stream", EventsStreamHandler)
 
 	hierarchy := router.Group("hierarchy")
 	hierarchy.GET("/sources/", SourcesHierarchyHandler)
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Full text search over the i18n tables of entities.
+// The mdb_search_* SQL functions and the matching indexes are defined in the full_text_search migration.
+// Expressions here must match the index expressions exactly or the indexes won't be used.
+
+const (
+	SEARCH_TYPE_CONTENT_UNIT = "content_unit"
+	SEARCH_TYPE_COLLECTION   = "collection"
+	SEARCH_TYPE_SOURCE       = "source"
+	SEARCH_TYPE_TAG          = "tag"
+	SEARCH_TYPE_PERSON       = "person"
+)
+
+type searchScope struct {
+	table       string
+	i18nTable   string
+	fk          string
+	name        string
+	description string // empty if the i18n table has no description
+	secure      bool   // table has a secure column
+	removable   bool   // table has a removed_at column
+	entityType  int    // SEARCH_IN_* of secure tables, for permission domains
+}
+
+var SEARCH_SCOPES = map[string]searchScope{
+	SEARCH_TYPE_CONTENT_UNIT: {
+		table:       "content_units",
+		i18nTable:   "content_unit_i18n",
+		fk:          "content_unit_id",
+		name:        "name",
+		description: "description",
+		secure:      true,
+		removable:   true,
+		entityType:  SEARCH_IN_CONTENT_UNITS,
+	},
+	SEARCH_TYPE_COLLECTION: {
+		table:       "collections",
+		i18nTable:   "collection_i18n",
+		fk:          "collection_id",
+		name:        "name",
+		description: "description",
+		secure:      true,
+		removable:   true,
+		entityType:  SEARCH_IN_COLLECTIONS,
+	},
+	SEARCH_TYPE_SOURCE: {
+		table:       "sources",
+		i18nTable:   "source_i18n",
+		fk:          "source_id",
+		name:        "name",
+		description: "description",
+	},
+	SEARCH_TYPE_TAG: {
+		table:     "tags",
+		i18nTable: "tag_i18n",
+		fk:        "tag_id",
+		name:      "label",
+	},
+	SEARCH_TYPE_PERSON: {
+		table:       "persons",
+		i18nTable:   "person_i18n",
+		fk:          "person_id",
+		name:        "name",
+		description: "description",
+		removable:   true,
+	},
+}
+
+// Default search types, in the order their results are merged
+var SEARCH_TYPES = []string{
+	SEARCH_TYPE_CONTENT_UNIT,
+	SEARCH_TYPE_COLLECTION,
+	SEARCH_TYPE_SOURCE,
+	SEARCH_TYPE_TAG,
+	SEARCH_TYPE_PERSON,
+}
+
+// vector is the document vector of i18n rows aliased as i
+func (s searchScope) vector() string {
+	description := "NULL"
+	if s.description != "" {
+		description = "i." + s.description
+	}
+	return fmt.Sprintf("mdb_search_vector(i.language, i.%s, %s)", s.name, description)
+}
+
+// matchSQL selects the ids of entities matching the query given as an arg
+func (s searchScope) matchSQL() string {
+	return fmt.Sprintf("SELECT i.%s FROM %s i WHERE %s @@ mdb_search_query(?)",
+		s.fk, s.i18nTable, s.vector())
+}
+
+// rankJoinSQL joins the best rank of the entity's i18n rows as sr.rank, for the query given as an arg.
+// ORDER BY clauses take no args, joins do.
+func (s searchScope) rankJoinSQL() string {
+	return fmt.Sprintf(`LATERAL (SELECT max(ts_rank(%s, mdb_search_query(?))) AS rank
+FROM %s i WHERE i.%s = %s.id) sr ON TRUE`,
+		s.vector(), s.i18nTable, s.fk, s.table)
+}
+
+func searchScopeOf(entityType int) (searchScope, bool) {
+	switch entityType {
+	case SEARCH_IN_CONTENT_UNITS:
+		return SEARCH_SCOPES[SEARCH_TYPE_CONTENT_UNIT], true
+	case SEARCH_IN_COLLECTIONS:
+		return SEARCH_SCOPES[SEARCH_TYPE_COLLECTION], true
+	default:
+		return searchScope{}, false
+	}
+}
+
+// appendSearchRankMods orders results by their search rank, best first.
+// Must come before appendListMods for its ordering to take precedence.
+// List queries group by id, so the rank is ordered by through an aggregate (a single row per id anyway).
+func appendSearchRankMods(mods *[]qm.QueryMod, f SearchTermFilter, entityType int) {
+	if f.Query == "" {
+		return
+	}
+
+	if scope, ok := searchScopeOf(entityType); ok {
+		*mods = append(*mods,
+			qm.InnerJoin(scope.rankJoinSQL(), f.Query),
+			qm.OrderBy("max(sr.rank) DESC NULLS LAST"))
+	}
+}
+
+func SearchHandler(c *gin.Context) {
+	var r SearchRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleSearch(c, c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func handleSearch(cp utils.ContextProvider, exec boil.Executor, r SearchRequest) (*SearchResponse, *HttpError) {
+	types := r.Types
+	if len(types) == 0 {
+		types = SEARCH_TYPES
+	}
+
+	// $1 is always the query
+	args := []interface{}{r.Query}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var langArg, secureArg string
+	if r.Language != "" {
+		langArg = arg(r.Language)
+	}
+	grants := domainGrants(cp, PERM_READ)
+
+	// best matching i18n row of each entity, per type
+	parts := make([]string, len(types))
+	for i, t := range types {
+		scope, ok := SEARCH_SCOPES[t]
+		if !ok {
+			return nil, NewBadRequestError(errors.Errorf("Unknown search type %s", t))
+		}
+
+		where := []string{scope.vector() + " @@ mdb_search_query($1)"}
+		if scope.secure {
+			if secureArg == "" {
+				secureArg = arg(allowedRead(cp))
+			}
+			secureWhere := []string{"x.secure <= " + secureArg}
+			for _, g := range grants {
+				if clause := domainFilterRawSQL(g.domain, scope.entityType, "x.id", arg); clause != "" {
+					secureWhere = append(secureWhere, fmt.Sprintf("(x.secure <= %s AND %s)", arg(g.secure), clause))
+				}
+			}
+			where = append(where, "("+strings.Join(secureWhere, " OR ")+")")
+		}
+		if scope.removable {
+			where = append(where, "x.removed_at IS NULL")
+		}
+		if langArg != "" {
+			where = append(where, "i.language = "+langArg)
+		}
+
+		description := "NULL::TEXT"
+		if scope.description != "" {
+			description = "i." + scope.description
+		}
+
+		parts[i] = fmt.Sprintf(`(SELECT DISTINCT ON (x.id) '%s' AS type, x.id, x.uid, i.language,
+  ts_rank(%s, mdb_search_query($1)) AS rank, i.%s :: TEXT AS name, %s AS description
+FROM %s x INNER JOIN %s i ON i.%s = x.id
+WHERE %s
+ORDER BY x.id, rank DESC)`,
+			t, scope.vector(), scope.name, description,
+			scope.table, scope.i18nTable, scope.fk,
+			strings.Join(where, " AND "))
+	}
+	union := strings.Join(parts, " UNION ALL ")
+
+	// count query
+	var total int64
+	err := queries.Raw(exec, fmt.Sprintf("SELECT count(*) FROM (%s) s", union), args...).
+		QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return NewSearchResponse(), nil
+	}
+
+	// limit, offset
+	limit, offset, err := listLimits(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// data query, highlighting only the page at hand
+	q := fmt.Sprintf(`SELECT s.type, s.id, s.uid, s.language, s.rank,
+  mdb_search_headline(s.language, s.name, mdb_search_query($1)) AS name,
+  mdb_search_headline(s.language, s.description, mdb_search_query($1)) AS description
+FROM (%s) s
+ORDER BY s.rank DESC, s.type, s.id
+LIMIT %d OFFSET %d`, union, limit, offset)
+	hits := make([]*SearchHit, 0)
+	if err := queries.Raw(exec, q, args...).Bind(&hits); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &SearchResponse{
+		ListResponse: ListResponse{Total: total},
+		Hits:         hits,
+	}, nil
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sorting of REST lists.
+// Clients order lists with a comma separated list of fields, a leading minus means descending:
+// order_by=-film_date,name
+// The legacy form of a field followed by a direction is still accepted:
+// order_by=film_date desc,name asc
+// Each list declares the fields it can be ordered by, anything else is rejected.
+
+// sortFields maps sortable fields of a list to their SQL expression.
+// Plain columns can also be used with cursor pagination.
+// {language} is replaced with the language of the request.
+type sortFields map[string]string
+
+type sortTerm struct {
+	field string
+	expr  string
+	desc  bool
+}
+
+const SORT_LANGUAGE_PLACEHOLDER = "{language}"
+
+// film date of collections and content units, same as their date range filters
+const (
+	COLLECTION_FILM_DATE_SQL   = "(coalesce(properties->>'film_date', properties->>'start_date', created_at::text))::date"
+	CONTENT_UNIT_FILM_DATE_SQL = "(coalesce(properties->>'capture_date', properties->>'film_date', created_at::text))::date"
+)
+
+var COLLECTION_SORT_FIELDS = sortFields{
+	"id":                "id",
+	"uid":               "uid",
+	"type_id":           "type_id",
+	"created_at":        "created_at",
+	"secure":            "secure",
+	"published":         "published",
+	"film_date":         COLLECTION_FILM_DATE_SQL,
+	"name":              "(SELECT name FROM collection_i18n WHERE collection_id = collections.id AND language = {language})",
+	"num_content_units": "(SELECT count(*) FROM collections_content_units WHERE collection_id = collections.id)",
+}
+
+var CONTENT_UNIT_SORT_FIELDS = sortFields{
+	"id":         "id",
+	"uid":        "uid",
+	"type_id":    "type_id",
+	"created_at": "created_at",
+	"secure":     "secure",
+	"published":  "published",
+	"film_date":  CONTENT_UNIT_FILM_DATE_SQL,
+	"name":       "(SELECT name FROM content_unit_i18n WHERE content_unit_id = content_units.id AND language = {language})",
+	"num_files":  "(SELECT count(*) FROM files WHERE content_unit_id = content_units.id AND removed_at IS NULL)",
+}
+
+var FILE_SORT_FIELDS = sortFields{
+	"id":              "id",
+	"uid":             "uid",
+	"name":            "name",
+	"size":            "size",
+	"type":            "type",
+	"sub_type":        "sub_type",
+	"mime_type":       "mime_type",
+	"language":        "language",
+	"created_at":      "created_at",
+	"file_created_at": "file_created_at",
+	"content_unit_id": "content_unit_id",
+	"secure":          "secure",
+	"published":       "published",
+}
+
+var OPERATION_SORT_FIELDS = sortFields{
+	"id":         "id",
+	"uid":        "uid",
+	"type_id":    "type_id",
+	"created_at": "created_at",
+	"station":    "station",
+}
+
+var SOURCE_SORT_FIELDS = sortFields{
+	"id":         "id",
+	"uid":        "uid",
+	"type_id":    "type_id",
+	"parent_id":  "parent_id",
+	"position":   "position",
+	"created_at": "created_at",
+	"name":       "(SELECT name FROM source_i18n WHERE source_id = sources.id AND language = {language})",
+}
+
+var TAG_SORT_FIELDS = sortFields{
+	"id":        "id",
+	"uid":       "uid",
+	"parent_id": "parent_id",
+	"pattern":   "pattern",
+	"name":      "(SELECT label FROM tag_i18n WHERE tag_id = tags.id AND language = {language})",
+}
+
+var PERSON_SORT_FIELDS = sortFields{
+	"id":      "id",
+	"uid":     "uid",
+	"pattern": "pattern",
+	"name":    "(SELECT name FROM person_i18n WHERE person_id = persons.id AND language = {language})",
+}
+
+var PUBLISHER_SORT_FIELDS = sortFields{
+	"id":      "id",
+	"uid":     "uid",
+	"pattern": "pattern",
+	"name":    "(SELECT name FROM publisher_i18n WHERE publisher_id = publishers.id AND language = {language})",
+}
+
+var STORAGE_SORT_FIELDS = sortFields{
+	"id":       "id",
+	"name":     "name",
+	"country":  "country",
+	"location": "location",
+	"status":   "status",
+	"access":   "access",
+}
+
+var AUDIT_LOG_SORT_FIELDS = sortFields{
+	"id":         "id",
+	"created_at": "created_at",
+	"entity":     "entity",
+	"entity_id":  "entity_id",
+	"user_email": "user_email",
+}
+
+var JOB_SORT_FIELDS = sortFields{
+	"id":         "id",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"priority":   "priority",
+	"state":      "state",
+}
+
+// contentUnitSortFields adds the position of units in the given collection
+func contentUnitSortFields(collectionID int64) sortFields {
+	if collectionID == 0 {
+		return CONTENT_UNIT_SORT_FIELDS
+	}
+
+	fields := make(sortFields, len(CONTENT_UNIT_SORT_FIELDS)+1)
+	for k, v := range CONTENT_UNIT_SORT_FIELDS {
+		fields[k] = v
+	}
+	fields["position"] = fmt.Sprintf(
+		"(SELECT min(position) FROM collections_content_units WHERE content_unit_id = content_units.id AND collection_id = %d)",
+		collectionID)
+
+	return fields
+}
+
+// isColumn tells if the field is a plain column
+func (f sortFields) isColumn(field string) bool {
+	return f[field] == field
+}
+
+func (f sortFields) names() []string {
+	names := make([]string, 0, len(f))
+	for k := range f {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseSort parses the order_by of a list request. Lists are ordered by -id by default.
+func parseSort(r ListRequest, fields sortFields) ([]sortTerm, error) {
+	if r.OrderBy == "" {
+		return []sortTerm{{field: "id", expr: "id", desc: true}}, nil
+	}
+
+	// inlined in sort expressions, ORDER BY clauses take no args
+	language := LANG_ENGLISH
+	if r.Language != "" {
+		language = r.Language
+		if !isKnownLanguage(language) {
+			return nil, errors.Errorf("Unknown language %q", language)
+		}
+	}
+
+	terms := make([]sortTerm, 0)
+	seen := make(map[string]bool)
+	for _, x := range strings.Split(r.OrderBy, ",") {
+		x = strings.TrimSpace(x)
+		desc := strings.HasPrefix(x, "-")
+		field := strings.TrimPrefix(strings.TrimPrefix(x, "-"), "+")
+
+		// legacy form
+		if parts := strings.Fields(x); len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+				field, desc = parts[0], false
+			case "desc":
+				field, desc = parts[0], true
+			default:
+				return nil, errors.Errorf("Unknown sort direction %q, expecting asc or desc", parts[1])
+			}
+		}
+
+		expr, ok := fields[field]
+		if !ok {
+			return nil, errors.Errorf("Unknown sort field %q, expecting one of: %s",
+				field, strings.Join(fields.names(), ", "))
+		}
+		if seen[field] {
+			return nil, errors.Errorf("Sort field %q given more than once", field)
+		}
+		seen[field] = true
+
+		expr = strings.Replace(expr, SORT_LANGUAGE_PLACEHOLDER, "'"+language+"'", -1)
+		terms = append(terms, sortTerm{field: field, expr: expr, desc: desc})
+	}
+
+	return terms, nil
+}
+
+func isKnownLanguage(language string) bool {
+	for _, l := range ALL_LANGS {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// orderByClause breaks ties by id so the order is stable across pages
+func orderByClause(terms []sortTerm) string {
+	parts := make([]string, 0, len(terms)+1)
+	hasID := false
+	for _, t := range terms {
+		parts = append(parts, fmt.Sprintf("%s %s", t.expr, sortDirection(t.desc)))
+		hasID = hasID || t.field == "id"
+	}
+	if !hasID {
+		parts = append(parts, fmt.Sprintf("id %s", sortDirection(terms[len(terms)-1].desc)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return "desc"
+	}
+	return "asc"
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSort(t *testing.T) {
+	terms, err := parseSort(ListRequest{OrderBy: "-film_date,name"}, CONTENT_UNIT_SORT_FIELDS)
+	assert.Nil(t, err)
+	assert.Len(t, terms, 2)
+	assert.Equal(t, "film_date", terms[0].field)
+	assert.True(t, terms[0].desc)
+	assert.False(t, terms[1].desc)
+
+	// legacy form
+	terms, err = parseSort(ListRequest{OrderBy: "film_date DESC, id asc"}, CONTENT_UNIT_SORT_FIELDS)
+	assert.Nil(t, err)
+	assert.Len(t, terms, 2)
+	assert.Equal(t, "film_date", terms[0].field)
+	assert.True(t, terms[0].desc)
+	assert.Equal(t, "id", terms[1].field)
+	assert.False(t, terms[1].desc)
+
+	_, err = parseSort(ListRequest{OrderBy: "id sideways"}, CONTENT_UNIT_SORT_FIELDS)
+	assert.NotNil(t, err, "bad direction")
+	_, err = parseSort(ListRequest{OrderBy: "secure; DROP TABLE files desc"}, CONTENT_UNIT_SORT_FIELDS)
+	assert.NotNil(t, err, "not a field")
+	_, err = parseSort(ListRequest{OrderBy: "properties desc"}, CONTENT_UNIT_SORT_FIELDS)
+	assert.NotNil(t, err, "not whitelisted")
+}
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/media"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// ProbeMedia runs ffprobe on local files, or all files under directories,
+// and saves their technical metadata to the MDB files with the same SHA1.
+func ProbeMedia(paths []string, dryRun bool) {
+	var err error
+	clock := time.Now()
+
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	if bin := viper.GetString("media.ffprobe"); bin != "" {
+		media.FFprobeBin = bin
+	}
+
+	log.Info("Setting up connection to MDB")
+	mdb, err = sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(mdb.Ping())
+	defer mdb.Close()
+	boil.SetDB(mdb)
+
+	var probed, unknown, failed int
+	for _, root := range paths {
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Errorf("Walk %s: %s", path, err.Error())
+				failed++
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			ok, err := probeFile(path, dryRun)
+			if err != nil {
+				log.Errorf("%s: %s", path, err.Error())
+				failed++
+			} else if ok {
+				probed++
+			} else {
+				unknown++
+			}
+			return nil
+		})
+		utils.Must(err)
+	}
+
+	log.Infof("Probed %d files, %d not in MDB, %d failed", probed, unknown, failed)
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// probeFile returns false if the file is not in MDB
+func probeFile(path string, dryRun bool) (bool, error) {
+	sha1, err := fileSHA1(path)
+	if err != nil {
+		return false, errors.Wrap(err, "Compute SHA1")
+	}
+
+	file, _, err := api.FindFileBySHA1(mdb, sha1)
+	if err != nil {
+		if _, ok := err.(api.FileNotFound); ok {
+			log.Warnf("%s: no file with SHA1 %s in MDB", path, sha1)
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Lookup file")
+	}
+
+	m, err := media.Probe(context.Background(), path)
+	if err != nil {
+		return false, err
+	}
+	info := media.NewInfo(m)
+
+	log.Infof("%s: file %d, %s, %d streams", path, file.ID, info.Format, len(info.Streams))
+	if dryRun {
+		return true, nil
+	}
+
+	return true, inTx(func(tx *sql.Tx) error { return media.SaveFileInfo(tx, file.ID, info) })
+}
+
+func fileSHA1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
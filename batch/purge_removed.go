@@ -0,0 +1,113 @@
+package batch
+
+import (
+	"database/sql"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// PurgeRemoved deletes collections, content units and persons
+// which were removed more than retention ago.
+func PurgeRemoved(retention time.Duration) {
+	var err error
+	clock := time.Now()
+
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	if retention <= 0 {
+		retention = viper.GetDuration("purge.retention")
+	}
+	if retention <= 0 {
+		log.Fatal("Retention must be positive")
+	}
+	before := time.Now().UTC().Add(-retention)
+	log.Infof("Purging entities removed before %s", before.Format(time.RFC3339))
+
+	log.Info("Setting up connection to MDB")
+	mdb, err = sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(mdb.Ping())
+	defer mdb.Close()
+	boil.SetDB(mdb)
+
+	utils.Must(purgeCollections(before))
+	utils.Must(purgeContentUnits(before))
+	utils.Must(purgePersons(before))
+
+	log.Info("Success")
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+func purgeCollections(before time.Time) error {
+	collections, err := models.Collections(mdb, qm.Where("removed_at < ?", before)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load removed collections")
+	}
+
+	log.Infof("%d collections to purge", len(collections))
+	for i := range collections {
+		c := collections[i]
+		if err := inTx(func(tx *sql.Tx) error { return api.PurgeCollection(tx, c) }); err != nil {
+			return errors.Wrapf(err, "Purge collection %d", c.ID)
+		}
+	}
+
+	return nil
+}
+
+func purgeContentUnits(before time.Time) error {
+	units, err := models.ContentUnits(mdb, qm.Where("removed_at < ?", before)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load removed content units")
+	}
+
+	log.Infof("%d content units to purge", len(units))
+	for i := range units {
+		cu := units[i]
+		if err := inTx(func(tx *sql.Tx) error { return api.PurgeContentUnit(tx, cu) }); err != nil {
+			return errors.Wrapf(err, "Purge content unit %d", cu.ID)
+		}
+	}
+
+	return nil
+}
+
+func purgePersons(before time.Time) error {
+	persons, err := models.Persons(mdb, qm.Where("removed_at < ?", before)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load removed persons")
+	}
+
+	log.Infof("%d persons to purge", len(persons))
+	for i := range persons {
+		p := persons[i]
+		if err := inTx(func(tx *sql.Tx) error { return api.PurgePerson(tx, p) }); err != nil {
+			return errors.Wrapf(err, "Purge person %d", p.ID)
+		}
+	}
+
+	return nil
+}
+
+func inTx(f func(*sql.Tx) error) error {
+	tx, err := mdb.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Begin transaction")
+	}
+
+	if err := f(tx); err != nil {
+		utils.Must(tx.Rollback())
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "Commit transaction")
+}
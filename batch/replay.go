@@ -0,0 +1,215 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/client"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Replay of operation requests recorded by the MDB, see api/recorder.go.
+// Requests are resent in the order they were received, to the live API,
+// and their new response is compared with the recorded one.
+
+type ReplayOptions struct {
+	Operation string
+	Status    int // 0 for any
+	Since     time.Time
+	Until     time.Time
+	DryRun    bool
+}
+
+type RecordedRequest struct {
+	ID        int64     `boil:"id"`
+	CreatedAt time.Time `boil:"created_at"`
+	Path      string    `boil:"path"`
+	Operation string    `boil:"operation"`
+	Headers   null.JSON `boil:"headers"`
+	Body      string    `boil:"body"`
+	Status    int       `boil:"status"`
+	Response  string    `boil:"response"`
+}
+
+func Replay(c *client.Client, opts ReplayOptions) {
+	var err error
+	clock := time.Now()
+
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	log.Info("Setting up connection to MDB")
+	mdb, err = sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(mdb.Ping())
+	defer mdb.Close()
+	boil.SetDB(mdb)
+
+	requests, err := loadRecordedRequests(mdb, opts)
+	utils.Must(err)
+	log.Infof("%d recorded requests to replay", len(requests))
+
+	var same, differ, skipped, failed int
+	for _, r := range requests {
+		fmt.Printf("#%d %s %s [%d]\n", r.ID, r.CreatedAt.Format(time.RFC3339), r.Path, r.Status)
+		if opts.DryRun {
+			fmt.Println(r.Body)
+			continue
+		}
+
+		status, response, stored, err := replayRequest(c, r)
+		if err != nil {
+			log.Errorf("Replay #%d: %s", r.ID, err.Error())
+			failed++
+			continue
+		}
+
+		if stored {
+			// the idempotency key (header or workflow_id) was seen before, nothing was run
+			fmt.Printf("  [%d] skipped, already done\n", status)
+			skipped++
+		} else if status == r.Status && normalizeJSON(response) == normalizeJSON(r.Response) {
+			fmt.Printf("  [%d] same response\n", status)
+			same++
+		} else {
+			fmt.Printf("  [%d] -> [%d]\n", r.Status, status)
+			fmt.Print(diffLines(normalizeJSON(r.Response), normalizeJSON(response)))
+			differ++
+		}
+	}
+
+	if !opts.DryRun {
+		log.Infof("Replayed %d requests: %d same, %d differ, %d skipped, %d failed",
+			len(requests)-failed, same, differ, skipped, failed)
+	}
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+func loadRecordedRequests(exec boil.Executor, opts ReplayOptions) ([]*RecordedRequest, error) {
+	mods := []qm.QueryMod{
+		qm.Select("id", "created_at", "path", "operation", "headers", "coalesce(body, '') AS body",
+			"status", "coalesce(response, '') AS response"),
+		qm.From("recorded_requests"),
+		qm.Where("replay_of IS NULL"),
+		qm.OrderBy("id"),
+	}
+	if opts.Operation != "" {
+		mods = append(mods, qm.Where("operation = ?", opts.Operation))
+	}
+	if opts.Status != 0 {
+		mods = append(mods, qm.Where("status = ?", opts.Status))
+	}
+	if !opts.Since.IsZero() {
+		mods = append(mods, qm.Where("created_at >= ?", opts.Since))
+	}
+	if !opts.Until.IsZero() {
+		mods = append(mods, qm.Where("created_at < ?", opts.Until))
+	}
+
+	requests := make([]*RecordedRequest, 0)
+	if err := models.NewQuery(exec, mods...).Bind(&requests); err != nil {
+		return nil, errors.Wrap(err, "Load recorded requests")
+	}
+
+	return requests, nil
+}
+
+// replayRequest returns the status and body of the response to the replayed request,
+// and whether it's the stored response of an earlier request with the same idempotency key.
+// Error responses are not errors here, they are compared with the recorded response.
+func replayRequest(c *client.Client, r *RecordedRequest) (int, string, bool, error) {
+	ctx := context.Background()
+
+	// requests with an idempotency key which did succeed are not run again
+	var headers http.Header
+	if r.Headers.Valid {
+		if err := r.Headers.Unmarshal(&headers); err != nil {
+			return 0, "", false, errors.Wrap(err, "json.Unmarshal headers")
+		}
+	}
+	if key := headers.Get(api.IDEMPOTENCY_KEY_HEADER); key != "" {
+		ctx = client.WithIdempotencyKey(ctx, key)
+	}
+
+	resp, stored, err := c.Replay(ctx, r.Path, []byte(r.Body), r.ID)
+	if err != nil {
+		if e, ok := err.(*client.Error); ok {
+			return e.StatusCode, string(e.Body), false, nil
+		}
+		return 0, "", false, err
+	}
+
+	return http.StatusOK, string(resp), stored, nil
+}
+
+// normalizeJSON indents JSON for comparison and display, other text is returned as is
+func normalizeJSON(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return strings.TrimSpace(s)
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return string(b)
+}
+
+// diffLines is a minimal line diff of a and b, by longest common subsequence
+func diffLines(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			fmt.Fprintf(&buf, "  - %s\n", x[i])
+			i++
+		default:
+			fmt.Fprintf(&buf, "  + %s\n", y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		fmt.Fprintf(&buf, "  - %s\n", x[i])
+	}
+	for ; j < len(y); j++ {
+		fmt.Fprintf(&buf, "  + %s\n", y[j])
+	}
+
+	return buf.String()
+}
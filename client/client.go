@@ -0,0 +1,266 @@
+// Package client is a Go client of the MDB HTTP API.
+//
+// Requests and responses are the structs of the api package.
+// Every request is authenticated with a bearer token, if one is configured.
+// Requests failing on a 5xx response, or on the network, are retried with exponential backoff.
+// POST requests are retried only when idempotent, i.e. operations with a workflow_id
+// or requests given an idempotency key with WithIdempotencyKey.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/api"
+)
+
+const (
+	DEFAULT_MAX_RETRIES = 3
+	DEFAULT_MIN_BACKOFF = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 10 * time.Second
+	DEFAULT_TIMEOUT     = time.Minute
+)
+
+// TokenSource returns the access token to send with a request.
+// It is called for every attempt so it may refresh an expired token.
+type TokenSource func() (string, error)
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      TokenSource
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// New creates a client of the MDB at baseURL, e.g. http://localhost:8080
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DEFAULT_TIMEOUT},
+		MaxRetries: DEFAULT_MAX_RETRIES,
+		MinBackoff: DEFAULT_MIN_BACKOFF,
+		MaxBackoff: DEFAULT_MAX_BACKOFF,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// WithToken authenticates all requests with a fixed access token
+func WithToken(token string) Option {
+	return WithTokenSource(func() (string, error) { return token, nil })
+}
+
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) {
+		c.Token = ts
+	}
+}
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = hc
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the bounds of the backoff between attempts.
+// Zero retries disables retrying.
+func WithRetries(max int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.MaxRetries = max
+		c.MinBackoff = minBackoff
+		c.MaxBackoff = maxBackoff
+	}
+}
+
+type ctxKey int
+
+const (
+	idempotencyKeyCtxKey ctxKey = iota
+	replayOfCtxKey
+)
+
+// WithIdempotencyKey sets the Idempotency-Key header of requests made with the returned context.
+// Such requests are retried even if they are not otherwise idempotent.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey, key)
+}
+
+// Error is a non 2xx response of the MDB
+type Error struct {
+	StatusCode int
+	Message    string            `json:"error"`
+	Errors     map[string]string `json:"errors"` // validation errors by field
+	Body       []byte            `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Errors) > 0 {
+		fields := make([]string, 0, len(e.Errors))
+		for k, v := range e.Errors {
+			fields = append(fields, fmt.Sprintf("%s: %s", k, v))
+		}
+		sort.Strings(fields)
+		msg = strings.Join(fields, ", ")
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("mdb: %d %s", e.StatusCode, msg)
+}
+
+// IsNotFound tells if err is a 404 response
+func IsNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+type idempotentRequest interface {
+	IdempotencyKey() string
+}
+
+// do sends a request, retrying it as appropriate, and decodes the JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return errors.Wrapf(err, "json.Marshal %s %s", method, path)
+		}
+	}
+
+	key, _ := ctx.Value(idempotencyKeyCtxKey).(string)
+	idempotent := method != http.MethodPost || key != ""
+	if r, ok := body.(idempotentRequest); ok && r.IdempotencyKey() != "" {
+		idempotent = true
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := c.attempt(ctx, method, u, payload, key, out)
+		if err == nil || !retry || !idempotent || attempt >= c.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// headerReader is implemented by responses which need the headers of the HTTP response
+type headerReader interface {
+	readHeader(http.Header)
+}
+
+// attempt sends a request once and tells if it may be retried on failure
+func (c *Client) attempt(ctx context.Context, method, u string, payload []byte, key string, out interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return false, errors.Wrapf(err, "http.NewRequest %s %s", method, u)
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set(api.IDEMPOTENCY_KEY_HEADER, key)
+	}
+	if id, ok := ctx.Value(replayOfCtxKey).(int64); ok {
+		req.Header.Set(api.REPLAY_OF_HEADER, strconv.FormatInt(id, 10))
+	}
+	if c.Token != nil {
+		token, err := c.Token()
+		if err != nil {
+			return false, errors.Wrap(err, "Token source")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, errors.Wrapf(err, "%s %s", method, u)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{StatusCode: resp.StatusCode}
+		e.Body, _ = ioutil.ReadAll(resp.Body)
+		json.Unmarshal(e.Body, e)
+		return resp.StatusCode >= http.StatusInternalServerError, e
+	}
+
+	if h, ok := out.(headerReader); ok {
+		h.readHeader(resp.Header)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, errors.Wrapf(err, "Decode response of %s %s", method, u)
+	}
+	return false, nil
+}
+
+// backoff before the retry following the given attempt, exponential with jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.MinBackoff << uint(attempt)
+	if d > c.MaxBackoff || d <= 0 {
+		d = c.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, nil, body, out)
+}
+
+func (c *Client) put(ctx context.Context, path string, body, out interface{}) error {
+	return c.do(ctx, http.MethodPut, path, nil, body, out)
+}
+
+func (c *Client) delete(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodDelete, path, nil, nil, out)
+}
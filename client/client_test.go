@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	c := New(server.URL, WithToken("secret"), WithRetries(2, time.Millisecond, 5*time.Millisecond))
+	return c, server.Close
+}
+
+func TestClientRequest(t *testing.T) {
+	c, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "/rest/collections/", r.URL.Path)
+		assert.Equal(t, []string{"1", "2"}, r.URL.Query()["id"])
+		assert.Equal(t, "daily_lesson", r.URL.Query().Get("content_type"))
+		assert.Equal(t, "10", r.URL.Query().Get("page_size"))
+		assert.NotContains(t, r.URL.Query(), "page_no", "zero values omitted")
+
+		json.NewEncoder(w).Encode(api.CollectionsResponse{
+			ListResponse: api.ListResponse{Total: 1},
+			Collections:  []*api.Collection{{Collection: models.Collection{ID: 1, UID: "12345678"}}},
+		})
+	})
+	defer stop()
+
+	r := api.CollectionsRequest{
+		ListRequest:        api.ListRequest{PageSize: 10},
+		IDsFilter:          api.IDsFilter{IDs: []int64{1, 2}},
+		ContentTypesFilter: api.ContentTypesFilter{ContentTypes: []string{"daily_lesson"}},
+	}
+	resp, err := c.Collections(context.Background(), r)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, resp.Total)
+	assert.Equal(t, "12345678", resp.Collections[0].UID)
+}
+
+func TestClientErrors(t *testing.T) {
+	c, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/collections/1/":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errors":{"User":"required"}}`))
+		}
+	})
+	defer stop()
+
+	_, err := c.Collection(context.Background(), 1)
+	assert.True(t, IsNotFound(err))
+
+	_, err = c.CaptureStart(context.Background(), api.CaptureStartRequest{})
+	if assert.IsType(t, &Error{}, err) {
+		e := err.(*Error)
+		assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+		assert.Equal(t, map[string]string{"User": "required"}, e.Errors)
+		assert.Equal(t, "mdb: 400 User: required", e.Error())
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	c, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/rest/tags/1/" && n > 2 {
+			w.Write([]byte(`{"id":1}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer stop()
+
+	tag, err := c.Tag(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, tag.ID)
+	assert.EqualValues(t, 3, calls, "GET retried on 5xx")
+
+	calls = 0
+	_, err = c.CreateTag(context.Background(), &api.Tag{})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 1, calls, "POST not retried")
+
+	calls = 0
+	_, err = c.CreateTag(WithIdempotencyKey(context.Background(), "key"), &api.Tag{})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 3, calls, "POST with idempotency key retried")
+
+	calls = 0
+	_, err = c.Convert(context.Background(), api.ConvertRequest{Operation: api.Operation{WorkflowID: "c12345"}})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 3, calls, "operation with workflow_id retried")
+}
+
+func TestIterator(t *testing.T) {
+	// cursor paging
+	c, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		resp := api.FilesResponse{ListResponse: api.ListResponse{Total: 3}}
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			resp.Files = []*api.MFile{{File: models.File{ID: 1}}, {File: models.File{ID: 2}}}
+			resp.NextCursor = "next"
+		case "next":
+			resp.Files = []*api.MFile{{File: models.File{ID: 3}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	defer stop()
+
+	var ids []int64
+	it := c.IterFiles(context.Background(), api.FilesRequest{})
+	for it.Next() {
+		ids = append(ids, it.File().ID)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+
+	// page number paging
+	c, stop = newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page_no"))
+		resp := api.TagsResponse{ListResponse: api.ListResponse{Total: 5}}
+		if page == 0 {
+			page = 1
+		}
+		for i := (page-1)*2 + 1; i <= page*2 && i <= 5; i++ {
+			resp.Tags = append(resp.Tags, &api.Tag{Tag: models.Tag{ID: int64(i)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	defer stop()
+
+	ids = nil
+	tit := c.IterTags(context.Background(), api.TagsRequest{ListRequest: api.ListRequest{PageSize: 2}})
+	for tit.Next() {
+		ids = append(ids, tit.Tag().ID)
+	}
+	assert.Nil(t, tit.Err())
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+
+	// errors stop the iteration
+	c, stop = newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	defer stop()
+
+	pit := c.IterPersons(context.Background(), api.PersonsRequest{})
+	assert.False(t, pit.Next())
+	assert.NotNil(t, pit.Err())
+}
+
+func TestClientReplay(t *testing.T) {
+	c, stop := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "7", r.Header.Get(api.REPLAY_OF_HEADER))
+		if r.Header.Get(api.IDEMPOTENCY_KEY_HEADER) != "" {
+			w.Header().Set(api.IDEMPOTENT_REPLAYED_HEADER, "true")
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	defer stop()
+
+	resp, stored, err := c.Replay(context.Background(), "/operations/insert", []byte(`{}`), 7)
+	assert.Nil(t, err)
+	assert.False(t, stored)
+	assert.JSONEq(t, `{"status":"ok"}`, string(resp))
+
+	_, stored, err = c.Replay(WithIdempotencyKey(context.Background(), "key"), "/operations/insert", []byte(`{}`), 7)
+	assert.Nil(t, err)
+	assert.True(t, stored, "stored response")
+}
@@ -0,0 +1,351 @@
+package client
+
+import (
+	"context"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// Iterators walk all pages of a list endpoint, starting with the page of the given request.
+// Pages are followed by next_cursor where the endpoint supports it, or by page_no otherwise.
+// A request with a start_index is a single page.
+//
+//	it := c.IterCollections(ctx, api.CollectionsRequest{})
+//	for it.Next() {
+//		fmt.Println(it.Collection().UID)
+//	}
+//	if err := it.Err(); err != nil { ... }
+
+// Iterator holds the paging state common to all iterators
+type Iterator struct {
+	fetch func(r api.ListRequest) (int, api.ListResponse, error)
+	req   api.ListRequest
+	i     int
+	n     int
+	seen  int64
+	done  bool
+	err   error
+}
+
+// Next advances to the next item, fetching the next page if needed.
+// It returns false when there are no more items or on error.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.i+1 < it.n {
+		it.i++
+		return true
+	}
+
+	for !it.done {
+		n, resp, err := it.fetch(it.req)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.seen += int64(n)
+		switch {
+		case resp.NextCursor != "":
+			it.req.Cursor = resp.NextCursor
+			it.req.PageNumber = 0
+		case it.req.Cursor == "" && it.req.StartIndex == 0 && n > 0 && it.seen < resp.Total:
+			if it.req.PageNumber == 0 {
+				it.req.PageNumber = 1
+			}
+			it.req.PageNumber++
+		default:
+			it.done = true
+		}
+
+		if n > 0 {
+			it.i, it.n = 0, n
+			return true
+		}
+	}
+
+	return false
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+type CollectionsIterator struct {
+	Iterator
+	page []*api.Collection
+}
+
+func (it *CollectionsIterator) Collection() *api.Collection {
+	return it.page[it.i]
+}
+
+func (c *Client) IterCollections(ctx context.Context, r api.CollectionsRequest) *CollectionsIterator {
+	it := &CollectionsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Collections(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Collections
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type ContentUnitsIterator struct {
+	Iterator
+	page []*api.ContentUnit
+}
+
+func (it *ContentUnitsIterator) ContentUnit() *api.ContentUnit {
+	return it.page[it.i]
+}
+
+func (c *Client) IterContentUnits(ctx context.Context, r api.ContentUnitsRequest) *ContentUnitsIterator {
+	it := &ContentUnitsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.ContentUnits(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.ContentUnits
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type FilesIterator struct {
+	Iterator
+	page []*api.MFile
+}
+
+func (it *FilesIterator) File() *api.MFile {
+	return it.page[it.i]
+}
+
+func (c *Client) IterFiles(ctx context.Context, r api.FilesRequest) *FilesIterator {
+	it := &FilesIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Files(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Files
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type OperationsIterator struct {
+	Iterator
+	page []*models.Operation
+}
+
+func (it *OperationsIterator) Operation() *models.Operation {
+	return it.page[it.i]
+}
+
+func (c *Client) IterOperations(ctx context.Context, r api.OperationsRequest) *OperationsIterator {
+	it := &OperationsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Operations(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Operations
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type SourcesIterator struct {
+	Iterator
+	page []*api.Source
+}
+
+func (it *SourcesIterator) Source() *api.Source {
+	return it.page[it.i]
+}
+
+func (c *Client) IterSources(ctx context.Context, r api.SourcesRequest) *SourcesIterator {
+	it := &SourcesIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Sources(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Sources
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type TagsIterator struct {
+	Iterator
+	page []*api.Tag
+}
+
+func (it *TagsIterator) Tag() *api.Tag {
+	return it.page[it.i]
+}
+
+func (c *Client) IterTags(ctx context.Context, r api.TagsRequest) *TagsIterator {
+	it := &TagsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Tags(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Tags
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type PersonsIterator struct {
+	Iterator
+	page []*api.Person
+}
+
+func (it *PersonsIterator) Person() *api.Person {
+	return it.page[it.i]
+}
+
+func (c *Client) IterPersons(ctx context.Context, r api.PersonsRequest) *PersonsIterator {
+	it := &PersonsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Persons(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Persons
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type StoragesIterator struct {
+	Iterator
+	page []*models.Storage
+}
+
+func (it *StoragesIterator) Storage() *models.Storage {
+	return it.page[it.i]
+}
+
+func (c *Client) IterStorages(ctx context.Context, r api.StoragesRequest) *StoragesIterator {
+	it := &StoragesIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Storages(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Storages
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type PublishersIterator struct {
+	Iterator
+	page []*api.Publisher
+}
+
+func (it *PublishersIterator) Publisher() *api.Publisher {
+	return it.page[it.i]
+}
+
+func (c *Client) IterPublishers(ctx context.Context, r api.PublishersRequest) *PublishersIterator {
+	it := &PublishersIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Publishers(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Publishers
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type SearchIterator struct {
+	Iterator
+	page []*api.SearchHit
+}
+
+func (it *SearchIterator) Hit() *api.SearchHit {
+	return it.page[it.i]
+}
+
+func (c *Client) IterSearch(ctx context.Context, r api.SearchRequest) *SearchIterator {
+	it := &SearchIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Search(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Hits
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type AuditLogIterator struct {
+	Iterator
+	page []*api.AuditLogEntry
+}
+
+func (it *AuditLogIterator) Entry() *api.AuditLogEntry {
+	return it.page[it.i]
+}
+
+func (c *Client) IterAuditLog(ctx context.Context, r api.AuditLogRequest) *AuditLogIterator {
+	it := &AuditLogIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.AuditLog(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.AuditLog
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
+
+type JobsIterator struct {
+	Iterator
+	page []*api.Job
+}
+
+func (it *JobsIterator) Job() *api.Job {
+	return it.page[it.i]
+}
+
+func (c *Client) IterJobs(ctx context.Context, r api.JobsRequest) *JobsIterator {
+	it := &JobsIterator{Iterator: Iterator{req: r.ListRequest}}
+	it.fetch = func(lr api.ListRequest) (int, api.ListResponse, error) {
+		r.ListRequest = lr
+		resp, err := c.Jobs(ctx, r)
+		if err != nil {
+			return 0, api.ListResponse{}, err
+		}
+		it.page = resp.Jobs
+		return len(it.page), resp.ListResponse, nil
+	}
+	return it
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Bnei-Baruch/mdb/api"
+)
+
+// Operations reported by the workflow.
+// A request with a workflow_id is idempotent and safe to retry.
+
+func (c *Client) CaptureStart(ctx context.Context, r api.CaptureStartRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_CAPTURE_START, r)
+}
+
+func (c *Client) CaptureStop(ctx context.Context, r api.CaptureStopRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_CAPTURE_STOP, r)
+}
+
+func (c *Client) Demux(ctx context.Context, r api.DemuxRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_DEMUX, r)
+}
+
+func (c *Client) Trim(ctx context.Context, r api.TrimRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_TRIM, r)
+}
+
+func (c *Client) Send(ctx context.Context, r api.SendRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_SEND, r)
+}
+
+func (c *Client) Convert(ctx context.Context, r api.ConvertRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_CONVERT, r)
+}
+
+func (c *Client) Upload(ctx context.Context, r api.UploadRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_UPLOAD, r)
+}
+
+func (c *Client) Sirtutim(ctx context.Context, r api.SirtutimRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_SIRTUTIM, r)
+}
+
+func (c *Client) Insert(ctx context.Context, r api.InsertRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_INSERT, r)
+}
+
+func (c *Client) Transcode(ctx context.Context, r api.TranscodeRequest) (*api.OperationResult, error) {
+	return c.operation(ctx, api.OP_TRANSCODE, r)
+}
+
+// DescendantUnits returns the content units of the descendants of a file
+func (c *Client) DescendantUnits(ctx context.Context, sha1 string) (*api.ContentUnitsResponse, error) {
+	var resp api.ContentUnitsResponse
+	if err := c.get(ctx, "/operations/descendant_units/"+sha1, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// replayResponse is the raw response to a replayed request
+type replayResponse struct {
+	body   json.RawMessage
+	stored bool
+}
+
+func (r *replayResponse) UnmarshalJSON(b []byte) error {
+	r.body = append(r.body[:0], b...)
+	return nil
+}
+
+func (r *replayResponse) readHeader(h http.Header) {
+	r.stored = h.Get(api.IDEMPOTENT_REPLAYED_HEADER) != ""
+}
+
+// Replay resends a recorded operation request as is, marking it as a replay of the recorded request.
+// Its response is returned raw, for comparison with the recorded response.
+// stored is true if the response is the recorded response of an earlier request with the same idempotency key,
+// i.e. the request wasn't run again.
+func (c *Client) Replay(ctx context.Context, path string, body []byte, recordID int64) (resp json.RawMessage, stored bool, err error) {
+	var r replayResponse
+	ctx = context.WithValue(ctx, replayOfCtxKey, recordID)
+	if err = c.post(ctx, path, json.RawMessage(body), &r); err != nil {
+		return nil, false, err
+	}
+	return r.body, r.stored, nil
+}
+
+func (c *Client) operation(ctx context.Context, opType string, body interface{}) (*api.OperationResult, error) {
+	var resp api.OperationResult
+	if err := c.post(ctx, "/operations/"+opType, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// encodeQuery encodes the form tagged fields of a request struct,
+// the way gin binds them, into query parameters. Zero values are omitted.
+func encodeQuery(v interface{}) url.Values {
+	q := url.Values{}
+	encodeFields(q, reflect.Indirect(reflect.ValueOf(v)))
+	return q
+}
+
+func encodeFields(q url.Values, v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			encodeFields(q, fv)
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("form"), ",")[0]
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < fv.Len(); j++ {
+				q.Add(name, fmt.Sprint(fv.Index(j).Interface()))
+			}
+		default:
+			if fv.Interface() != reflect.Zero(f.Type).Interface() {
+				q.Set(name, fmt.Sprint(fv.Interface()))
+			}
+		}
+	}
+}
@@ -0,0 +1,752 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/media"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/permissions"
+)
+
+// Collections
+
+func (c *Client) Collections(ctx context.Context, r api.CollectionsRequest) (*api.CollectionsResponse, error) {
+	var resp api.CollectionsResponse
+	if err := c.get(ctx, "/rest/collections/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateCollection(ctx context.Context, collection *api.Collection) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.post(ctx, "/rest/collections/", collection, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Collection(ctx context.Context, id int64) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.get(ctx, fmt.Sprintf("/rest/collections/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateCollection(ctx context.Context, id int64, collection *api.PartialCollection) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.put(ctx, fmt.Sprintf("/rest/collections/%d/", id), collection, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RemoveCollection marks a collection as removed, it can be restored
+func (c *Client) RemoveCollection(ctx context.Context, id int64) error {
+	return c.delete(ctx, fmt.Sprintf("/rest/collections/%d/", id), nil)
+}
+
+func (c *Client) RestoreCollection(ctx context.Context, id int64) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.post(ctx, fmt.Sprintf("/rest/collections/%d/restore", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ActivateCollection toggles the active flag of a collection
+func (c *Client) ActivateCollection(ctx context.Context, id int64) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.post(ctx, fmt.Sprintf("/rest/collections/%d/activate", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateCollectionI18n(ctx context.Context, id int64, i18ns []*models.CollectionI18n) (*api.Collection, error) {
+	var resp api.Collection
+	if err := c.put(ctx, fmt.Sprintf("/rest/collections/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CollectionContentUnits(ctx context.Context, id int64) ([]*api.CollectionContentUnit, error) {
+	var resp []*api.CollectionContentUnit
+	if err := c.get(ctx, fmt.Sprintf("/rest/collections/%d/content_units/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddCollectionContentUnits(ctx context.Context, id int64, ccus []*models.CollectionsContentUnit) error {
+	return c.post(ctx, fmt.Sprintf("/rest/collections/%d/content_units/", id), ccus, nil)
+}
+
+// UpdateCollectionContentUnit updates the name or position of a content unit in a collection
+func (c *Client) UpdateCollectionContentUnit(ctx context.Context, id, cuID int64, ccu *models.CollectionsContentUnit) error {
+	return c.put(ctx, fmt.Sprintf("/rest/collections/%d/content_units/%d", id, cuID), ccu, nil)
+}
+
+func (c *Client) RemoveCollectionContentUnit(ctx context.Context, id, cuID int64) error {
+	return c.delete(ctx, fmt.Sprintf("/rest/collections/%d/content_units/%d", id, cuID), nil)
+}
+
+// Content Units
+
+func (c *Client) ContentUnits(ctx context.Context, r api.ContentUnitsRequest) (*api.ContentUnitsResponse, error) {
+	var resp api.ContentUnitsResponse
+	if err := c.get(ctx, "/rest/content_units/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateContentUnit(ctx context.Context, unit *api.ContentUnit) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.post(ctx, "/rest/content_units/", unit, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnit(ctx context.Context, id int64) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateContentUnit(ctx context.Context, id int64, unit *api.PartialContentUnit) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.put(ctx, fmt.Sprintf("/rest/content_units/%d/", id), unit, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RestoreContentUnit(ctx context.Context, id int64) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/restore", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateContentUnitI18n(ctx context.Context, id int64, i18ns []*models.ContentUnitI18n) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.put(ctx, fmt.Sprintf("/rest/content_units/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnitFiles(ctx context.Context, id int64) ([]*api.MFile, error) {
+	var resp []*api.MFile
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/files/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddContentUnitFiles(ctx context.Context, id int64, fileIDs []int64) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/files/", id), fileIDs, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnitCollections(ctx context.Context, id int64) ([]*api.CollectionContentUnit, error) {
+	var resp []*api.CollectionContentUnit
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/collections/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ContentUnitDerivatives(ctx context.Context, id int64) ([]*api.ContentUnitDerivation, error) {
+	var resp []*api.ContentUnitDerivation
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/derivatives/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddContentUnitDerivative(ctx context.Context, id int64, d *models.ContentUnitDerivation) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/derivatives/", id), d, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateContentUnitDerivative updates the name of a derivation
+func (c *Client) UpdateContentUnitDerivative(ctx context.Context, id, duID int64, d *models.ContentUnitDerivation) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.put(ctx, fmt.Sprintf("/rest/content_units/%d/derivatives/%d", id, duID), d, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemoveContentUnitDerivative(ctx context.Context, id, duID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.delete(ctx, fmt.Sprintf("/rest/content_units/%d/derivatives/%d", id, duID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ContentUnitOrigins returns the content units a content unit is derived from
+func (c *Client) ContentUnitOrigins(ctx context.Context, id int64) ([]*api.ContentUnitDerivation, error) {
+	var resp []*api.ContentUnitDerivation
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/origins/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ContentUnitSources(ctx context.Context, id int64) ([]*api.Source, error) {
+	var resp []*api.Source
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/sources/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddContentUnitSource(ctx context.Context, id, sourceID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	body := map[string]int64{"sourceID": sourceID}
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/sources/", id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemoveContentUnitSource(ctx context.Context, id, sourceID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.delete(ctx, fmt.Sprintf("/rest/content_units/%d/sources/%d", id, sourceID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnitTags(ctx context.Context, id int64) ([]*api.Tag, error) {
+	var resp []*api.Tag
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/tags/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddContentUnitTag(ctx context.Context, id, tagID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	body := map[string]int64{"tagID": tagID}
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/tags/", id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemoveContentUnitTag(ctx context.Context, id, tagID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.delete(ctx, fmt.Sprintf("/rest/content_units/%d/tags/%d", id, tagID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnitPersons(ctx context.Context, id int64) ([]*api.ContentUnitPerson, error) {
+	var resp []*api.ContentUnitPerson
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/persons/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AddContentUnitPerson adds a person, in a role, to a content unit
+func (c *Client) AddContentUnitPerson(ctx context.Context, id int64, p *models.ContentUnitsPerson) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/persons/", id), p, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemoveContentUnitPerson(ctx context.Context, id, personID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.delete(ctx, fmt.Sprintf("/rest/content_units/%d/persons/%d", id, personID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ContentUnitPublishers(ctx context.Context, id int64) ([]*api.Publisher, error) {
+	var resp []*api.Publisher
+	if err := c.get(ctx, fmt.Sprintf("/rest/content_units/%d/publishers/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddContentUnitPublisher(ctx context.Context, id, publisherID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	body := map[string]int64{"publisherID": publisherID}
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/publishers/", id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemoveContentUnitPublisher(ctx context.Context, id, publisherID int64) (*models.ContentUnit, error) {
+	var resp models.ContentUnit
+	if err := c.delete(ctx, fmt.Sprintf("/rest/content_units/%d/publishers/%d", id, publisherID), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// MergeContentUnits merges the given content units into a content unit
+func (c *Client) MergeContentUnits(ctx context.Context, id int64, ids []int64) (*api.ContentUnit, error) {
+	var resp api.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/merge", id), ids, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SplitContentUnit splits files of a content unit into new content units
+func (c *Client) SplitContentUnit(ctx context.Context, id int64, r api.ContentUnitSplitRequest) ([]*api.ContentUnit, error) {
+	var resp []*api.ContentUnit
+	if err := c.post(ctx, fmt.Sprintf("/rest/content_units/%d/split", id), r, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// BulkEditContentUnits applies the same operations to many content units
+func (c *Client) BulkEditContentUnits(ctx context.Context, r api.ContentUnitsBulkRequest) (*api.ContentUnitsBulkResponse, error) {
+	var resp api.ContentUnitsBulkResponse
+	if err := c.post(ctx, "/rest/bulk/content_units/", r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Files
+
+func (c *Client) Files(ctx context.Context, r api.FilesRequest) (*api.FilesResponse, error) {
+	var resp api.FilesResponse
+	if err := c.get(ctx, "/rest/files/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) File(ctx context.Context, id int64) (*api.MFile, error) {
+	var resp api.MFile
+	if err := c.get(ctx, fmt.Sprintf("/rest/files/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateFile(ctx context.Context, id int64, file *api.PartialFile) (*api.MFile, error) {
+	var resp api.MFile
+	if err := c.put(ctx, fmt.Sprintf("/rest/files/%d/", id), file, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PublishFile publishes a file, and its content unit and collections if needed
+func (c *Client) PublishFile(ctx context.Context, id int64) (*api.MFile, error) {
+	var resp api.MFile
+	if err := c.post(ctx, fmt.Sprintf("/rest/files/%d/publish", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UnpublishFile unpublishes a file, and its content unit and collections if no other file is published
+func (c *Client) UnpublishFile(ctx context.Context, id int64) (*api.MFile, error) {
+	var resp api.MFile
+	if err := c.post(ctx, fmt.Sprintf("/rest/files/%d/unpublish", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RemoveFile marks a file as removed
+func (c *Client) RemoveFile(ctx context.Context, id int64) error {
+	return c.delete(ctx, fmt.Sprintf("/rest/files/%d/", id), nil)
+}
+
+func (c *Client) FileStorages(ctx context.Context, id int64) ([]*api.Storage, error) {
+	var resp []*api.Storage
+	if err := c.get(ctx, fmt.Sprintf("/rest/files/%d/storages/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FileLocations returns the copies of a file, best first for a caller in country, which may be empty
+func (c *Client) FileLocations(ctx context.Context, id int64, country string) ([]*api.FileLocation, error) {
+	var resp []*api.FileLocation
+	r := api.FileLocationsRequest{Country: country}
+	if err := c.get(ctx, fmt.Sprintf("/rest/files/%d/locations/", id), encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FileMedia returns the technical metadata of a media file
+func (c *Client) FileMedia(ctx context.Context, id int64) (*media.Info, error) {
+	var resp media.Info
+	if err := c.get(ctx, fmt.Sprintf("/rest/files/%d/media/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FileTree returns the ancestors and descendants of a file with their operations
+func (c *Client) FileTree(ctx context.Context, id int64) (*api.FileTreeResponse, error) {
+	var resp api.FileTreeResponse
+	if err := c.get(ctx, fmt.Sprintf("/rest/files/%d/tree/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Operations
+
+func (c *Client) Operations(ctx context.Context, r api.OperationsRequest) (*api.OperationsResponse, error) {
+	var resp api.OperationsResponse
+	if err := c.get(ctx, "/rest/operations/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Operation(ctx context.Context, id int64) (*models.Operation, error) {
+	var resp models.Operation
+	if err := c.get(ctx, fmt.Sprintf("/rest/operations/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) OperationFiles(ctx context.Context, id int64) ([]*api.MFile, error) {
+	var resp []*api.MFile
+	if err := c.get(ctx, fmt.Sprintf("/rest/operations/%d/files/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Sources
+
+func (c *Client) Authors(ctx context.Context) (*api.AuthorsResponse, error) {
+	var resp api.AuthorsResponse
+	if err := c.get(ctx, "/rest/authors/", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Sources(ctx context.Context, r api.SourcesRequest) (*api.SourcesResponse, error) {
+	var resp api.SourcesResponse
+	if err := c.get(ctx, "/rest/sources/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateSource(ctx context.Context, r api.CreateSourceRequest) (*api.Source, error) {
+	var resp api.Source
+	if err := c.post(ctx, "/rest/sources/", r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Source(ctx context.Context, id int64) (*api.Source, error) {
+	var resp api.Source
+	if err := c.get(ctx, fmt.Sprintf("/rest/sources/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateSource(ctx context.Context, id int64, source *api.Source) (*api.Source, error) {
+	var resp api.Source
+	if err := c.put(ctx, fmt.Sprintf("/rest/sources/%d/", id), source, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateSourceI18n(ctx context.Context, id int64, i18ns []*models.SourceI18n) (*api.Source, error) {
+	var resp api.Source
+	if err := c.put(ctx, fmt.Sprintf("/rest/sources/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Tags
+
+func (c *Client) Tags(ctx context.Context, r api.TagsRequest) (*api.TagsResponse, error) {
+	var resp api.TagsResponse
+	if err := c.get(ctx, "/rest/tags/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateTag(ctx context.Context, tag *api.Tag) (*api.Tag, error) {
+	var resp api.Tag
+	if err := c.post(ctx, "/rest/tags/", tag, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Tag(ctx context.Context, id int64) (*api.Tag, error) {
+	var resp api.Tag
+	if err := c.get(ctx, fmt.Sprintf("/rest/tags/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateTag(ctx context.Context, id int64, tag *api.Tag) (*api.Tag, error) {
+	var resp api.Tag
+	if err := c.put(ctx, fmt.Sprintf("/rest/tags/%d/", id), tag, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateTagI18n(ctx context.Context, id int64, i18ns []*models.TagI18n) (*api.Tag, error) {
+	var resp api.Tag
+	if err := c.put(ctx, fmt.Sprintf("/rest/tags/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Persons
+
+func (c *Client) Persons(ctx context.Context, r api.PersonsRequest) (*api.PersonsResponse, error) {
+	var resp api.PersonsResponse
+	if err := c.get(ctx, "/rest/persons/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreatePerson(ctx context.Context, person *api.Person) (*api.Person, error) {
+	var resp api.Person
+	if err := c.post(ctx, "/rest/persons/", person, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Person(ctx context.Context, id int64) (*api.Person, error) {
+	var resp api.Person
+	if err := c.get(ctx, fmt.Sprintf("/rest/persons/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdatePerson(ctx context.Context, id int64, person *api.Person) (*api.Person, error) {
+	var resp api.Person
+	if err := c.put(ctx, fmt.Sprintf("/rest/persons/%d/", id), person, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RemovePerson marks a person as removed, it can be restored
+func (c *Client) RemovePerson(ctx context.Context, id int64) error {
+	return c.delete(ctx, fmt.Sprintf("/rest/persons/%d/", id), nil)
+}
+
+func (c *Client) RestorePerson(ctx context.Context, id int64) (*api.Person, error) {
+	var resp api.Person
+	if err := c.post(ctx, fmt.Sprintf("/rest/persons/%d/restore", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdatePersonI18n(ctx context.Context, id int64, i18ns []*models.PersonI18n) (*api.Person, error) {
+	var resp api.Person
+	if err := c.put(ctx, fmt.Sprintf("/rest/persons/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Storages
+
+func (c *Client) Storages(ctx context.Context, r api.StoragesRequest) (*api.StoragesResponse, error) {
+	var resp api.StoragesResponse
+	if err := c.get(ctx, "/rest/storages/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Publishers
+
+func (c *Client) Publishers(ctx context.Context, r api.PublishersRequest) (*api.PublishersResponse, error) {
+	var resp api.PublishersResponse
+	if err := c.get(ctx, "/rest/publishers/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreatePublisher(ctx context.Context, publisher *api.Publisher) (*api.Publisher, error) {
+	var resp api.Publisher
+	if err := c.post(ctx, "/rest/publishers/", publisher, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Publisher(ctx context.Context, id int64) (*api.Publisher, error) {
+	var resp api.Publisher
+	if err := c.get(ctx, fmt.Sprintf("/rest/publishers/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdatePublisher(ctx context.Context, id int64, publisher *api.Publisher) (*api.Publisher, error) {
+	var resp api.Publisher
+	if err := c.put(ctx, fmt.Sprintf("/rest/publishers/%d/", id), publisher, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdatePublisherI18n(ctx context.Context, id int64, i18ns []*models.PublisherI18n) (*api.Publisher, error) {
+	var resp api.Publisher
+	if err := c.put(ctx, fmt.Sprintf("/rest/publishers/%d/i18n/", id), i18ns, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search and audit
+
+func (c *Client) Search(ctx context.Context, r api.SearchRequest) (*api.SearchResponse, error) {
+	var resp api.SearchResponse
+	if err := c.get(ctx, "/rest/search/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) AuditLog(ctx context.Context, r api.AuditLogRequest) (*api.AuditLogResponse, error) {
+	var resp api.AuditLogResponse
+	if err := c.get(ctx, "/rest/audit/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Permissions policy
+
+func (c *Client) PermissionRules(ctx context.Context, r api.PermissionRulesRequest) (*api.PermissionRulesResponse, error) {
+	var resp api.PermissionRulesResponse
+	if err := c.get(ctx, "/rest/permissions/rules/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreatePermissionRule(ctx context.Context, rule *permissions.PolicyRule) (*permissions.PolicyRule, error) {
+	var resp permissions.PolicyRule
+	if err := c.post(ctx, "/rest/permissions/rules/", rule, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) PermissionRule(ctx context.Context, id int64) (*permissions.PolicyRule, error) {
+	var resp permissions.PolicyRule
+	if err := c.get(ctx, fmt.Sprintf("/rest/permissions/rules/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RemovePermissionRule(ctx context.Context, id int64) (*permissions.PolicyRule, error) {
+	var resp permissions.PolicyRule
+	if err := c.delete(ctx, fmt.Sprintf("/rest/permissions/rules/%d/", id), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Jobs
+
+func (c *Client) Jobs(ctx context.Context, r api.JobsRequest) (*api.JobsResponse, error) {
+	var resp api.JobsResponse
+	if err := c.get(ctx, "/rest/jobs/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Job(ctx context.Context, id int64) (*api.Job, error) {
+	var resp api.Job
+	if err := c.get(ctx, fmt.Sprintf("/rest/jobs/%d/", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) EnqueueJobs(ctx context.Context, r api.EnqueueJobsRequest) (*api.EnqueueJobsResponse, error) {
+	var resp api.EnqueueJobsResponse
+	if err := c.post(ctx, "/rest/jobs/", r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ClaimJob returns the next queued job, nil if there is none
+func (c *Client) ClaimJob(ctx context.Context, r api.ClaimJobRequest) (*api.Job, error) {
+	var resp *api.Job
+	if err := c.post(ctx, "/rest/job-claims/", r, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) JobHeartbeat(ctx context.Context, id int64, r api.JobHeartbeatRequest) (*api.Job, error) {
+	var resp api.Job
+	if err := c.post(ctx, fmt.Sprintf("/rest/jobs/%d/heartbeat/", id), r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CompleteJob(ctx context.Context, id int64, r api.CompleteJobRequest) (*api.Job, error) {
+	var resp api.Job
+	if err := c.post(ctx, fmt.Sprintf("/rest/jobs/%d/complete/", id), r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+
+	"github.com/Bnei-Baruch/mdb/api"
+)
+
+// The Server-Sent Events stream, metrics and specification viewer are not JSON endpoints.
+// Poll Events with a Wait instead of the stream.
+
+// HealthCheck checks the DB connection of the server
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return c.get(ctx, "/health_check", nil, nil)
+}
+
+// Live returns the liveness of the server.
+// An unhealthy server responds with an *Error holding the HealthResponse in its Body.
+func (c *Client) Live(ctx context.Context) (*api.HealthResponse, error) {
+	var resp api.HealthResponse
+	if err := c.get(ctx, "/health/live", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ready returns the readiness of the server and its dependencies.
+// An unready server responds with an *Error holding the HealthResponse in its Body.
+func (c *Client) Ready(ctx context.Context) (*api.HealthResponse, error) {
+	var resp api.HealthResponse
+	if err := c.get(ctx, "/health/ready", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) OpenAPI(ctx context.Context) (*api.OpenAPI, error) {
+	var resp api.OpenAPI
+	if err := c.get(ctx, "/openapi.json", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Events returns the events since a given event, waiting up to r.Wait seconds for new ones
+func (c *Client) Events(ctx context.Context, r api.EventsRequest) (*api.EventsResponse, error) {
+	var resp api.EventsResponse
+	if err := c.get(ctx, "/events", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AuthorsHierarchy returns the sources tree under their authors
+func (c *Client) AuthorsHierarchy(ctx context.Context, r api.SourcesHierarchyRequest) ([]*api.AuthorH, error) {
+	r.RootUID = ""
+	var resp []*api.AuthorH
+	if err := c.get(ctx, "/hierarchy/sources/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SourcesHierarchy returns the sources tree under r.RootUID
+func (c *Client) SourcesHierarchy(ctx context.Context, r api.SourcesHierarchyRequest) ([]*api.SourceH, error) {
+	var resp []*api.SourceH
+	if err := c.get(ctx, "/hierarchy/sources/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) TagsHierarchy(ctx context.Context, r api.TagsHierarchyRequest) ([]*api.TagH, error) {
+	var resp []*api.TagH
+	if err := c.get(ctx, "/hierarchy/tags/", encodeQuery(r), &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/client"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Administration commands go through the REST API, never to the DB directly,
+// so they are subject to the same permissions and emit the same events as the web UI.
+
+var (
+	apiURL       string
+	apiToken     string
+	outputFormat string
+)
+
+// addAPIFlags adds the flags common to commands calling the REST API
+func addAPIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&apiURL, "api-url", "", "MDB API url (default is api.url in config)")
+	cmd.PersistentFlags().StringVar(&apiToken, "token", "", "access token or API key (default is api.token in config)")
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "output format, table or json")
+}
+
+func mustAPIClient() *client.Client {
+	url := apiURL
+	if url == "" {
+		url = viper.GetString("api.url")
+	}
+	token := apiToken
+	if token == "" {
+		token = viper.GetString("api.token")
+	}
+	if url == "" {
+		exitWithError(fmt.Errorf("No API url, set api.url in config or use --api-url"))
+	}
+
+	return client.New(url, client.WithToken(token))
+}
+
+// mustCall exits on API errors, they are expected and need no stack trace
+func mustCall(err error) {
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
+
+func requireArgs(cmd *cobra.Command, args []string, n int) {
+	if len(args) < n {
+		fmt.Printf("Usage: %s\n", cmd.UseLine())
+		os.Exit(1)
+	}
+}
+
+// printOutput prints v as JSON, or as a table with the given function
+func printOutput(v interface{}, table func(w *tabwriter.Writer)) {
+	if outputFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		utils.Must(enc.Encode(v))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	utils.Must(w.Flush())
+}
+
+// Arguments identify entities by ID or UID, files by SHA1 as well.
+
+func resolveContentUnitID(c *client.Client, arg string) int64 {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id
+	}
+
+	resp, err := c.ContentUnits(context.Background(), api.ContentUnitsRequest{
+		UIDsFilter: api.UIDsFilter{UIDs: []string{arg}},
+	})
+	mustCall(err)
+	if len(resp.ContentUnits) == 0 {
+		exitWithError(fmt.Errorf("Content unit not found: %s", arg))
+	}
+	return resp.ContentUnits[0].ID
+}
+
+func resolveCollectionID(c *client.Client, arg string) int64 {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id
+	}
+
+	resp, err := c.Collections(context.Background(), api.CollectionsRequest{
+		UIDsFilter: api.UIDsFilter{UIDs: []string{arg}},
+	})
+	mustCall(err)
+	if len(resp.Collections) == 0 {
+		exitWithError(fmt.Errorf("Collection not found: %s", arg))
+	}
+	return resp.Collections[0].ID
+}
+
+func resolveFileID(c *client.Client, arg string) int64 {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return id
+	}
+
+	r := api.FilesRequest{}
+	if _, err := hex.DecodeString(arg); err == nil && len(arg) == 40 {
+		r.SHA1s = []string{arg}
+	} else {
+		r.UIDs = []string{arg}
+	}
+	resp, err := c.Files(context.Background(), r)
+	mustCall(err)
+	if len(resp.Files) == 0 {
+		exitWithError(fmt.Errorf("File not found: %s", arg))
+	}
+	return resp.Files[0].ID
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
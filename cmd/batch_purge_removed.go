@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/batch"
+)
+
+var purgeRetention time.Duration
+
+var purgeRemovedCmd = &cobra.Command{
+	Use:   "purge_removed",
+	Short: "Delete collections, content units and persons removed long ago",
+	Run:   purgeRemovedFn,
+}
+
+func init() {
+	batchCmd.AddCommand(purgeRemovedCmd)
+	purgeRemovedCmd.Flags().DurationVar(&purgeRetention, "retention", 0,
+		"Purge entities removed before this long ago (default is purge.retention from config)")
+}
+
+func purgeRemovedFn(cmd *cobra.Command, args []string) {
+	batch.PurgeRemoved(purgeRetention)
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+var (
+	collectionUnitName     string
+	collectionUnitPosition int
+)
+
+var collectionCmd = &cobra.Command{
+	Use:   "collection",
+	Short: "Manage collections through the API",
+}
+
+var collectionGetCmd = &cobra.Command{
+	Use:   "get COLLECTION",
+	Short: "Show a collection, by ID or UID",
+	Run:   collectionGetFn,
+}
+
+var collectionUnitsCmd = &cobra.Command{
+	Use:   "units COLLECTION",
+	Short: "List the content units of a collection",
+	Run:   collectionUnitsFn,
+}
+
+var collectionAddUnitCmd = &cobra.Command{
+	Use:   "add-unit COLLECTION CU",
+	Short: "Add a content unit to a collection",
+	Run:   collectionAddUnitFn,
+}
+
+var collectionRemoveUnitCmd = &cobra.Command{
+	Use:   "remove-unit COLLECTION CU",
+	Short: "Remove a content unit from a collection",
+	Run:   collectionRemoveUnitFn,
+}
+
+func init() {
+	RootCmd.AddCommand(collectionCmd)
+	addAPIFlags(collectionCmd)
+	collectionCmd.AddCommand(collectionGetCmd, collectionUnitsCmd, collectionAddUnitCmd, collectionRemoveUnitCmd)
+
+	collectionAddUnitCmd.Flags().StringVar(&collectionUnitName, "name", "", "name of the unit in the collection, e.g. part number")
+	collectionAddUnitCmd.Flags().IntVar(&collectionUnitPosition, "position", 0, "position of the unit in the collection")
+}
+
+func collectionGetFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	cl, err := c.Collection(context.Background(), resolveCollectionID(c, args[0]))
+	mustCall(err)
+
+	printOutput(cl, func(w *tabwriter.Writer) {
+		name := ""
+		for _, lang := range []string{api.LANG_ENGLISH, api.LANG_HEBREW} {
+			if i18n, ok := cl.I18n[lang]; ok && i18n.Name.Valid {
+				name = i18n.Name.String
+				break
+			}
+		}
+		fmt.Fprintln(w, "ID\tUID\tTYPE ID\tNAME\tSECURE\tPUBLISHED\tCREATED\tREMOVED")
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%t\t%s\t%s\n", cl.ID, cl.UID, cl.TypeID, name,
+			cl.Secure, cl.Published, formatTime(cl.CreatedAt), formatTime(cl.RemovedAt.Time))
+	})
+}
+
+func collectionUnitsFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	ccus, err := c.CollectionContentUnits(context.Background(), resolveCollectionID(c, args[0]))
+	mustCall(err)
+	printCollectionContentUnits(ccus)
+}
+
+func collectionAddUnitFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 2)
+	c := mustAPIClient()
+	ctx := context.Background()
+
+	id := resolveCollectionID(c, args[0])
+	ccu := &models.CollectionsContentUnit{
+		CollectionID:  id,
+		ContentUnitID: resolveContentUnitID(c, args[1]),
+		Name:          collectionUnitName,
+		Position:      collectionUnitPosition,
+	}
+	mustCall(c.AddCollectionContentUnits(ctx, id, []*models.CollectionsContentUnit{ccu}))
+
+	ccus, err := c.CollectionContentUnits(ctx, id)
+	mustCall(err)
+	printCollectionContentUnits(ccus)
+}
+
+func collectionRemoveUnitFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 2)
+	c := mustAPIClient()
+	ctx := context.Background()
+
+	id := resolveCollectionID(c, args[0])
+	mustCall(c.RemoveCollectionContentUnit(ctx, id, resolveContentUnitID(c, args[1])))
+
+	ccus, err := c.CollectionContentUnits(ctx, id)
+	mustCall(err)
+	printCollectionContentUnits(ccus)
+}
+
+func printCollectionContentUnits(ccus []*api.CollectionContentUnit) {
+	printOutput(ccus, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "POSITION\tNAME\tCU ID\tCU UID\tTYPE ID\tPUBLISHED")
+		for _, ccu := range ccus {
+			cu := ccu.ContentUnit
+			if cu == nil {
+				continue
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%t\n", ccu.Position, ccu.Name, cu.ID, cu.UID, cu.TypeID, cu.Published)
+		}
+	})
+}
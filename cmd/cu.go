@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+var (
+	cuSecure     int
+	cuProperties []string
+	cuNames      []string
+	cuRemoveTag  bool
+)
+
+var cuCmd = &cobra.Command{
+	Use:   "cu",
+	Short: "Manage content units through the API",
+}
+
+var cuGetCmd = &cobra.Command{
+	Use:   "get CU",
+	Short: "Show a content unit, by ID or UID",
+	Run:   cuGetFn,
+}
+
+var cuUpdateCmd = &cobra.Command{
+	Use:   "update CU",
+	Short: "Update the security level, properties or names of a content unit",
+	Run:   cuUpdateFn,
+}
+
+var cuMergeCmd = &cobra.Command{
+	Use:   "merge CU OTHER_CU...",
+	Short: "Merge other content units into a content unit",
+	Run:   cuMergeFn,
+}
+
+var cuFilesCmd = &cobra.Command{
+	Use:   "files CU",
+	Short: "List the files of a content unit",
+	Run:   cuFilesFn,
+}
+
+var cuTagCmd = &cobra.Command{
+	Use:   "tag CU TAG_ID",
+	Short: "Add a tag to a content unit, or remove it with --remove",
+	Run:   cuTagFn,
+}
+
+func init() {
+	RootCmd.AddCommand(cuCmd)
+	addAPIFlags(cuCmd)
+	cuCmd.AddCommand(cuGetCmd, cuUpdateCmd, cuMergeCmd, cuFilesCmd, cuTagCmd)
+
+	cuUpdateCmd.Flags().IntVar(&cuSecure, "secure", -1, "security level")
+	cuUpdateCmd.Flags().StringArrayVar(&cuProperties, "property", nil,
+		"set a property, KEY=VALUE. VALUE is JSON or a string")
+	cuUpdateCmd.Flags().StringArrayVar(&cuNames, "name", nil, "set the name in a language, LANG=NAME")
+	cuTagCmd.Flags().BoolVar(&cuRemoveTag, "remove", false, "remove the tag instead")
+}
+
+func cuGetFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	cu, err := c.ContentUnit(context.Background(), resolveContentUnitID(c, args[0]))
+	mustCall(err)
+	printContentUnits([]*api.ContentUnit{cu})
+}
+
+func cuUpdateFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+	ctx := context.Background()
+	id := resolveContentUnitID(c, args[0])
+
+	var cu *api.ContentUnit
+	var err error
+
+	if cuSecure >= 0 || len(cuProperties) > 0 {
+		r := &api.PartialContentUnit{}
+		if cuSecure >= 0 {
+			r.Secure = null.Int16From(int16(cuSecure))
+		}
+		if len(cuProperties) > 0 {
+			props := make(map[string]interface{}, len(cuProperties))
+			for _, kv := range cuProperties {
+				k, v := splitKeyValue(kv)
+				var x interface{}
+				if json.Unmarshal([]byte(v), &x) != nil {
+					x = v
+				}
+				props[k] = x
+			}
+			b, err := json.Marshal(props)
+			mustCall(err)
+			r.Properties = null.JSONFrom(b)
+		}
+		cu, err = c.UpdateContentUnit(ctx, id, r)
+		mustCall(err)
+	}
+
+	if len(cuNames) > 0 {
+		if cu == nil {
+			cu, err = c.ContentUnit(ctx, id)
+			mustCall(err)
+		}
+
+		// translations are replaced as a whole
+		byLang := make(map[string]*models.ContentUnitI18n, len(cu.I18n))
+		for k, v := range cu.I18n {
+			byLang[k] = v
+		}
+		for _, kv := range cuNames {
+			lang, name := splitKeyValue(kv)
+			if i18n, ok := byLang[lang]; ok {
+				i18n.Name = null.StringFrom(name)
+			} else {
+				byLang[lang] = &models.ContentUnitI18n{Language: lang, Name: null.StringFrom(name)}
+			}
+		}
+		i18ns := make([]*models.ContentUnitI18n, 0, len(byLang))
+		for _, v := range byLang {
+			i18ns = append(i18ns, v)
+		}
+
+		cu, err = c.UpdateContentUnitI18n(ctx, id, i18ns)
+		mustCall(err)
+	}
+
+	if cu == nil {
+		exitWithError(fmt.Errorf("Nothing to update, see mdb cu update -h"))
+	}
+	printContentUnits([]*api.ContentUnit{cu})
+}
+
+func cuMergeFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 2)
+	c := mustAPIClient()
+
+	id := resolveContentUnitID(c, args[0])
+	others := make([]int64, len(args)-1)
+	for i := range others {
+		others[i] = resolveContentUnitID(c, args[i+1])
+	}
+
+	cu, err := c.MergeContentUnits(context.Background(), id, others)
+	mustCall(err)
+	printContentUnits([]*api.ContentUnit{cu})
+}
+
+func cuFilesFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	files, err := c.ContentUnitFiles(context.Background(), resolveContentUnitID(c, args[0]))
+	mustCall(err)
+	printFiles(files)
+}
+
+func cuTagFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 2)
+	c := mustAPIClient()
+	ctx := context.Background()
+
+	id := resolveContentUnitID(c, args[0])
+	tagID, err := strconv.ParseInt(args[1], 10, 64)
+	mustCall(err)
+
+	if cuRemoveTag {
+		_, err = c.RemoveContentUnitTag(ctx, id, tagID)
+	} else {
+		_, err = c.AddContentUnitTag(ctx, id, tagID)
+	}
+	mustCall(err)
+
+	tags, err := c.ContentUnitTags(ctx, id)
+	mustCall(err)
+	printOutput(tags, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tUID\tPATTERN\tLABEL")
+		for _, t := range tags {
+			label := ""
+			for _, lang := range []string{api.LANG_ENGLISH, api.LANG_HEBREW} {
+				if i18n, ok := t.I18n[lang]; ok && i18n.Label.Valid {
+					label = i18n.Label.String
+					break
+				}
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.UID, t.Pattern.String, label)
+		}
+	})
+}
+
+func printContentUnits(units []*api.ContentUnit) {
+	printOutput(units, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tUID\tTYPE ID\tNAME\tSECURE\tPUBLISHED\tCREATED\tREMOVED")
+		for _, cu := range units {
+			name := ""
+			for _, lang := range []string{api.LANG_ENGLISH, api.LANG_HEBREW} {
+				if i18n, ok := cu.I18n[lang]; ok && i18n.Name.Valid {
+					name = i18n.Name.String
+					break
+				}
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%t\t%s\t%s\n", cu.ID, cu.UID, cu.TypeID, name,
+				cu.Secure, cu.Published, formatTime(cu.CreatedAt), formatTime(cu.RemovedAt.Time))
+		}
+	})
+}
+
+func splitKeyValue(kv string) (string, string) {
+	s := strings.SplitN(kv, "=", 2)
+	if len(s) != 2 || s[0] == "" {
+		exitWithError(fmt.Errorf("Expected KEY=VALUE, got %s", kv))
+	}
+	return s[0], s[1]
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/api"
+)
+
+var fileCmd = &cobra.Command{
+	Use:   "file",
+	Short: "Manage files through the API",
+}
+
+var fileGetCmd = &cobra.Command{
+	Use:   "get FILE",
+	Short: "Show a file, by ID, UID or SHA1",
+	Run:   fileGetFn,
+}
+
+var fileMoveCmd = &cobra.Command{
+	Use:   "move FILE CU",
+	Short: "Move a file to another content unit",
+	Run:   fileMoveFn,
+}
+
+var filePublishCmd = &cobra.Command{
+	Use:   "publish FILE",
+	Short: "Publish a file, and its content unit and collections if needed",
+	Run: func(cmd *cobra.Command, args []string) {
+		fileSetPublished(cmd, args, true)
+	},
+}
+
+var fileUnpublishCmd = &cobra.Command{
+	Use:   "unpublish FILE",
+	Short: "Unpublish a file, and its content unit and collections if no other file is published",
+	Run: func(cmd *cobra.Command, args []string) {
+		fileSetPublished(cmd, args, false)
+	},
+}
+
+var fileRemoveCmd = &cobra.Command{
+	Use:   "remove FILE",
+	Short: "Mark a file as removed",
+	Run:   fileRemoveFn,
+}
+
+func init() {
+	RootCmd.AddCommand(fileCmd)
+	addAPIFlags(fileCmd)
+	fileCmd.AddCommand(fileGetCmd, fileMoveCmd, filePublishCmd, fileUnpublishCmd, fileRemoveCmd)
+}
+
+func fileGetFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	f, err := c.File(context.Background(), resolveFileID(c, args[0]))
+	mustCall(err)
+	printFiles([]*api.MFile{f})
+}
+
+func fileMoveFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 2)
+	c := mustAPIClient()
+	ctx := context.Background()
+
+	id := resolveFileID(c, args[0])
+	cuID := resolveContentUnitID(c, args[1])
+	_, err := c.AddContentUnitFiles(ctx, cuID, []int64{id})
+	mustCall(err)
+
+	f, err := c.File(ctx, id)
+	mustCall(err)
+	printFiles([]*api.MFile{f})
+}
+
+func fileSetPublished(cmd *cobra.Command, args []string, published bool) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	id := resolveFileID(c, args[0])
+	var f *api.MFile
+	var err error
+	if published {
+		f, err = c.PublishFile(context.Background(), id)
+	} else {
+		f, err = c.UnpublishFile(context.Background(), id)
+	}
+	mustCall(err)
+	printFiles([]*api.MFile{f})
+}
+
+func fileRemoveFn(cmd *cobra.Command, args []string) {
+	requireArgs(cmd, args, 1)
+	c := mustAPIClient()
+
+	id := resolveFileID(c, args[0])
+	mustCall(c.RemoveFile(context.Background(), id))
+	fmt.Printf("Removed file %d\n", id)
+}
+
+func printFiles(files []*api.MFile) {
+	printOutput(files, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tUID\tNAME\tSHA1\tSIZE\tTYPE\tLANGUAGE\tCU\tSECURE\tPUBLISHED\tREMOVED")
+		for _, f := range files {
+			cu := ""
+			if f.ContentUnitID.Valid {
+				cu = fmt.Sprintf("%d", f.ContentUnitID.Int64)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%d\t%t\t%s\n", f.ID, f.UID, f.Name, f.Sha1Str,
+				f.Size, f.Type, f.Language.String, cu, f.Secure, f.Published, formatTime(f.RemovedAt.Time))
+		}
+	})
+}
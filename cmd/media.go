@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/batch"
+)
+
+var mediaProbeDryRun bool
+
+var mediaCmd = &cobra.Command{
+	Use:   "media",
+	Short: "Technical metadata of media files",
+}
+
+var mediaProbeCmd = &cobra.Command{
+	Use:   "probe PATH...",
+	Short: "Run ffprobe on local files, or directories, and save the metadata of files known to MDB",
+	Run:   mediaProbeFn,
+}
+
+func init() {
+	RootCmd.AddCommand(mediaCmd)
+	mediaCmd.AddCommand(mediaProbeCmd)
+	mediaProbeCmd.Flags().BoolVar(&mediaProbeDryRun, "dry-run", false, "probe but don't save")
+}
+
+func mediaProbeFn(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Please specify paths to probe")
+		os.Exit(1)
+	}
+	batch.ProbeMedia(args, mediaProbeDryRun)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/migrations"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var migrationsDir string
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply or revert schema migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up [N]",
+	Short: "Apply pending migrations, all of them or the next N",
+	Run:   migrateUpFn,
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [N]",
+	Short: "Revert the last applied migration, or the last N",
+	Run:   migrateDownFn,
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Run:   migrateStatusFn,
+}
+
+var migrateRedoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Revert the last applied migration and apply it again",
+	Run:   migrateRedoFn,
+}
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateRedoCmd)
+	migrateCmd.PersistentFlags().StringVar(&migrationsDir, "dir", "", "migrations directory (default migrations.directory or ./migrations)")
+}
+
+func migrateUpFn(cmd *cobra.Command, args []string) {
+	r, db := mustMigrationsRunner()
+	defer db.Close()
+
+	applied, err := r.Up(context.Background(), migrateCount(args, 0))
+	printMigrations("Applied", applied)
+	utils.Must(err)
+}
+
+func migrateDownFn(cmd *cobra.Command, args []string) {
+	r, db := mustMigrationsRunner()
+	defer db.Close()
+
+	reverted, err := r.Down(context.Background(), migrateCount(args, 1))
+	printMigrations("Reverted", reverted)
+	utils.Must(err)
+}
+
+func migrateStatusFn(cmd *cobra.Command, args []string) {
+	r, db := mustMigrationsRunner()
+	defer db.Close()
+
+	status, err := r.Status()
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tAPPLIED")
+	for _, s := range status {
+		fmt.Fprintf(w, "%s\t%t\n", s.Name, s.Applied)
+	}
+	w.Flush()
+}
+
+func migrateRedoFn(cmd *cobra.Command, args []string) {
+	r, db := mustMigrationsRunner()
+	defer db.Close()
+	ctx := context.Background()
+
+	reverted, err := r.Down(ctx, 1)
+	printMigrations("Reverted", reverted)
+	utils.Must(err)
+
+	applied, err := r.Up(ctx, 1)
+	printMigrations("Applied", applied)
+	utils.Must(err)
+}
+
+func mustMigrationsRunner() (*migrations.Runner, *sql.DB) {
+	dir := migrationsDir
+	if dir == "" {
+		dir = viper.GetString("migrations.directory")
+	}
+	if dir == "" {
+		dir = "migrations"
+	}
+
+	log.Info("Setting up connection to MDB")
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+
+	return migrations.NewRunner(db, dir), db
+}
+
+func migrateCount(args []string, defaultN int) int {
+	if len(args) == 0 {
+		return defaultN
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		fmt.Fprintf(os.Stderr, "N should be a positive number, got %s\n", args[0])
+		os.Exit(1)
+	}
+	return n
+}
+
+func printMigrations(action string, names []string) {
+	if len(names) == 0 {
+		fmt.Printf("%s no migrations\n", action)
+		return
+	}
+	for _, name := range names {
+		fmt.Printf("%s %s\n", action, name)
+	}
+}
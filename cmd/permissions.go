@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/bindata"
+	"github.com/Bnei-Baruch/mdb/permissions"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "Manage the permissions policy",
+}
+
+var permissionsImportCmd = &cobra.Command{
+	Use:   "import [FILE]",
+	Short: "Replace the permissions policy in the DB with a casbin policy CSV (default: data/permissions_policy.csv)",
+	Run:   permissionsImportFn,
+}
+
+var permissionsExportCmd = &cobra.Command{
+	Use:   "export [FILE]",
+	Short: "Write the permissions policy in the DB as a casbin policy CSV (default: stdout)",
+	Run:   permissionsExportFn,
+}
+
+func init() {
+	RootCmd.AddCommand(permissionsCmd)
+	permissionsCmd.AddCommand(permissionsImportCmd, permissionsExportCmd)
+}
+
+func permissionsImportFn(cmd *cobra.Command, args []string) {
+	var r io.Reader
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		utils.Must(err)
+		defer f.Close()
+		r = f
+	} else {
+		b, err := bindata.Asset("data/permissions_policy.csv")
+		utils.Must(err)
+		r = bytes.NewReader(b)
+	}
+
+	rules, err := permissions.ReadPolicyCSV(r)
+	utils.Must(err)
+
+	db := mustOpenMDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	utils.Must(err)
+	err = permissions.ReplacePolicyRules(tx, rules)
+	if err == nil {
+		// running servers reload the policy once committed
+		err = permissions.NotifyPolicyChanged(tx)
+	}
+	if err != nil {
+		utils.Must(tx.Rollback())
+		utils.Must(err)
+	}
+	utils.Must(tx.Commit())
+
+	fmt.Printf("Imported %d rules\n", len(rules))
+}
+
+func permissionsExportFn(cmd *cobra.Command, args []string) {
+	db := mustOpenMDB()
+	defer db.Close()
+
+	rules, err := permissions.LoadPolicyRules(db)
+	utils.Must(err)
+
+	w := io.Writer(os.Stdout)
+	if len(args) > 0 {
+		f, err := os.Create(args[0])
+		utils.Must(err)
+		defer f.Close()
+		w = f
+	}
+
+	utils.Must(permissions.WritePolicyCSV(w, rules))
+}
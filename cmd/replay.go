@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/batch"
+)
+
+var (
+	replayOptions batch.ReplayOptions
+	replaySince   string
+	replayUntil   string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay recorded operation requests against the API",
+	Long: `Replay operation requests recorded by the server (recorder.enable) in the order they were received.
+Each replay is compared with the recorded response and the operation it creates is marked with replay_of.
+Times are RFC3339, a date (2006-01-02) or a duration ago (24h).`,
+	Run: replayFn,
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayOptions.Operation, "op", "", "operation, e.g. insert")
+	replayCmd.Flags().IntVar(&replayOptions.Status, "status", 0, "recorded response status, e.g. 500")
+	replayCmd.Flags().StringVar(&replaySince, "since", "", "requests recorded since")
+	replayCmd.Flags().StringVar(&replayUntil, "until", "", "requests recorded before")
+	replayCmd.Flags().BoolVar(&replayOptions.DryRun, "dry-run", false, "list the requests without replaying")
+	addAPIFlags(replayCmd)
+	RootCmd.AddCommand(replayCmd)
+}
+
+func replayFn(cmd *cobra.Command, args []string) {
+	var err error
+	replayOptions.Since, err = parseReplayTime(replaySince)
+	mustCall(err)
+	replayOptions.Until, err = parseReplayTime(replayUntil)
+	mustCall(err)
+
+	batch.Replay(mustAPIClient(), replayOptions)
+}
+
+func parseReplayTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("Bad time %q, expecting RFC3339, 2006-01-02 or a duration", s)
+}
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/utils"
 )
 
 var cfgFile string
@@ -41,3 +44,11 @@ func initConfig() {
 		fmt.Println("Could not read config, using: ", viper.ConfigFileUsed(), err.Error())
 	}
 }
+
+// mustOpenMDB connects to MDB for commands that need it
+func mustOpenMDB() *sql.DB {
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	return db
+}
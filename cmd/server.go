@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/coreos/go-oidc"
 	"github.com/nats-io/go-nats-streaming"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stvp/rollbar"
@@ -21,6 +23,8 @@ import (
 
 	"github.com/Bnei-Baruch/mdb/api"
 	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/metrics"
+	"github.com/Bnei-Baruch/mdb/migrations"
 	"github.com/Bnei-Baruch/mdb/permissions"
 	"github.com/Bnei-Baruch/mdb/utils"
 	"github.com/Bnei-Baruch/mdb/version"
@@ -47,9 +51,39 @@ func serverFn(cmd *cobra.Command, args []string) {
 	//boil.SetDB(db)
 	boil.DebugMode = viper.GetString("server.mode") == "debug"
 
+	if viper.GetBool("migrations.refuse-pending") {
+		log.Info("Checking schema migrations")
+		utils.Must(migrations.CheckVersion(db))
+	}
+
 	log.Info("Initializing type registries")
 	utils.Must(api.InitTypeRegistries(db))
 
+	if ttl := viper.GetDuration("operations.idempotency-ttl"); ttl > 0 {
+		api.IdempotencyKeyTTL = ttl
+	}
+	if x := viper.GetInt64("health.outbox-backlog-threshold"); x > 0 {
+		api.OutboxBacklogThreshold = x
+	}
+	if x := viper.GetDuration("health.timeout"); x > 0 {
+		api.HealthCheckTimeout = x
+	}
+	for k, v := range viper.GetStringMapString("downloads.url-templates") {
+		api.StorageURLTemplates[strings.ToLower(k)] = v
+	}
+	api.DownloadLinkSecret = []byte(viper.GetString("downloads.link-secret"))
+	if x := viper.GetDuration("downloads.link-ttl"); x > 0 {
+		api.DownloadLinkTTL = x
+	}
+	api.CountryHeader = viper.GetString("downloads.country-header")
+	if x := viper.GetDuration("jobs.lease"); x > 0 {
+		api.JobLeaseDuration = x
+	}
+	if x := viper.GetDuration("jobs.retry-backoff"); x > 0 {
+		api.JobRetryBackoff = x
+	}
+	api.RecordOperationRequests = viper.GetBool("recorder.enable")
+
 	// Setup events handlers
 	eventHandlers := make([]events.EventHandler, 0)
 	hNames := viper.GetStringSlice("events.handlers")
@@ -67,19 +101,52 @@ func serverFn(cmd *cobra.Command, args []string) {
 					stan.NatsURL(viper.GetString("nats.url")),
 					stan.PubAckWait(viper.GetDuration("nats.pub-ack-wait")),
 				)
+				// The relay marks events delivered only once every handler accepted them.
+				// Without nats they wait in the outbox while the handler reconnects.
+				eventHandlers = append(eventHandlers, h)
 				if err != nil {
 					log.Errorf("Error connecting to nats streaming server: %s", err)
-				} else {
-					eventHandlers = append(eventHandlers, h)
+				}
+				api.READINESS_CHECKS["nats"] = func(ctx context.Context) (interface{}, error) {
+					return h.Status(api.HealthCheckTimeout)
 				}
 			default:
-				log.Warnf("Unknown event handler: %s", hNames[i])
+				log.Fatalf("Unknown event handler: %s", hNames[i])
 			}
 		}
 	}
 
-	emitter, err := events.NewBufferedEmitter(viper.GetInt("events.emitter-size"), eventHandlers...)
+	// Events are written to the outbox in the same transaction as the data change.
+	// The relay delivers them to handlers once committed.
+	emitter := events.NewOutboxEmitter()
+	relay, err := events.NewOutboxRelay(db, viper.GetString("mdb.url"), eventHandlers...)
 	utils.Must(err)
+	if x := viper.GetInt("events.relay-batch-size"); x > 0 {
+		relay.BatchSize = x
+	}
+	if x := viper.GetDuration("events.relay-poll-interval"); x > 0 {
+		relay.PollInterval = x
+	}
+	if x := viper.GetDuration("events.relay-min-backoff"); x > 0 {
+		relay.MinBackoff = x
+	}
+	if x := viper.GetDuration("events.relay-max-backoff"); x > 0 {
+		relay.MaxBackoff = x
+	}
+	relay.Retention = viper.GetDuration("events.retention")
+	relay.Start()
+
+	// Consumers of the events API waiting for new events share a single listener
+	deliveries, err := events.NewDeliveryListener(viper.GetString("mdb.url"))
+	utils.Must(err)
+	deliveries.Start()
+	api.EventsDeliveries = deliveries
+
+	// Metrics collected on scrape
+	prometheus.MustRegister(
+		metrics.NewDBStatsCollector(db, "mdb"),
+		events.NewOutboxCollector(db),
+	)
 
 	// Setup Rollbar
 	rollbar.Token = viper.GetString("server.rollbar-token")
@@ -100,19 +167,31 @@ func serverFn(cmd *cobra.Command, args []string) {
 		oidcIDTokenVerifier = oidcProvider.Verifier(&oidc.Config{
 			SkipClientIDCheck: true,
 		})
+		api.READINESS_CHECKS["oidc"] = func(ctx context.Context) (interface{}, error) {
+			n, err := permissions.CheckOIDCKeys(ctx, oidcProvider)
+			return gin.H{"keys": n}, err
+		}
 	}
 
 	// casbin
-	enforcer, err := permissions.NewEnforcer()
+	// The policy is kept in the DB and reloaded whenever it's changed, on any instance.
+	enforcer, err := permissions.NewEnforcer(permissions.NewPostgresPolicyAdapter(db))
 	utils.Must(err)
 	enforcer.EnableEnforce(viper.GetBool("permissions.enable"))
 	enforcer.EnableLog(viper.GetBool("permissions.log"))
+	policyListener, err := permissions.NewPolicyListener(viper.GetString("mdb.url"), enforcer)
+	utils.Must(err)
+	if x := viper.GetDuration("permissions.reload-interval"); x > 0 {
+		policyListener.ReloadInterval = x
+	}
+	policyListener.Start()
 
 	// Setup gin
 	gin.SetMode(viper.GetString("server.mode"))
 	router := gin.New()
 	router.Use(
 		utils.MdbLoggerMiddleware(),
+		metrics.Middleware(router),
 		utils.EnvMiddleware(db, emitter, enforcer, oidcIDTokenVerifier),
 		utils.ErrorHandlingMiddleware(),
 		permissions.AuthenticationMiddleware(),
@@ -148,6 +227,19 @@ func serverFn(cmd *cobra.Command, args []string) {
 	}
 	log.Infof("Server exiting")
 
+	log.Infof("Stopping events outbox relay")
+	if err := relay.Close(); err != nil {
+		log.Errorf("Stop events outbox relay: %s", err.Error())
+	}
+
+	if err := deliveries.Close(); err != nil {
+		log.Errorf("Stop events delivery listener: %s", err.Error())
+	}
+
+	if err := policyListener.Close(); err != nil {
+		log.Errorf("Stop permissions policy listener: %s", err.Error())
+	}
+
 	log.Infof("Closing event handlers")
 	for i := range eventHandlers {
 		if h, ok := eventHandlers[i].(io.Closer); ok {
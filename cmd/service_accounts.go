@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/permissions"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var (
+	saRoles   []string
+	saOIDCSub string
+	saNoKey   bool
+	saGrace   time.Duration
+)
+
+var serviceAccountsCmd = &cobra.Command{
+	Use:   "service_accounts",
+	Short: "Manage service accounts and their API keys",
+}
+
+var serviceAccountsCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a service account and print its API key",
+	Run:   serviceAccountsCreateFn,
+}
+
+var serviceAccountsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List service accounts",
+	Run:   serviceAccountsListFn,
+}
+
+var serviceAccountsRotateCmd = &cobra.Command{
+	Use:   "rotate NAME",
+	Short: "Create a new API key for a service account and expire the old ones",
+	Run:   serviceAccountsRotateFn,
+}
+
+var serviceAccountsRolesCmd = &cobra.Command{
+	Use:   "roles NAME",
+	Short: "Set the roles of a service account",
+	Run:   serviceAccountsRolesFn,
+}
+
+var serviceAccountsDisableCmd = &cobra.Command{
+	Use:   "disable NAME",
+	Short: "Disable a service account",
+	Run: func(cmd *cobra.Command, args []string) {
+		serviceAccountsSetDisabled(serviceAccountName(args), true)
+	},
+}
+
+var serviceAccountsEnableCmd = &cobra.Command{
+	Use:   "enable NAME",
+	Short: "Enable a disabled service account",
+	Run: func(cmd *cobra.Command, args []string) {
+		serviceAccountsSetDisabled(serviceAccountName(args), false)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serviceAccountsCmd)
+	serviceAccountsCmd.AddCommand(serviceAccountsCreateCmd, serviceAccountsListCmd, serviceAccountsRotateCmd,
+		serviceAccountsRolesCmd, serviceAccountsDisableCmd, serviceAccountsEnableCmd)
+
+	serviceAccountsCreateCmd.Flags().StringSliceVar(&saRoles, "roles", nil, "casbin roles, e.g. workflow_station")
+	serviceAccountsCreateCmd.Flags().StringVar(&saOIDCSub, "oidc-sub", "",
+		"subject of the OIDC client credentials tokens of this account")
+	serviceAccountsCreateCmd.Flags().BoolVar(&saNoKey, "no-key", false,
+		"don't create an API key, i.e. the account uses OIDC tokens only")
+	serviceAccountsRolesCmd.Flags().StringSliceVar(&saRoles, "roles", nil, "casbin roles, e.g. workflow_station")
+	serviceAccountsRotateCmd.Flags().DurationVar(&saGrace, "grace", 0,
+		"keep existing keys valid for this long so clients can switch over")
+}
+
+func serviceAccountName(args []string) string {
+	if len(args) != 1 {
+		fmt.Println("Please specify service account name")
+		os.Exit(1)
+	}
+	return args[0]
+}
+
+func serviceAccountsCreateFn(cmd *cobra.Command, args []string) {
+	name := serviceAccountName(args)
+	db := mustOpenMDB()
+	defer db.Close()
+
+	sa, err := permissions.CreateServiceAccount(db, name, saRoles, saOIDCSub)
+	utils.Must(err)
+	fmt.Printf("Created service account %s with roles %s\n", sa.Name, strings.Join(sa.Roles, ","))
+
+	if !saNoKey {
+		key, err := permissions.RotateServiceAccountKey(db, sa.Name, 0)
+		utils.Must(err)
+		printAPIKey(key)
+	}
+}
+
+func serviceAccountsListFn(cmd *cobra.Command, args []string) {
+	db := mustOpenMDB()
+	defer db.Close()
+
+	accounts, err := permissions.AllServiceAccounts(db)
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLES\tOIDC SUB\tCREATED\tDISABLED")
+	for _, sa := range accounts {
+		disabled := ""
+		if sa.DisabledAt.Valid {
+			disabled = sa.DisabledAt.Time.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", sa.Name, strings.Join(sa.Roles, ","),
+			sa.OIDCSub.String, sa.CreatedAt.Format(time.RFC3339), disabled)
+	}
+	utils.Must(w.Flush())
+}
+
+func serviceAccountsRotateFn(cmd *cobra.Command, args []string) {
+	name := serviceAccountName(args)
+	db := mustOpenMDB()
+	defer db.Close()
+
+	key, err := permissions.RotateServiceAccountKey(db, name, saGrace)
+	utils.Must(err)
+	if saGrace > 0 {
+		fmt.Printf("Previous keys expire in %s\n", saGrace)
+	} else {
+		fmt.Println("Previous keys expired")
+	}
+	printAPIKey(key)
+}
+
+func serviceAccountsRolesFn(cmd *cobra.Command, args []string) {
+	name := serviceAccountName(args)
+	db := mustOpenMDB()
+	defer db.Close()
+
+	utils.Must(permissions.UpdateServiceAccountRoles(db, name, saRoles))
+	fmt.Printf("Roles of %s set to %s\n", name, strings.Join(saRoles, ","))
+}
+
+func serviceAccountsSetDisabled(name string, disabled bool) {
+	db := mustOpenMDB()
+	defer db.Close()
+
+	utils.Must(permissions.SetServiceAccountDisabled(db, name, disabled))
+	if disabled {
+		fmt.Printf("Disabled %s\n", name)
+	} else {
+		fmt.Printf("Enabled %s\n", name)
+	}
+}
+
+func printAPIKey(key string) {
+	fmt.Printf("API key (shown only once, send as \"Authorization: Bearer <key>\"):\n%s\n", key)
+}
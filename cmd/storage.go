@@ -2,17 +2,34 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/Bnei-Baruch/mdb/storage"
 )
 
+var storageSyncOptions storage.SyncOptions
+
 func init() {
 	command := &cobra.Command{
 		Use:   "storage",
 		Short: "Import storage locations status of files in MDB",
 		Run: func(cmd *cobra.Command, args []string) {
-			storage.ImportStorageStatus()
+			opts := storageSyncOptions
+			opts.BatchSize = viper.GetInt("storage.sync-batch-size")
+			if opts.BatchSize <= 0 {
+				opts.BatchSize = 5000
+			}
+			opts.Threshold = 0.05
+			if viper.IsSet("storage.clear-missing-threshold") {
+				opts.Threshold = viper.GetFloat64("storage.clear-missing-threshold")
+			}
+			opts.Overlap = viper.GetDuration("storage.sync-overlap")
+			storage.ImportStorageStatus(opts)
 		},
 	}
+	command.Flags().BoolVar(&storageSyncOptions.Incremental, "incremental", false,
+		"only files changed since the last successful sync")
+	command.Flags().BoolVar(&storageSyncOptions.Force, "force", false,
+		"clear status for missing files even beyond storage.clear-missing-threshold")
 	RootCmd.AddCommand(command)
 }
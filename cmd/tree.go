@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/api"
+)
+
+var (
+	treeLanguage string
+	treeDepth    int
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Browse tags through the API",
+}
+
+var tagTreeCmd = &cobra.Command{
+	Use:   "tree [ROOT_UID]",
+	Short: "Print the tags tree, or the subtree of a tag",
+	Run:   tagTreeFn,
+}
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Browse sources through the API",
+}
+
+var sourceTreeCmd = &cobra.Command{
+	Use:   "tree [ROOT_UID]",
+	Short: "Print the sources tree under their authors, or the subtree of a source",
+	Run:   sourceTreeFn,
+}
+
+func init() {
+	RootCmd.AddCommand(tagCmd, sourceCmd)
+	addAPIFlags(tagCmd)
+	addAPIFlags(sourceCmd)
+	tagCmd.AddCommand(tagTreeCmd)
+	sourceCmd.AddCommand(sourceTreeCmd)
+
+	for _, cmd := range []*cobra.Command{tagTreeCmd, sourceTreeCmd} {
+		cmd.Flags().StringVar(&treeLanguage, "language", api.LANG_HEBREW, "language of names")
+		cmd.Flags().IntVar(&treeDepth, "depth", 0, "levels to print, 0 is all")
+	}
+}
+
+func tagTreeFn(cmd *cobra.Command, args []string) {
+	c := mustAPIClient()
+
+	r := api.TagsHierarchyRequest{}
+	r.Language = treeLanguage
+	r.Depth = treeDepth
+	if len(args) > 0 {
+		r.RootUID = args[0]
+	}
+
+	tags, err := c.TagsHierarchy(context.Background(), r)
+	mustCall(err)
+
+	printOutput(tags, func(w *tabwriter.Writer) {
+		var walk func(tags []*api.TagH, depth int)
+		walk = func(tags []*api.TagH, depth int) {
+			for _, t := range tags {
+				fmt.Fprintf(w, "%s%s\t%d\t%s\t%s\n", strings.Repeat("  ", depth), t.Label.String, t.ID, t.UID, t.Pattern.String)
+				walk(t.Children, depth+1)
+			}
+		}
+		fmt.Fprintln(w, "LABEL\tID\tUID\tPATTERN")
+		walk(tags, 0)
+	})
+}
+
+func sourceTreeFn(cmd *cobra.Command, args []string) {
+	c := mustAPIClient()
+	ctx := context.Background()
+
+	r := api.SourcesHierarchyRequest{}
+	r.Language = treeLanguage
+	r.Depth = treeDepth
+
+	var walk func(w *tabwriter.Writer, sources []*api.SourceH, depth int)
+	walk = func(w *tabwriter.Writer, sources []*api.SourceH, depth int) {
+		for _, s := range sources {
+			fmt.Fprintf(w, "%s%s\t%d\t%s\t%s\n", strings.Repeat("  ", depth), s.Name.String, s.ID, s.UID, s.Type)
+			walk(w, s.Children, depth+1)
+		}
+	}
+
+	if len(args) > 0 {
+		r.RootUID = args[0]
+		sources, err := c.SourcesHierarchy(ctx, r)
+		mustCall(err)
+		printOutput(sources, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "NAME\tID\tUID\tTYPE")
+			walk(w, sources, 0)
+		})
+		return
+	}
+
+	authors, err := c.AuthorsHierarchy(ctx, r)
+	mustCall(err)
+	printOutput(authors, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tID\tUID\tTYPE")
+		for _, a := range authors {
+			fmt.Fprintf(w, "%s\t\t%s\tauthor\n", a.Name, a.Code)
+			walk(w, a.Children, 1)
+		}
+	})
+}
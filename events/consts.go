@@ -1,5 +1,8 @@
 package events
 
+// Bump on breaking changes to events payload
+const PAYLOAD_SCHEMA_VERSION = 2
+
 const (
 	E_COLLECTION_CREATE               = "COLLECTION_CREATE"
 	E_COLLECTION_UPDATE               = "COLLECTION_UPDATE"
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Values larger than this (JSON encoded) are reported as changed without the value itself
+const MAX_DIFF_VALUE_SIZE = 512
+
+type Change struct {
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	Omitted bool        `json:"omitted,omitempty"`
+}
+
+// WithDiff attaches a field-level diff between two versions of the event's entity.
+// See Diff.
+func (e Event) WithDiff(before, after interface{}) Event {
+	if diff := Diff(before, after); len(diff) > 0 {
+		e.Payload["diff"] = diff
+	}
+	return e
+}
+
+// Diff compares the JSON representation of two versions of an entity.
+// Keys of the properties bag are compared individually, as "properties.<key>".
+// Unchanged fields are not included.
+func Diff(before, after interface{}) map[string]Change {
+	bFields := toFields(before)
+	aFields := toFields(after)
+
+	if props, ok := bFields["properties"]; ok {
+		delete(bFields, "properties")
+		for k, v := range toFields(props) {
+			bFields["properties."+k] = v
+		}
+	}
+	if props, ok := aFields["properties"]; ok {
+		delete(aFields, "properties")
+		for k, v := range toFields(props) {
+			aFields["properties."+k] = v
+		}
+	}
+
+	keys := make([]string, 0)
+	for k := range bFields {
+		keys = append(keys, k)
+	}
+	for k := range aFields {
+		if _, ok := bFields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := make(map[string]Change)
+	for _, k := range keys {
+		b, a := normalize(bFields[k]), normalize(aFields[k])
+		if bytes.Equal(b, a) {
+			continue
+		}
+
+		if len(b) > MAX_DIFF_VALUE_SIZE || len(a) > MAX_DIFF_VALUE_SIZE {
+			diff[k] = Change{Omitted: true}
+		} else {
+			diff[k] = Change{Old: decode(b), New: decode(a)}
+		}
+	}
+
+	return diff
+}
+
+func toFields(x interface{}) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+
+	var b []byte
+	if raw, ok := x.(json.RawMessage); ok {
+		b = raw
+	} else if x != nil {
+		var err error
+		if b, err = json.Marshal(x); err != nil {
+			return fields
+		}
+	}
+
+	if len(b) > 0 {
+		json.Unmarshal(b, &fields)
+	}
+
+	return fields
+}
+
+// normalize reformats a JSON value so that equal values are equal bytes
+func normalize(raw json.RawMessage) []byte {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return b
+}
+
+func decode(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	var v interface{}
+	json.Unmarshal(b, &v)
+	return v
+}
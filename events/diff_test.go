@@ -0,0 +1,72 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func TestDiff(t *testing.T) {
+	before := &models.ContentUnit{
+		ID:         1,
+		UID:        "12345678",
+		TypeID:     2,
+		Secure:     0,
+		Published:  false,
+		Properties: null.JSONFrom([]byte(`{"film_date": "2018-01-01", "duration": 100, "big": "x"}`)),
+	}
+	after := *before
+	after.Secure = 1
+	after.Properties = null.JSONFrom([]byte(`{"duration":100, "film_date": "2018-01-02", "big": "` +
+		strings.Repeat("x", MAX_DIFF_VALUE_SIZE) + `", "new_key": true}`))
+
+	diff := Diff(before, &after)
+	if len(diff) != 4 {
+		t.Fatalf("Expected 4 changes, got %d: %v", len(diff), diff)
+	}
+
+	if c := diff["secure"]; c.Old != float64(0) || c.New != float64(1) {
+		t.Errorf("Unexpected secure change %v", c)
+	}
+	if c := diff["properties.film_date"]; c.Old != "2018-01-01" || c.New != "2018-01-02" {
+		t.Errorf("Unexpected properties.film_date change %v", c)
+	}
+	if c := diff["properties.new_key"]; c.Old != nil || c.New != true {
+		t.Errorf("Unexpected properties.new_key change %v", c)
+	}
+	if c := diff["properties.big"]; !c.Omitted || c.New != nil {
+		t.Errorf("Expected properties.big to be omitted %v", c)
+	}
+	if _, ok := diff["properties.duration"]; ok {
+		t.Error("Unchanged properties key properties.duration in diff")
+	}
+
+	if diff := Diff(before, before); len(diff) != 0 {
+		t.Errorf("Expected no changes, got %v", diff)
+	}
+}
+
+func TestWithDiff(t *testing.T) {
+	cu := &models.ContentUnit{ID: 1, UID: "12345678", TypeID: 2}
+	e := ContentUnitUpdateEvent(cu).WithDiff(cu, cu)
+	if _, ok := e.Payload["diff"]; ok {
+		t.Error("Expected no diff for unchanged entity")
+	}
+	if e.Payload["schema_version"] != PAYLOAD_SCHEMA_VERSION {
+		t.Errorf("Unexpected schema_version %v", e.Payload["schema_version"])
+	}
+
+	changed := *cu
+	changed.Published = true
+	e = ContentUnitUpdateEvent(&changed).WithDiff(cu, &changed)
+	diff, ok := e.Payload["diff"].(map[string]Change)
+	if !ok || len(diff) != 1 {
+		t.Fatalf("Expected a single change, got %v", e.Payload["diff"])
+	}
+	if e.Payload["published"] != true {
+		t.Error("Expected published in payload")
+	}
+}
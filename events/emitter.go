@@ -1,68 +1,91 @@
 package events
 
 import (
+	"encoding/json"
 	"io"
 	"math/rand"
+	"sync"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
 )
 
+const OUTBOX_CHANNEL = "events_outbox"
+
 type EventEmitter interface {
-	Emit(...Event)
+	Emit(boil.Executor, ...Event) error
 }
 
 type NoopEmitter struct{}
 
-func (e *NoopEmitter) Emit(event ...Event) {}
+func (e *NoopEmitter) Emit(exec boil.Executor, event ...Event) error {
+	return nil
+}
 
-type BufferedEmitter struct {
-	running  bool
-	queue    chan Event
-	entropy  io.Reader
-	handlers []EventHandler
+// OutboxEmitter writes events to the events_outbox table using the caller's transaction.
+// Events are delivered to handlers by an OutboxRelay once the transaction commits.
+type OutboxEmitter struct {
+	mu      sync.Mutex
+	entropy io.Reader
 }
 
-func NewBufferedEmitter(size int, handlers ...EventHandler) (*BufferedEmitter, error) {
-	if len(handlers) == 0 {
-		return nil, errors.New("At least one handler is required")
+func NewOutboxEmitter() *OutboxEmitter {
+	return &OutboxEmitter{
+		entropy: rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
 	}
-
-	emitter := new(BufferedEmitter)
-	emitter.init(size)
-	emitter.handlers = handlers
-
-	return emitter, nil
 }
 
-func (e *BufferedEmitter) Emit(events ...Event) {
-	if e.running && len(events) > 0 {
-		for i := range events {
-			e.queue <- events[i]
-		}
+func (e *OutboxEmitter) Emit(exec boil.Executor, events ...Event) error {
+	if len(events) == 0 {
+		return nil
 	}
-}
 
-func (e *BufferedEmitter) Shutdown() {
-	close(e.queue)
-}
+	// Seqs are drawn at insert time, not at commit. An xid assigned before the seqs and a horizon
+	// taken after them let the relay tell when no lower seq can still commit, see OutboxRelay.
+	_, err := queries.Raw(exec, "SELECT txid_current()").Exec()
+	if err != nil {
+		return errors.Wrap(err, "Assign transaction id")
+	}
 
-func (e *BufferedEmitter) init(size int) {
-	e.queue = make(chan Event, size)
-	e.entropy = rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
-	go e.run()
-}
+	seqs := make([]int64, len(events))
+	for i := range events {
+		events[i].ID = e.nextID()
 
-func (e *BufferedEmitter) run() {
-	e.running = true
+		payload, err := json.Marshal(events[i].Payload)
+		if err != nil {
+			return errors.Wrapf(err, "json.Marshal payload [%s]", events[i].ID)
+		}
 
-	for event := range e.queue {
-		event.ID = ulid.MustNew(ulid.Now(), e.entropy).String()
-		for i := range e.handlers {
-			e.handlers[i].Handle(event)
+		err = queries.Raw(exec,
+			"INSERT INTO events_outbox (id, type, payload) VALUES ($1, $2, $3) RETURNING seq",
+			events[i].ID, events[i].Type, payload).QueryRow().Scan(&seqs[i])
+		if err != nil {
+			return errors.Wrapf(err, "Insert event [%s]", events[i].ID)
 		}
 	}
 
-	e.running = false
+	_, err = queries.Raw(exec,
+		"UPDATE events_outbox SET horizon = txid_snapshot_xmax(txid_current_snapshot()) WHERE seq = ANY($1)",
+		pq.Array(seqs)).Exec()
+	if err != nil {
+		return errors.Wrap(err, "Set events horizon")
+	}
+
+	// notifications are delivered only when the transaction commits
+	_, err = queries.Raw(exec, "SELECT pg_notify($1, '')", OUTBOX_CHANNEL).Exec()
+	if err != nil {
+		return errors.Wrap(err, "Notify outbox relay")
+	}
+
+	return nil
+}
+
+func (e *OutboxEmitter) nextID() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return ulid.MustNew(ulid.Now(), e.entropy).String()
 }
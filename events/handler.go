@@ -2,127 +2,120 @@ package events
 
 import (
 	"encoding/json"
-	"os"
+	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/nats-io/go-nats-streaming"
 	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/metrics"
 )
 
+// EventHandler delivers a single event.
+// An error means the event should be delivered again later.
 type EventHandler interface {
-	Handle(Event)
+	Handle(Event) error
 }
 
 type LoggerEventHandler struct{}
 
-func (eh *LoggerEventHandler) Handle(event Event) {
+func (eh *LoggerEventHandler) Handle(event Event) error {
 	log.WithFields(log.Fields{
 		"id":      event.ID,
 		"type":    event.Type,
 		"rloc":    event.ReplicationLocation,
 		"payload": event.Payload,
 	}).Info("event")
+	return nil
 }
 
-const queueSize = 4096
-const nats_tmp_file = "__DO_NOT_REMOVE_nats-event-handler.tmp"
-
+// NatsStreamingEventHandler publishes events to a nats streaming server.
+//
+// The connection is (re)established on demand. While the server is unreachable
+// publishing fails, so the outbox relay keeps the events until it comes back.
 type NatsStreamingEventHandler struct {
-	sc      stan.Conn
-	subject string
-	ch      chan *Event
-	stopCH  chan bool
-	peek    *Event
+	subject   string
+	clusterID string
+	clientID  string
+	options   []stan.Option
+
+	mu          sync.Mutex
+	sc          stan.Conn     // nil while disconnected
+	lastAck     time.Duration // ack latency of last successful publish
+	lastFailure error         // error of last publish, if it failed
 }
 
+// NatsStatus is the state of a nats streaming connection
+type NatsStatus struct {
+	URL         string  `json:"url"`
+	RTT         float64 `json:"rtt_ms"`
+	LastAck     float64 `json:"last_ack_ms,omitempty"`
+	LastFailure string  `json:"last_failure,omitempty"`
+}
+
+// NewNatsStreamingEventHandler connects to nats streaming.
+// If the server is unreachable the handler is still usable, it reconnects on the next publish or status check.
+// The returned error is that of the initial connection attempt.
 func NewNatsStreamingEventHandler(subject, clusterID, clientID string,
 	options ...stan.Option) (*NatsStreamingEventHandler, error) {
-	eh := new(NatsStreamingEventHandler)
+	eh := &NatsStreamingEventHandler{
+		subject:   subject,
+		clusterID: clusterID,
+		clientID:  clientID,
+		options:   options,
+	}
 
-	// connect to nats
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+	_, err := eh.conn()
+
+	return eh, err
+}
+
+// conn returns the current connection, connecting if there is none. Call with mu held.
+func (eh *NatsStreamingEventHandler) conn() (stan.Conn, error) {
+	if eh.sc != nil {
+		return eh.sc, nil
+	}
 
 	// Unfortunately, there is an open issue regarding connection failures on startup.
 	// see https://github.com/nats-io/go-nats/issues/195
 	// we should upgrade as soon as it's fixed !
-	var err error
-	eh.sc, err = stan.Connect(clusterID, clientID, options...)
+	log.Infof("nats: connect to cluster %s as %s", eh.clusterID, eh.clientID)
+	sc, err := stan.Connect(eh.clusterID, eh.clientID, eh.options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "connect")
 	}
 
-	eh.subject = subject
-	eh.stopCH = make(chan bool)
-	eh.ch = make(chan *Event, queueSize)
-
-	// start runner
-	go eh.run()
-
-	// try to load unprocessed events from temp file (last shutdown)
-	if err := eh.loadFromFile(); err != nil {
-		return nil, errors.Wrap(err, "load from file")
-	}
-
-	return eh, nil
+	eh.sc = sc
+	return sc, nil
 }
 
-func (eh *NatsStreamingEventHandler) Close() error {
-	// whatever happens, close connection to nats (second time is noop)
-	defer eh.sc.Close()
-
-	// stop runner
-	log.Infof("nats: stop runner")
-	eh.stopCH <- true
-
-	// close events channel
-	log.Infof("nats: close events channel")
-	close(eh.ch)
-
-	if err := eh.drainToFile(); err != nil {
-		return errors.Wrap(err, "drain to file")
+// disconnect drops a broken connection so the next publish or status check reconnects. Call with mu held.
+func (eh *NatsStreamingEventHandler) disconnect() {
+	if eh.sc == nil {
+		return
 	}
-
-	// close connection to nats
-	log.Infof("nats: close connection")
-	return eh.sc.Close()
-}
-
-func (eh *NatsStreamingEventHandler) Handle(event Event) {
-	if len(eh.ch) < cap(eh.ch) {
-		eh.ch <- &event
-	} else {
-		log.Warnf("nats: buffer limit reached, dropping event %s", event.ID)
+	if err := eh.sc.Close(); err != nil {
+		log.Warnf("nats: close broken connection: %s", err.Error())
 	}
+	eh.sc = nil
 }
 
-func (eh *NatsStreamingEventHandler) run() {
-	for {
-		// async read stop channel
-		select {
-		case <-eh.stopCH:
-			return
-		default:
-		}
-
-		// publish first event in queue if we have something
-		if eh.peek != nil {
-			if err := eh.publish(eh.peek); err == nil {
-				eh.peek = nil // success , set peek to nil
-			} else {
-				log.Errorf("nats: %s", err.Error())
-			}
-		}
-
-		// async read from queue next event to publish if we need it
-		if eh.peek == nil {
-			select {
-			case eh.peek = <-eh.ch:
-			default:
-			}
-		}
+func (eh *NatsStreamingEventHandler) Close() error {
+	log.Infof("nats: close connection")
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+	if eh.sc == nil {
+		return nil
 	}
+	err := eh.sc.Close()
+	eh.sc = nil
+	return err
 }
 
-func (eh *NatsStreamingEventHandler) publish(event *Event) error {
+func (eh *NatsStreamingEventHandler) Handle(event Event) error {
 	log.Infof("nats: publish event %s", event.ID)
 
 	b, err := json.Marshal(event)
@@ -131,70 +124,68 @@ func (eh *NatsStreamingEventHandler) publish(event *Event) error {
 		return nil // not a nats related error. report don't choke
 	}
 
-	// sync publish, timeout is set on the nats client
-	err = eh.sc.Publish(eh.subject, b)
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	sc, err := eh.conn()
+	if err == nil {
+		// sync publish, timeout is set on the nats client
+		start := time.Now()
+		err = sc.Publish(eh.subject, b)
+		if err == nil {
+			eh.lastAck = time.Since(start)
+		} else if nc := sc.NatsConn(); err == stan.ErrConnectionClosed || nc == nil || nc.IsClosed() {
+			eh.disconnect()
+		}
+	}
+	eh.lastFailure = err
+
 	if err != nil {
+		metrics.NatsPublish.WithLabelValues("failure").Inc()
 		return errors.Wrapf(err, "publish event [%s]", event.ID)
 	}
 
+	metrics.NatsPublish.WithLabelValues("success").Inc()
 	return nil
 }
 
-func (eh *NatsStreamingEventHandler) loadFromFile() error {
-	f, err := os.Open(nats_tmp_file)
-	if err != nil && !os.IsNotExist(err) {
-		return errors.Wrap(err, "os.Open")
+// Status checks the connection with a round trip to the nats server.
+// It fails if the connection is down or if the last publish failed,
+// i.e. events can't be published until the outbox relay retries succeed.
+func (eh *NatsStreamingEventHandler) Status(timeout time.Duration) (*NatsStatus, error) {
+	// reconnect if down, so the status follows the connection retries
+	eh.mu.Lock()
+	sc, err := eh.conn()
+	eh.mu.Unlock()
+	if err != nil {
+		return nil, errors.Wrap(err, "not connected")
 	}
 
-	defer func() {
-		f.Close()
-		os.Remove(nats_tmp_file)
-	}()
-
-	if f != nil {
-		var evnts []*Event
-		if err := json.NewDecoder(f).Decode(&evnts); err != nil {
-			return errors.Wrap(err, "json.Decode")
-		}
-
-		if len(evnts) > 0 {
-			log.Warnf("nats: tmp file has %d events. queuing...", len(evnts))
-			for i := range evnts {
-				eh.ch <- evnts[i]
-			}
-		}
+	nc := sc.NatsConn()
+	if nc == nil || !nc.IsConnected() {
+		return nil, errors.New("not connected")
 	}
 
-	return nil
-}
-
-func (eh *NatsStreamingEventHandler) drainToFile() error {
-	evnts := make([]*Event, 0)
-
-	// peek should be first if we have one
-	if eh.peek != nil {
-		evnts = append(evnts, eh.peek)
-	}
+	status := &NatsStatus{URL: nc.ConnectedUrl()}
 
-	// drain channel
-	// channel is expected to be closed by now
-	for e := range eh.ch {
-		evnts = append(evnts, e)
+	start := time.Now()
+	if err := nc.FlushTimeout(timeout); err != nil {
+		return status, errors.Wrap(err, "flush")
 	}
+	status.RTT = toMillis(time.Since(start))
 
-	if len(evnts) > 0 {
-		log.Infof("nats: drain %d unprocessed events to tmp file", len(evnts))
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
 
-		f, err := os.Create(nats_tmp_file)
-		if err != nil {
-			return errors.Wrap(err, "create tmp file")
-		}
-		defer f.Close()
-
-		if err := json.NewEncoder(f).Encode(evnts); err != nil {
-			return errors.Wrap(err, "json.Encode")
-		}
+	status.LastAck = toMillis(eh.lastAck)
+	if eh.lastFailure != nil {
+		status.LastFailure = eh.lastFailure.Error()
+		return status, errors.Wrap(eh.lastFailure, "last publish")
 	}
 
-	return nil
+	return status, nil
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// The relay notifies this channel whenever it delivers events
+const DELIVERED_CHANNEL = "events_delivered"
+
+// DeliveryListener wakes up consumers waiting for delivered events, on any instance.
+// A single LISTEN connection is shared by all the consumers of this instance.
+type DeliveryListener struct {
+	WakeInterval time.Duration // wake up at least this often, in case a notification is missed
+
+	listener *pq.Listener
+	mu       sync.Mutex
+	wake     chan struct{}
+	stopCH   chan bool
+	doneCH   chan bool
+}
+
+func NewDeliveryListener(url string) (*DeliveryListener, error) {
+	l := &DeliveryListener{
+		WakeInterval: 30 * time.Second,
+		wake:         make(chan struct{}),
+		stopCH:       make(chan bool),
+		doneCH:       make(chan bool),
+	}
+
+	l.listener = pq.NewListener(url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Errorf("events: delivery listener: %s", err.Error())
+		}
+	})
+	if err := l.listener.Listen(DELIVERED_CHANNEL); err != nil {
+		l.listener.Close()
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	return l, nil
+}
+
+func (l *DeliveryListener) Start() {
+	go l.run()
+}
+
+func (l *DeliveryListener) Close() error {
+	log.Infof("events: stop delivery listener")
+	l.stopCH <- true
+	<-l.doneCH
+
+	return l.listener.Close()
+}
+
+// Wait returns a channel which is closed on the next delivery of events.
+// Take it before looking for events, so a delivery in between isn't missed.
+func (l *DeliveryListener) Wait() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wake
+}
+
+func (l *DeliveryListener) run() {
+	defer close(l.doneCH)
+
+	ticker := time.NewTicker(l.WakeInterval)
+	defer ticker.Stop()
+
+	for {
+		// a nil notification means the connection was re-established
+		// and we might have missed some, so we wake up anyway.
+		select {
+		case <-l.stopCH:
+			return
+		case <-l.listener.Notify:
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		close(l.wake)
+		l.wake = make(chan struct{})
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"database/sql"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Bnei-Baruch/mdb/metrics"
+)
+
+// OutboxCollector exposes the backlog of undelivered events.
+// Alert when it keeps growing or its oldest event gets old: delivery is stuck.
+type OutboxCollector struct {
+	db      *sql.DB
+	pending *prometheus.Desc
+	oldest  *prometheus.Desc
+}
+
+func NewOutboxCollector(db *sql.DB) *OutboxCollector {
+	return &OutboxCollector{
+		db: db,
+		pending: prometheus.NewDesc(prometheus.BuildFQName(metrics.NAMESPACE, "events", "outbox_pending"),
+			"Events in the outbox waiting for delivery.", nil, nil),
+		oldest: prometheus.NewDesc(prometheus.BuildFQName(metrics.NAMESPACE, "events", "outbox_oldest_pending_seconds"),
+			"Age of the oldest event waiting for delivery.", nil, nil),
+	}
+}
+
+func (c *OutboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pending
+	ch <- c.oldest
+}
+
+func (c *OutboxCollector) Collect(ch chan<- prometheus.Metric) {
+	pending, oldest, err := OutboxBacklog(c.db)
+	if err != nil {
+		log.Errorf("outbox: collect metrics: %+v", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(pending))
+	ch <- prometheus.MustNewConstMetric(c.oldest, prometheus.GaugeValue, oldest.Seconds())
+}
@@ -1,6 +1,8 @@
 package events
 
 import (
+	"encoding/hex"
+
 	"github.com/Bnei-Baruch/mdb/models"
 )
 
@@ -12,231 +14,200 @@ type Event struct {
 }
 
 func makeEvent(Type string, Payload map[string]interface{}) Event {
+	Payload["schema_version"] = PAYLOAD_SCHEMA_VERSION
 	return Event{Type: Type, Payload: Payload}
 }
 
 func CollectionCreateEvent(c *models.Collection) Event {
-	return makeEvent(E_COLLECTION_CREATE, map[string]interface{}{
-		"id":  c.ID,
-		"uid": c.UID,
-		//"type_id": c.TypeID,
-	})
+	return makeEvent(E_COLLECTION_CREATE, collectionPayload(c))
 }
 
 func CollectionUpdateEvent(c *models.Collection) Event {
-	return makeEvent(E_COLLECTION_UPDATE, map[string]interface{}{
-		"id":  c.ID,
-		"uid": c.UID,
-	})
+	return makeEvent(E_COLLECTION_UPDATE, collectionPayload(c))
 }
 
 func CollectionDeleteEvent(c *models.Collection) Event {
-	return makeEvent(E_COLLECTION_DELETE, map[string]interface{}{
-		"id":  c.ID,
-		"uid": c.UID,
-	})
+	return makeEvent(E_COLLECTION_DELETE, collectionPayload(c))
 }
 
 func CollectionPublishedChangeEvent(c *models.Collection) Event {
-	return makeEvent(E_COLLECTION_PUBLISHED_CHANGE, map[string]interface{}{
-		"id":  c.ID,
-		"uid": c.UID,
-		//"published": c.Published,
-	})
+	return makeEvent(E_COLLECTION_PUBLISHED_CHANGE, collectionPayload(c))
 }
 
 func CollectionContentUnitsChangeEvent(c *models.Collection) Event {
-	return makeEvent(E_COLLECTION_CONTENT_UNITS_CHANGE, map[string]interface{}{
-		"id":  c.ID,
-		"uid": c.UID,
-	})
+	return makeEvent(E_COLLECTION_CONTENT_UNITS_CHANGE, collectionPayload(c))
 }
 
 func ContentUnitCreateEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_CREATE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-		//"type_id": cu.TypeID,
-	})
+	return makeEvent(E_CONTENT_UNIT_CREATE, contentUnitPayload(cu))
 }
 
 func ContentUnitUpdateEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_UPDATE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_UPDATE, contentUnitPayload(cu))
 }
 
 func ContentUnitDeleteEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_DELETE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_DELETE, contentUnitPayload(cu))
 }
 
 func ContentUnitPublishedChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_PUBLISHED_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-		//"published": cu.Published,
-	})
+	return makeEvent(E_CONTENT_UNIT_PUBLISHED_CHANGE, contentUnitPayload(cu))
 }
 
 func ContentUnitDerivativesChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_DERIVATIVES_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_DERIVATIVES_CHANGE, contentUnitPayload(cu))
 }
 
 func ContentUnitSourcesChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_SOURCES_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_SOURCES_CHANGE, contentUnitPayload(cu))
 }
 
 func ContentUnitTagsChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_TAGS_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_TAGS_CHANGE, contentUnitPayload(cu))
 }
 
 func ContentUnitPersonsChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_PERSONS_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_PERSONS_CHANGE, contentUnitPayload(cu))
 }
 
 func ContentUnitPublishersChangeEvent(cu *models.ContentUnit) Event {
-	return makeEvent(E_CONTENT_UNIT_PUBLISHERS_CHANGE, map[string]interface{}{
-		"id":  cu.ID,
-		"uid": cu.UID,
-	})
+	return makeEvent(E_CONTENT_UNIT_PUBLISHERS_CHANGE, contentUnitPayload(cu))
 }
 
 func FileUpdateEvent(f *models.File) Event {
-	return makeEvent(E_FILE_UPDATE, map[string]interface{}{
-		"id":  f.ID,
-		"uid": f.UID,
-		//"name": f.Name,
-		//"size": f.Size,
-		//"sha1": hex.EncodeToString(f.Sha1.Bytes),
-	})
+	return makeEvent(E_FILE_UPDATE, filePayload(f))
 }
 
 func FileInsertEvent(f *models.File, insertType string) Event {
-	return makeEvent(E_FILE_INSERT, map[string]interface{}{
-		"id":  f.ID,
-		"uid": f.UID,
-		//"name": f.Name,
-		//"size": f.Size,
-		//"sha1": hex.EncodeToString(f.Sha1.Bytes),
-		"insert_type": insertType,
-	})
+	payload := filePayload(f)
+	payload["insert_type"] = insertType
+	return makeEvent(E_FILE_INSERT, payload)
 }
 
 func FileReplaceEvent(oldFile *models.File, newFile *models.File, insertType string) Event {
 	return makeEvent(E_FILE_REPLACE, map[string]interface{}{
-		"old": map[string]interface{}{
-			"id":  oldFile.ID,
-			"uid": oldFile.UID,
-			//"name": oldFile.Name,
-			//"size": oldFile.Size,
-			//"sha1": hex.EncodeToString(oldFile.Sha1.Bytes),
-		},
-		"new": map[string]interface{}{
-			"id":  newFile.ID,
-			"uid": newFile.UID,
-			//"name": newFile.Name,
-			//"size": newFile.Size,
-			//"sha1": hex.EncodeToString(oldFile.Sha1.Bytes),
-		},
+		"old":         filePayload(oldFile),
+		"new":         filePayload(newFile),
 		"insert_type": insertType,
 	})
 }
 
 func FilePublishedEvent(f *models.File) Event {
-	return makeEvent(E_FILE_PUBLISHED, map[string]interface{}{
-		"id":  f.ID,
-		"uid": f.UID,
-		//"name": f.Name,
-		//"size": f.Size,
-		//"sha1": hex.EncodeToString(f.Sha1.Bytes),
-	})
+	return makeEvent(E_FILE_PUBLISHED, filePayload(f))
 }
 
 func FileRemoveEvent(f *models.File) Event {
-	return makeEvent(E_FILE_REMOVE, map[string]interface{}{
-		"id":  f.ID,
-		"uid": f.UID,
-		//"name": f.Name,
-		//"size": f.Size,
-		//"sha1": hex.EncodeToString(f.Sha1.Bytes),
-	})
+	return makeEvent(E_FILE_REMOVE, filePayload(f))
 }
 
 func SourceCreateEvent(s *models.Source) Event {
-	return makeEvent(E_SOURCE_CREATE, map[string]interface{}{
-		"id":  s.ID,
-		"uid": s.UID,
-	})
+	return makeEvent(E_SOURCE_CREATE, sourcePayload(s))
 }
 
 func SourceUpdateEvent(s *models.Source) Event {
-	return makeEvent(E_SOURCE_UPDATE, map[string]interface{}{
-		"id":  s.ID,
-		"uid": s.UID,
-	})
+	return makeEvent(E_SOURCE_UPDATE, sourcePayload(s))
 }
 
 func TagCreateEvent(t *models.Tag) Event {
-	return makeEvent(E_TAG_CREATE, map[string]interface{}{
-		"id":  t.ID,
-		"uid": t.UID,
-	})
+	return makeEvent(E_TAG_CREATE, tagPayload(t))
 }
 
 func TagUpdateEvent(t *models.Tag) Event {
-	return makeEvent(E_TAG_UPDATE, map[string]interface{}{
-		"id":  t.ID,
-		"uid": t.UID,
-	})
+	return makeEvent(E_TAG_UPDATE, tagPayload(t))
 }
 
 func PersonCreateEvent(p *models.Person) Event {
-	return makeEvent(E_PERSON_CREATE, map[string]interface{}{
-		"id":  p.ID,
-		"uid": p.UID,
-	})
+	return makeEvent(E_PERSON_CREATE, personPayload(p))
 }
 
 func PersonUpdateEvent(p *models.Person) Event {
-	return makeEvent(E_PERSON_UPDATE, map[string]interface{}{
-		"id":  p.ID,
-		"uid": p.UID,
-	})
+	return makeEvent(E_PERSON_UPDATE, personPayload(p))
 }
 
 func PersonDeleteEvent(p *models.Person) Event {
-	return makeEvent(E_PERSON_DELETE, map[string]interface{}{
-		"id":  p.ID,
-		"uid": p.UID,
-	})
+	return makeEvent(E_PERSON_DELETE, personPayload(p))
 }
 
 func PublisherCreateEvent(p *models.Publisher) Event {
-	return makeEvent(E_PUBLISHER_CREATE, map[string]interface{}{
-		"id":  p.ID,
-		"uid": p.UID,
-	})
+	return makeEvent(E_PUBLISHER_CREATE, publisherPayload(p))
 }
 
 func PublisherUpdateEvent(p *models.Publisher) Event {
-	return makeEvent(E_PUBLISHER_UPDATE, map[string]interface{}{
-		"id":  p.ID,
-		"uid": p.UID,
-	})
+	return makeEvent(E_PUBLISHER_UPDATE, publisherPayload(p))
+}
+
+// Payloads carry the entity's small, frequently needed fields.
+// Large fields, like properties, are left out.
+
+func collectionPayload(c *models.Collection) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        c.ID,
+		"uid":       c.UID,
+		"type_id":   c.TypeID,
+		"published": c.Published,
+		"secure":    c.Secure,
+	}
+}
+
+func contentUnitPayload(cu *models.ContentUnit) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        cu.ID,
+		"uid":       cu.UID,
+		"type_id":   cu.TypeID,
+		"published": cu.Published,
+		"secure":    cu.Secure,
+	}
+}
+
+func filePayload(f *models.File) map[string]interface{} {
+	payload := map[string]interface{}{
+		"id":              f.ID,
+		"uid":             f.UID,
+		"name":            f.Name,
+		"size":            f.Size,
+		"type":            f.Type,
+		"sub_type":        f.SubType,
+		"mime_type":       f.MimeType,
+		"language":        f.Language,
+		"content_unit_id": f.ContentUnitID,
+		"published":       f.Published,
+		"secure":          f.Secure,
+	}
+	if f.Sha1.Valid {
+		payload["sha1"] = hex.EncodeToString(f.Sha1.Bytes)
+	}
+	return payload
+}
+
+func sourcePayload(s *models.Source) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        s.ID,
+		"uid":       s.UID,
+		"type_id":   s.TypeID,
+		"parent_id": s.ParentID,
+	}
+}
+
+func tagPayload(t *models.Tag) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        t.ID,
+		"uid":       t.UID,
+		"parent_id": t.ParentID,
+	}
+}
+
+func personPayload(p *models.Person) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      p.ID,
+		"uid":     p.UID,
+		"pattern": p.Pattern,
+	}
+}
+
+func publisherPayload(p *models.Publisher) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      p.ID,
+		"uid":     p.UID,
+		"pattern": p.Pattern,
+	}
 }
@@ -0,0 +1,320 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/metrics"
+)
+
+// OutboxRelay delivers committed events from the events_outbox table to events handlers.
+//
+// Events are delivered in order. A failed delivery is retried with exponential backoff,
+// blocking the events behind it. Delivery is at least once: a failure in one handler
+// means all handlers get the event again on the next attempt.
+//
+// Relays of all instances take turns under an advisory lock, so the order holds across instances.
+// An event is delivered only once no transaction older than its horizon is in flight.
+// Otherwise such a transaction could still commit an event with a lower seq,
+// which consumers catching up by seq would skip.
+type OutboxRelay struct {
+	BatchSize    int           // max number of events to deliver in a single transaction
+	PollInterval time.Duration // check the outbox at least this often
+	MinBackoff   time.Duration // delay before first retry of a failed delivery
+	MaxBackoff   time.Duration // max delay between retries of a failed delivery
+	Retention    time.Duration // purge delivered events older than this. Zero means keep forever.
+
+	db        *sql.DB
+	listener  *pq.Listener
+	handlers  []EventHandler
+	stopCH    chan bool
+	doneCH    chan bool
+	lastPurge time.Time
+}
+
+func NewOutboxRelay(db *sql.DB, url string, handlers ...EventHandler) (*OutboxRelay, error) {
+	if len(handlers) == 0 {
+		return nil, errors.New("At least one handler is required")
+	}
+
+	r := &OutboxRelay{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+		db:           db,
+		handlers:     handlers,
+		stopCH:       make(chan bool),
+		doneCH:       make(chan bool),
+	}
+
+	r.listener = pq.NewListener(url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Errorf("outbox: listener: %s", err.Error())
+		}
+	})
+	if err := r.listener.Listen(OUTBOX_CHANNEL); err != nil {
+		r.listener.Close()
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	return r, nil
+}
+
+func (r *OutboxRelay) Start() {
+	go r.run()
+}
+
+// Close stops the relay. Undelivered events remain in the outbox for the next run.
+func (r *OutboxRelay) Close() error {
+	log.Infof("outbox: stop relay")
+	r.stopCH <- true
+	<-r.doneCH
+
+	return r.listener.Close()
+}
+
+func (r *OutboxRelay) run() {
+	defer close(r.doneCH)
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// deliver as much as we can
+		for {
+			select {
+			case <-r.stopCH:
+				return
+			default:
+			}
+
+			more, err := r.relayBatch()
+			if err != nil {
+				log.Errorf("outbox: %+v", err)
+				break
+			}
+			if !more {
+				break
+			}
+		}
+
+		if r.Retention > 0 && time.Since(r.lastPurge) > time.Hour {
+			if err := r.purge(); err != nil {
+				log.Errorf("outbox: %+v", err)
+			}
+			r.lastPurge = time.Now()
+		}
+
+		// wait for something to happen
+		select {
+		case <-r.stopCH:
+			return
+		case <-r.listener.Notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+const OUTBOX_RELAY_LOCK = 7270002 // pg_advisory_xact_lock key of relay batches
+
+type outboxRow struct {
+	seq           int64
+	horizon       sql.NullInt64
+	event         Event
+	attempts      int
+	nextAttemptAt time.Time
+}
+
+// relayBatch delivers the next batch of pending events.
+// Returns true if there might be more events ready for delivery.
+func (r *OutboxRelay) relayBatch() (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "begin tx")
+	}
+
+	more, err := r.doRelayBatch(tx)
+	if err != nil {
+		if ex := tx.Rollback(); ex != nil {
+			log.Errorf("outbox: rollback: %s", ex.Error())
+		}
+		return false, err
+	}
+
+	return more, errors.Wrap(tx.Commit(), "commit tx")
+}
+
+func (r *OutboxRelay) doRelayBatch(tx *sql.Tx) (bool, error) {
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", OUTBOX_RELAY_LOCK).Scan(&locked); err != nil {
+		return false, errors.Wrap(err, "Lock relay")
+	}
+	if !locked {
+		return false, nil // another instance is relaying
+	}
+
+	// transactions older than this are all finished
+	var xmin int64
+	if err := tx.QueryRow("SELECT txid_snapshot_xmin(txid_current_snapshot())").Scan(&xmin); err != nil {
+		return false, errors.Wrap(err, "Fetch snapshot xmin")
+	}
+
+	pending, err := r.loadPending(tx)
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		return false, nil
+	}
+
+	// We attach postgresql replication log location
+	// so that clients could verify that their stand-bys are synced
+	// see:
+	// https://blog.2ndquadrant.com/postgresql-10-transaction-traceability/
+	// https://www.postgresql.org/docs/9.6/static/functions-admin.html
+	// https://www.postgresql.org/docs/9.6/static/datatype-pg-lsn.html
+	var rLoc string
+	if err := tx.QueryRow("SELECT pg_current_xlog_insert_location()").Scan(&rLoc); err != nil {
+		return false, errors.Wrap(err, "Fetch Replication Position")
+	}
+
+	now := time.Now()
+	delivered := make([]int64, 0)
+	var failed *outboxRow
+	var failure error
+	for i := range pending {
+		row := pending[i]
+		if row.nextAttemptAt.After(now) {
+			break // keep order, wait for backoff of head event
+		}
+		if row.horizon.Valid && row.horizon.Int64 > xmin {
+			break // keep order, wait for transactions which may commit lower seqs
+		}
+
+		row.event.ReplicationLocation = rLoc
+		if err := r.deliver(row.event); err != nil {
+			metrics.EventDeliveryFailures.Inc()
+			failed, failure = row, err
+			break
+		}
+		metrics.EventsDelivered.Inc()
+		delivered = append(delivered, row.seq)
+	}
+
+	if len(delivered) > 0 {
+		_, err := tx.Exec(`UPDATE events_outbox
+SET delivered_at = now_utc(), rloc = $2, attempts = attempts + 1, last_error = NULL
+WHERE seq = ANY($1)`,
+			pq.Array(delivered), rLoc)
+		if err != nil {
+			return false, errors.Wrap(err, "Mark delivered")
+		}
+
+		// wake up consumers of the events API, see DeliveryListener
+		if _, err := tx.Exec("SELECT pg_notify($1, '')", DELIVERED_CHANNEL); err != nil {
+			return false, errors.Wrap(err, "Notify delivered")
+		}
+	}
+
+	if failed != nil {
+		backoff := r.backoff(failed.attempts)
+		log.Warnf("outbox: deliver event %s failed [attempt %d], retry in %s: %s",
+			failed.event.ID, failed.attempts+1, backoff, failure.Error())
+		_, err := tx.Exec(`UPDATE events_outbox
+SET attempts = attempts + 1, last_error = $2, next_attempt_at = now_utc() + $3::BIGINT * INTERVAL '1 millisecond'
+WHERE seq = $1`,
+			failed.seq, failure.Error(), int64(backoff/time.Millisecond))
+		if err != nil {
+			return false, errors.Wrap(err, "Mark failed")
+		}
+		return false, nil
+	}
+
+	return len(delivered) == r.BatchSize, nil
+}
+
+func (r *OutboxRelay) loadPending(tx *sql.Tx) ([]*outboxRow, error) {
+	rows, err := tx.Query(`SELECT seq, horizon, id, type, payload, attempts, next_attempt_at
+FROM events_outbox
+WHERE delivered_at IS NULL
+ORDER BY seq
+LIMIT $1
+FOR UPDATE`,
+		r.BatchSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load pending events")
+	}
+	defer rows.Close()
+
+	pending := make([]*outboxRow, 0)
+	for rows.Next() {
+		row := new(outboxRow)
+		var payload []byte
+		if err := rows.Scan(&row.seq, &row.horizon, &row.event.ID, &row.event.Type, &payload,
+			&row.attempts, &row.nextAttemptAt); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		if err := json.Unmarshal(payload, &row.event.Payload); err != nil {
+			return nil, errors.Wrapf(err, "json.Unmarshal payload [%s]", row.event.ID)
+		}
+		pending = append(pending, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err()")
+	}
+
+	return pending, nil
+}
+
+func (r *OutboxRelay) deliver(event Event) error {
+	for i := range r.handlers {
+		if err := r.handlers[i].Handle(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	d := float64(r.MinBackoff) * math.Pow(2, float64(attempts))
+	if d > float64(r.MaxBackoff) {
+		return r.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// OutboxBacklog returns the number of events waiting for delivery and the age of the oldest one
+func OutboxBacklog(db *sql.DB) (int64, time.Duration, error) {
+	var pending int64
+	var oldest float64
+	err := db.QueryRow(`SELECT count(*), coalesce(extract(EPOCH FROM now_utc() - min(created_at)), 0)
+FROM events_outbox
+WHERE delivered_at IS NULL`).Scan(&pending, &oldest)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "Query outbox backlog")
+	}
+
+	return pending, time.Duration(oldest * float64(time.Second)), nil
+}
+
+func (r *OutboxRelay) purge() error {
+	res, err := r.db.Exec(`DELETE FROM events_outbox
+WHERE delivered_at IS NOT NULL AND delivered_at < now_utc() - $1::BIGINT * INTERVAL '1 second'`,
+		int64(r.Retention.Seconds()))
+	if err != nil {
+		return errors.Wrap(err, "Purge delivered events")
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		log.Infof("outbox: purged %d delivered events", n)
+	}
+
+	return nil
+}
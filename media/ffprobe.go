@@ -1,18 +1,18 @@
-package batch
+package media
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"strings"
+	"os/exec"
 
-	log "github.com/Sirupsen/logrus"
-
-	"github.com/Bnei-Baruch/mdb/utils"
+	"github.com/pkg/errors"
 )
 
+// FFprobeBin is the ffprobe executable, looked up in PATH by default
+var FFprobeBin = "ffprobe"
+
+// ffprobe -print_format json -show_format -show_streams output
+
 type FFPstreamTags struct {
 	Language string `json:"language"`
 }
@@ -72,54 +72,19 @@ type FFprobeMetadata struct {
 	Format  FFPformat   `json:"format"`
 }
 
-func ImportFFprobeMetadata() {
-	baseDir := "/home/edos/projects/wmv_meta"
-
-	fileList := make([]string, 0)
-	err := filepath.Walk(baseDir, func(path string, f os.FileInfo, err error) error {
-		if strings.HasSuffix(path, "json") {
-			fileList = append(fileList, path)
-		}
-		return err
-	})
-	utils.Must(err)
-
-	badJson := 0
-	noVideo := 0
-	log.Infof("%d json files", len(fileList))
-	for _, file := range fileList {
-		data, err := readFFProbeJson(file)
-		if err != nil {
-			badJson++
-			continue
-		}
-
-		var video *FFPstream
-		for _, s := range data.Streams {
-			if s.CodecType == "video" {
-				video = &s
-			}
-		}
-
-		if video != nil {
-			log.Infof("%s %dx%d %s %s", video.DisplayAspectRatio, video.Width, video.Height, video.RFrameRate, data.Format.Filename)
-		} else {
-			noVideo++
-		}
-
+// Probe runs ffprobe on a local file
+func Probe(ctx context.Context, path string) (*FFprobeMetadata, error) {
+	out, err := exec.CommandContext(ctx, FFprobeBin,
+		"-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", path).
+		Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ffprobe %s", path)
 	}
-	log.Infof("%d bad json files", badJson)
-	log.Infof("%d no video files", noVideo)
-}
 
-func readFFProbeJson(filename string) (FFprobeMetadata, error) {
-	raw, err := ioutil.ReadFile(filename)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+	var m FFprobeMetadata
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, errors.Wrapf(err, "json.Unmarshal ffprobe output of %s", path)
 	}
 
-	var c FFprobeMetadata
-	err = json.Unmarshal(raw, &c)
-	return c, err
+	return &m, nil
 }
@@ -0,0 +1,193 @@
+package media
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+)
+
+// Info is the normalized technical metadata of a media file, kept in files_media and files_media_streams
+type Info struct {
+	Format   string    `json:"format,omitempty"`
+	Duration float64   `json:"duration,omitempty"` // seconds
+	BitRate  int64     `json:"bit_rate,omitempty"` // bits per second
+	Streams  []*Stream `json:"streams"`
+}
+
+type Stream struct {
+	Index      int     `json:"index"`
+	Type       string  `json:"type"` // video, audio, subtitle, data
+	Codec      string  `json:"codec,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FrameRate  float64 `json:"frame_rate,omitempty"`
+	BitRate    int64   `json:"bit_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Language   string  `json:"language,omitempty"`
+}
+
+func NewInfo(m *FFprobeMetadata) *Info {
+	info := &Info{
+		Format:   m.Format.FormatName,
+		Duration: parseFloat(m.Format.Duration),
+		BitRate:  parseInt(m.Format.BitRate),
+		Streams:  make([]*Stream, len(m.Streams)),
+	}
+
+	for i, s := range m.Streams {
+		frameRate := parseRational(s.AvgFrameRate)
+		if frameRate == 0 {
+			frameRate = parseRational(s.RFrameRate)
+		}
+		language := s.Tags.Language
+		if language == "und" {
+			language = ""
+		}
+
+		info.Streams[i] = &Stream{
+			Index:      s.Index,
+			Type:       s.CodecType,
+			Codec:      s.CodecName,
+			Width:      s.Width,
+			Height:     s.Height,
+			FrameRate:  frameRate,
+			BitRate:    parseInt(s.BitRate),
+			Channels:   s.Channels,
+			SampleRate: int(parseInt(s.SampleRate)),
+			Language:   language,
+		}
+	}
+
+	return info
+}
+
+// SaveFileInfo replaces the media info of a file
+func SaveFileInfo(exec boil.Executor, fileID int64, info *Info) error {
+	_, err := exec.Exec(`DELETE FROM files_media WHERE file_id = $1`, fileID)
+	if err != nil {
+		return errors.Wrap(err, "Delete previous info")
+	}
+
+	_, err = exec.Exec(`INSERT INTO files_media (file_id, format, duration, bit_rate) VALUES ($1, $2, $3, $4)`,
+		fileID, nullIfZero(info.Format), nullIfZero(info.Duration), nullIfZero(info.BitRate))
+	if err != nil {
+		return errors.Wrap(err, "Insert info")
+	}
+
+	for _, s := range info.Streams {
+		_, err = exec.Exec(`INSERT INTO files_media_streams
+(file_id, idx, type, codec, width, height, frame_rate, bit_rate, channels, sample_rate, language)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			fileID, s.Index, s.Type, nullIfZero(s.Codec), nullIfZero(s.Width), nullIfZero(s.Height),
+			nullIfZero(s.FrameRate), nullIfZero(s.BitRate), nullIfZero(s.Channels), nullIfZero(s.SampleRate),
+			nullIfZero(s.Language))
+		if err != nil {
+			return errors.Wrapf(err, "Insert stream %d", s.Index)
+		}
+	}
+
+	return nil
+}
+
+// LoadFileInfo returns the media info of a file, nil if it has none
+func LoadFileInfo(exec boil.Executor, fileID int64) (*Info, error) {
+	var format sql.NullString
+	var duration sql.NullFloat64
+	var bitRate sql.NullInt64
+	err := exec.QueryRow(`SELECT format, duration, bit_rate FROM files_media WHERE file_id = $1`, fileID).
+		Scan(&format, &duration, &bitRate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Load info")
+	}
+
+	info := &Info{
+		Format:   format.String,
+		Duration: duration.Float64,
+		BitRate:  bitRate.Int64,
+		Streams:  make([]*Stream, 0),
+	}
+
+	rows, err := exec.Query(`SELECT idx, type, codec, width, height, frame_rate, bit_rate, channels, sample_rate, language
+FROM files_media_streams WHERE file_id = $1 ORDER BY idx`, fileID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load streams")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var codec, language sql.NullString
+		var width, height, channels, sampleRate, bitRate sql.NullInt64
+		var frameRate sql.NullFloat64
+		s := new(Stream)
+		err := rows.Scan(&s.Index, &s.Type, &codec, &width, &height, &frameRate, &bitRate, &channels, &sampleRate, &language)
+		if err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		s.Codec = codec.String
+		s.Width = int(width.Int64)
+		s.Height = int(height.Int64)
+		s.FrameRate = frameRate.Float64
+		s.BitRate = bitRate.Int64
+		s.Channels = int(channels.Int64)
+		s.SampleRate = int(sampleRate.Int64)
+		s.Language = language.String
+		info.Streams = append(info.Streams, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return info, nil
+}
+
+func nullIfZero(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		if x == "" {
+			return nil
+		}
+	case int:
+		if x == 0 {
+			return nil
+		}
+	case int64:
+		if x == 0 {
+			return nil
+		}
+	case float64:
+		if x == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+func parseFloat(s string) float64 {
+	x, _ := strconv.ParseFloat(s, 64)
+	return x
+}
+
+func parseInt(s string) int64 {
+	x, _ := strconv.ParseInt(s, 10, 64)
+	return x
+}
+
+// parseRational parses ffprobe rationals such as 30000/1001, 0/0 is zero
+func parseRational(s string) float64 {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return parseFloat(s)
+	}
+	num, den := parseFloat(parts[0]), parseFloat(parts[1])
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
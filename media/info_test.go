@@ -0,0 +1,51 @@
+package media
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const ffprobeOutput = `{
+  "streams": [
+    {"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1280, "height": 720,
+     "avg_frame_rate": "30000/1001", "r_frame_rate": "30000/1001", "bit_rate": "1500000"},
+    {"index": 1, "codec_name": "aac", "codec_type": "audio", "sample_rate": "48000", "channels": 2,
+     "avg_frame_rate": "0/0", "bit_rate": "128000", "tags": {"language": "heb"}},
+    {"index": 2, "codec_name": "aac", "codec_type": "audio", "sample_rate": "44100", "channels": 1,
+     "tags": {"language": "und"}}
+  ],
+  "format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "3600.500000", "bit_rate": "1630000"}
+}`
+
+func TestNewInfo(t *testing.T) {
+	var m FFprobeMetadata
+	assert.Nil(t, json.Unmarshal([]byte(ffprobeOutput), &m))
+
+	info := NewInfo(&m)
+	assert.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", info.Format)
+	assert.Equal(t, 3600.5, info.Duration)
+	assert.EqualValues(t, 1630000, info.BitRate)
+	assert.Len(t, info.Streams, 3)
+
+	video := info.Streams[0]
+	assert.Equal(t, "video", video.Type)
+	assert.Equal(t, "h264", video.Codec)
+	assert.Equal(t, 720, video.Height)
+	assert.InDelta(t, 29.97, video.FrameRate, 0.01)
+
+	audio := info.Streams[1]
+	assert.Equal(t, 48000, audio.SampleRate)
+	assert.Equal(t, 2, audio.Channels)
+	assert.Zero(t, audio.FrameRate, "0/0 frame rate")
+	assert.Equal(t, "heb", audio.Language)
+	assert.Empty(t, info.Streams[2].Language, "undefined language")
+}
+
+func TestParseRational(t *testing.T) {
+	assert.Equal(t, 25.0, parseRational("25/1"))
+	assert.Equal(t, 25.0, parseRational("25"))
+	assert.Zero(t, parseRational("0/0"))
+	assert.Zero(t, parseRational(""))
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus metrics of the MDB server, exposed on /metrics.
+// Names are prefixed with mdb_.
+
+const NAMESPACE = "mdb"
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and response status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method"})
+
+	Operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "operations_total",
+		Help:      "Committed operations by type.",
+	}, []string{"type"})
+
+	PermissionChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "permissions",
+		Name:      "checks_total",
+		Help:      "Permission checks by object, action and result (allow or deny).",
+	}, []string{"object", "action", "result"})
+
+	EventsDelivered = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "events",
+		Name:      "delivered_total",
+		Help:      "Events delivered to all handlers by the outbox relay.",
+	})
+
+	EventDeliveryFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "events",
+		Name:      "delivery_failures_total",
+		Help:      "Failed event deliveries. Each one is retried with backoff.",
+	})
+
+	NatsPublish = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "nats",
+		Name:      "publish_total",
+		Help:      "Events published to nats streaming by result (success or failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequests,
+		HTTPRequestDuration,
+		Operations,
+		PermissionChecks,
+		EventsDelivered,
+		EventDeliveryFailures,
+		NatsPublish,
+	)
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+func TestRoutePattern(t *testing.T) {
+	assert.Equal(t, "/health_check", routePattern("/health_check", nil))
+	assert.Equal(t, "/rest/collections/:id/",
+		routePattern("/rest/collections/12/", gin.Params{{Key: "id", Value: "12"}}))
+	assert.Equal(t, "/rest/collections/:id/content_units/:cuID",
+		routePattern("/rest/collections/5/content_units/5",
+			gin.Params{{Key: "id", Value: "5"}, {Key: "cuID", Value: "5"}}))
+	assert.Equal(t, "/operations/descendant_units/:sha1",
+		routePattern("/operations/descendant_units/abc", gin.Params{{Key: "sha1", Value: "abc"}}))
+	assert.Equal(t, "/docs/*filepath",
+		routePattern("/docs/css/main.css", gin.Params{{Key: "filepath", Value: "/css/main.css"}}))
+}
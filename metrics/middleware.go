@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/gin-gonic/gin.v1"
+)
+
+// Requests not matching any route are counted under this route,
+// keeping arbitrary paths out of the labels.
+const UNMATCHED_ROUTE = "unmatched"
+
+// Handler serves the registered metrics
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware counts requests and measures their latency per route of the given router.
+// Routes are read on the first request, once they're all set up.
+func Middleware(router *gin.Engine) gin.HandlerFunc {
+	var once sync.Once
+	var routes map[string]bool
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		method := c.Request.Method
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		once.Do(func() {
+			routes = make(map[string]bool)
+			for _, r := range router.Routes() {
+				routes[r.Method+" "+r.Path] = true
+			}
+		})
+
+		route := routePattern(path, c.Params)
+		if !routes[method+" "+route] {
+			route = UNMATCHED_ROUTE
+		}
+
+		HTTPRequests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// routePattern restores the route a path was matched against, i.e.
+// /rest/collections/12/ to /rest/collections/:id/
+func routePattern(path string, params gin.Params) string {
+	segments := strings.Split(path, "/")
+	j := 0
+	for _, p := range params {
+		// catch-all parameters take the rest of the path
+		if strings.HasPrefix(p.Value, "/") {
+			return strings.TrimSuffix(path, p.Value) + "/*" + p.Key
+		}
+
+		for ; j < len(segments); j++ {
+			if segments[j] == p.Value {
+				segments[j] = ":" + p.Key
+				j++
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,22 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS operations_idempotency;
+CREATE TABLE operations_idempotency (
+  endpoint     VARCHAR(255)                                  NOT NULL,
+  key          VARCHAR(255)                                  NOT NULL,
+  request_hash CHAR(64)                                      NOT NULL,
+  operation_id BIGINT REFERENCES operations ON DELETE CASCADE NULL,
+  response     JSONB                                         NOT NULL,
+  created_at   TIMESTAMP WITH TIME ZONE DEFAULT now_utc()    NOT NULL,
+  expires_at   TIMESTAMP WITH TIME ZONE                      NOT NULL,
+  PRIMARY KEY (endpoint, key)
+);
+
+CREATE INDEX IF NOT EXISTS operations_idempotency_expires_at_idx
+  ON operations_idempotency USING BTREE (expires_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS operations_idempotency_expires_at_idx;
+DROP TABLE IF EXISTS operations_idempotency;
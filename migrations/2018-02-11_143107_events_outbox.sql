@@ -0,0 +1,29 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS events_outbox;
+CREATE TABLE events_outbox (
+  seq             BIGSERIAL PRIMARY KEY,
+  id              CHAR(26) UNIQUE                            NOT NULL,
+  type            VARCHAR(255)                               NOT NULL,
+  payload         JSONB                                      NOT NULL,
+  created_at      TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  attempts        INTEGER DEFAULT 0                          NOT NULL,
+  next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  last_error      TEXT                                       NULL,
+  delivered_at    TIMESTAMP WITH TIME ZONE                   NULL,
+  rloc            VARCHAR(30)                                NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_outbox_pending_idx
+  ON events_outbox USING BTREE (seq)
+  WHERE delivered_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS events_outbox_delivered_at_idx
+  ON events_outbox USING BTREE (delivered_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS events_outbox_delivered_at_idx;
+DROP INDEX IF EXISTS events_outbox_pending_idx;
+DROP TABLE IF EXISTS events_outbox;
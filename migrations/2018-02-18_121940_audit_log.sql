@@ -0,0 +1,36 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS audit_log;
+CREATE TABLE audit_log (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  user_sub   VARCHAR(255)                               NULL,
+  user_email VARCHAR(255)                               NULL,
+  user_roles VARCHAR(255) []                            NULL,
+  endpoint   VARCHAR(255)                               NULL,
+  entity     VARCHAR(32)                                NOT NULL,
+  entity_id  BIGINT                                     NOT NULL,
+  before     JSONB                                      NULL,
+  after      JSONB                                      NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx
+  ON audit_log USING BTREE (entity, entity_id);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_sub_idx
+  ON audit_log USING BTREE (user_sub);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_email_idx
+  ON audit_log USING BTREE (user_email);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx
+  ON audit_log USING BTREE (created_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS audit_log_created_at_idx;
+DROP INDEX IF EXISTS audit_log_user_email_idx;
+DROP INDEX IF EXISTS audit_log_user_sub_idx;
+DROP INDEX IF EXISTS audit_log_entity_idx;
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,38 @@
+-- MDB generated migration file
+-- rambler up
+
+ALTER TABLE collections
+  ADD COLUMN removed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL;
+
+ALTER TABLE content_units
+  ADD COLUMN removed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL;
+
+ALTER TABLE persons
+  ADD COLUMN removed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS collections_removed_at_idx
+  ON collections USING BTREE (removed_at)
+  WHERE removed_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS content_units_removed_at_idx
+  ON content_units USING BTREE (removed_at)
+  WHERE removed_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS persons_removed_at_idx
+  ON persons USING BTREE (removed_at)
+  WHERE removed_at IS NOT NULL;
+
+-- rambler down
+
+DROP INDEX IF EXISTS persons_removed_at_idx;
+DROP INDEX IF EXISTS content_units_removed_at_idx;
+DROP INDEX IF EXISTS collections_removed_at_idx;
+
+ALTER TABLE persons
+  DROP COLUMN removed_at;
+
+ALTER TABLE content_units
+  DROP COLUMN removed_at;
+
+ALTER TABLE collections
+  DROP COLUMN removed_at;
@@ -0,0 +1,107 @@
+-- MDB generated migration file
+-- rambler up
+
+-- Text search configuration for a language code.
+-- Languages without a built-in stemmer (he included) fall back to simple.
+CREATE OR REPLACE FUNCTION mdb_search_config(lang CHAR(2))
+  RETURNS REGCONFIG AS $$
+SELECT CASE lang
+       WHEN 'en' THEN 'english'
+       WHEN 'ru' THEN 'russian'
+       WHEN 'es' THEN 'spanish'
+       WHEN 'it' THEN 'italian'
+       WHEN 'de' THEN 'german'
+       WHEN 'nl' THEN 'dutch'
+       WHEN 'fr' THEN 'french'
+       WHEN 'pt' THEN 'portuguese'
+       WHEN 'tr' THEN 'turkish'
+       WHEN 'hu' THEN 'hungarian'
+       WHEN 'fi' THEN 'finnish'
+       WHEN 'no' THEN 'norwegian'
+       WHEN 'sv' THEN 'swedish'
+       ELSE 'simple'
+       END :: REGCONFIG;
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Normalize text before indexing or querying:
+-- Hebrew niqqud and cantillation marks are dropped, maqaf separates words,
+-- geresh and gershayim (or ascii quotes) inside Hebrew acronyms are removed
+-- and Russian ё is folded to е.
+CREATE OR REPLACE FUNCTION mdb_search_normalize(s TEXT)
+  RETURNS TEXT AS $$
+SELECT translate(
+    regexp_replace(
+        regexp_replace(
+            regexp_replace(coalesce(s, ''), '[\u0591-\u05BD\u05BF\u05C1\u05C2\u05C4\u05C5\u05C7]', '', 'g'),
+            '\u05BE', ' ', 'g'),
+        '([\u05D0-\u05EA])[\u05F3\u05F4"''`]+([\u05D0-\u05EA])', '\1\2', 'g'),
+    'ёЁ', 'еЕ');
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Document vector of an i18n row.
+-- Words are indexed both stemmed by the row's language and as is, so a query
+-- matches regardless of the language it was typed in.
+CREATE OR REPLACE FUNCTION mdb_search_vector(lang CHAR(2), name TEXT, description TEXT)
+  RETURNS TSVECTOR AS $$
+SELECT setweight(to_tsvector(mdb_search_config(lang), mdb_search_normalize(name)), 'A') ||
+       setweight(to_tsvector('simple', mdb_search_normalize(name)), 'A') ||
+       setweight(to_tsvector(mdb_search_config(lang), mdb_search_normalize(description)), 'B') ||
+       setweight(to_tsvector('simple', mdb_search_normalize(description)), 'B');
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Search query matching any of the configurations used by mdb_search_vector.
+CREATE OR REPLACE FUNCTION mdb_search_query(q TEXT)
+  RETURNS TSQUERY AS $$
+SELECT plainto_tsquery('simple', mdb_search_normalize(q)) ||
+       plainto_tsquery('english', mdb_search_normalize(q)) ||
+       plainto_tsquery('russian', mdb_search_normalize(q)) ||
+       plainto_tsquery('spanish', mdb_search_normalize(q)) ||
+       plainto_tsquery('italian', mdb_search_normalize(q)) ||
+       plainto_tsquery('german', mdb_search_normalize(q)) ||
+       plainto_tsquery('dutch', mdb_search_normalize(q)) ||
+       plainto_tsquery('french', mdb_search_normalize(q)) ||
+       plainto_tsquery('portuguese', mdb_search_normalize(q)) ||
+       plainto_tsquery('turkish', mdb_search_normalize(q)) ||
+       plainto_tsquery('hungarian', mdb_search_normalize(q)) ||
+       plainto_tsquery('finnish', mdb_search_normalize(q)) ||
+       plainto_tsquery('norwegian', mdb_search_normalize(q)) ||
+       plainto_tsquery('swedish', mdb_search_normalize(q));
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Highlight query matches in text.
+CREATE OR REPLACE FUNCTION mdb_search_headline(lang CHAR(2), s TEXT, q TSQUERY)
+  RETURNS TEXT AS $$
+SELECT CASE WHEN s IS NULL
+  THEN NULL
+       ELSE ts_headline(mdb_search_config(lang), mdb_search_normalize(s), q,
+                        'StartSel=<em>, StopSel=</em>, MaxFragments=3, MaxWords=20, MinWords=5')
+       END;
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS content_unit_i18n_search_idx
+  ON content_unit_i18n USING GIN (mdb_search_vector(language, name, description));
+
+CREATE INDEX IF NOT EXISTS collection_i18n_search_idx
+  ON collection_i18n USING GIN (mdb_search_vector(language, name, description));
+
+CREATE INDEX IF NOT EXISTS source_i18n_search_idx
+  ON source_i18n USING GIN (mdb_search_vector(language, name, description));
+
+CREATE INDEX IF NOT EXISTS tag_i18n_search_idx
+  ON tag_i18n USING GIN (mdb_search_vector(language, label, NULL));
+
+CREATE INDEX IF NOT EXISTS person_i18n_search_idx
+  ON person_i18n USING GIN (mdb_search_vector(language, name, description));
+
+-- rambler down
+
+DROP INDEX IF EXISTS person_i18n_search_idx;
+DROP INDEX IF EXISTS tag_i18n_search_idx;
+DROP INDEX IF EXISTS source_i18n_search_idx;
+DROP INDEX IF EXISTS collection_i18n_search_idx;
+DROP INDEX IF EXISTS content_unit_i18n_search_idx;
+DROP FUNCTION IF EXISTS mdb_search_headline( CHAR(2), TEXT, TSQUERY );
+DROP FUNCTION IF EXISTS mdb_search_query( TEXT );
+DROP FUNCTION IF EXISTS mdb_search_vector( CHAR(2), TEXT, TEXT );
+DROP FUNCTION IF EXISTS mdb_search_normalize( TEXT );
+DROP FUNCTION IF EXISTS mdb_search_config( CHAR(2) );
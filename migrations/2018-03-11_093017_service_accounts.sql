@@ -0,0 +1,32 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS service_accounts;
+CREATE TABLE service_accounts (
+  id          BIGSERIAL PRIMARY KEY,
+  name        VARCHAR(64) UNIQUE                         NOT NULL,
+  roles       VARCHAR(64) []                             NOT NULL DEFAULT '{}',
+  oidc_sub    VARCHAR(255) UNIQUE                        NULL,
+  created_at  TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  disabled_at TIMESTAMP WITH TIME ZONE                   NULL
+);
+
+DROP TABLE IF EXISTS service_account_keys;
+CREATE TABLE service_account_keys (
+  id                 BIGSERIAL PRIMARY KEY,
+  service_account_id BIGINT REFERENCES service_accounts (id) NOT NULL,
+  key_prefix         VARCHAR(16)                                NOT NULL,
+  key_hash           CHAR(64) UNIQUE                            NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  expires_at         TIMESTAMP WITH TIME ZONE                   NULL,
+  last_used_at       TIMESTAMP WITH TIME ZONE                   NULL
+);
+
+CREATE INDEX IF NOT EXISTS service_account_keys_service_account_id_idx
+  ON service_account_keys USING BTREE (service_account_id);
+
+-- rambler down
+
+DROP INDEX IF EXISTS service_account_keys_service_account_id_idx;
+DROP TABLE IF EXISTS service_account_keys;
+DROP TABLE IF EXISTS service_accounts;
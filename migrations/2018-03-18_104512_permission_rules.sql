@@ -0,0 +1,46 @@
+-- MDB generated migration file
+-- rambler up
+
+-- casbin policy rules, see permissions.PostgresPolicyAdapter
+DROP TABLE IF EXISTS permission_rules;
+CREATE TABLE permission_rules (
+  id         BIGSERIAL PRIMARY KEY,
+  ptype      VARCHAR(8)                                 NOT NULL,
+  v0         VARCHAR(255)                               NOT NULL DEFAULT '',
+  v1         VARCHAR(255)                               NOT NULL DEFAULT '',
+  v2         VARCHAR(255)                               NOT NULL DEFAULT '',
+  v3         VARCHAR(255)                               NOT NULL DEFAULT '',
+  v4         VARCHAR(255)                               NOT NULL DEFAULT '',
+  v5         VARCHAR(255)                               NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS permission_rules_rule_idx
+  ON permission_rules USING BTREE (ptype, v0, v1, v2, v3, v4, v5);
+
+-- policy of data/permissions_policy.csv at the time of this migration
+INSERT INTO permission_rules (ptype, v0, v1, v2) VALUES
+  ('p', 'archive_editor', 'data_sensitive', 'read'),
+  ('p', 'archive_editor', 'data_sensitive', 'write'),
+  ('p', 'archive_editor', 'data_sensitive', 'i18n_write'),
+  ('p', 'archive_editor', 'data_sensitive', 'metadata_write'),
+  ('p', 'archive_editor', 'audit_log', 'read'),
+  ('p', 'archive_tagger', 'data_sensitive', 'read'),
+  ('p', 'archive_tagger', 'data_sensitive', 'i18n_write'),
+  ('p', 'archive_tagger', 'data_sensitive', 'metadata_write'),
+  ('p', 'archive_uploader', 'data_sensitive', 'read'),
+  ('p', 'archive_typist', 'data_private', 'read'),
+  ('p', 'bb_user', 'data_public', 'read'),
+  ('p', 'workflow_station', 'operations', 'read'),
+  ('p', 'workflow_station', 'operations', 'write'),
+  ('p', 'workflow_station', 'data_private', 'read'),
+  ('p', 'mdb_cit', 'data_private', 'read');
+
+INSERT INTO permission_rules (ptype, v0, v1) VALUES
+  ('g', 'data_sensitive', 'data_private'),
+  ('g', 'data_public', 'data_sensitive');
+
+-- rambler down
+
+DROP INDEX IF EXISTS permission_rules_rule_idx;
+DROP TABLE IF EXISTS permission_rules;
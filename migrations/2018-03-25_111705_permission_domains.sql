@@ -0,0 +1,10 @@
+-- MDB generated migration file
+-- rambler up
+
+-- policies get a domain, existing ones apply to the whole archive
+UPDATE permission_rules SET v3 = '*' WHERE ptype = 'p' AND v3 = '';
+
+-- rambler down
+
+DELETE FROM permission_rules WHERE ptype = 'p' AND v3 <> '*';
+UPDATE permission_rules SET v3 = '' WHERE ptype = 'p';
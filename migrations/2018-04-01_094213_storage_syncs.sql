@@ -0,0 +1,27 @@
+-- MDB generated migration file
+-- rambler up
+
+-- runs of storage status sync, the last successful one is the checkpoint of incremental runs
+DROP TABLE IF EXISTS storage_syncs;
+CREATE TABLE storage_syncs (
+  id          BIGSERIAL PRIMARY KEY,
+  incremental BOOLEAN                                    NOT NULL,
+  since       TIMESTAMP WITH TIME ZONE                   NULL,
+  started_at  TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  finished_at TIMESTAMP WITH TIME ZONE                   NULL,
+  lines       BIGINT DEFAULT 0                           NOT NULL,
+  files       BIGINT DEFAULT 0                           NOT NULL,
+  created     BIGINT DEFAULT 0                           NOT NULL,
+  deleted     BIGINT DEFAULT 0                           NOT NULL,
+  cleared     BIGINT DEFAULT 0                           NOT NULL,
+  error       TEXT                                       NULL
+);
+
+CREATE INDEX IF NOT EXISTS storage_syncs_finished_at_idx
+  ON storage_syncs USING BTREE (finished_at)
+  WHERE error IS NULL;
+
+-- rambler down
+
+DROP INDEX IF EXISTS storage_syncs_finished_at_idx;
+DROP TABLE IF EXISTS storage_syncs;
@@ -0,0 +1,40 @@
+-- MDB generated migration file
+-- rambler up
+
+-- technical metadata of media files, as reported by ffprobe
+DROP TABLE IF EXISTS files_media;
+CREATE TABLE files_media (
+  file_id    BIGINT REFERENCES files ON DELETE CASCADE PRIMARY KEY,
+  format     VARCHAR(255)                               NULL,
+  duration   DOUBLE PRECISION                           NULL,
+  bit_rate   BIGINT                                     NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+DROP TABLE IF EXISTS files_media_streams;
+CREATE TABLE files_media_streams (
+  file_id     BIGINT REFERENCES files_media ON DELETE CASCADE NOT NULL,
+  idx         INTEGER                                         NOT NULL,
+  type        VARCHAR(16)                                     NOT NULL,
+  codec       VARCHAR(64)                                     NULL,
+  width       INTEGER                                         NULL,
+  height      INTEGER                                         NULL,
+  frame_rate  DOUBLE PRECISION                                NULL,
+  bit_rate    BIGINT                                          NULL,
+  channels    INTEGER                                         NULL,
+  sample_rate INTEGER                                         NULL,
+  language    VARCHAR(16)                                     NULL,
+  PRIMARY KEY (file_id, idx)
+);
+
+CREATE INDEX IF NOT EXISTS files_media_streams_codec_idx
+  ON files_media_streams USING BTREE (codec);
+CREATE INDEX IF NOT EXISTS files_media_streams_height_idx
+  ON files_media_streams USING BTREE (height);
+
+-- rambler down
+
+DROP INDEX IF EXISTS files_media_streams_height_idx;
+DROP INDEX IF EXISTS files_media_streams_codec_idx;
+DROP TABLE IF EXISTS files_media_streams;
+DROP TABLE IF EXISTS files_media;
@@ -0,0 +1,66 @@
+-- MDB generated migration file
+-- rambler up
+
+-- background jobs, e.g. transcoding, claimed by workers through the API. See api/jobs.go
+DROP TABLE IF EXISTS jobs;
+CREATE TABLE jobs (
+  id               BIGSERIAL PRIMARY KEY,
+  type             VARCHAR(32)                                      NOT NULL,
+  file_id          BIGINT REFERENCES files ON DELETE CASCADE        NOT NULL,
+  params           JSONB                                            NULL,
+  state            VARCHAR(16) DEFAULT 'queued'                     NOT NULL,
+  priority         INTEGER DEFAULT 0                                NOT NULL,
+  attempts         INTEGER DEFAULT 0                                NOT NULL,
+  max_attempts     INTEGER DEFAULT 3                                NOT NULL,
+  run_at           TIMESTAMP WITH TIME ZONE DEFAULT now_utc()       NOT NULL,
+  worker           VARCHAR(255)                                     NULL,
+  lease_expires_at TIMESTAMP WITH TIME ZONE                         NULL,
+  error            TEXT                                             NULL,
+  result           JSONB                                            NULL,
+  operation_id     BIGINT REFERENCES operations ON DELETE SET NULL  NULL,
+  created_at       TIMESTAMP WITH TIME ZONE DEFAULT now_utc()       NOT NULL,
+  updated_at       TIMESTAMP WITH TIME ZONE DEFAULT now_utc()       NOT NULL,
+  started_at       TIMESTAMP WITH TIME ZONE                         NULL,
+  finished_at      TIMESTAMP WITH TIME ZONE                         NULL
+);
+
+-- a file has at most one active job of each type
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_active_idx
+  ON jobs USING BTREE (type, file_id)
+  WHERE state IN ('queued', 'running');
+
+CREATE INDEX IF NOT EXISTS jobs_queued_idx
+  ON jobs USING BTREE (priority DESC, id)
+  WHERE state = 'queued';
+
+CREATE INDEX IF NOT EXISTS jobs_file_id_idx
+  ON jobs USING BTREE (file_id);
+
+-- files pending in the ad-hoc batch_convert table of the old batch commands, if any, are queued.
+-- The table itself is kept as the history of past conversions.
+DO $$
+BEGIN
+  IF to_regclass('batch_convert') IS NOT NULL
+  THEN
+    INSERT INTO jobs (type, file_id, params)
+      SELECT DISTINCT 'transcode', file_id, '{"format": "mp4"}' :: JSONB
+      FROM batch_convert
+      WHERE operation_id IS NULL
+    ON CONFLICT DO NOTHING;
+  END IF;
+END $$;
+
+INSERT INTO permission_rules (ptype, v0, v1, v2, v3) VALUES
+  ('p', 'archive_editor', 'jobs', 'read', '*'),
+  ('p', 'archive_editor', 'jobs', 'write', '*'),
+  ('p', 'workflow_station', 'jobs', 'read', '*'),
+  ('p', 'workflow_station', 'jobs', 'write', '*')
+ON CONFLICT DO NOTHING;
+
+-- rambler down
+
+DELETE FROM permission_rules WHERE ptype = 'p' AND v1 = 'jobs';
+DROP INDEX IF EXISTS jobs_file_id_idx;
+DROP INDEX IF EXISTS jobs_queued_idx;
+DROP INDEX IF EXISTS jobs_active_idx;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,30 @@
+-- MDB generated migration file
+-- rambler up
+
+-- operation requests and their responses, recorded for replay when enabled. See api/recorder.go
+DROP TABLE IF EXISTS recorded_requests;
+CREATE TABLE recorded_requests (
+  id         BIGSERIAL PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc()  NOT NULL,
+  method     VARCHAR(16)                                 NOT NULL,
+  path       VARCHAR(255)                                NOT NULL,
+  operation  VARCHAR(32)                                 NOT NULL,
+  headers    JSONB                                       NULL,
+  body       TEXT                                        NULL,
+  status     INTEGER                                     NOT NULL,
+  response   TEXT                                        NULL,
+  duration   INTEGER                                     NOT NULL, -- milliseconds
+  replay_of  BIGINT REFERENCES recorded_requests ON DELETE SET NULL NULL
+);
+
+CREATE INDEX IF NOT EXISTS recorded_requests_operation_idx
+  ON recorded_requests USING BTREE (operation, created_at);
+
+CREATE INDEX IF NOT EXISTS recorded_requests_replay_of_idx
+  ON recorded_requests USING BTREE (replay_of);
+
+-- rambler down
+
+DROP INDEX IF EXISTS recorded_requests_replay_of_idx;
+DROP INDEX IF EXISTS recorded_requests_operation_idx;
+DROP TABLE IF EXISTS recorded_requests;
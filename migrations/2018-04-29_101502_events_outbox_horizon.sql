@@ -0,0 +1,12 @@
+-- MDB generated migration file
+-- rambler up
+
+-- xmax of a snapshot taken after the event got its seq.
+-- Once no transaction older than it is in flight, no lower seq can still commit. See events/outbox.go
+ALTER TABLE events_outbox
+  ADD COLUMN horizon BIGINT NULL;
+
+-- rambler down
+
+ALTER TABLE events_outbox
+  DROP COLUMN IF EXISTS horizon;
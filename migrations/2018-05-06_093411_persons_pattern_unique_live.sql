@@ -0,0 +1,18 @@
+-- MDB generated migration file
+-- rambler up
+
+-- Patterns of removed persons may be taken by new persons.
+-- Restoring such a removed person is refused, see handleRestorePerson.
+ALTER TABLE persons
+  DROP CONSTRAINT IF EXISTS persons_pattern_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS persons_pattern_idx
+  ON persons USING BTREE (pattern)
+  WHERE removed_at IS NULL;
+
+-- rambler down
+
+DROP INDEX IF EXISTS persons_pattern_idx;
+
+ALTER TABLE persons
+  ADD CONSTRAINT persons_pattern_key UNIQUE (pattern);
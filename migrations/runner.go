@@ -0,0 +1,282 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// Migrations are applied in the order of their file names and recorded in the same table rambler uses,
+// so the two can be used interchangeably on the same DB.
+// Each migration runs in its own transaction. A run holds an advisory lock so concurrent runs wait for it.
+
+const (
+	MIGRATIONS_TABLE = "migrations"
+	MIGRATIONS_LOCK  = 7270001 // pg_advisory_lock key of migration runs
+)
+
+type Status struct {
+	Name    string
+	Applied bool
+}
+
+// Runner applies and reverts the migration files in Dir
+type Runner struct {
+	DB  *sql.DB
+	Dir string
+}
+
+func NewRunner(db *sql.DB, dir string) *Runner {
+	return &Runner{DB: db, Dir: dir}
+}
+
+// Available returns the names of the migration files, in order
+func (r *Runner) Available() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(r.Dir, "*.sql"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "List migrations in %s", r.Dir)
+	}
+
+	names := make([]string, len(paths))
+	for i := range paths {
+		names[i] = filepath.Base(paths[i])
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Applied returns the names of the applied migrations, in order
+func (r *Runner) Applied() ([]string, error) {
+	if err := r.ensureTable(); err != nil {
+		return nil, err
+	}
+	return appliedMigrations(r.DB)
+}
+
+// Status returns all migrations, applied or available, in order
+func (r *Runner) Status() ([]*Status, error) {
+	available, err := r.Available()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Status)
+	for _, name := range available {
+		byName[name] = &Status{Name: name}
+	}
+	for _, name := range applied {
+		byName[name] = &Status{Name: name, Applied: true}
+	}
+
+	status := make([]*Status, 0, len(byName))
+	for _, s := range byName {
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+
+	return status, nil
+}
+
+// Pending returns the migrations not yet applied.
+// It fails if some are older than the last applied one, or applied migrations are missing.
+func (r *Runner) Pending() ([]string, error) {
+	available, err := r.Available()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.Applied()
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(available, applied)
+}
+
+func pendingMigrations(available, applied []string) ([]string, error) {
+	isAvailable := make(map[string]bool, len(available))
+	for _, name := range available {
+		isAvailable[name] = true
+	}
+	isApplied := make(map[string]bool, len(applied))
+	last := ""
+	for _, name := range applied {
+		if !isAvailable[name] {
+			return nil, errors.Errorf("Applied migration %s is missing", name)
+		}
+		isApplied[name] = true
+		if name > last {
+			last = name
+		}
+	}
+
+	pending := make([]string, 0)
+	for _, name := range available {
+		if isApplied[name] {
+			continue
+		}
+		if name < last {
+			return nil, errors.Errorf("Migration %s is out of order, %s is already applied", name, last)
+		}
+		pending = append(pending, name)
+	}
+
+	return pending, nil
+}
+
+// Up applies at most n pending migrations, all of them if n <= 0.
+// It returns the migrations applied.
+func (r *Runner) Up(ctx context.Context, n int) ([]string, error) {
+	var done []string
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		pending, err := r.Pending()
+		if err != nil {
+			return err
+		}
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+
+		for _, name := range pending {
+			log.Infof("Applying migration %s", name)
+			m, err := r.load(name)
+			if err != nil {
+				return err
+			}
+			if err := r.apply(ctx, conn, name, m.Up(),
+				"INSERT INTO "+MIGRATIONS_TABLE+" (migration) VALUES ($1)"); err != nil {
+				return err
+			}
+			done = append(done, name)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the last n applied migrations, at least one.
+// It returns the migrations reverted.
+func (r *Runner) Down(ctx context.Context, n int) ([]string, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	var done []string
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := r.Applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < n; i-- {
+			name := applied[i]
+			log.Infof("Reverting migration %s", name)
+			m, err := r.load(name)
+			if err != nil {
+				return err
+			}
+			if err := r.apply(ctx, conn, name, m.Down(),
+				"DELETE FROM "+MIGRATIONS_TABLE+" WHERE migration = $1"); err != nil {
+				return err
+			}
+			done = append(done, name)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// apply runs the statements of a migration and records it in a single transaction
+func (r *Runner) apply(ctx context.Context, conn *sql.Conn, name string, statements []string, record string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "Begin transaction")
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "Migration %s, statement:\n%s\n", name, statement)
+		}
+	}
+	if _, err := tx.Exec(record, name); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "Record migration %s", name)
+	}
+
+	return errors.Wrapf(tx.Commit(), "Commit migration %s", name)
+}
+
+func (r *Runner) load(name string) (*Migration, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.Dir, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read migration %s", name)
+	}
+	return &Migration{Name: name, reader: bytes.NewReader(b)}, nil
+}
+
+// withLock runs f holding the migrations lock on a dedicated connection
+func (r *Runner) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	if err := r.ensureTable(); err != nil {
+		return err
+	}
+
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Get DB connection")
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", MIGRATIONS_LOCK).Scan(&locked); err != nil {
+		return errors.Wrap(err, "Acquire migrations lock")
+	}
+	if !locked {
+		log.Info("Another migration run is in progress, waiting for it")
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", MIGRATIONS_LOCK); err != nil {
+			return errors.Wrap(err, "Acquire migrations lock")
+		}
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", MIGRATIONS_LOCK)
+
+	return f(conn)
+}
+
+// ensureTable creates the bookkeeping table the way rambler does
+func (r *Runner) ensureTable() error {
+	_, err := r.DB.Exec("CREATE TABLE IF NOT EXISTS " + MIGRATIONS_TABLE + " (migration VARCHAR(255) NOT NULL)")
+	return errors.Wrap(err, "Create migrations table")
+}
+
+func appliedMigrations(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT migration FROM " + MIGRATIONS_TABLE + " ORDER BY migration")
+	if err != nil {
+		return nil, errors.Wrap(err, "Fetch applied migrations")
+	}
+	defer rows.Close()
+
+	applied := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		applied = append(applied, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailable(t *testing.T) {
+	names, err := NewRunner(nil, ".").Available()
+	assert.Nil(t, err)
+	assert.Equal(t, SCHEMA_VERSION, names[len(names)-1], "last available migration")
+	for _, name := range names {
+		assert.NotEqual(t, "dev.sql", name, "data migrations should be ignored")
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	available := []string{"01_a.sql", "02_b.sql", "03_c.sql"}
+
+	pending, err := pendingMigrations(available, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, available, pending, "nothing applied")
+
+	pending, err = pendingMigrations(available, []string{"01_a.sql"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"02_b.sql", "03_c.sql"}, pending, "some applied")
+
+	pending, err = pendingMigrations(available, available)
+	assert.Nil(t, err)
+	assert.Empty(t, pending, "all applied")
+
+	_, err = pendingMigrations(available, []string{"01_a.sql", "03_c.sql"})
+	assert.NotNil(t, err, "out of order")
+
+	_, err = pendingMigrations(available, []string{"00_x.sql"})
+	assert.NotNil(t, err, "applied is missing")
+}
+
+func TestMigrationStatements(t *testing.T) {
+	r := NewRunner(nil, ".")
+	m, err := r.load(SCHEMA_VERSION)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, m.Up(), "up statements")
+
+	m, err = r.load(SCHEMA_VERSION)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, m.Down(), "down statements")
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// SCHEMA_VERSION is the last migration this binary expects to be applied.
+// Bump it with every new migration.
+const SCHEMA_VERSION = "2018-05-06_093411_persons_pattern_unique_live.sql"
+
+// AppliedVersion returns the last migration applied to the DB, as recorded by rambler.
+func AppliedVersion(db *sql.DB) (string, error) {
+	var version string
+	err := db.QueryRow("SELECT migration FROM migrations ORDER BY migration DESC LIMIT 1").Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "Fetch applied migration")
+	}
+
+	return version, nil
+}
+
+// CheckVersion fails if SCHEMA_VERSION is not yet applied to the DB.
+func CheckVersion(db *sql.DB) error {
+	applied, err := AppliedVersion(db)
+	if err != nil {
+		return err
+	}
+	if applied < SCHEMA_VERSION {
+		return errors.Errorf("Pending migrations, applied %q expected %q. Run mdb migrate up", applied, SCHEMA_VERSION)
+	}
+	return nil
+}
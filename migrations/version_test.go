@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	files, err := filepath.Glob("*.sql")
+	assert.Nil(t, err)
+	sort.Strings(files)
+	assert.Equal(t, files[len(files)-1], SCHEMA_VERSION, "SCHEMA_VERSION should be the last migration")
+}
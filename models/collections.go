@@ -29,6 +29,7 @@ type Collection struct {
 	Properties null.JSON `boil:"properties" json:"properties,omitempty" toml:"properties" yaml:"properties,omitempty"`
 	Secure     int16     `boil:"secure" json:"secure" toml:"secure" yaml:"secure"`
 	Published  bool      `boil:"published" json:"published" toml:"published" yaml:"published"`
+	RemovedAt  null.Time `boil:"removed_at" json:"removed_at,omitempty" toml:"removed_at" yaml:"removed_at,omitempty"`
 
 	R *collectionR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L collectionL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -42,6 +43,7 @@ var CollectionColumns = struct {
 	Properties string
 	Secure     string
 	Published  string
+	RemovedAt  string
 }{
 	ID:         "id",
 	UID:        "uid",
@@ -50,6 +52,7 @@ var CollectionColumns = struct {
 	Properties: "properties",
 	Secure:     "secure",
 	Published:  "published",
+	RemovedAt:  "removed_at",
 }
 
 // collectionR is where relationships are stored.
@@ -63,8 +66,8 @@ type collectionR struct {
 type collectionL struct{}
 
 var (
-	collectionColumns               = []string{"id", "uid", "type_id", "created_at", "properties", "secure", "published"}
-	collectionColumnsWithoutDefault = []string{"uid", "type_id", "properties"}
+	collectionColumns               = []string{"id", "uid", "type_id", "created_at", "properties", "secure", "published", "removed_at"}
+	collectionColumnsWithoutDefault = []string{"uid", "type_id", "properties", "removed_at"}
 	collectionColumnsWithDefault    = []string{"id", "created_at", "secure", "published"}
 	collectionPrimaryKeyColumns     = []string{"id"}
 )
@@ -29,6 +29,7 @@ type ContentUnit struct {
 	Properties null.JSON `boil:"properties" json:"properties,omitempty" toml:"properties" yaml:"properties,omitempty"`
 	Secure     int16     `boil:"secure" json:"secure" toml:"secure" yaml:"secure"`
 	Published  bool      `boil:"published" json:"published" toml:"published" yaml:"published"`
+	RemovedAt  null.Time `boil:"removed_at" json:"removed_at,omitempty" toml:"removed_at" yaml:"removed_at,omitempty"`
 
 	R *contentUnitR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L contentUnitL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -42,6 +43,7 @@ var ContentUnitColumns = struct {
 	Properties string
 	Secure     string
 	Published  string
+	RemovedAt  string
 }{
 	ID:         "id",
 	UID:        "uid",
@@ -50,6 +52,7 @@ var ContentUnitColumns = struct {
 	Properties: "properties",
 	Secure:     "secure",
 	Published:  "published",
+	RemovedAt:  "removed_at",
 }
 
 // contentUnitR is where relationships are stored.
@@ -70,8 +73,8 @@ type contentUnitR struct {
 type contentUnitL struct{}
 
 var (
-	contentUnitColumns               = []string{"id", "uid", "type_id", "created_at", "properties", "secure", "published"}
-	contentUnitColumnsWithoutDefault = []string{"uid", "type_id", "properties"}
+	contentUnitColumns               = []string{"id", "uid", "type_id", "created_at", "properties", "secure", "published", "removed_at"}
+	contentUnitColumnsWithoutDefault = []string{"uid", "type_id", "properties", "removed_at"}
 	contentUnitColumnsWithDefault    = []string{"id", "created_at", "secure", "published"}
 	contentUnitPrimaryKeyColumns     = []string{"id"}
 )
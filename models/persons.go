@@ -22,22 +22,25 @@ import (
 
 // Person is an object representing the database table.
 type Person struct {
-	ID      int64       `boil:"id" json:"id" toml:"id" yaml:"id"`
-	UID     string      `boil:"uid" json:"uid" toml:"uid" yaml:"uid"`
-	Pattern null.String `boil:"pattern" json:"pattern,omitempty" toml:"pattern" yaml:"pattern,omitempty"`
+	ID        int64       `boil:"id" json:"id" toml:"id" yaml:"id"`
+	UID       string      `boil:"uid" json:"uid" toml:"uid" yaml:"uid"`
+	Pattern   null.String `boil:"pattern" json:"pattern,omitempty" toml:"pattern" yaml:"pattern,omitempty"`
+	RemovedAt null.Time   `boil:"removed_at" json:"removed_at,omitempty" toml:"removed_at" yaml:"removed_at,omitempty"`
 
 	R *personR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L personL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var PersonColumns = struct {
-	ID      string
-	UID     string
-	Pattern string
+	ID        string
+	UID       string
+	Pattern   string
+	RemovedAt string
 }{
-	ID:      "id",
-	UID:     "uid",
-	Pattern: "pattern",
+	ID:        "id",
+	UID:       "uid",
+	Pattern:   "pattern",
+	RemovedAt: "removed_at",
 }
 
 // personR is where relationships are stored.
@@ -50,8 +53,8 @@ type personR struct {
 type personL struct{}
 
 var (
-	personColumns               = []string{"id", "uid", "pattern"}
-	personColumnsWithoutDefault = []string{"uid", "pattern"}
+	personColumns               = []string{"id", "uid", "pattern", "removed_at"}
+	personColumnsWithoutDefault = []string{"uid", "pattern", "removed_at"}
 	personColumnsWithDefault    = []string{"id"}
 	personPrimaryKeyColumns     = []string{"id"}
 )
@@ -3,9 +3,12 @@ package permissions
 import (
 	"bufio"
 	"bytes"
+	"database/sql"
+	"fmt"
 	"io"
 	"strings"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/casbin/casbin/model"
 	"github.com/casbin/casbin/persist"
 	"github.com/pkg/errors"
@@ -59,3 +62,117 @@ func (a *BindataPolicyAdapter) RemovePolicy(sec string, ptype string, rule []str
 func (a *BindataPolicyAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
 	return errors.New("not implemented")
 }
+
+// PostgresPolicyAdapter stores the policy in the permission_rules table
+// so it can be changed at runtime, see the permission rules REST API and `mdb permissions`.
+//
+// Use it with a casbin.SyncedEnforcer, LoadPolicy clears the policy before reloading it.
+type PostgresPolicyAdapter struct {
+	db   *sql.DB
+	last []PolicyRule // last successfully loaded policy
+}
+
+func NewPostgresPolicyAdapter(db *sql.DB) *PostgresPolicyAdapter {
+	return &PostgresPolicyAdapter{db: db}
+}
+
+// LoadPolicy loads all policy rules from the storage.
+// If the DB is unavailable we keep enforcing the last loaded policy rather than an empty one.
+func (a *PostgresPolicyAdapter) LoadPolicy(model model.Model) error {
+	rules, err := LoadPolicyRules(a.db)
+	if err != nil {
+		if a.last == nil {
+			return err
+		}
+		log.Errorf("permissions: keeping last loaded policy: %+v", err)
+		rules = a.last
+	}
+	a.last = rules
+
+	loadPolicyRules(rules, model)
+	return nil
+}
+
+// loadPolicyRules adds the rules to the model, skipping invalid ones.
+// Rules in the DB may have been edited directly.
+func loadPolicyRules(rules []PolicyRule, model model.Model) {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			log.Warnf("permissions: rule %d is invalid, ignoring: %s", rule.ID, err.Error())
+			continue
+		}
+		if _, ok := model[rule.PType[:1]][rule.PType]; !ok {
+			log.Warnf("permissions: rule %d has unknown ptype %s, ignoring", rule.ID, rule.PType)
+			continue
+		}
+		persist.LoadPolicyLine(rule.String(), model)
+	}
+}
+
+// SavePolicy saves all policy rules to the storage.
+func (a *PostgresPolicyAdapter) SavePolicy(model model.Model) error {
+	rules := make([]PolicyRule, 0)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			for _, values := range ast.Policy {
+				rules = append(rules, PolicyRule{PType: ptype, Values: values})
+			}
+		}
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Begin transaction")
+	}
+
+	err = ReplacePolicyRules(tx, rules)
+	if err == nil {
+		err = NotifyPolicyChanged(tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "Commit transaction")
+}
+
+// AddPolicy adds a policy rule to the storage.
+func (a *PostgresPolicyAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	if _, err := InsertPolicyRule(a.db, &PolicyRule{PType: ptype, Values: rule}); err != nil {
+		return err
+	}
+	return NotifyPolicyChanged(a.db)
+}
+
+// RemovePolicy removes a policy rule from the storage.
+func (a *PostgresPolicyAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	if _, err := DeletePolicyRule(a.db, &PolicyRule{PType: ptype, Values: rule}); err != nil {
+		return err
+	}
+	return NotifyPolicyChanged(a.db)
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+// Empty field values match any value.
+func (a *PostgresPolicyAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	if fieldIndex < 0 || fieldIndex+len(fieldValues) > MAX_RULE_VALUES {
+		return errors.Errorf("Invalid filter, fieldIndex %d with %d values", fieldIndex, len(fieldValues))
+	}
+
+	where := []string{"ptype = $1"}
+	args := []interface{}{ptype}
+	for i, v := range fieldValues {
+		if v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("v%d = $%d", fieldIndex+i, len(args)))
+		}
+	}
+
+	_, err := a.db.Exec("DELETE FROM permission_rules WHERE "+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return errors.Wrap(err, "Delete permission rules")
+	}
+
+	return NotifyPolicyChanged(a.db)
+}
@@ -2,13 +2,16 @@ package permissions
 
 import (
 	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/persist"
 	"github.com/pkg/errors"
 
 	"github.com/Bnei-Baruch/mdb/bindata"
 )
 
-func NewEnforcer() (*casbin.Enforcer, error) {
-	e := casbin.NewEnforcer()
+// NewEnforcer returns an enforcer of the policy in the given adapter.
+// The enforcer is synced so its policy can be reloaded while serving requests.
+func NewEnforcer(adapter persist.Adapter) (*casbin.SyncedEnforcer, error) {
+	e := casbin.NewSyncedEnforcer()
 	e.EnableLog(false)
 
 	// load model
@@ -16,8 +19,13 @@ func NewEnforcer() (*casbin.Enforcer, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Load permissions_model.conf")
 	}
-	e.SetModel(casbin.NewModel(string(pModel)))
 
-	e.InitWithModelAndAdapter(casbin.NewModel(string(pModel)), NewBindataPolicyAdapter())
+	// InitWithModelAndAdapter ignores policy load errors so we load it ourselves
+	e.InitWithModelAndAdapter(casbin.NewModel(string(pModel)), nil)
+	e.SetAdapter(adapter)
+	if err := e.LoadPolicy(); err != nil {
+		return nil, errors.Wrap(err, "Load policy")
+	}
+
 	return e, nil
 }
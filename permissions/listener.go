@@ -0,0 +1,83 @@
+package permissions
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/casbin/casbin"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// PolicyListener reloads the policy of the enforcer when it's changed in the DB,
+// by this instance or by any other. See NotifyPolicyChanged.
+//
+// casbin's Watcher is not used as its callback reloads the policy without the lock of the SyncedEnforcer.
+type PolicyListener struct {
+	ReloadInterval time.Duration // reload at least this often, in case a notification is missed. Zero means never.
+
+	enforcer *casbin.SyncedEnforcer
+	listener *pq.Listener
+	stopCH   chan bool
+	doneCH   chan bool
+}
+
+func NewPolicyListener(url string, enforcer *casbin.SyncedEnforcer) (*PolicyListener, error) {
+	l := &PolicyListener{
+		ReloadInterval: 5 * time.Minute,
+		enforcer:       enforcer,
+		stopCH:         make(chan bool),
+		doneCH:         make(chan bool),
+	}
+
+	l.listener = pq.NewListener(url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Errorf("permissions: listener: %s", err.Error())
+		}
+	})
+	if err := l.listener.Listen(POLICY_CHANGED_CHANNEL); err != nil {
+		l.listener.Close()
+		return nil, errors.Wrap(err, "listen")
+	}
+
+	return l, nil
+}
+
+func (l *PolicyListener) Start() {
+	go l.run()
+}
+
+func (l *PolicyListener) Close() error {
+	log.Infof("permissions: stop policy listener")
+	l.stopCH <- true
+	<-l.doneCH
+
+	return l.listener.Close()
+}
+
+func (l *PolicyListener) run() {
+	defer close(l.doneCH)
+
+	var tick <-chan time.Time
+	if l.ReloadInterval > 0 {
+		ticker := time.NewTicker(l.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-l.stopCH:
+			return
+		case <-l.listener.Notify:
+			// a nil notification means the connection was re-established
+			// and we might have missed some, so we reload anyway.
+			log.Infof("permissions: policy changed, reloading")
+		case <-tick:
+		}
+
+		if err := l.enforcer.LoadPolicy(); err != nil {
+			log.Errorf("permissions: reload policy: %+v", err)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package permissions
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
 	"strings"
 
 	"github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
 	"gopkg.in/gin-gonic/gin.v1"
 )
 
@@ -37,34 +39,71 @@ type IDTokenClaims struct {
 	Typ               string           `json:"typ"`
 }
 
+// AuthenticationMiddleware identifies the caller by the bearer token of the request.
+// Tokens are either API keys of service accounts or OIDC ID tokens.
+// An OIDC token whose subject is registered on a service account gets the roles of that account.
 func AuthenticationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		authHeader := strings.Split(strings.TrimSpace(c.Request.Header.Get("Authorization")), " ")
+		if len(authHeader) != 2 || strings.ToLower(authHeader[0]) != "bearer" {
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("MDB").(*sql.DB)
+
+		if IsAPIKey(authHeader[1]) {
+			sa, err := AuthenticateAPIKey(db, authHeader[1])
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err).SetType(gin.ErrorTypePrivate)
+				return
+			}
+			if sa == nil {
+				c.AbortWithError(http.StatusUnauthorized, errors.New("Invalid API key")).
+					SetType(gin.ErrorTypePublic)
+				return
+			}
+
+			c.Set("SERVICE_ACCOUNT", sa)
+			c.Set("ID_TOKEN_CLAIMS", sa.Claims())
+			c.Next()
+			return
+		}
+
 		tokenVerifier, _ := c.Get("TOKEN_VERIFIER")
 		if verifier, ok := tokenVerifier.(*oidc.IDTokenVerifier); ok {
 			// We have a proper ID Token Verifier. Game on
 
-			authHeader := strings.Split(strings.TrimSpace(c.Request.Header.Get("Authorization")), " ")
-			if len(authHeader) == 2 || strings.ToLower(authHeader[0]) == "bearer" {
-				// Authorization header provided, let's verify.
+			token, err := verifier.Verify(context.TODO(), authHeader[1])
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err).SetType(gin.ErrorTypePrivate)
+				return
+			}
+
+			// ID Token is verified. WooHoo !
+			c.Set("ID_TOKEN", token)
+
+			// parse claims
+			var claims IDTokenClaims
+			if err := token.Claims(&claims); err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err).SetType(gin.ErrorTypePrivate)
+				return
+			}
 
-				token, err := verifier.Verify(context.TODO(), authHeader[1])
+			// client credentials of a service account
+			if claims.Sub != "" {
+				sa, err := FindServiceAccountBySub(db, claims.Sub)
 				if err != nil {
 					c.AbortWithError(http.StatusInternalServerError, err).SetType(gin.ErrorTypePrivate)
 					return
 				}
-
-				// ID Token is verified. WooHoo !
-				c.Set("ID_TOKEN", token)
-
-				// parse claims
-				var claims IDTokenClaims
-				if err := token.Claims(&claims); err != nil {
-					c.AbortWithError(http.StatusInternalServerError, err).SetType(gin.ErrorTypePrivate)
-					return
+				if sa != nil {
+					c.Set("SERVICE_ACCOUNT", sa)
+					claims.RealmAccess.Roles = append(claims.RealmAccess.Roles, sa.Roles...)
 				}
-
-				c.Set("ID_TOKEN_CLAIMS", claims)
 			}
+
+			c.Set("ID_TOKEN_CLAIMS", claims)
 		}
 
 		c.Next()
@@ -0,0 +1,47 @@
+package permissions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+)
+
+// CheckOIDCKeys fetches the signing keys of the provider, which ID tokens are verified with.
+// Returns the number of keys.
+func CheckOIDCKeys(ctx context.Context, provider *oidc.Provider) (int, error) {
+	var claims struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		return 0, errors.Wrap(err, "Provider claims")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, claims.JWKSURL, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "New request")
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Fetch keys %s", claims.JWKSURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("Fetch keys %s: %s", claims.JWKSURL, resp.Status)
+	}
+
+	var keySet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return 0, errors.Wrap(err, "Decode keys")
+	}
+	if len(keySet.Keys) == 0 {
+		return 0, errors.New("No keys")
+	}
+
+	return len(keySet.Keys), nil
+}
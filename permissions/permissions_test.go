@@ -1,6 +1,7 @@
 package permissions
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -76,7 +77,7 @@ func (suite *PermissionsSuite) TestPermissions() {
 		{"bb_user", "data_public", "read"},
 	}
 	for _, perm := range perms {
-		suite.True(e.Enforce(utils.ConvertArgsString(perm)...), strings.Join(perm, ", "))
+		suite.True(e.Enforce(utils.ConvertArgsString(append(perm, DOMAIN_ALL))...), strings.Join(perm, ", "))
 	}
 
 	perms = [][]string{
@@ -126,11 +127,27 @@ func (suite *PermissionsSuite) TestPermissions() {
 		{"bb_user", "data_private", "metadata_write"},
 	}
 	for _, perm := range perms {
-		suite.False(e.Enforce(utils.ConvertArgsString(perm)...), strings.Join(perm, ", "))
+		suite.False(e.Enforce(utils.ConvertArgsString(append(perm, DOMAIN_ALL))...), strings.Join(perm, ", "))
 	}
 
 }
 
+func (suite *PermissionsSuite) TestDomains() {
+	e, err := NewEnforcer(NewBindataPolicyAdapter())
+	suite.Require().Nil(err)
+	suite.True(e.AddPolicy("ru_team", "data_private", "write", "collection:12345678"), "add policy")
+
+	suite.True(e.Enforce("ru_team", "data_private", "write", "collection:12345678"), "in domain")
+	suite.True(e.Enforce("ru_team", "data_public", "write", "collection:12345678"), "in domain inherited object")
+	suite.False(e.Enforce("ru_team", "data_private", "write", "collection:87654321"), "other domain")
+	suite.False(e.Enforce("ru_team", "data_private", "write", DOMAIN_ALL), "whole archive")
+	suite.False(e.Enforce("ru_team", "data_private", "read", "collection:12345678"), "other action")
+
+	// policies of the whole archive apply in every domain
+	suite.True(e.Enforce("archive_editor", "data_sensitive", "write", "collection:12345678"), "global policy in domain")
+	suite.True(e.Enforce("archive_admin", "data_private", "write", "content_type:LESSON_PART"), "admin in domain")
+}
+
 func (suite *PermissionsSuite) TestOIDC() {
 	provider, err := oidc.NewProvider(context.TODO(), "https://accounts.kbb1.com/auth/realms/main")
 	utils.Must(err)
@@ -153,3 +170,57 @@ func (suite *PermissionsSuite) TestOIDC() {
 	fmt.Printf("%s\n", string(b))
 
 }
+
+func (suite *PermissionsSuite) TestAPIKey() {
+	key, err := GenerateAPIKey()
+	suite.Require().Nil(err)
+	suite.True(IsAPIKey(key), "IsAPIKey")
+	suite.False(IsAPIKey("eyJhbGciOiJSUzI1NiJ9.e30.sig"), "IsAPIKey jwt")
+
+	other, err := GenerateAPIKey()
+	suite.Require().Nil(err)
+	suite.NotEqual(key, other, "unique keys")
+
+	suite.Len(hashAPIKey(key), 64, "hash length")
+	suite.Equal(hashAPIKey(key), hashAPIKey(key), "hash is deterministic")
+	suite.NotEqual(hashAPIKey(key), hashAPIKey(other), "hash differs")
+	suite.Equal(key[:len(API_KEY_PREFIX)+8], apiKeyPrefix(key), "prefix")
+
+	sa := &ServiceAccount{Name: "ws1", Roles: []string{"workflow_station"}}
+	claims := sa.Claims()
+	suite.Equal(SERVICE_ACCOUNT_SUB_PREFIX+"ws1", claims.Sub, "claims sub")
+	suite.Equal([]string{"workflow_station"}, claims.RealmAccess.Roles, "claims roles")
+}
+
+func (suite *PermissionsSuite) TestPolicyCSV() {
+	pPolicy, err := bindata.Asset("data/permissions_policy.csv")
+	suite.Require().Nil(err)
+
+	rules, err := ReadPolicyCSV(bytes.NewReader(pPolicy))
+	suite.Require().Nil(err)
+	suite.NotEmpty(rules, "rules")
+
+	var buf bytes.Buffer
+	suite.Require().Nil(WritePolicyCSV(&buf, rules))
+	again, err := ReadPolicyCSV(&buf)
+	suite.Require().Nil(err)
+	suite.Equal(rules, again, "round trip")
+
+	_, err = ReadPolicyCSV(strings.NewReader("p, archive_editor, data_sensitive"))
+	suite.NotNil(err, "missing value")
+	_, err = ReadPolicyCSV(strings.NewReader("x, a, b"))
+	suite.NotNil(err, "unknown type")
+	_, err = ReadPolicyCSV(strings.NewReader("g, a, "))
+	suite.NotNil(err, "empty value")
+
+	// invalid rules in the DB are skipped
+	pModel, err := bindata.Asset("data/permissions_model.conf")
+	suite.Require().Nil(err)
+	m := casbin.NewModel(string(pModel))
+	loadPolicyRules([]PolicyRule{
+		{ID: 1, PType: "", Values: []string{"a", "b"}},
+		{ID: 2, PType: "x", Values: []string{"a", "b"}},
+		{ID: 3, PType: "g", Values: []string{"a", "b"}},
+	}, m)
+	suite.Equal([][]string{{"a", "b"}}, m["g"]["g"].Policy, "valid rules")
+}
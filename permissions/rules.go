@@ -0,0 +1,208 @@
+package permissions
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+)
+
+// Policy rules as stored in the permission_rules table.
+// In CSV they're written as casbin policy lines, e.g.
+// p, archive_editor, data_sensitive, write, *
+// g, data_sensitive, data_private
+
+const (
+	// Instances reload the policy when notified on this channel
+	POLICY_CHANGED_CHANNEL = "permissions_policy"
+
+	MAX_RULE_VALUES = 6
+
+	// Domain of policies applying to the whole archive
+	DOMAIN_ALL = "*"
+)
+
+// Number of values of each rule type, see data/permissions_model.conf
+var POLICY_RULE_SIZES = map[string]int{
+	"p": 4, // subject (role), object, action, domain
+	"g": 2, // member, inherited
+}
+
+type PolicyRule struct {
+	ID     int64    `json:"id"`
+	PType  string   `json:"ptype"`
+	Values []string `json:"values"`
+}
+
+func (r *PolicyRule) String() string {
+	return strings.Join(append([]string{r.PType}, r.Values...), ", ")
+}
+
+func (r *PolicyRule) Validate() error {
+	size, ok := POLICY_RULE_SIZES[r.PType]
+	if !ok {
+		return errors.Errorf("Unknown rule type %q", r.PType)
+	}
+	if len(r.Values) != size {
+		return errors.Errorf("Rule of type %s expects %d values, got %d", r.PType, size, len(r.Values))
+	}
+	for _, v := range r.Values {
+		if v == "" || v != strings.TrimSpace(v) || strings.Contains(v, ",") {
+			return errors.Errorf("Invalid rule value %q", v)
+		}
+	}
+	return nil
+}
+
+// padRuleValues returns the values of all the v0..v5 columns
+func padRuleValues(values []string) []interface{} {
+	padded := make([]interface{}, MAX_RULE_VALUES)
+	for i := range padded {
+		if i < len(values) {
+			padded[i] = values[i]
+		} else {
+			padded[i] = ""
+		}
+	}
+	return padded
+}
+
+func LoadPolicyRules(exec boil.Executor) ([]PolicyRule, error) {
+	rows, err := exec.Query(`SELECT id, ptype, ARRAY[v0, v1, v2, v3, v4, v5] FROM permission_rules ORDER BY ptype DESC, id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Query permission rules")
+	}
+	defer rows.Close()
+
+	rules := make([]PolicyRule, 0)
+	for rows.Next() {
+		var rule PolicyRule
+		var values pq.StringArray
+		if err := rows.Scan(&rule.ID, &rule.PType, &values); err != nil {
+			return nil, errors.Wrap(err, "Scan permission rule")
+		}
+
+		// trailing columns are empty
+		n := len(values)
+		for n > 0 && values[n-1] == "" {
+			n--
+		}
+		rule.Values = values[:n]
+
+		rules = append(rules, rule)
+	}
+
+	return rules, errors.Wrap(rows.Err(), "Iterate permission rules")
+}
+
+// InsertPolicyRule sets the id of the new rule.
+// Returns false if the rule already exists.
+func InsertPolicyRule(exec boil.Executor, rule *PolicyRule) (bool, error) {
+	if err := rule.Validate(); err != nil {
+		return false, err
+	}
+
+	args := append([]interface{}{rule.PType}, padRuleValues(rule.Values)...)
+	err := exec.QueryRow(`INSERT INTO permission_rules (ptype, v0, v1, v2, v3, v4, v5)
+VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING RETURNING id`, args...).
+		Scan(&rule.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Insert permission rule")
+	}
+
+	return true, nil
+}
+
+// DeletePolicyRule deletes the rule with the same type and values.
+// Returns false if there's no such rule.
+func DeletePolicyRule(exec boil.Executor, rule *PolicyRule) (bool, error) {
+	args := append([]interface{}{rule.PType}, padRuleValues(rule.Values)...)
+	res, err := exec.Exec(`DELETE FROM permission_rules
+WHERE ptype = $1 AND v0 = $2 AND v1 = $3 AND v2 = $4 AND v3 = $5 AND v4 = $6 AND v5 = $7`, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "Delete permission rule")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "Delete permission rule")
+	}
+
+	return n > 0, nil
+}
+
+// ReplacePolicyRules replaces the whole policy with the given rules.
+// Run it in a transaction.
+func ReplacePolicyRules(exec boil.Executor, rules []PolicyRule) error {
+	if _, err := exec.Exec("DELETE FROM permission_rules"); err != nil {
+		return errors.Wrap(err, "Delete permission rules")
+	}
+
+	for i := range rules {
+		if _, err := InsertPolicyRule(exec, &rules[i]); err != nil {
+			return errors.Wrapf(err, "Rule %s", rules[i].String())
+		}
+	}
+
+	return nil
+}
+
+// NotifyPolicyChanged tells all instances to reload the policy.
+// Within a transaction, the notification is delivered only if it commits.
+func NotifyPolicyChanged(exec boil.Executor) error {
+	_, err := exec.Exec("SELECT pg_notify($1, '')", POLICY_CHANGED_CHANNEL)
+	return errors.Wrap(err, "Notify policy changed")
+}
+
+// ReadPolicyCSV parses casbin policy lines, skipping empty lines and # comments
+func ReadPolicyCSV(r io.Reader) ([]PolicyRule, error) {
+	rules := make([]PolicyRule, 0)
+
+	scanner := bufio.NewScanner(r)
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens := strings.Split(line, ",")
+		for j := range tokens {
+			tokens[j] = strings.TrimSpace(tokens[j])
+		}
+		rule := PolicyRule{PType: tokens[0], Values: tokens[1:]}
+		if err := rule.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "Line %d", i)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, errors.Wrap(scanner.Err(), "Read policy")
+}
+
+// WritePolicyCSV writes the rules as casbin policy lines, policies first then groupings
+func WritePolicyCSV(w io.Writer, rules []PolicyRule) error {
+	prev := ""
+	for i := range rules {
+		if prev != "" && prev != rules[i].PType {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return errors.Wrap(err, "Write policy")
+			}
+		}
+		prev = rules[i].PType
+
+		if _, err := fmt.Fprintln(w, rules[i].String()); err != nil {
+			return errors.Wrap(err, "Write policy")
+		}
+	}
+
+	return nil
+}
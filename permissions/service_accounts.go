@@ -0,0 +1,222 @@
+package permissions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Service accounts are named API clients such as workflow stations and MDB-CIT.
+// They authenticate with an API key, or with an OIDC token (client credentials grant)
+// whose subject is registered on the account. Either way they act with the casbin roles of the account.
+
+const (
+	API_KEY_PREFIX = "mdb_"
+
+	// Subject of service accounts authenticated by API keys
+	SERVICE_ACCOUNT_SUB_PREFIX = "service-account:"
+)
+
+type ServiceAccount struct {
+	ID         int64       `json:"id"`
+	Name       string      `json:"name"`
+	Roles      []string    `json:"roles"`
+	OIDCSub    null.String `json:"oidc_sub"`
+	CreatedAt  time.Time   `json:"created_at"`
+	DisabledAt null.Time   `json:"disabled_at"`
+}
+
+const serviceAccountColumns = "sa.id, sa.name, sa.roles, sa.oidc_sub, sa.created_at, sa.disabled_at"
+
+// Claims presents the service account as if it came with an ID token
+func (sa *ServiceAccount) Claims() IDTokenClaims {
+	return IDTokenClaims{
+		Sub:               SERVICE_ACCOUNT_SUB_PREFIX + sa.Name,
+		Name:              sa.Name,
+		PreferredUsername: sa.Name,
+		RealmAccess:       Roles{Roles: sa.Roles},
+	}
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, API_KEY_PREFIX)
+}
+
+// GenerateAPIKey returns a new random API key.
+// Keys are stored hashed, the key itself is shown only once.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+	return API_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// API keys are long and random so a plain sha256 is enough
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyPrefix identifies a key to humans without revealing it
+func apiKeyPrefix(key string) string {
+	n := len(API_KEY_PREFIX) + 8
+	if len(key) < n {
+		return key
+	}
+	return key[:n]
+}
+
+func scanServiceAccount(row interface {
+	Scan(dest ...interface{}) error
+}) (*ServiceAccount, error) {
+	sa := new(ServiceAccount)
+	var roles pq.StringArray
+	if err := row.Scan(&sa.ID, &sa.Name, &roles, &sa.OIDCSub, &sa.CreatedAt, &sa.DisabledAt); err != nil {
+		return nil, err
+	}
+	sa.Roles = roles
+	return sa, nil
+}
+
+// AuthenticateAPIKey returns the active service account owning the given key
+// or nil if the key is unknown, expired or its account is disabled.
+func AuthenticateAPIKey(db *sql.DB, key string) (*ServiceAccount, error) {
+	var keyID int64
+	var roles pq.StringArray
+	sa := new(ServiceAccount)
+	err := db.QueryRow(`SELECT k.id, `+serviceAccountColumns+`
+FROM service_account_keys k INNER JOIN service_accounts sa ON k.service_account_id = sa.id
+WHERE k.key_hash = $1 AND sa.disabled_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > now_utc())`,
+		hashAPIKey(key)).
+		Scan(&keyID, &sa.ID, &sa.Name, &roles, &sa.OIDCSub, &sa.CreatedAt, &sa.DisabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Lookup API key")
+	}
+	sa.Roles = roles
+
+	// don't write on every request
+	_, err = db.Exec(`UPDATE service_account_keys SET last_used_at = now_utc()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now_utc() - INTERVAL '1 minute')`, keyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Update API key last used")
+	}
+
+	return sa, nil
+}
+
+// FindServiceAccountBySub returns the active service account registered with the given OIDC subject, if any
+func FindServiceAccountBySub(db *sql.DB, sub string) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.QueryRow(`SELECT `+serviceAccountColumns+`
+FROM service_accounts sa WHERE sa.oidc_sub = $1 AND sa.disabled_at IS NULL`, sub))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sa, errors.Wrap(err, "Lookup service account by sub")
+}
+
+func FindServiceAccount(db *sql.DB, name string) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.QueryRow(`SELECT `+serviceAccountColumns+`
+FROM service_accounts sa WHERE sa.name = $1`, name))
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("Unknown service account %s", name)
+	}
+	return sa, errors.Wrap(err, "Lookup service account")
+}
+
+func AllServiceAccounts(db *sql.DB) ([]*ServiceAccount, error) {
+	rows, err := db.Query(`SELECT ` + serviceAccountColumns + ` FROM service_accounts sa ORDER BY sa.name`)
+	if err != nil {
+		return nil, errors.Wrap(err, "Query service accounts")
+	}
+	defer rows.Close()
+
+	accounts := make([]*ServiceAccount, 0)
+	for rows.Next() {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "Scan service account")
+		}
+		accounts = append(accounts, sa)
+	}
+
+	return accounts, errors.Wrap(rows.Err(), "Iterate service accounts")
+}
+
+func CreateServiceAccount(db *sql.DB, name string, roles []string, oidcSub string) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.QueryRow(`INSERT INTO service_accounts (name, roles, oidc_sub)
+VALUES ($1, $2, $3) RETURNING `+strings.Replace(serviceAccountColumns, "sa.", "", -1),
+		name, pq.Array(roles), null.NewString(oidcSub, oidcSub != "")))
+	return sa, errors.Wrap(err, "Insert service account")
+}
+
+func UpdateServiceAccountRoles(db *sql.DB, name string, roles []string) error {
+	return updateServiceAccount(db, name, "roles = $2", pq.Array(roles))
+}
+
+// SetServiceAccountDisabled disables or enables a service account.
+// Disabled accounts can't authenticate with either API keys or OIDC tokens.
+func SetServiceAccountDisabled(db *sql.DB, name string, disabled bool) error {
+	if disabled {
+		return updateServiceAccount(db, name, "disabled_at = now_utc()")
+	}
+	return updateServiceAccount(db, name, "disabled_at = NULL")
+}
+
+func updateServiceAccount(db *sql.DB, name string, set string, args ...interface{}) error {
+	res, err := db.Exec("UPDATE service_accounts SET "+set+" WHERE name = $1",
+		append([]interface{}{name}, args...)...)
+	if err != nil {
+		return errors.Wrap(err, "Update service account")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "Update service account")
+	} else if n == 0 {
+		return errors.Errorf("Unknown service account %s", name)
+	}
+	return nil
+}
+
+// RotateServiceAccountKey creates a new API key for the service account.
+// Existing keys expire after the grace period, giving clients time to switch to the new key.
+func RotateServiceAccountKey(db *sql.DB, name string, grace time.Duration) (string, error) {
+	sa, err := FindServiceAccount(db, name)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", errors.Wrap(err, "Begin transaction")
+	}
+
+	_, err = tx.Exec(`UPDATE service_account_keys SET expires_at = now_utc() + $2 * INTERVAL '1 second'
+WHERE service_account_id = $1 AND (expires_at IS NULL OR expires_at > now_utc() + $2 * INTERVAL '1 second')`,
+		sa.ID, grace.Seconds())
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO service_account_keys (service_account_id, key_prefix, key_hash)
+VALUES ($1, $2, $3)`, sa.ID, apiKeyPrefix(key), hashAPIKey(key))
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", errors.Wrap(err, "Rotate key")
+	}
+
+	return key, errors.Wrap(tx.Commit(), "Commit transaction")
+}
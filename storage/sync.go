@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/version"
+)
+
+type SyncOptions struct {
+	Incremental bool          // only files changed since the last successful sync
+	Force       bool          // clear status for missing files beyond the threshold
+	BatchSize   int           // catalog lines per transaction
+	Threshold   float64       // max fraction of mapped files to clear status for
+	Overlap     time.Duration // of incremental runs with the previous one, covers clock skew
+}
+
+type SyncStats struct {
+	Lines   int64 // catalog lines read
+	Files   int64 // catalog files found in MDB
+	Created int64 // new mappings
+	Deleted int64 // mappings no longer in catalog
+	Cleared int64 // mappings of files missing from catalog
+}
+
+type catalogEntry struct {
+	sha1     string
+	storages []string
+}
+
+// syncCatalog streams the catalog from the storage API and diffs it against files_storages, batch by batch.
+//
+// Full runs also clear the status of files missing from the catalog.
+// A truncated catalog would have us clear everything it's missing,
+// so we refuse to clear more than opts.Threshold of the mapped files unless forced.
+func syncCatalog(db *sql.DB, opts SyncOptions) (*SyncStats, error) {
+	ctx := context.Background()
+
+	var since *time.Time
+	if opts.Incremental {
+		checkpoint, err := lastSync(db)
+		if err != nil {
+			return nil, errors.Wrap(err, "Load checkpoint")
+		}
+		if checkpoint == nil {
+			log.Info("No previous successful sync, running a full one")
+			opts.Incremental = false
+		} else {
+			x := checkpoint.Add(-opts.Overlap)
+			since = &x
+		}
+	}
+
+	syncID, err := startSync(db, opts.Incremental, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "Record sync start")
+	}
+
+	stats, err := doSyncCatalog(ctx, db, opts, since)
+	if ferr := finishSync(db, syncID, stats, err); ferr != nil {
+		log.Errorf("Record sync finish: %s", ferr.Error())
+	}
+
+	return stats, err
+}
+
+func doSyncCatalog(ctx context.Context, db *sql.DB, opts SyncOptions, since *time.Time) (*SyncStats, error) {
+	stats := new(SyncStats)
+
+	sMap, err := getMDBStorageMap(db)
+	if err != nil {
+		return stats, errors.Wrap(err, "Load storages from MDB")
+	}
+
+	// files seen in catalog are kept in a session temp table, hence a dedicated connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return stats, errors.Wrap(err, "Get DB connection")
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `CREATE TEMP TABLE storage_sync_seen (file_id BIGINT PRIMARY KEY)`)
+	if err != nil {
+		return stats, errors.Wrap(err, "Create seen files table")
+	}
+	defer conn.ExecContext(context.Background(), `DROP TABLE IF EXISTS storage_sync_seen`)
+
+	body, err := openCatalog(since)
+	if err != nil {
+		return stats, errors.Wrap(err, "Open catalog")
+	}
+	defer body.Close()
+
+	batch := make([]*catalogEntry, 0, opts.BatchSize)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		stats.Lines++
+
+		entry, err := parseCatalogLine(line)
+		if err != nil {
+			return stats, errors.Wrapf(err, "Catalog line %d", stats.Lines)
+		}
+
+		// unknown storage devices are skipped, their files are still diffed
+		storages := make([]string, 0, len(entry.storages))
+		for _, name := range entry.storages {
+			if _, ok := sMap[name]; ok {
+				storages = append(storages, name)
+			} else {
+				log.Warnf("Unknown storage device %s line [%d]", name, stats.Lines)
+			}
+		}
+		entry.storages = storages
+
+		batch = append(batch, entry)
+		if len(batch) == opts.BatchSize {
+			if err := syncBatch(ctx, conn, batch, stats); err != nil {
+				return stats, errors.Wrapf(err, "Sync batch ending at line %d", stats.Lines)
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, errors.Wrap(err, "Read catalog")
+	}
+	if len(batch) > 0 {
+		if err := syncBatch(ctx, conn, batch, stats); err != nil {
+			return stats, errors.Wrapf(err, "Sync batch ending at line %d", stats.Lines)
+		}
+	}
+	log.Infof("Catalog lines %d, files in MDB %d, new mappings %d, deleted mappings %d",
+		stats.Lines, stats.Files, stats.Created, stats.Deleted)
+
+	if opts.Incremental {
+		return stats, nil
+	}
+
+	stats.Cleared, err = clearStatusForMissing(ctx, conn, opts.Threshold, opts.Force)
+	if err != nil {
+		return stats, errors.Wrap(err, "Clear status for missing")
+	}
+
+	return stats, nil
+}
+
+// openCatalog streams the catalog of the storage API, all of it or entries changed since
+func openCatalog(since *time.Time) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%scatalog", viper.GetString("storage.api-url"))
+	if since != nil {
+		u += "?" + url.Values{"since": []string{since.UTC().Format(time.RFC3339)}}.Encode()
+	}
+	log.Infof("Streaming storage catalog from %s", u)
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("MDB_%s", version.Version))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Do http request")
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, errors.Errorf("Http Error %d: %s", resp.StatusCode, string(b))
+	}
+
+	return resp.Body, nil
+}
+
+// parseCatalogLine parses catalog lines such as
+// 0123456789abcdef0123456789abcdef01234567,["storage1","storage2"]
+func parseCatalogLine(line string) (*catalogEntry, error) {
+	if len(line) < 43 || line[40] != ',' || line[41] != '[' || line[len(line)-1] != ']' {
+		return nil, errors.Errorf("Malformed line: %s", line)
+	}
+
+	entry := &catalogEntry{sha1: line[:40], storages: make([]string, 0)}
+
+	// dedup names since the API doesn't do that for us at the moment
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(strings.Replace(line[42:len(line)-1], "\"", "", -1), ",") {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			entry.storages = append(entry.storages, name)
+		}
+	}
+
+	return entry, nil
+}
+
+// syncBatch copies a batch of catalog entries to a temp table and diffs it against files_storages.
+// Unchanged mappings are untouched.
+func syncBatch(ctx context.Context, conn *sql.Conn, batch []*catalogEntry, stats *SyncStats) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "Begin transaction")
+	}
+
+	created, deleted, files, err := doSyncBatch(tx, batch)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "Commit transaction")
+	}
+
+	stats.Files += files
+	stats.Created += created
+	stats.Deleted += deleted
+
+	return nil
+}
+
+func doSyncBatch(tx *sql.Tx, batch []*catalogEntry) (created, deleted, files int64, err error) {
+	_, err = tx.Exec(`CREATE TEMP TABLE storage_sync_batch (sha1 BYTEA NOT NULL, storage VARCHAR(255) NULL)
+ON COMMIT DROP`)
+	if err != nil {
+		err = errors.Wrap(err, "Create batch table")
+		return
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("storage_sync_batch", "sha1", "storage"))
+	if err != nil {
+		err = errors.Wrap(err, "Prepare copy")
+		return
+	}
+	for _, entry := range batch {
+		// entries without storages are copied as well, so their old mappings are deleted
+		sha1 := "\\x" + entry.sha1
+		if len(entry.storages) == 0 {
+			_, err = stmt.Exec(sha1, nil)
+		}
+		for _, name := range entry.storages {
+			if _, err = stmt.Exec(sha1, name); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			stmt.Close()
+			err = errors.Wrapf(err, "Copy %s", entry.sha1)
+			return
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		err = errors.Wrap(err, "Flush copy")
+		return
+	}
+	if err = stmt.Close(); err != nil {
+		err = errors.Wrap(err, "Close copy")
+		return
+	}
+
+	res, err := tx.Exec(`INSERT INTO storage_sync_seen (file_id)
+SELECT DISTINCT f.id FROM storage_sync_batch b INNER JOIN files f ON f.sha1 = b.sha1
+ON CONFLICT DO NOTHING`)
+	if err != nil {
+		err = errors.Wrap(err, "Mark seen files")
+		return
+	}
+	if files, err = res.RowsAffected(); err != nil {
+		err = errors.Wrap(err, "Mark seen files, retrieve rows affected")
+		return
+	}
+
+	res, err = tx.Exec(`INSERT INTO files_storages (file_id, storage_id)
+SELECT DISTINCT f.id, s.id FROM storage_sync_batch b
+  INNER JOIN files f ON f.sha1 = b.sha1
+  INNER JOIN storages s ON s.name = b.storage
+ON CONFLICT DO NOTHING`)
+	if err != nil {
+		err = errors.Wrap(err, "Insert mappings")
+		return
+	}
+	if created, err = res.RowsAffected(); err != nil {
+		err = errors.Wrap(err, "Insert mappings, retrieve rows affected")
+		return
+	}
+
+	res, err = tx.Exec(`DELETE FROM files_storages fs
+USING files f
+WHERE fs.file_id = f.id
+  AND f.sha1 IN (SELECT sha1 FROM storage_sync_batch)
+  AND NOT EXISTS(SELECT 1 FROM storage_sync_batch b INNER JOIN storages s ON s.name = b.storage
+                 WHERE b.sha1 = f.sha1 AND s.id = fs.storage_id)`)
+	if err != nil {
+		err = errors.Wrap(err, "Delete mappings")
+		return
+	}
+	if deleted, err = res.RowsAffected(); err != nil {
+		err = errors.Wrap(err, "Delete mappings, retrieve rows affected")
+		return
+	}
+
+	return
+}
+
+// clearStatusForMissing deletes the mappings of files with sha1 not seen in catalog.
+func clearStatusForMissing(ctx context.Context, conn *sql.Conn, threshold float64, force bool) (int64, error) {
+	var total, missing int64
+	err := conn.QueryRowContext(ctx, `SELECT
+  COUNT(DISTINCT fs.file_id),
+  COUNT(DISTINCT fs.file_id) FILTER (WHERE NOT EXISTS(SELECT 1 FROM storage_sync_seen x WHERE x.file_id = fs.file_id))
+FROM files_storages fs INNER JOIN files f ON fs.file_id = f.id AND f.sha1 IS NOT NULL`).
+		Scan(&total, &missing)
+	if err != nil {
+		return 0, errors.Wrap(err, "Count missing files")
+	}
+
+	log.Infof("Clearing storage status for %d missing files out of %d", missing, total)
+	if missing == 0 {
+		return 0, nil
+	}
+	if exceedsThreshold(missing, total, threshold) {
+		if !force {
+			return 0, errors.Errorf("%d of %d files are missing from catalog, more than threshold %.2f. Is the catalog truncated ?",
+				missing, total, threshold)
+		}
+		log.Warnf("%d of %d files are missing from catalog, more than threshold %.2f. Forced to clear anyway",
+			missing, total, threshold)
+	}
+
+	res, err := conn.ExecContext(ctx, `DELETE FROM files_storages fs
+USING files f
+WHERE fs.file_id = f.id AND f.sha1 IS NOT NULL
+  AND NOT EXISTS(SELECT 1 FROM storage_sync_seen x WHERE x.file_id = fs.file_id)`)
+	if err != nil {
+		return 0, errors.Wrap(err, "Delete mappings")
+	}
+
+	return res.RowsAffected()
+}
+
+func exceedsThreshold(missing, total int64, threshold float64) bool {
+	return total > 0 && float64(missing)/float64(total) > threshold
+}
+
+// lastSync returns the start time of the last successful sync, nil if none
+func lastSync(db *sql.DB) (*time.Time, error) {
+	var startedAt time.Time
+	err := db.QueryRow(`SELECT started_at FROM storage_syncs
+WHERE finished_at IS NOT NULL AND error IS NULL
+ORDER BY finished_at DESC LIMIT 1`).Scan(&startedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &startedAt, nil
+}
+
+func startSync(db *sql.DB, incremental bool, since *time.Time) (int64, error) {
+	var id int64
+	err := db.QueryRow(`INSERT INTO storage_syncs (incremental, since) VALUES ($1, $2) RETURNING id`,
+		incremental, since).Scan(&id)
+	return id, err
+}
+
+func finishSync(db *sql.DB, id int64, stats *SyncStats, syncErr error) error {
+	var errStr *string
+	if syncErr != nil {
+		x := syncErr.Error()
+		errStr = &x
+	}
+	_, err := db.Exec(`UPDATE storage_syncs
+SET finished_at = now_utc(), lines = $2, files = $3, created = $4, deleted = $5, cleared = $6, error = $7
+WHERE id = $1`,
+		id, stats.Lines, stats.Files, stats.Created, stats.Deleted, stats.Cleared, errStr)
+	return err
+}
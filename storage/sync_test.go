@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCatalogLine(t *testing.T) {
+	sha1 := "0123456789abcdef0123456789abcdef01234567"
+
+	entry, err := parseCatalogLine(sha1 + `,["s1","s2","s1"]`)
+	assert.Nil(t, err)
+	assert.Equal(t, sha1, entry.sha1)
+	assert.Equal(t, []string{"s1", "s2"}, entry.storages, "deduped storages")
+
+	entry, err = parseCatalogLine(sha1 + `,[]`)
+	assert.Nil(t, err)
+	assert.Empty(t, entry.storages, "no storages")
+
+	for _, line := range []string{sha1, sha1 + `,["s1"`, sha1[:39] + `,["s1"]`} {
+		_, err = parseCatalogLine(line)
+		assert.NotNil(t, err, "malformed %s", line)
+	}
+}
+
+func TestExceedsThreshold(t *testing.T) {
+	assert.False(t, exceedsThreshold(0, 0, 0.05), "nothing mapped")
+	assert.False(t, exceedsThreshold(5, 100, 0.05), "at threshold")
+	assert.True(t, exceedsThreshold(6, 100, 0.05), "above threshold")
+	assert.True(t, exceedsThreshold(100, 100, 0.05), "truncated catalog")
+}
@@ -37,7 +37,7 @@ func MdbLoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
-func EnvMiddleware(mdb *sql.DB, emitter events.EventEmitter, enforcer *casbin.Enforcer,
+func EnvMiddleware(mdb *sql.DB, emitter events.EventEmitter, enforcer *casbin.SyncedEnforcer,
 	tokenVerifier *oidc.IDTokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("MDB", mdb)